@@ -0,0 +1,125 @@
+package main
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"app/internal/repository"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// migrate rewrites a file of vehicles with the latest schema version (see loader.SchemaVersion), upgrading its
+// records with the migrations. The file keeps its format and compression unless another output is given
+//
+//	usage: migrate [-format json|ndjson|yaml|csv] [-o output] [-check] path
+func main() {
+	format := flag.String("format", "", "the format of the file when its extension is not known: json, ndjson, yaml or csv")
+	output := flag.String("o", "", "the file to write, with the format and compression of its extension (the file itself by default)")
+	check := flag.Bool("check", false, "only print the schema version of the file, and fail when it is not the latest")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: migrate [-format json|ndjson|yaml|csv] [-o output] [-check] path")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *output, *format, *check); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// errOutdated is the error of -check when the file is not at the latest schema version
+var errOutdated = errors.New("the file is not at the latest schema version")
+
+// run is a function that migrates the file at path to output
+func run(path, output, format string, check bool) (err error) {
+	ld := loader.NewVehicleFile(path, &loader.ConfigVehicleFile{Format: format})
+	version, err := ld.SchemaVersion()
+	if err != nil {
+		return
+	}
+	if check {
+		fmt.Printf("%s: schema version %d, the latest is %d\n", path, version, loader.SchemaVersion)
+		if version != loader.SchemaVersion {
+			err = errOutdated
+		}
+		return
+	}
+	if output == "" {
+		if version == loader.SchemaVersion {
+			fmt.Printf("%s: already at schema version %d\n", path, version)
+			return
+		}
+		output = path
+	}
+
+	// the format of the output, or of the file itself when it is rewritten
+	outputFormat, err := loader.DetectFormat(output)
+	if err != nil && output == path {
+		outputFormat, err = ld.Format()
+	}
+	if err != nil {
+		return
+	}
+
+	// the records are upgraded as they are read
+	v, err := readVehicles(ld)
+	if err != nil {
+		return
+	}
+	mode := os.FileMode(0o644)
+	if info, errStat := os.Stat(output); errStat == nil {
+		mode = info.Mode().Perm()
+	}
+	err = repository.WriteFileAtomic(output, func(w io.Writer) error {
+		wc, err := loader.CompressWriter(w, output)
+		if err != nil {
+			return err
+		}
+		if err = loader.WriteVehicles(wc, outputFormat, v); err != nil {
+			_ = wc.Close()
+			return err
+		}
+		return wc.Close()
+	})
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(output, mode); err != nil {
+		return
+	}
+
+	fmt.Printf("%s: %d vehicles written with schema version %d, read from %s with schema version %d\n",
+		output, len(v), loader.SchemaVersion, path, version)
+	return
+}
+
+// readVehicles is a function that reads the vehicles of the records of a file by id. It fails on the first record
+// that can not be read and on the first record with the id of an earlier one, as only one of them could be written
+func readVehicles(ld internal.VehicleRecordLoader) (v map[int]internal.Vehicle, err error) {
+	v = make(map[int]internal.Vehicle)
+	rows := make(map[int]int)
+	err = ld.Records(func(r internal.VehicleRecord) error {
+		if r.Err != nil {
+			return fmt.Errorf("%s: %w", r.Path, &internal.ImportRowError{Row: r.Row, Err: r.Err})
+		}
+		if row, ok := rows[r.Vehicle.Id]; ok {
+			err := fmt.Errorf("%w: %d, the id of row %d", internal.ErrVehicleIdAlreadyExists, r.Vehicle.Id, row)
+			return fmt.Errorf("%s: %w", r.Path, &internal.ImportRowError{Row: r.Row, Err: err})
+		}
+		rows[r.Vehicle.Id] = r.Row
+		v[r.Vehicle.Id] = r.Vehicle
+		return nil
+	})
+	if err != nil {
+		v = nil
+	}
+	return
+}
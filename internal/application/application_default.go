@@ -1,30 +1,95 @@
 package application
 
 import (
+	"app/internal"
 	"app/internal/handler"
 	"app/internal/loader"
 	"app/internal/repository"
 	"app/internal/service"
+	"app/internal/validator"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+// loadChunk is the number of vehicles of the loader files that are imported together into the storages that do
+// not keep them in memory
+const loadChunk = 1000
+
+const (
+	// StorageMemory is the storage that keeps the vehicles only in memory
+	StorageMemory = "memory"
+	// StorageFile is the storage that writes every change back to a JSON file
+	StorageFile = "file"
+	// StorageWAL is the storage that appends every change to a write-ahead log on top of a JSON snapshot
+	StorageWAL = "wal"
+	// StorageSQLite is the storage that keeps the vehicles in an embedded SQLite database
+	StorageSQLite = "sqlite"
+)
+
 // ConfigServerChi is a struct that represents the configuration for ServerChi
 type ConfigServerChi struct {
 	// ServerAddress is the address where the server will be listening
 	ServerAddress string
-	// LoaderFilePath is the path to the file that contains the vehicles
+	// LoaderFilePath is the path to the file that contains the vehicles, optionally compressed with gzip or zstd.
+	// It can also be a directory or a pattern (e.g. seeds/*.csv) whose files are merged
 	LoaderFilePath string
+	// LoaderFormat is the format of the files of the vehicles (detected by their extension by default)
+	LoaderFormat string
+	// LoaderPolicy is the policy of a strict load of the vehicles (see loader.LoadPolicy): every record is checked
+	// with the validation rules and the vocabularies, and for duplicate ids and registrations, and a report of the
+	// issues is printed. The vehicles are loaded without checks when it is empty
+	LoaderPolicy string
+	// LoaderWatchInterval is the time between the checks of the files of the vehicles for changes, that replace
+	// the vehicles of the repository when they are loaded (0 does not watch them)
+	LoaderWatchInterval time.Duration
+	// Storage is the backend of the vehicle repository (StorageMemory by default)
+	Storage string
+	// StoragePath is the path where the repository persists the vehicles (by default LoaderFilePath when it is
+	// an uncompressed JSON file, else LoaderFilePath with the extension ".json", or ".db" for StorageSQLite)
+	// It must be set for a directory or a pattern
+	StoragePath string
+	// StorageFlushInterval is the time that writes to disk are debounced (0 writes on every change)
+	StorageFlushInterval time.Duration
+	// StorageCompactInterval is the time between compactions of the write-ahead log
+	StorageCompactInterval time.Duration
+	// TrashRetention is the time that the deleted vehicles are kept in the trash, where they can be restored,
+	// before they are purged (30 days by default)
+	TrashRetention time.Duration
+	// TrashPurgeInterval is the time between the purges of the trash (1 hour by default)
+	TrashPurgeInterval time.Duration
+	// ValidationRulesPath is the path to the JSON file with the validation rules of the vehicles
+	// (the default rules when it is empty)
+	ValidationRulesPath string
+	// VocabulariesPath is the path to the JSON file where the vocabularies of fuel type, transmission and color
+	// are kept. The default vocabularies are used until it exists, and they are kept only in memory when it is empty
+	VocabulariesPath string
+	// CatalogPath is the path to the JSON file where the catalog of brands and models is kept. Until it exists the
+	// catalog is created with the brands and models of the loaded vehicles, and it is kept only in memory when
+	// it is empty
+	CatalogPath string
 }
 
 // NewServerChi is a function that returns a new instance of ServerChi
 func NewServerChi(cfg *ConfigServerChi) *ServerChi {
 	// default values
 	defaultConfig := &ConfigServerChi{
-		ServerAddress: ":8080",
+		ServerAddress:      ":8080",
+		Storage:            StorageMemory,
+		TrashRetention:     30 * 24 * time.Hour,
+		TrashPurgeInterval: time.Hour,
 	}
 	if cfg != nil {
 		if cfg.ServerAddress != "" {
@@ -33,11 +98,62 @@ func NewServerChi(cfg *ConfigServerChi) *ServerChi {
 		if cfg.LoaderFilePath != "" {
 			defaultConfig.LoaderFilePath = cfg.LoaderFilePath
 		}
+		if cfg.LoaderFormat != "" {
+			defaultConfig.LoaderFormat = cfg.LoaderFormat
+		}
+		if cfg.LoaderPolicy != "" {
+			defaultConfig.LoaderPolicy = cfg.LoaderPolicy
+		}
+		if cfg.LoaderWatchInterval > 0 {
+			defaultConfig.LoaderWatchInterval = cfg.LoaderWatchInterval
+		}
+		if cfg.Storage != "" {
+			defaultConfig.Storage = cfg.Storage
+		}
+		if cfg.StoragePath != "" {
+			defaultConfig.StoragePath = cfg.StoragePath
+		}
+		if cfg.StorageFlushInterval > 0 {
+			defaultConfig.StorageFlushInterval = cfg.StorageFlushInterval
+		}
+		if cfg.StorageCompactInterval > 0 {
+			defaultConfig.StorageCompactInterval = cfg.StorageCompactInterval
+		}
+		if cfg.TrashRetention > 0 {
+			defaultConfig.TrashRetention = cfg.TrashRetention
+		}
+		if cfg.TrashPurgeInterval > 0 {
+			defaultConfig.TrashPurgeInterval = cfg.TrashPurgeInterval
+		}
+		if cfg.ValidationRulesPath != "" {
+			defaultConfig.ValidationRulesPath = cfg.ValidationRulesPath
+		}
+		if cfg.VocabulariesPath != "" {
+			defaultConfig.VocabulariesPath = cfg.VocabulariesPath
+		}
+		if cfg.CatalogPath != "" {
+			defaultConfig.CatalogPath = cfg.CatalogPath
+		}
+	}
+	if defaultConfig.StoragePath == "" {
+		defaultConfig.StoragePath = defaultStoragePath(defaultConfig)
 	}
 
 	return &ServerChi{
-		serverAddress:  defaultConfig.ServerAddress,
-		loaderFilePath: defaultConfig.LoaderFilePath,
+		serverAddress:          defaultConfig.ServerAddress,
+		loaderFilePath:         defaultConfig.LoaderFilePath,
+		loaderFormat:           defaultConfig.LoaderFormat,
+		loaderPolicy:           defaultConfig.LoaderPolicy,
+		loaderWatchInterval:    defaultConfig.LoaderWatchInterval,
+		storage:                defaultConfig.Storage,
+		storagePath:            defaultConfig.StoragePath,
+		storageFlushInterval:   defaultConfig.StorageFlushInterval,
+		storageCompactInterval: defaultConfig.StorageCompactInterval,
+		trashRetention:         defaultConfig.TrashRetention,
+		trashPurgeInterval:     defaultConfig.TrashPurgeInterval,
+		validationRulesPath:    defaultConfig.ValidationRulesPath,
+		vocabulariesPath:       defaultConfig.VocabulariesPath,
+		catalogPath:            defaultConfig.CatalogPath,
 	}
 }
 
@@ -45,25 +161,113 @@ func NewServerChi(cfg *ConfigServerChi) *ServerChi {
 type ServerChi struct {
 	// serverAddress is the address where the server will be listening
 	serverAddress string
-	// loaderFilePath is the path to the file that contains the vehicles
+	// loaderFilePath is the path to the file, directory or pattern of the files that contain the vehicles
 	loaderFilePath string
+	// loaderFormat is the format of the files of the vehicles, or empty to detect it
+	loaderFormat string
+	// loaderPolicy is the policy of a strict load of the vehicles, or empty
+	loaderPolicy string
+	// loaderWatchInterval is the time between the checks of the files of the vehicles for changes, or 0
+	loaderWatchInterval time.Duration
+	// storage is the backend of the vehicle repository
+	storage string
+	// storagePath is the path where the repository persists the vehicles
+	storagePath string
+	// storageFlushInterval is the time that writes to disk are debounced
+	storageFlushInterval time.Duration
+	// storageCompactInterval is the time between compactions of the write-ahead log
+	storageCompactInterval time.Duration
+	// trashRetention is the time that the deleted vehicles are kept in the trash
+	trashRetention time.Duration
+	// trashPurgeInterval is the time between the purges of the trash
+	trashPurgeInterval time.Duration
+	// validationRulesPath is the path to the JSON file with the validation rules of the vehicles
+	validationRulesPath string
+	// vocabulariesPath is the path to the JSON file with the vocabularies
+	vocabulariesPath string
+	// catalogPath is the path to the JSON file with the catalog of brands and models
+	catalogPath string
 }
 
 // Run is a method that runs the application
 func (a *ServerChi) Run() (err error) {
 	// dependencies
-	// - loader
-	ld := loader.NewVehicleJSONFile(a.loaderFilePath)
-	db, err := ld.Load()
+	// - the storage is not reloaded from itself
+	if a.loaderWatchInterval > 0 && a.watchesStorage() {
+		err = fmt.Errorf("the storage file %s can not be watched as a file of the vehicles", a.storagePath)
+		return
+	}
+	// - validation rules, before any storage is opened
+	vl, err := a.newValidator()
+	if err != nil {
+		return
+	}
+	// - vocabularies
+	vc, err := a.newVocabularies()
+	if err != nil {
+		return
+	}
+	ix, err := vc.Index()
+	if err != nil {
+		return
+	}
+	// - loader and repository
+	ld, err := a.newLoader(vl, vc)
+	if err != nil {
+		return
+	}
+	rp, err := a.newRepository(ld)
+	if err != nil {
+		return
+	}
+	if c, ok := rp.(io.Closer); ok {
+		defer func() {
+			if errClose := c.Close(); errClose != nil && err == nil {
+				err = errClose
+			}
+		}()
+	}
+	// - migration of the values of the vocabularies
+	if err = normalizeTerms(rp, ix); err != nil {
+		return
+	}
+	// - catalog, once the vehicles it may be created from are loaded
+	ct, err := a.newCatalog(rp)
 	if err != nil {
 		return
 	}
-	// - repository
-	rp := repository.NewVehicleMap(db)
 	// - service
-	sv := service.NewVehicleDefault(rp)
+	svCatalog := service.NewCatalogDefault(ct, rp)
+	sv := service.NewVehicleDefault(rp, vl, vc, svCatalog)
+	svVocabulary := service.NewVocabularyDefault(vc)
 	// - handler
 	hd := handler.NewVehicleDefault(sv)
+	hdVocabulary := handler.NewVocabularyDefault(svVocabulary)
+	hdCatalog := handler.NewCatalogDefault(svCatalog)
+	// - hot reload, stopped before the repository is closed
+	if a.loaderWatchInterval > 0 {
+		ctxWatch, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			a.watch(ctxWatch, sv, ld)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+	// - purge of the trash, stopped before the repository is closed
+	ctxPurge, cancelPurge := context.WithCancel(context.Background())
+	donePurge := make(chan struct{})
+	go func() {
+		defer close(donePurge)
+		a.purge(ctxPurge, sv)
+	}()
+	defer func() {
+		cancelPurge()
+		<-donePurge
+	}()
 	// router
 	rt := chi.NewRouter()
 	// - middlewares
@@ -74,6 +278,12 @@ func (a *ServerChi) Run() (err error) {
 		// - GET /vehicles
 		rt.Get("/", hd.GetAll())
 		rt.Post("/", hd.AddVehicle())
+		rt.Get("/aggregate", hd.Aggregate())
+		rt.Get("/histogram", hd.Histogram())
+		rt.Get("/export", hd.Export())
+		rt.Post("/import", hd.Import())
+		rt.Get("/{id}", hd.GetById())
+		rt.Get("/registration/{registration}", hd.GetByRegistration())
 		rt.Get("/color/{color}/year/{year}", hd.GetByColorAndYear())
 		rt.Get("/brand/{brand}/between/{start_year}/{end_year}", hd.GetByBrandAndYears())
 		rt.Get("/average_speed/brand/{brand}", hd.GetAverageSpeedByBrand())
@@ -81,13 +291,380 @@ func (a *ServerChi) Run() (err error) {
 		rt.Put("/{id}/update_speed", hd.UpdateSpeed())
 		rt.Get("/fuel_type/{type}", hd.GetByFuelType())
 		rt.Delete("/{id}", hd.DeleteVehicle())
+		rt.Get("/trash", hd.Trash())
+		rt.Post("/{id}/restore", hd.Restore())
+		rt.Put("/{id}", hd.Update())
+		rt.Patch("/{id}", hd.Patch())
 		rt.Get("/average_capacity/brand/{brand}", hd.GetAverageCapacityByBrand())
 		rt.Get("/dimensions", hd.GetByDimensions())
 		rt.Get("/weight", hd.GetByWeight())
 	})
+	rt.Route("/vocabularies", func(rt chi.Router) {
+		rt.Get("/", hdVocabulary.GetAll())
+		rt.Get("/{field}", hdVocabulary.Get())
+		rt.Post("/{field}/terms", hdVocabulary.AddTerm())
+		rt.Put("/{field}/terms/{value}", hdVocabulary.UpdateTerm())
+		rt.Delete("/{field}/terms/{value}", hdVocabulary.DeleteTerm())
+	})
+	rt.Route("/catalog", func(rt chi.Router) {
+		rt.Get("/", hdCatalog.GetAll())
+		rt.Post("/brands", hdCatalog.AddBrand())
+		rt.Get("/brands/{brand}", hdCatalog.GetBrand())
+		rt.Delete("/brands/{brand}", hdCatalog.DeleteBrand())
+		rt.Post("/brands/{brand}/models", hdCatalog.AddModel())
+		rt.Put("/brands/{brand}/models/{model}", hdCatalog.UpdateModel())
+		rt.Delete("/brands/{brand}/models/{model}", hdCatalog.DeleteModel())
+	})
 
 	fmt.Println("server is running...")
-	// run server
-	err = http.ListenAndServe(a.serverAddress, rt)
+	// run server until it fails or the process is interrupted
+	srv := &http.Server{Addr: a.serverAddress, Handler: rt}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	select {
+	case err = <-errCh:
+		return
+	case <-ctx.Done():
+	}
+
+	// graceful shutdown, so pending writes reach the storage
+	fmt.Println("server is shutting down...")
+	ctxShutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = srv.Shutdown(ctxShutdown)
+	// ListenAndServe returns http.ErrServerClosed after Shutdown
+	<-errCh
+	return
+}
+
+// defaultStoragePath is a function that returns the path where the storage of a configuration persists the
+// vehicles by default, or empty when the vehicles are loaded from a directory or a pattern
+func defaultStoragePath(cfg *ConfigServerChi) string {
+	path := cfg.LoaderFilePath
+	if loader.IsPattern(path) {
+		return ""
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return ""
+	}
+
+	stripped, compressed := loader.StripCompression(path)
+	stem := strings.TrimSuffix(stripped, filepath.Ext(stripped))
+	if cfg.Storage == StorageSQLite {
+		return stem + ".db"
+	}
+	format := cfg.LoaderFormat
+	if format == "" {
+		format, _ = loader.DetectFormat(path)
+	}
+	if format == loader.FormatJSON && !compressed {
+		return path
+	}
+	return stem + ".json"
+}
+
+// newLoader is a method that returns the loader of the vehicles of the loader path, strict when there is a
+// policy: the vehicles are checked with the validation rules and the vocabularies
+func (a *ServerChi) newLoader(vl internal.VehicleValidator, vc internal.VocabularyRepository) (ld internal.VehicleRecordLoader, err error) {
+	rl := loader.NewVehicleLoader(a.loaderFilePath, &loader.ConfigVehicleFile{
+		Format: a.loaderFormat,
+		Progress: func(p loader.LoadProgress) {
+			fmt.Printf("loading %s: %d records, %d%% read\n", p.Path, p.Records, p.Bytes*100/max(p.Size, 1))
+		},
+	})
+	if a.loaderPolicy == "" {
+		ld = rl
+		return
+	}
+
+	policy, err := loader.ParseLoadPolicy(a.loaderPolicy)
+	if err != nil {
+		return
+	}
+	ld = loader.NewVehicleStrict(rl, &loader.ConfigVehicleStrict{
+		Policy: policy,
+		Check:  service.NewVehicleCheck(vl, vc),
+		Report: func(r loader.LoadReport) {
+			printLoadReport(os.Stdout, a.loaderFilePath, r)
+		},
+	})
+	return
+}
+
+// printLoadReport is a function that writes the report of a strict load of the vehicles of a path: a summary
+// and an issue per line
+func printLoadReport(w io.Writer, path string, r loader.LoadReport) {
+	fmt.Fprintf(w, "loaded %d vehicles of %d records of %s (policy %s): %d records with issues\n",
+		r.Loaded, r.Records, path, r.Policy, r.Rejected)
+	for _, issue := range r.Issues {
+		fmt.Fprintf(w, "  %s row %d (id %d, registration %q): %v\n", issue.Path, issue.Row, issue.Id, issue.Registration, issue.Err)
+	}
+	if r.Truncated {
+		fmt.Fprintf(w, "  (only the first %d issues are listed)\n", len(r.Issues))
+	}
+}
+
+// watchesStorage is a method that returns if the file where the storage persists the vehicles is one of the
+// files of the vehicles
+func (a *ServerChi) watchesStorage() bool {
+	if a.storage == StorageMemory || a.storagePath == "" {
+		return false
+	}
+	storagePath, loaderPath := filepath.Clean(a.storagePath), filepath.Clean(a.loaderFilePath)
+	if loader.IsPattern(loaderPath) {
+		ok, _ := filepath.Match(loaderPath, storagePath)
+		return ok
+	}
+	return storagePath == loaderPath || filepath.Dir(storagePath) == loaderPath
+}
+
+// watch is a method that replaces the vehicles of the service with the vehicles of the loader files every time
+// they change, until ctx is done. When the files can not be loaded the error is reported and the vehicles are kept
+func (a *ServerChi) watch(ctx context.Context, sv internal.VehicleService, ld internal.VehicleLoader) {
+	w := loader.NewVehicleWatcher(a.loaderFilePath, ld, &loader.ConfigVehicleWatcher{
+		Interval: a.loaderWatchInterval,
+	})
+	w.Watch(ctx, func(v map[int]internal.Vehicle) error {
+		d, err := sv.Reload(v)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reloaded %s: %d added, %d updated, %d deleted\n",
+			a.loaderFilePath, len(d.Added), len(d.Updated), len(d.Deleted))
+		return nil
+	}, func(err error) {
+		fmt.Printf("reload of %s failed, the vehicles are kept: %v\n", a.loaderFilePath, err)
+	})
+}
+
+// purge is a method that removes for good the vehicles deleted before the retention of the trash, when it starts
+// and every purge interval, until ctx is done. When the purge fails the error is reported and it is tried again
+// on the next interval
+func (a *ServerChi) purge(ctx context.Context, sv internal.VehicleService) {
+	ticker := time.NewTicker(a.trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		before := time.Now().Add(-a.trashRetention)
+		n, err := sv.Purge(before)
+		switch {
+		case err != nil:
+			fmt.Printf("purge of the trash failed: %v\n", err)
+		case n > 0:
+			fmt.Printf("purged %d vehicles deleted before %s\n", n, before.Format(time.RFC3339))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newValidator is a method that returns the validator of the vehicles with the rules of the configured file,
+// or the default rules
+func (a *ServerChi) newValidator() (vl internal.VehicleValidator, err error) {
+	if a.validationRulesPath == "" {
+		vl = validator.NewDefaultVehicleRules()
+		return
+	}
+	c, err := validator.LoadVehicleRulesFile(a.validationRulesPath)
+	if err != nil {
+		return
+	}
+	vl, err = validator.NewVehicleRules(c)
+	return
+}
+
+// newVocabularies is a method that returns the vocabulary repository with the vocabularies of the configured file,
+// or the default vocabularies while the file does not exist
+func (a *ServerChi) newVocabularies() (vc *repository.VocabularyMap, err error) {
+	v := loader.DefaultVocabularies()
+	if a.vocabulariesPath != "" {
+		if _, errStat := os.Stat(a.vocabulariesPath); errStat == nil {
+			if v, err = loader.NewVocabularyJSONFile(a.vocabulariesPath).Load(); err != nil {
+				return
+			}
+		}
+	}
+	vc, err = repository.NewVocabularyMap(v, a.vocabulariesPath)
+	return
+}
+
+// newCatalog is a method that returns the catalog repository with the brands of the configured file, or with the
+// brands and models of the vehicles of rp while the file does not exist (written to the file, if any)
+func (a *ServerChi) newCatalog(rp internal.VehicleRepository) (ct *repository.CatalogMap, err error) {
+	if a.catalogPath != "" {
+		if _, errStat := os.Stat(a.catalogPath); errStat == nil {
+			var b []internal.Brand
+			if b, err = loader.NewCatalogJSONFile(a.catalogPath).Load(); err != nil {
+				return
+			}
+			ct, err = repository.NewCatalogMap(b, a.catalogPath)
+			return
+		}
+	}
+
+	v, err := rp.FindAll()
+	if err != nil {
+		return
+	}
+	if ct, err = repository.NewCatalogMap(catalogOf(v), a.catalogPath); err != nil {
+		return
+	}
+	if a.catalogPath != "" {
+		err = ct.Save()
+	}
+	return
+}
+
+// catalogOf is a function that returns the brands and models of some vehicles, sorted by name and without specs
+// The first name found is kept for the brands and models with the same key
+func catalogOf(v map[int]internal.Vehicle) (b []internal.Brand) {
+	ids := make([]int, 0, len(v))
+	for id := range v {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	brands := make(map[string]int)
+	for _, id := range ids {
+		vh := v[id]
+		key := internal.CatalogKey(vh.Brand)
+		if key == "" {
+			continue
+		}
+		i, ok := brands[key]
+		if !ok {
+			i = len(b)
+			brands[key] = i
+			b = append(b, internal.Brand{Name: vh.Brand})
+		}
+		if _, ok := b[i].Model(vh.Model); !ok && internal.CatalogKey(vh.Model) != "" {
+			b[i].Models = append(b[i].Models, internal.Model{Name: vh.Model})
+		}
+	}
+
+	slices.SortFunc(b, func(x, y internal.Brand) int { return strings.Compare(x.Name, y.Name) })
+	for _, brand := range b {
+		slices.SortFunc(brand.Models, func(x, y internal.Model) int { return strings.Compare(x.Name, y.Name) })
+	}
+	return
+}
+
+// termsNormalizer is an interface of the repositories that normalize the values of the vocabulary fields of
+// their vehicles
+type termsNormalizer interface {
+	// NormalizeTerms is a method that replaces the values with their canonical values and returns how many
+	// vehicles changed
+	NormalizeTerms(ix internal.VocabularyIndex) (n int, err error)
+}
+
+// normalizeTerms is a function that normalizes the values of the vocabulary fields of the vehicles of a repository,
+// the migration of the data loaded before the vocabularies (or some of their terms) existed
+func normalizeTerms(rp internal.VehicleRepository, ix internal.VocabularyIndex) (err error) {
+	tn, ok := rp.(termsNormalizer)
+	if !ok {
+		return
+	}
+	n, err := tn.NormalizeTerms(ix)
+	if err != nil {
+		return
+	}
+	if n > 0 {
+		fmt.Printf("normalized the vocabulary values of %d vehicles\n", n)
+	}
+	return
+}
+
+// newRepository is a method that returns the vehicle repository for the configured storage,
+// loaded with the vehicles of the loader file
+func (a *ServerChi) newRepository(ld internal.VehicleRecordLoader) (rp internal.VehicleRepository, err error) {
+	if a.storage != StorageMemory && a.storagePath == "" {
+		err = fmt.Errorf("storage %q needs a storage path to load the vehicles of %s", a.storage, a.loaderFilePath)
+		return
+	}
+
+	switch a.storage {
+	case StorageMemory:
+		var db map[int]internal.Vehicle
+		if db, err = ld.Load(); err != nil {
+			return
+		}
+		rp = repository.NewVehicleMap(db)
+	case StorageFile, StorageWAL:
+		// resume from the storage file (in JSON) once it exists
+		var src internal.VehicleLoader = ld
+		if _, errStat := os.Stat(a.storagePath); errStat == nil {
+			src = loader.NewVehicleJSONFile(a.storagePath)
+		}
+		var db map[int]internal.Vehicle
+		if db, err = src.Load(); err != nil {
+			return
+		}
+		if a.storage == StorageFile {
+			rp = repository.NewVehicleFile(db, a.storagePath, a.storageFlushInterval)
+			return
+		}
+		rp, err = repository.NewVehicleWAL(db, &repository.ConfigVehicleWAL{
+			SnapshotPath:    a.storagePath,
+			CompactInterval: a.storageCompactInterval,
+		})
+	case StorageSQLite:
+		rp, err = a.newRepositorySQLite(ld)
+	default:
+		err = fmt.Errorf("unknown storage %q", a.storage)
+	}
+	return
+}
+
+// newRepositorySQLite is a method that returns the SQLite vehicle repository with the schema up to date
+// The vehicles of the loader file are imported only once, into an empty database
+func (a *ServerChi) newRepositorySQLite(ld internal.VehicleRecordLoader) (rp internal.VehicleRepository, err error) {
+	db, err := repository.OpenSQLite(a.storagePath)
+	if err != nil {
+		return
+	}
+	sq := repository.NewVehicleSQLite(db)
+	defer func() {
+		if err != nil {
+			_ = sq.Close()
+		}
+	}()
+
+	// schema
+	if err = sq.Migrate(); err != nil {
+		return
+	}
+
+	// one-shot import, streamed by chunks so the vehicles are never all in memory
+	if a.loaderFilePath != "" {
+		im, errImport := sq.BeginImport()
+		switch {
+		case errors.Is(errImport, repository.ErrNotEmpty):
+			rp = sq
+			return
+		case errImport != nil:
+			err = errImport
+			return
+		}
+		if err = loader.ChunkVehicles(ld, loadChunk, im.Add); err != nil {
+			_ = im.Rollback()
+			return
+		}
+		var n int
+		if n, err = im.Commit(); err != nil {
+			return
+		}
+		if n > 0 {
+			fmt.Printf("imported %d vehicles from %s\n", n, a.loaderFilePath)
+		}
+	}
+
+	rp = sq
 	return
 }
@@ -0,0 +1,151 @@
+package internal
+
+import "errors"
+
+var (
+	// ErrBrandNotFound is the error returned when a brand is not in the catalog
+	ErrBrandNotFound = errors.New("brand not found")
+	// ErrModelNotFound is the error returned when a model is not in the catalog
+	ErrModelNotFound = errors.New("model not found")
+	// ErrBrandAlreadyExists is the error returned when a brand is already in the catalog
+	ErrBrandAlreadyExists = errors.New("brand already exists")
+	// ErrModelAlreadyExists is the error returned when a model of a brand is already in the catalog
+	ErrModelAlreadyExists = errors.New("model already exists")
+	// ErrCatalogEntryInUse is the error returned when a brand or a model can not be deleted or renamed because
+	// vehicles reference it
+	ErrCatalogEntryInUse = errors.New("catalog entry in use")
+)
+
+// RuleCatalog is the rule of the brand and the model of a vehicle, that must be in the catalog
+const RuleCatalog = "catalog"
+
+// ModelSpecs is a struct that represents the default attributes of the vehicles of a model
+// Zero values have no default
+type ModelSpecs struct {
+	// Capacity is the capacity of people
+	Capacity int
+	// MaxSpeed is the maximum speed
+	MaxSpeed float64
+	// FuelType is the fuel type
+	FuelType string
+	// Transmission is the transmission
+	Transmission string
+	// Weight is the weight
+	Weight float64
+	// Dimensions are the dimensions
+	Dimensions
+}
+
+// specFields are the fields of a vehicle that have a default in ModelSpecs
+var specFields = []VehicleField{
+	VehicleFieldCapacity,
+	VehicleFieldMaxSpeed,
+	VehicleFieldFuelType,
+	VehicleFieldTransmission,
+	VehicleFieldWeight,
+	VehicleFieldHeight,
+	VehicleFieldLength,
+	VehicleFieldWidth,
+}
+
+// Fill is a method that sets the missing (zero) attributes of a vehicle that have a default in the specs
+// It returns the fields that were filled
+func (s ModelSpecs) Fill(v *Vehicle) (filled []VehicleField) {
+	defaults := Vehicle{VehicleAttributes: VehicleAttributes{
+		Capacity:     s.Capacity,
+		MaxSpeed:     s.MaxSpeed,
+		FuelType:     s.FuelType,
+		Transmission: s.Transmission,
+		Weight:       s.Weight,
+		Dimensions:   s.Dimensions,
+	}}
+	for _, f := range specFields {
+		if f.IsZero(*v) && !f.IsZero(defaults) {
+			f.SetValue(v, f.Value(defaults))
+			filled = append(filled, f)
+		}
+	}
+	return
+}
+
+// Model is a struct that represents a model of a brand
+type Model struct {
+	// Name is the name of the model
+	Name string
+	// Specs are the default attributes of the vehicles of the model
+	Specs ModelSpecs
+}
+
+// Brand is a struct that represents a manufacturer and its models
+type Brand struct {
+	// Name is the name of the brand
+	Name string
+	// Models are the models of the brand
+	Models []Model
+}
+
+// CatalogKey is a function that returns the key a brand or a model is matched by, ignoring case and spaces
+func CatalogKey(name string) string {
+	return TermKey(name)
+}
+
+// Model is a method that returns the model of the brand with a name, compared by its key
+func (b Brand) Model(name string) (m Model, ok bool) {
+	key := CatalogKey(name)
+	for _, m = range b.Models {
+		if CatalogKey(m.Name) == key {
+			return m, true
+		}
+	}
+	return Model{}, false
+}
+
+// CatalogLoader is an interface that represents the loader for the catalog
+type CatalogLoader interface {
+	// Load is a method that loads the brands of the catalog
+	Load() (b []Brand, err error)
+}
+
+// CatalogRepository is an interface that represents a catalog repository
+// Brands and models are found by their key (see CatalogKey)
+type CatalogRepository interface {
+	// FindAll is a method that returns all the brands with their models
+	FindAll() (b []Brand, err error)
+	// GetBrand is a method that returns a brand with its models
+	GetBrand(name string) (b Brand, err error)
+	// AddBrand is a method that adds a brand with its models
+	AddBrand(b Brand) (err error)
+	// DeleteBrand is a method that deletes a brand with its models
+	DeleteBrand(name string) (err error)
+	// AddModel is a method that adds a model to a brand
+	AddModel(brand string, m Model) (err error)
+	// UpdateModel is a method that replaces a model of a brand
+	UpdateModel(brand, name string, m Model) (err error)
+	// DeleteModel is a method that deletes a model of a brand
+	DeleteModel(brand, name string) (err error)
+}
+
+// CatalogService is an interface that represents a catalog service
+type CatalogService interface {
+	// FindAll is a method that returns all the brands with their models
+	FindAll() (b []Brand, err error)
+	// GetBrand is a method that returns a brand with its models
+	GetBrand(name string) (b Brand, err error)
+	// AddBrand is a method that adds a brand with its models
+	AddBrand(b Brand) (err error)
+	// DeleteBrand is a method that deletes a brand with its models, or ErrCatalogEntryInUse if vehicles reference it
+	DeleteBrand(name string) (err error)
+	// AddModel is a method that adds a model to a brand
+	AddModel(brand string, m Model) (err error)
+	// UpdateModel is a method that replaces a model of a brand. It can not be renamed while vehicles reference it
+	UpdateModel(brand, name string, m Model) (err error)
+	// DeleteModel is a method that deletes a model of a brand, or ErrCatalogEntryInUse if vehicles reference it
+	DeleteModel(brand, name string) (err error)
+	// Resolve is a method that checks the brand and the model of a vehicle against the catalog, replaces them with
+	// the names of the catalog and fills the missing attributes with the specs of the model
+	// It returns a *ValidationError when the brand or the model are not in the catalog
+	Resolve(v *Vehicle) (err error)
+	// Reference is a method that runs fn, which adds or changes vehicles that reference the catalog, while no brand
+	// or model can be deleted or renamed
+	Reference(fn func() error) (err error)
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+
+	"github.com/bootcamp-go/web/request"
+	"github.com/bootcamp-go/web/response"
+	"github.com/go-chi/chi/v5"
+)
+
+// BrandJSON is a struct that represents a brand of the catalog in JSON format
+type BrandJSON struct {
+	Name   string      `json:"name"`
+	Models []ModelJSON `json:"models"`
+}
+
+// ModelJSON is a struct that represents a model of the catalog in JSON format
+type ModelJSON struct {
+	Name  string    `json:"name"`
+	Specs SpecsJSON `json:"specs"`
+}
+
+// SpecsJSON is a struct that represents the default attributes of the vehicles of a model in JSON format
+// Zero values have no default
+type SpecsJSON struct {
+	Capacity     int     `json:"passengers,omitempty"`
+	MaxSpeed     float64 `json:"max_speed,omitempty"`
+	FuelType     string  `json:"fuel_type,omitempty"`
+	Transmission string  `json:"transmission,omitempty"`
+	Weight       float64 `json:"weight,omitempty"`
+	Height       float64 `json:"height,omitempty"`
+	Length       float64 `json:"length,omitempty"`
+	Width        float64 `json:"width,omitempty"`
+}
+
+// serializeBrand is a function that returns the JSON representation of a brand
+func serializeBrand(b internal.Brand) BrandJSON {
+	bj := BrandJSON{Name: b.Name, Models: make([]ModelJSON, 0, len(b.Models))}
+	for _, m := range b.Models {
+		bj.Models = append(bj.Models, serializeModel(m))
+	}
+	return bj
+}
+
+// serializeModel is a function that returns the JSON representation of a model
+func serializeModel(m internal.Model) ModelJSON {
+	return ModelJSON{
+		Name: m.Name,
+		Specs: SpecsJSON{
+			Capacity:     m.Specs.Capacity,
+			MaxSpeed:     m.Specs.MaxSpeed,
+			FuelType:     m.Specs.FuelType,
+			Transmission: m.Specs.Transmission,
+			Weight:       m.Specs.Weight,
+			Height:       m.Specs.Height,
+			Length:       m.Specs.Length,
+			Width:        m.Specs.Width,
+		},
+	}
+}
+
+// deserializeModel is a function that returns the model of its JSON representation
+func deserializeModel(mj ModelJSON) internal.Model {
+	return internal.Model{
+		Name: mj.Name,
+		Specs: internal.ModelSpecs{
+			Capacity:     mj.Specs.Capacity,
+			MaxSpeed:     mj.Specs.MaxSpeed,
+			FuelType:     mj.Specs.FuelType,
+			Transmission: mj.Specs.Transmission,
+			Weight:       mj.Specs.Weight,
+			Dimensions: internal.Dimensions{
+				Height: mj.Specs.Height,
+				Length: mj.Specs.Length,
+				Width:  mj.Specs.Width,
+			},
+		},
+	}
+}
+
+// NewCatalogDefault is a function that returns a new instance of CatalogDefault
+func NewCatalogDefault(sv internal.CatalogService) *CatalogDefault {
+	return &CatalogDefault{sv: sv}
+}
+
+// CatalogDefault is a struct with methods that represent handlers for the catalog of brands and models
+type CatalogDefault struct {
+	// sv is the service that will be used by the handler
+	sv internal.CatalogService
+}
+
+// GetAll is a method that returns all the brands with their models
+// Pattern GET /catalog
+func (h *CatalogDefault) GetAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// process
+		b, err := h.sv.FindAll()
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Internal error")
+			return
+		}
+
+		// response
+		data := make([]BrandJSON, 0, len(b))
+		for _, brand := range b {
+			data = append(data, serializeBrand(brand))
+		}
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    data,
+		})
+	}
+}
+
+// GetBrand is a method that returns a brand with its models
+// Pattern GET /catalog/brands/{brand}
+func (h *CatalogDefault) GetBrand() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// process
+		b, err := h.sv.GetBrand(chi.URLParam(r, "brand"))
+		if err != nil {
+			respondCatalogError(w, err)
+			return
+		}
+
+		// response
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    serializeBrand(b),
+		})
+	}
+}
+
+// AddBrand is a method that adds a brand with its models
+// Pattern POST /catalog/brands
+func (h *CatalogDefault) AddBrand() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		var reqBody BrandJSON
+		if err := request.JSON(r, &reqBody); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		// process
+		b := internal.Brand{Name: reqBody.Name, Models: make([]internal.Model, 0, len(reqBody.Models))}
+		for _, mj := range reqBody.Models {
+			b.Models = append(b.Models, deserializeModel(mj))
+		}
+		if err := h.sv.AddBrand(b); err != nil {
+			respondCatalogError(w, err)
+			return
+		}
+
+		// response
+		h.respondBrand(w, b.Name, http.StatusCreated, "brand created")
+	}
+}
+
+// DeleteBrand is a method that deletes a brand with its models, unless vehicles reference it
+// Pattern DELETE /catalog/brands/{brand}
+func (h *CatalogDefault) DeleteBrand() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// process
+		if err := h.sv.DeleteBrand(chi.URLParam(r, "brand")); err != nil {
+			respondCatalogError(w, err)
+			return
+		}
+
+		// response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AddModel is a method that adds a model to a brand
+// Pattern POST /catalog/brands/{brand}/models
+func (h *CatalogDefault) AddModel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		brand := chi.URLParam(r, "brand")
+		var reqBody ModelJSON
+		if err := request.JSON(r, &reqBody); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		// process
+		if err := h.sv.AddModel(brand, deserializeModel(reqBody)); err != nil {
+			respondCatalogError(w, err)
+			return
+		}
+
+		// response
+		h.respondBrand(w, brand, http.StatusCreated, "model created")
+	}
+}
+
+// UpdateModel is a method that replaces a model of a brand, e.g. to change its specs
+// Pattern PUT /catalog/brands/{brand}/models/{model}
+func (h *CatalogDefault) UpdateModel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		brand := chi.URLParam(r, "brand")
+		var reqBody ModelJSON
+		if err := request.JSON(r, &reqBody); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		// process
+		if err := h.sv.UpdateModel(brand, chi.URLParam(r, "model"), deserializeModel(reqBody)); err != nil {
+			respondCatalogError(w, err)
+			return
+		}
+
+		// response
+		h.respondBrand(w, brand, http.StatusOK, "model updated")
+	}
+}
+
+// DeleteModel is a method that deletes a model of a brand, unless vehicles reference it
+// Pattern DELETE /catalog/brands/{brand}/models/{model}
+func (h *CatalogDefault) DeleteModel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// process
+		if err := h.sv.DeleteModel(chi.URLParam(r, "brand"), chi.URLParam(r, "model")); err != nil {
+			respondCatalogError(w, err)
+			return
+		}
+
+		// response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// respondBrand is a method that responds with a brand after a change
+func (h *CatalogDefault) respondBrand(w http.ResponseWriter, name string, code int, message string) {
+	b, err := h.sv.GetBrand(name)
+	if err != nil {
+		respondCatalogError(w, err)
+		return
+	}
+	response.JSON(w, code, map[string]any{
+		"message": message,
+		"data":    serializeBrand(b),
+	})
+}
+
+// respondCatalogError is a function that responds with the error of an operation over the catalog
+func respondCatalogError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, internal.ErrBrandNotFound):
+		response.Error(w, http.StatusNotFound, "Brand not found")
+	case errors.Is(err, internal.ErrModelNotFound):
+		response.Error(w, http.StatusNotFound, "Model not found")
+	case errors.Is(err, internal.ErrBrandAlreadyExists):
+		response.Error(w, http.StatusConflict, "Brand already exists")
+	case errors.Is(err, internal.ErrModelAlreadyExists):
+		response.Error(w, http.StatusConflict, "Model already exists")
+	case errors.Is(err, internal.ErrCatalogEntryInUse):
+		response.Error(w, http.StatusConflict, "Vehicles reference the brand or the model")
+	case errors.Is(err, internal.ErrFieldRequired):
+		response.Error(w, http.StatusBadRequest, "The names of the brand and its models are required")
+	default:
+		response.Error(w, http.StatusInternalServerError, "Internal error")
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"app/internal"
+	"encoding/json"
+	"net/http"
+)
+
+// contentTypeProblem is the media type of a problem detail (RFC 7807)
+const contentTypeProblem = "application/problem+json"
+
+// ViolationJSON is a struct that represents a validation rule broken by a field, in JSON format
+type ViolationJSON struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ProblemJSON is a struct that represents a problem detail (RFC 7807)
+// Errors is an extension member with the violations of a validation problem
+type ProblemJSON struct {
+	Type   string          `json:"type"`
+	Title  string          `json:"title"`
+	Status int             `json:"status"`
+	Detail string          `json:"detail,omitempty"`
+	Errors []ViolationJSON `json:"errors,omitempty"`
+}
+
+// serializeViolations is a function that serializes the violations of a validation error
+func serializeViolations(e *internal.ValidationError) (v []ViolationJSON) {
+	v = make([]ViolationJSON, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		v = append(v, ViolationJSON{
+			Field:   violation.Field,
+			Rule:    violation.Rule,
+			Message: violation.Message,
+		})
+	}
+	return
+}
+
+// respondProblem is a function that responds with a problem detail
+func respondProblem(w http.ResponseWriter, p ProblemJSON) {
+	w.Header().Set("Content-Type", contentTypeProblem)
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// respondValidationProblem is a function that responds with 400 Bad Request and every violation of a validation error
+func respondValidationProblem(w http.ResponseWriter, e *internal.ValidationError) {
+	respondProblem(w, ProblemJSON{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusBadRequest),
+		Status: http.StatusBadRequest,
+		Detail: "Some fields of the vehicle are invalid, see errors",
+		Errors: serializeViolations(e),
+	})
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestVehicleDefault_ValidationProblem(t *testing.T) {
+	// a vehicle with every kind of violation: a model out of the catalog, a value out of its vocabulary,
+	// a missing field and a value over its limit
+	v := serializeVehicle(newTestVehicle(2))
+	v.Model, v.FuelType, v.Registration, v.Capacity = "Mondeo", "steam", "", 9
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"model", "fuel_type", "registration", "passengers"}
+
+	fields := func(violations []ViolationJSON) (f []string) {
+		for _, violation := range violations {
+			if violation.Rule == "" || violation.Message == "" {
+				t.Errorf("expected the rule and the message of %+v", violation)
+			}
+			f = append(f, violation.Field)
+		}
+		return
+	}
+
+	for _, c := range []struct {
+		method string
+		target string
+		seed   bool
+	}{
+		{http.MethodPost, "/vehicles", false},
+		{http.MethodPut, "/vehicles/2", true},
+	} {
+		rt, rp := newTestRouter(t)
+		if c.seed {
+			seed := newTestVehicle(2)
+			if err := rp.Add(&seed); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w := serve(rt, c.method, c.target, string(b), "Content-Type", "application/json")
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != contentTypeProblem {
+			t.Fatalf("%s %s: expected 400 %s, got %d %s: %s", c.method, c.target, contentTypeProblem, w.Code, w.Header().Get("Content-Type"), w.Body)
+		}
+		var p ProblemJSON
+		decodeBody(t, w, &p)
+		if p.Status != http.StatusBadRequest || p.Title == "" {
+			t.Errorf("%s %s: expected the status and the title of the problem, got %+v", c.method, c.target, p)
+		}
+		if got := fields(p.Errors); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s %s: expected violations of %v, got %v", c.method, c.target, expected, got)
+		}
+	}
+
+	// the items of a batch report their violations too
+	rt, _ := newTestRouter(t)
+	w := serve(rt, http.MethodPost, "/vehicles/batch", "["+string(b)+"]", "Content-Type", "application/json")
+	var body struct {
+		Results []BatchItemResult `json:"results"`
+	}
+	decodeBody(t, w, &body)
+	if len(body.Results) != 1 {
+		t.Fatalf("expected 1 result, got %s", w.Body)
+	}
+	if got := fields(body.Results[0].Errors); !reflect.DeepEqual(got, expected) {
+		t.Errorf("batch: expected violations of %v, got %v", expected, got)
+	}
+}
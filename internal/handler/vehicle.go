@@ -5,6 +5,8 @@ import (
 	"errors"
 	"github.com/bootcamp-go/web/request"
 	"github.com/go-chi/chi/v5"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -28,6 +30,72 @@ type VehicleJSON struct {
 	Height          float64 `json:"height"`
 	Length          float64 `json:"length"`
 	Width           float64 `json:"width"`
+	Version         int     `json:"version"`
+}
+
+// serializeVehicle is a function that returns the JSON representation of a vehicle
+func serializeVehicle(v internal.Vehicle) VehicleJSON {
+	return VehicleJSON{
+		ID:              v.Id,
+		Brand:           v.Brand,
+		Model:           v.Model,
+		Registration:    v.Registration,
+		Color:           v.Color,
+		FabricationYear: v.FabricationYear,
+		Capacity:        v.Capacity,
+		MaxSpeed:        v.MaxSpeed,
+		FuelType:        v.FuelType,
+		Transmission:    v.Transmission,
+		Weight:          v.Weight,
+		Height:          v.Height,
+		Length:          v.Length,
+		Width:           v.Width,
+		Version:         v.Version,
+	}
+}
+
+// deserializeVehicle is a function that returns the vehicle of a JSON representation
+// The version is not deserialized: the version a change applies to comes from If-Match
+func deserializeVehicle(v VehicleJSON) internal.Vehicle {
+	return internal.Vehicle{
+		Id: v.ID,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           v.Brand,
+			Model:           v.Model,
+			Registration:    v.Registration,
+			Color:           v.Color,
+			FabricationYear: v.FabricationYear,
+			Capacity:        v.Capacity,
+			MaxSpeed:        v.MaxSpeed,
+			FuelType:        v.FuelType,
+			Transmission:    v.Transmission,
+			Weight:          v.Weight,
+			Dimensions: internal.Dimensions{
+				Height: v.Height,
+				Length: v.Length,
+				Width:  v.Width,
+			},
+		},
+	}
+}
+
+const (
+	// BatchItemCreated is the status of a vehicle of a batch that was created
+	BatchItemCreated = "created"
+	// BatchItemFailed is the status of a vehicle of a batch that can not be created
+	BatchItemFailed = "failed"
+	// BatchItemNotCreated is the status of a valid vehicle of an atomic batch that failed
+	BatchItemNotCreated = "not_created"
+)
+
+// BatchItemResult is a struct that represents the result of a vehicle of a batch
+// Errors are the violations of a vehicle that failed validation
+type BatchItemResult struct {
+	Index  int             `json:"index"`
+	ID     int             `json:"id"`
+	Status string          `json:"status"`
+	Error  string          `json:"error,omitempty"`
+	Errors []ViolationJSON `json:"errors,omitempty"`
 }
 
 // SpeedUpdateRequest is a struct that represents the speed update request.
@@ -47,10 +115,15 @@ type VehicleDefault struct {
 }
 
 // GetAll is a method that returns a handler for the route GET /vehicles
+// With query parameters it filters, sorts and pages the vehicles (see parseVehicleQuery). The list has a weak ETag
+// (see respondList)
 func (h *VehicleDefault) GetAll() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// request
-		// ...
+		if len(r.URL.Query()) > 0 {
+			h.query(w, r)
+			return
+		}
 
 		// process
 		// - get all vehicles
@@ -80,13 +153,105 @@ func (h *VehicleDefault) GetAll() http.HandlerFunc {
 				Width:           value.Width,
 			}
 		}
-		response.JSON(w, http.StatusOK, map[string]any{
+		respondList(w, r, map[string]any{
 			"message": "success",
 			"data":    data,
 		})
 	}
 }
 
+// query is a method that responds to GET /vehicles with a list query
+func (h *VehicleDefault) query(w http.ResponseWriter, r *http.Request) {
+	// request
+	q, err := parseVehicleQuery(r.URL.Query())
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// process
+	v, total, err := h.sv.Query(q)
+	if err != nil {
+		switch {
+		case errors.Is(err, internal.ErrInvalidQuery):
+			response.Error(w, http.StatusBadRequest, err.Error())
+		default:
+			response.Error(w, http.StatusInternalServerError, "Internal error")
+		}
+		return
+	}
+
+	// response
+	data := make([]VehicleJSON, 0, len(v))
+	for _, value := range v {
+		data = append(data, serializeVehicle(value))
+	}
+	respondList(w, r, map[string]any{
+		"message": "success",
+		"data":    data,
+		"total":   total,
+		"offset":  q.Offset,
+		"limit":   q.Limit,
+	})
+}
+
+// GetById is a method that returns the vehicle with an id, with its ETag (see etag)
+// Pattern GET /vehicles/{id}
+func (h *VehicleDefault) GetById() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || id <= 0 {
+			response.Text(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		// process
+		v, err := h.sv.GetById(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, internal.ErrVehicleIdNotFound):
+				response.Error(w, http.StatusNotFound, "Vehicle with that id not found")
+			default:
+				response.Error(w, http.StatusInternalServerError, "Internal error")
+			}
+			return
+		}
+
+		// response
+		respondVehicle(w, r, v)
+	}
+}
+
+// GetByRegistration is a method that returns the vehicle with a registration, with its ETag (see etag)
+// Spaces and case are ignored: "ab 123" finds the vehicle registered as "AB123"
+// Pattern GET /vehicles/registration/{registration}
+func (h *VehicleDefault) GetByRegistration() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		registration := chi.URLParam(r, "registration")
+		if internal.NormalizeRegistration(registration) == "" {
+			response.Text(w, http.StatusBadRequest, "invalid registration")
+			return
+		}
+
+		// process
+		v, err := h.sv.GetByRegistration(registration)
+		if err != nil {
+			switch {
+			case errors.Is(err, internal.ErrVehicleIdNotFound):
+				response.Error(w, http.StatusNotFound, "Vehicle with that registration not found")
+			default:
+				response.Error(w, http.StatusInternalServerError, "Internal error")
+			}
+			return
+		}
+
+		// response
+		respondVehicle(w, r, v)
+	}
+}
+
 // AddVehicle is a method that adds a new vehicle to the vehicles map for the route post /vehicles
 func (h *VehicleDefault) AddVehicle() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -121,7 +286,10 @@ func (h *VehicleDefault) AddVehicle() http.HandlerFunc {
 		}
 		err = h.sv.Add(&v)
 		if err != nil {
+			var validationErr *internal.ValidationError
 			switch {
+			case errors.As(err, &validationErr):
+				respondValidationProblem(w, validationErr)
 			case errors.Is(err, internal.ErrVehicleAlreadyExists):
 				response.Error(w, http.StatusConflict, "Vehicle already exists")
 			case errors.Is(err, internal.ErrFieldRequired):
@@ -134,27 +302,10 @@ func (h *VehicleDefault) AddVehicle() http.HandlerFunc {
 			return
 		}
 		// response
-		// - serialize to VehicleJSON
-		responseData := VehicleJSON{
-			ID:              v.Id,
-			Brand:           v.Brand,
-			Model:           v.Model,
-			Registration:    v.Registration,
-			Color:           v.Color,
-			FabricationYear: v.FabricationYear,
-			Capacity:        v.Capacity,
-			MaxSpeed:        v.MaxSpeed,
-			FuelType:        v.FuelType,
-			Transmission:    v.Transmission,
-			Weight:          v.Weight,
-			Height:          v.Height,
-			Length:          v.Length,
-			Width:           v.Width,
-		}
-
+		w.Header().Set("ETag", etag(v))
 		response.JSON(w, http.StatusCreated, map[string]any{
 			"message": "vehicle created",
-			"data":    responseData,
+			"data":    serializeVehicle(v),
 		})
 	}
 }
@@ -204,7 +355,7 @@ func (h *VehicleDefault) GetByColorAndYear() http.HandlerFunc {
 				Width:           value.Width,
 			}
 		}
-		response.JSON(w, http.StatusOK, map[string]any{
+		respondList(w, r, map[string]any{
 			"message": "success",
 			"data":    data,
 		})
@@ -266,7 +417,7 @@ func (h *VehicleDefault) GetByBrandAndYears() http.HandlerFunc {
 				Width:           value.Width,
 			}
 		}
-		response.JSON(w, http.StatusOK, map[string]any{
+		respondList(w, r, map[string]any{
 			"message": "success",
 			"data":    data,
 		})
@@ -306,9 +457,15 @@ func (h *VehicleDefault) GetAverageSpeedByBrand() http.HandlerFunc {
 }
 
 // AddVehiclesByBatch is a method that adds batch of vehicles. Pattern /bach
+// The query parameter mode is atomic (default: all the vehicles or none) or best_effort (the valid vehicles).
+// The response has the result of each vehicle, in the order of the request
 func (h *VehicleDefault) AddVehiclesByBatch() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// request
+		mode := internal.BatchModeAtomic
+		if m := r.URL.Query().Get("mode"); m != "" {
+			mode = internal.BatchMode(m)
+		}
 		var reqBody []VehicleJSON
 		err := request.JSON(r, &reqBody)
 		if err != nil {
@@ -317,51 +474,81 @@ func (h *VehicleDefault) AddVehiclesByBatch() http.HandlerFunc {
 		}
 		// process
 		// - deserialize to vehicle
-		var deserializedData []*internal.Vehicle
+		deserializedData := make([]*internal.Vehicle, 0, len(reqBody))
 		for _, v := range reqBody {
-			deserializedV := internal.Vehicle{
-				Id: v.ID,
-				VehicleAttributes: internal.VehicleAttributes{
-					Brand:           v.Brand,
-					Model:           v.Model,
-					Registration:    v.Registration,
-					Color:           v.Color,
-					FabricationYear: v.FabricationYear,
-					Capacity:        v.Capacity,
-					MaxSpeed:        v.MaxSpeed,
-					FuelType:        v.FuelType,
-					Transmission:    v.Transmission,
-					Weight:          v.Weight,
-					Dimensions: internal.Dimensions{
-						Height: v.Height,
-						Length: v.Length,
-						Width:  v.Width,
-					},
-				},
-			}
+			deserializedV := deserializeVehicle(v)
 			deserializedData = append(deserializedData, &deserializedV)
 		}
-		err = h.sv.AddBatch(deserializedData)
+		err = h.sv.AddBatch(deserializedData, mode)
 
-		if err != nil {
+		var batchErr *internal.VehicleBatchError
+		if err != nil && !errors.As(err, &batchErr) {
 			switch {
-			case errors.Is(err, internal.ErrVehicleAlreadyExists):
-				response.Error(w, http.StatusConflict, "Some of the vehicles already exist")
-			case errors.Is(err, internal.ErrFieldRequired):
-				response.Error(w, http.StatusBadRequest, "Some vehicles have missing fields")
+			case errors.Is(err, internal.ErrInvalidBatchMode):
+				response.Error(w, http.StatusBadRequest, "Invalid mode, it must be atomic or best_effort")
 			default:
 				response.Error(w, http.StatusInternalServerError, "Internal error")
 			}
 			return
 		}
 
-		response.JSON(w, http.StatusCreated, map[string]any{
-			"message": "vehicles successfully created",
+		// response
+		// - result of each vehicle
+		results := make([]BatchItemResult, 0, len(deserializedData))
+		created := 0
+		for i, v := range deserializedData {
+			result := BatchItemResult{Index: i, ID: v.Id, Status: BatchItemCreated}
+			switch {
+			case batchErr != nil && batchErr.Errors[i] != nil:
+				result.Status, result.Error = BatchItemFailed, batchErr.Errors[i].Error()
+				var validationErr *internal.ValidationError
+				if errors.As(batchErr.Errors[i], &validationErr) {
+					result.Errors = serializeViolations(validationErr)
+				}
+			case batchErr != nil && mode == internal.BatchModeAtomic:
+				result.Status = BatchItemNotCreated
+			default:
+				created++
+			}
+			results = append(results, result)
+		}
+
+		// - status of the batch, by the kinds of errors of its vehicles
+		code, message := http.StatusCreated, "vehicles successfully created"
+		switch {
+		case batchErr == nil:
+		case mode == internal.BatchModeBestEffort:
+			code, message = http.StatusMultiStatus, "some vehicles were not created"
+		default:
+			var conflicts, invalid int
+			for _, e := range batchErr.Errors {
+				if errors.Is(e, internal.ErrVehicleAlreadyExists) {
+					conflicts++
+				} else {
+					invalid++
+				}
+			}
+			switch {
+			case invalid == 0:
+				code, message = http.StatusConflict, "Some of the vehicles already exist"
+			case conflicts == 0:
+				code, message = http.StatusBadRequest, "Some vehicles are invalid"
+			default:
+				code, message = http.StatusBadRequest, "Some vehicles are invalid and some already exist"
+			}
+		}
+		response.JSON(w, code, map[string]any{
+			"message": message,
+			"mode":    mode,
+			"created": created,
+			"failed":  len(deserializedData) - created,
+			"results": results,
 		})
 	}
 }
 
 // UpdateSpeed is a method that update the speed of a vehicle
+// With If-Match, only if the vehicle is at that version
 func (h *VehicleDefault) UpdateSpeed() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// request
@@ -376,14 +563,23 @@ func (h *VehicleDefault) UpdateSpeed() http.HandlerFunc {
 			response.Error(w, http.StatusBadRequest, "Invalid request body")
 			return
 		}
+		version, ok := h.ifMatch(w, r, id)
+		if !ok {
+			return
+		}
 		// process
 
-		err = h.sv.UpdateSpeed(reqBody.MaxSpeed, id)
+		err = h.sv.UpdateSpeed(reqBody.MaxSpeed, id, version)
 
 		if err != nil {
+			var validationErr *internal.ValidationError
 			switch {
+			case errors.As(err, &validationErr):
+				respondValidationProblem(w, validationErr)
 			case errors.Is(err, internal.ErrVehicleIdNotFound):
 				response.Error(w, http.StatusConflict, "Vehicle with that id not found")
+			case errors.Is(err, internal.ErrVehicleVersionMismatch):
+				response.Error(w, http.StatusPreconditionFailed, "The vehicle was changed")
 			default:
 				response.Error(w, http.StatusInternalServerError, "Internal error")
 			}
@@ -399,6 +595,154 @@ func (h *VehicleDefault) UpdateSpeed() http.HandlerFunc {
 	}
 }
 
+// Update is a method that replaces a vehicle
+// The id of the body, if any, must be the id of the path. With If-Match, only if the vehicle is at that version
+// Pattern PUT /vehicles/{id}
+func (h *VehicleDefault) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || id <= 0 {
+			response.Text(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var reqBody VehicleJSON
+		err = request.JSON(r, &reqBody)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if reqBody.ID != 0 && reqBody.ID != id {
+			response.Error(w, http.StatusBadRequest, "The id of the body does not match the id of the path")
+			return
+		}
+		reqBody.ID = id
+		version, ok := h.ifMatch(w, r, id)
+		if !ok {
+			return
+		}
+
+		// process
+		v := deserializeVehicle(reqBody)
+		v.Version = version
+		err = h.sv.Update(&v)
+
+		// response
+		respondUpdated(w, v, err)
+	}
+}
+
+// Patch is a method that changes some fields of a vehicle
+// The body is a JSON Merge Patch (application/merge-patch+json or application/json) or a JSON Patch
+// (application/json-patch+json) over the JSON representation of the vehicle. The id can not be changed.
+// With If-Match, only if the vehicle is at that version
+// Pattern PATCH /vehicles/{id}
+func (h *VehicleDefault) Patch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || id <= 0 {
+			response.Text(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || (contentType != contentTypeMergePatch && contentType != contentTypeJSONPatch && contentType != "application/json") {
+			response.Error(w, http.StatusUnsupportedMediaType, "Unsupported patch media type")
+			return
+		}
+		patch, err := io.ReadAll(r.Body)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		// process
+		// the patch is applied to the current vehicle, which is updated only if it is still at the same version
+		// without If-Match a concurrent change is retried, with If-Match it fails the precondition
+		im := r.Header.Get("If-Match")
+		for attempt := 1; ; attempt++ {
+			// - current vehicle
+			v, err := h.sv.GetById(id)
+			if err != nil {
+				switch {
+				case errors.Is(err, internal.ErrVehicleIdNotFound) && im != "":
+					response.Error(w, http.StatusPreconditionFailed, "Vehicle with that id not found")
+				case errors.Is(err, internal.ErrVehicleIdNotFound):
+					response.Error(w, http.StatusNotFound, "Vehicle with that id not found")
+				default:
+					response.Error(w, http.StatusInternalServerError, "Internal error")
+				}
+				return
+			}
+			if im != "" && !etagMatches(im, etag(v), false) {
+				response.Error(w, http.StatusPreconditionFailed, "The vehicle was changed")
+				return
+			}
+
+			// - patch
+			patched, err := patchVehicle(serializeVehicle(v), contentType, patch)
+			if err != nil {
+				switch {
+				case errors.Is(err, ErrPatchTestFailed):
+					response.Error(w, http.StatusConflict, err.Error())
+				case errors.Is(err, ErrInvalidPatch):
+					response.Error(w, http.StatusBadRequest, err.Error())
+				default:
+					response.Error(w, http.StatusInternalServerError, "Internal error")
+				}
+				return
+			}
+			if patched.ID != id {
+				response.Error(w, http.StatusBadRequest, "The id can not be changed")
+				return
+			}
+
+			// - update
+			u := deserializeVehicle(patched)
+			u.Version = v.Version
+			err = h.sv.Update(&u)
+			if errors.Is(err, internal.ErrVehicleVersionMismatch) && im == "" && attempt < patchAttempts {
+				continue
+			}
+
+			// response
+			respondUpdated(w, u, err)
+			return
+		}
+	}
+}
+
+// respondUpdated is a function that responds to the update of a vehicle with the updated vehicle and its ETag,
+// or with the error of the update
+func respondUpdated(w http.ResponseWriter, v internal.Vehicle, err error) {
+	if err != nil {
+		var validationErr *internal.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			respondValidationProblem(w, validationErr)
+		case errors.Is(err, internal.ErrVehicleIdNotFound):
+			response.Error(w, http.StatusNotFound, "Vehicle with that id not found")
+		case errors.Is(err, internal.ErrVehicleVersionMismatch):
+			response.Error(w, http.StatusPreconditionFailed, "The vehicle was changed")
+		case errors.Is(err, internal.ErrVehicleAlreadyExists):
+			response.Error(w, http.StatusConflict, "Another vehicle has that registration")
+		case errors.Is(err, internal.ErrFieldRequired):
+			response.Error(w, http.StatusBadRequest, "Some fields are missing")
+		case errors.Is(err, internal.ErrInvalidFieldValue):
+			response.Error(w, http.StatusBadRequest, "Some fields have invalid values")
+		default:
+			response.Error(w, http.StatusInternalServerError, "Internal error")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", etag(v))
+	response.JSON(w, http.StatusOK, map[string]any{
+		"message": "vehicle updated",
+		"data":    serializeVehicle(v),
+	})
+}
+
 // GetByFuelType is a method that returns a map of vehicles with a specific fuel type.
 func (h *VehicleDefault) GetByFuelType() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -438,14 +782,15 @@ func (h *VehicleDefault) GetByFuelType() http.HandlerFunc {
 				Width:           value.Width,
 			}
 		}
-		response.JSON(w, http.StatusOK, map[string]any{
+		respondList(w, r, map[string]any{
 			"message": "success",
 			"data":    data,
 		})
 	}
 }
 
-// DeleteVehicle is a method that deletes a vehicle
+// DeleteVehicle is a method that moves a vehicle to the trash, for the reason of the query parameter reason
+// With If-Match, only if the vehicle is at that version
 func (h *VehicleDefault) DeleteVehicle() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// request
@@ -454,14 +799,20 @@ func (h *VehicleDefault) DeleteVehicle() http.HandlerFunc {
 			response.Text(w, http.StatusBadRequest, "invalid id")
 			return
 		}
+		version, ok := h.ifMatch(w, r, id)
+		if !ok {
+			return
+		}
 		// process
 
-		err = h.sv.DeleteVehicle(id)
+		err = h.sv.DeleteVehicle(id, version, strings.TrimSpace(r.URL.Query().Get("reason")))
 
 		if err != nil {
 			switch {
 			case errors.Is(err, internal.ErrVehicleIdNotFound):
 				response.Error(w, http.StatusConflict, "Vehicle with that id not found")
+			case errors.Is(err, internal.ErrVehicleVersionMismatch):
+				response.Error(w, http.StatusPreconditionFailed, "The vehicle was changed")
 			default:
 				response.Error(w, http.StatusInternalServerError, "Internal error")
 			}
@@ -568,7 +919,7 @@ func (h *VehicleDefault) GetByDimensions() http.HandlerFunc {
 				Width:           value.Width,
 			}
 		}
-		response.JSON(w, http.StatusOK, map[string]any{
+		respondList(w, r, map[string]any{
 			"message": "success",
 			"data":    data,
 		})
@@ -623,7 +974,7 @@ func (h *VehicleDefault) GetByWeight() http.HandlerFunc {
 				Width:           value.Width,
 			}
 		}
-		response.JSON(w, http.StatusOK, map[string]any{
+		respondList(w, r, map[string]any{
 			"message": "success",
 			"data":    data,
 		})
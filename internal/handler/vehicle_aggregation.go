@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bootcamp-go/web/response"
+)
+
+// queryParamsAggregation are the query parameters of the groups and metrics of an aggregation, the rest are filters
+var queryParamsAggregation = []string{"group_by", "metrics"}
+
+// GroupJSON is a struct that represents a group of an aggregation in JSON format
+type GroupJSON struct {
+	// Group are the values of the fields the vehicles are grouped by
+	Group map[string]any `json:"group"`
+	// Metrics are the values of the metrics, by their names (e.g. avg(max_speed))
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// parseVehicleAggregation is a function that parses the query parameters of an aggregation
+//   - filters: as in parseVehicleQuery
+//   - groups: group_by=field1,field2 with the fields in internal.GroupFields
+//   - metrics: metrics=count,avg(max_speed),median(weight),p90(max_speed) (count by default)
+func parseVehicleAggregation(values url.Values) (a internal.VehicleAggregation, err error) {
+	// filters
+	a.Filters, err = parseVehicleFilters(values, queryParamsAggregation...)
+	if err != nil {
+		return
+	}
+
+	// groups
+	a.GroupBy = make([]internal.VehicleField, 0)
+	if groupBy := values.Get("group_by"); groupBy != "" {
+		for _, g := range strings.Split(groupBy, ",") {
+			a.GroupBy = append(a.GroupBy, internal.VehicleField(g))
+		}
+	}
+
+	// metrics
+	metrics := values.Get("metrics")
+	if metrics == "" {
+		metrics = string(internal.AggregateCount)
+	}
+	for _, s := range strings.Split(metrics, ",") {
+		var m internal.VehicleMetric
+		if m, err = internal.ParseVehicleMetric(s); err != nil {
+			return
+		}
+		a.Metrics = append(a.Metrics, m)
+	}
+
+	err = a.Validate()
+	return
+}
+
+// Aggregate is a method that returns the metrics of the groups of the vehicles that satisfy some filters
+// Pattern GET /vehicles/aggregate (see parseVehicleAggregation)
+func (h *VehicleDefault) Aggregate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		a, err := parseVehicleAggregation(r.URL.Query())
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// process
+		groups, err := h.sv.Aggregate(a)
+		if err != nil {
+			switch {
+			case errors.Is(err, internal.ErrInvalidQuery):
+				response.Error(w, http.StatusBadRequest, err.Error())
+			default:
+				response.Error(w, http.StatusInternalServerError, "Internal error")
+			}
+			return
+		}
+
+		// response
+		data := make([]GroupJSON, 0, len(groups))
+		for _, g := range groups {
+			gj := GroupJSON{Group: make(map[string]any, len(a.GroupBy)), Metrics: make(map[string]float64, len(a.Metrics))}
+			for i, f := range a.GroupBy {
+				gj.Group[string(f)] = g.Keys[i]
+			}
+			for i, m := range a.Metrics {
+				gj.Metrics[m.String()] = g.Values[i]
+			}
+			data = append(data, gj)
+		}
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message":  "success",
+			"data":     data,
+			"group_by": a.GroupBy,
+			"metrics":  metricNames(a.Metrics),
+		})
+	}
+}
+
+// metricNames is a function that returns the names of some metrics
+func metricNames(metrics []internal.VehicleMetric) []string {
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.String())
+	}
+	return names
+}
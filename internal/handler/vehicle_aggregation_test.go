@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVehicleAggregation(t *testing.T) {
+	cases := []struct {
+		query   string
+		groupBy []internal.VehicleField
+		metrics []internal.VehicleMetric
+	}{
+		{
+			query:   "",
+			groupBy: []internal.VehicleField{},
+			metrics: []internal.VehicleMetric{{Func: internal.AggregateCount}},
+		},
+		{
+			query:   "group_by=brand,year&metrics=count,p90(max_speed),p99.5(weight),p0(weight),median(weight)",
+			groupBy: []internal.VehicleField{internal.VehicleFieldBrand, internal.VehicleFieldFabricationYear},
+			metrics: []internal.VehicleMetric{
+				{Func: internal.AggregateCount},
+				{Func: internal.AggregatePercentile, Field: internal.VehicleFieldMaxSpeed, Percentile: 90},
+				{Func: internal.AggregatePercentile, Field: internal.VehicleFieldWeight, Percentile: 99.5},
+				{Func: internal.AggregatePercentile, Field: internal.VehicleFieldWeight},
+				{Func: internal.AggregateMedian, Field: internal.VehicleFieldWeight},
+			},
+		},
+	}
+	for _, c := range cases {
+		values, err := url.ParseQuery(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := parseVehicleAggregation(values)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(a.GroupBy, c.groupBy) || !reflect.DeepEqual(a.Metrics, c.metrics) {
+			t.Errorf("%s: expected %v and %+v, got %v and %+v", c.query, c.groupBy, c.metrics, a.GroupBy, a.Metrics)
+		}
+	}
+}
+
+func TestParseVehicleAggregation_Invalid(t *testing.T) {
+	for query, message := range map[string]string{
+		"metrics=p101(max_speed)":       "must be between 0 and 100",
+		"metrics=p-1(max_speed)":        "must be between 0 and 100",
+		"metrics=percentile(max_speed)": "must be written as pN(field)",
+		"metrics=p(max_speed)":          `unknown aggregate function "p"`,
+		"metrics=pX(max_speed)":         `unknown aggregate function "pX"`,
+		"metrics=avg(brand)":            "needs a numeric field",
+		"metrics=avg(wheels)":           `unknown field "wheels"`,
+		"metrics=avg":                   "must be count or fn(field)",
+		"group_by=weight":               `can not be grouped by "weight"`,
+		"group_by=brand,brand":          `grouped by "brand" twice`,
+		"year[gte]=new&group_by=brand":  "year must be a number",
+		"metrics=count,p90(max_speed":   "must be count or fn(field)",
+	} {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = parseVehicleAggregation(values)
+		if !errors.Is(err, internal.ErrInvalidQuery) || !strings.Contains(err.Error(), message) {
+			t.Errorf("%s: expected %q, got %v", query, message, err)
+		}
+	}
+}
+
+func TestVehicleDefault_Aggregate(t *testing.T) {
+	var vehicles []internal.Vehicle
+	for i, speed := range []float64{100, 200, 300, 400} {
+		v := newTestVehicle(i + 1)
+		v.MaxSpeed = speed
+		vehicles = append(vehicles, v)
+	}
+	toyota := newTestVehicle(5)
+	toyota.Brand, toyota.Model, toyota.MaxSpeed = "Toyota", "Corolla", 150
+	rt, _ := newTestRouter(t, append(vehicles, toyota)...)
+
+	type body struct {
+		Data    []GroupJSON `json:"data"`
+		Metrics []string    `json:"metrics"`
+	}
+	aggregate := func(query string) (b body) {
+		t.Helper()
+		w := serve(rt, http.MethodGet, "/vehicles/aggregate?"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, w.Code, w.Body)
+		}
+		decodeBody(t, w, &b)
+		return
+	}
+
+	// groups sorted by their keys, with the percentiles interpolated between the values
+	b := aggregate("group_by=brand&metrics=count,p90(max_speed),median(max_speed),avg(max_speed)")
+	expected := []GroupJSON{
+		{Group: map[string]any{"brand": "Ford"}, Metrics: map[string]float64{"count": 4, "p90(max_speed)": 370, "median(max_speed)": 250, "avg(max_speed)": 250}},
+		{Group: map[string]any{"brand": "Toyota"}, Metrics: map[string]float64{"count": 1, "p90(max_speed)": 150, "median(max_speed)": 150, "avg(max_speed)": 150}},
+	}
+	if !reflect.DeepEqual(b.Data, expected) {
+		t.Errorf("expected %+v, got %+v", expected, b.Data)
+	}
+	if metrics := []string{"count", "p90(max_speed)", "median(max_speed)", "avg(max_speed)"}; !reflect.DeepEqual(b.Metrics, metrics) {
+		t.Errorf("expected metrics %v, got %v", metrics, b.Metrics)
+	}
+
+	// a single group of the filtered vehicles, and none when no vehicle satisfies the filters
+	b = aggregate("brand=Ford&max_speed[gte]=200&metrics=min(max_speed),max(max_speed),sum(max_speed)")
+	expected = []GroupJSON{{Group: map[string]any{}, Metrics: map[string]float64{"min(max_speed)": 200, "max(max_speed)": 400, "sum(max_speed)": 900}}}
+	if !reflect.DeepEqual(b.Data, expected) {
+		t.Errorf("expected %+v, got %+v", expected, b.Data)
+	}
+	if b = aggregate("brand=Kia&group_by=model"); len(b.Data) != 0 {
+		t.Errorf("expected no groups, got %+v", b.Data)
+	}
+
+	// bad groups, metrics and filters are rejected
+	for _, query := range []string{"metrics=p101(max_speed)", "metrics=avg(color)", "group_by=registration", "year[gte]=new"} {
+		if w := serve(rt, http.MethodGet, "/vehicles/aggregate?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", query, w.Code, w.Body)
+		}
+	}
+}
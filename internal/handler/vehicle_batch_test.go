@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestVehicleDefault_AddVehiclesByBatch(t *testing.T) {
+	item := func(id int, registration string, passengers int) VehicleJSON {
+		v := serializeVehicle(newTestVehicle(id))
+		v.Registration, v.Capacity = registration, passengers
+		return v
+	}
+	valid, invalid, existing := item(2, "REG-2", 5), item(3, "REG-3", 9), item(4, "REG-1", 5)
+
+	cases := []struct {
+		name    string
+		mode    string
+		items   []VehicleJSON
+		status  int
+		results []string
+	}{
+		{"valid", "", []VehicleJSON{valid}, http.StatusCreated, []string{BatchItemCreated}},
+		{"existing", "atomic", []VehicleJSON{valid, existing}, http.StatusConflict, []string{BatchItemNotCreated, BatchItemFailed}},
+		{"invalid", "atomic", []VehicleJSON{valid, invalid}, http.StatusBadRequest, []string{BatchItemNotCreated, BatchItemFailed}},
+		{"invalid and existing", "atomic", []VehicleJSON{invalid, existing}, http.StatusBadRequest, []string{BatchItemFailed, BatchItemFailed}},
+		{"best effort", "best_effort", []VehicleJSON{valid, invalid, existing}, http.StatusMultiStatus, []string{BatchItemCreated, BatchItemFailed, BatchItemFailed}},
+		{"unknown mode", "some", []VehicleJSON{valid}, http.StatusBadRequest, nil},
+	}
+	for _, c := range cases {
+		rt, _ := newTestRouter(t, newTestVehicle(1))
+		b, err := json.Marshal(c.items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := serve(rt, http.MethodPost, "/vehicles/batch?mode="+c.mode, string(b), "Content-Type", "application/json")
+		if w.Code != c.status {
+			t.Errorf("%s: expected %d, got %d: %s", c.name, c.status, w.Code, w.Body)
+			continue
+		}
+		if c.results == nil {
+			continue
+		}
+		var body struct {
+			Results []BatchItemResult `json:"results"`
+		}
+		decodeBody(t, w, &body)
+		if len(body.Results) != len(c.results) {
+			t.Errorf("%s: expected %d results, got %+v", c.name, len(c.results), body.Results)
+			continue
+		}
+		for i, status := range c.results {
+			if body.Results[i].Status != status {
+				t.Errorf("%s: expected item %d %s, got %+v", c.name, i, status, body.Results[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"app/internal"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootcamp-go/web/response"
+)
+
+// etag is a function that returns the entity tag of a vehicle: its version and a hash of its representation,
+// quoted. The version alone does not identify the vehicle, as a purged vehicle can be added again with the same id
+// and version but other attributes
+func etag(v internal.Vehicle) string {
+	b, _ := json.Marshal(serializeVehicle(v))
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return `"` + strconv.Itoa(v.Version) + "-" + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+// etagMatches is a function that returns if a list of entity tags (the value of If-Match or If-None-Match)
+// matches an entity tag. "*" matches any entity tag
+// The strong comparison, used by If-Match, never matches weak tags (W/"..."); the weak comparison, used by
+// If-None-Match, ignores the weak prefix
+func etagMatches(list, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// respondVehicle is a function that responds with a vehicle and its ETag, or with 304 Not Modified when the
+// request has an If-None-Match that matches it
+func respondVehicle(w http.ResponseWriter, r *http.Request, v internal.Vehicle) {
+	tag := etag(v)
+	w.Header().Set("ETag", tag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, tag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.JSON(w, http.StatusOK, map[string]any{
+		"message": "success",
+		"data":    serializeVehicle(v),
+	})
+}
+
+// respondList is a function that responds with a list of vehicles and a weak ETag, or with 304 Not Modified when
+// the request has an If-None-Match that matches it
+// The versions of the vehicles do not identify a list (a purged vehicle can be added again with the same id and
+// version), so the ETag is a hash of the body
+func respondList(w http.ResponseWriter, r *http.Request, body any) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	tag := `"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+
+	w.Header().Set("ETag", "W/"+tag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, tag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// ifMatch is a method that evaluates the If-Match precondition of a change to a vehicle
+// It returns the version the change must be applied to: 0 (any version) without If-Match, or the current version
+// when it matches. Otherwise it responds with 412 Precondition Failed, or an error, and ok is false
+func (h *VehicleDefault) ifMatch(w http.ResponseWriter, r *http.Request, id int) (version int, ok bool) {
+	im := r.Header.Get("If-Match")
+	if im == "" {
+		return 0, true
+	}
+
+	v, err := h.sv.GetById(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, internal.ErrVehicleIdNotFound):
+			// no current representation: no entity tag can match
+			response.Error(w, http.StatusPreconditionFailed, "Vehicle with that id not found")
+		default:
+			response.Error(w, http.StatusInternalServerError, "Internal error")
+		}
+		return 0, false
+	}
+	if !etagMatches(im, etag(v), false) {
+		response.Error(w, http.StatusPreconditionFailed, "The vehicle was changed")
+		return 0, false
+	}
+
+	return v.Version, true
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"app/internal/repository"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tagOf is a function that returns the ETag of the vehicle with an id in the repository
+func tagOf(t *testing.T, rp *repository.VehicleMap, id int) string {
+	t.Helper()
+	v, err := rp.GetById(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return etag(v)
+}
+
+func TestEtagMatches(t *testing.T) {
+	cases := []struct {
+		list     string
+		weak     bool
+		expected bool
+	}{
+		{list: `"1"`, expected: true},
+		{list: `"2", "1"`, expected: true},
+		{list: `*`, expected: true},
+		{list: `"2"`, expected: false},
+		{list: `W/"1"`, expected: false},
+		{list: `W/"1"`, weak: true, expected: true},
+		{list: `"1"`, weak: true, expected: true},
+	}
+	for _, c := range cases {
+		if got := etagMatches(c.list, `"1"`, c.weak); got != c.expected {
+			t.Errorf("%s (weak %t): expected %t, got %t", c.list, c.weak, c.expected, got)
+		}
+	}
+}
+
+func TestVehicleDefault_IfNoneMatch(t *testing.T) {
+	rt, rp := newTestRouter(t, newTestVehicle(1))
+	tag := tagOf(t, rp, 1)
+
+	w := serve(rt, http.MethodGet, "/vehicles/1", "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != tag || !strings.HasPrefix(tag, `"1-`) {
+		t.Fatalf("expected 200 with ETag %s of version 1, got %d %q", tag, w.Code, w.Header().Get("ETag"))
+	}
+	for inm, status := range map[string]int{tag: http.StatusNotModified, "W/" + tag: http.StatusNotModified, `"1"`: http.StatusOK} {
+		w := serve(rt, http.MethodGet, "/vehicles/1", "", "If-None-Match", inm)
+		if w.Code != status {
+			t.Errorf("If-None-Match %s: expected %d, got %d", inm, status, w.Code)
+		}
+		if status == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: expected no body, got %q", inm, w.Body)
+		}
+	}
+	if w := serve(rt, http.MethodGet, "/vehicles/registration/reg-1", "", "If-None-Match", tag); w.Code != http.StatusNotModified {
+		t.Errorf("by registration: expected 304, got %d", w.Code)
+	}
+}
+
+func TestVehicleDefault_ETag_AddedAgain(t *testing.T) {
+	rt, rp := newTestRouter(t, newTestVehicle(1))
+	tag := tagOf(t, rp, 1)
+
+	// the vehicle is purged and another one is added with its id, at the same version
+	if err := rp.DeleteVehicle(1, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.Purge(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVehicle(1)
+	v.Color = "Red"
+	if err := rp.Add(&v); err != nil || v.Version != 1 {
+		t.Fatalf("expected vehicle 1 added again at version 1, got %d, %v", v.Version, err)
+	}
+
+	if w := serve(rt, http.MethodGet, "/vehicles/1", "", "If-None-Match", tag); w.Code != http.StatusOK {
+		t.Errorf("If-None-Match of the purged vehicle: expected 200, got %d", w.Code)
+	}
+	if w := serve(rt, http.MethodDelete, "/vehicles/1", "", "If-Match", tag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match of the purged vehicle: expected 412, got %d", w.Code)
+	}
+}
+
+func TestVehicleDefault_IfNoneMatch_List(t *testing.T) {
+	rt, _ := newTestRouter(t, newTestVehicle(1), newTestVehicle(2))
+
+	for _, target := range []string{"/vehicles", "/vehicles?sort=-year"} {
+		w := serve(rt, http.MethodGet, target, "")
+		tag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || len(tag) < 4 || tag[:2] != "W/" {
+			t.Fatalf("%s: expected 200 with a weak ETag, got %d %q", target, w.Code, tag)
+		}
+		if w := serve(rt, http.MethodGet, target, "", "If-None-Match", tag); w.Code != http.StatusNotModified {
+			t.Fatalf("%s: expected 304, got %d", target, w.Code)
+		}
+	}
+
+	// a change of a vehicle changes the list
+	w := serve(rt, http.MethodGet, "/vehicles?sort=-year", "")
+	if u := serve(rt, http.MethodPatch, "/vehicles/1", `{"color": "Red"}`, "Content-Type", contentTypeMergePatch); u.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", u.Code, u.Body)
+	}
+	if w := serve(rt, http.MethodGet, "/vehicles?sort=-year", "", "If-None-Match", w.Header().Get("ETag")); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 after a change, got %d", w.Code)
+	}
+}
+
+func TestVehicleDefault_IfMatch(t *testing.T) {
+	rt, rp := newTestRouter(t, newTestVehicle(1), newTestVehicle(2))
+	body := `{"brand": "Ford", "model": "Focus", "registration": "REG-1", "color": "Red", "year": 2015, "passengers": 5,
+		"max_speed": 180, "fuel_type": "gasoline", "transmission": "manual", "weight": 120, "height": 150, "length": 400,
+		"width": 180}`
+
+	cases := []struct {
+		name    string
+		ifMatch func(current string) string
+		status  int
+		version string
+	}{
+		{name: "stale tag", ifMatch: func(string) string { return `"0-1"` }, status: http.StatusPreconditionFailed},
+		{name: "version only", ifMatch: func(string) string { return `"1"` }, status: http.StatusPreconditionFailed},
+		{name: "weak tag", ifMatch: func(current string) string { return "W/" + current }, status: http.StatusPreconditionFailed},
+		{name: "current tag", ifMatch: func(current string) string { return current }, status: http.StatusOK, version: "2"},
+		{name: "any tag", ifMatch: func(string) string { return `*` }, status: http.StatusOK, version: "3"},
+		{name: "without If-Match", ifMatch: func(string) string { return "" }, status: http.StatusOK, version: "4"},
+	}
+	for _, c := range cases {
+		headers := []string{"Content-Type", "application/json"}
+		if im := c.ifMatch(tagOf(t, rp, 1)); im != "" {
+			headers = append(headers, "If-Match", im)
+		}
+		w := serve(rt, http.MethodPut, "/vehicles/1", body, headers...)
+		expected := ""
+		if c.status == http.StatusOK {
+			if expected = tagOf(t, rp, 1); !strings.HasPrefix(expected, `"`+c.version+"-") {
+				t.Errorf("%s: expected version %s, got ETag %s", c.name, c.version, expected)
+			}
+		}
+		if w.Code != c.status || w.Header().Get("ETag") != expected {
+			t.Errorf("%s: expected %d with ETag %q of version %s, got %d %q: %s", c.name, c.status, expected, c.version, w.Code, w.Header().Get("ETag"), w.Body)
+		}
+	}
+
+	// deletes, and vehicles that do not exist
+	tag := tagOf(t, rp, 2)
+	if w := serve(rt, http.MethodDelete, "/vehicles/2", "", "If-Match", tagOf(t, rp, 1)); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("delete with the tag of another vehicle: expected 412, got %d", w.Code)
+	}
+	if w := serve(rt, http.MethodDelete, "/vehicles/2", "", "If-Match", tag); w.Code != http.StatusNoContent {
+		t.Errorf("delete with the current tag: expected 204, got %d", w.Code)
+	}
+	if w := serve(rt, http.MethodPut, "/vehicles/9", body, "Content-Type", "application/json", "If-Match", `*`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match of a vehicle that does not exist: expected 412, got %d", w.Code)
+	}
+}
+
+func TestVehicleDefault_AddVehicle_ETag(t *testing.T) {
+	rt, rp := newTestRouter(t)
+	body := `{"id": 1, "brand": "Ford", "model": "Focus", "registration": "REG-1", "color": "Red", "year": 2015,
+		"passengers": 5, "max_speed": 180, "fuel_type": "gasoline", "transmission": "manual", "weight": 120,
+		"height": 150, "length": 400, "width": 180}`
+	w := serve(rt, http.MethodPost, "/vehicles", body, "Content-Type", "application/json")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body)
+	}
+	if tag := tagOf(t, rp, 1); w.Header().Get("ETag") != tag || !strings.HasPrefix(tag, `"1-`) {
+		t.Fatalf("expected ETag %s of version 1, got %q", tag, w.Header().Get("ETag"))
+	}
+	var created struct {
+		Data VehicleJSON `json:"data"`
+	}
+	decodeBody(t, w, &created)
+	if created.Data.Version != 1 {
+		t.Fatalf("expected version 1, got %+v", created.Data)
+	}
+}
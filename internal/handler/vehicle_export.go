@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"app/internal"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootcamp-go/web/response"
+)
+
+const (
+	// ExportNDJSON is the format of the export with a vehicle in JSON format per line
+	ExportNDJSON = "ndjson"
+	// ExportCSV is the format of the export with a vehicle per row, after a header row with the fields
+	ExportCSV = "csv"
+)
+
+const (
+	// contentTypeNDJSON is the content type of ExportNDJSON
+	contentTypeNDJSON = "application/x-ndjson"
+	// contentTypeCSV is the content type of ExportCSV
+	contentTypeCSV = "text/csv"
+	// exportFlushRows is the number of vehicles written between flushes of the response
+	exportFlushRows = 100
+)
+
+// queryParamsExport are the query parameters of the format of an export, the rest are filters
+var queryParamsExport = []string{"format"}
+
+// exportColumns are the columns of ExportCSV, named as the fields in JSON format
+var exportColumns = append(append([]string{}, fieldNames(internal.VehicleFields)...), "version")
+
+// exportFormat is a function that returns the format of an export: the format query parameter, or else the
+// Accept header (NDJSON by default)
+func exportFormat(r *http.Request) (format string, err error) {
+	if format = r.URL.Query().Get("format"); format != "" {
+		if format != ExportNDJSON && format != ExportCSV {
+			err = fmt.Errorf("%w: unknown format %q, it must be %s or %s", internal.ErrInvalidQuery, format, ExportNDJSON, ExportCSV)
+		}
+		return
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case accept == "":
+		return ExportNDJSON, nil
+	case strings.Contains(accept, contentTypeCSV):
+		return ExportCSV, nil
+	case strings.Contains(accept, contentTypeNDJSON), strings.Contains(accept, "application/ndjson"),
+		strings.Contains(accept, "*/*"):
+		return ExportNDJSON, nil
+	}
+	return "", errNotAcceptable
+}
+
+// errNotAcceptable is the error of an Accept header without any format of the export
+var errNotAcceptable = errors.New("not acceptable")
+
+// Export is a method that streams the vehicles that satisfy some filters, sorted by id, as NDJSON or CSV
+// The response is written and flushed as the vehicles are read, so it starts with the first vehicle
+// Pattern GET /vehicles/export (filters as in parseVehicleQuery, format=ndjson|csv or the Accept header)
+func (h *VehicleDefault) Export() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		format, err := exportFormat(r)
+		switch {
+		case errors.Is(err, errNotAcceptable):
+			response.Error(w, http.StatusNotAcceptable, "The export is available as "+contentTypeNDJSON+" or "+contentTypeCSV)
+			return
+		case err != nil:
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filters, err := parseVehicleFilters(r.URL.Query(), queryParamsExport...)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// process
+		ew := newExportWriter(w, format)
+		err = h.sv.Stream(filters, ew.Write)
+		if err == nil {
+			err = ew.Close()
+		}
+
+		// response: the status can only change before the stream starts
+		if err != nil && !ew.started {
+			switch {
+			case errors.Is(err, internal.ErrInvalidQuery):
+				response.Error(w, http.StatusBadRequest, err.Error())
+			default:
+				response.Error(w, http.StatusInternalServerError, "Internal error")
+			}
+		}
+	}
+}
+
+// exportWriter is a struct that writes the vehicles of an export to a response
+type exportWriter struct {
+	// w is the response
+	w http.ResponseWriter
+	// rc flushes the response
+	rc *http.ResponseController
+	// format is the format of the export
+	format string
+	// started is true once the status and the headers are written
+	started bool
+	// rows is the number of vehicles written since the last flush
+	rows int
+	// enc writes ExportNDJSON
+	enc *json.Encoder
+	// cw writes ExportCSV
+	cw *csv.Writer
+}
+
+// newExportWriter is a function that returns a new exportWriter for a response
+func newExportWriter(w http.ResponseWriter, format string) *exportWriter {
+	return &exportWriter{w: w, rc: http.NewResponseController(w), format: format}
+}
+
+// start is a method that writes the status, the headers and, in ExportCSV, the header row
+func (ew *exportWriter) start() error {
+	ew.started = true
+	switch ew.format {
+	case ExportCSV:
+		ew.w.Header().Set("Content-Type", contentTypeCSV+"; charset=utf-8")
+		ew.w.Header().Set("Content-Disposition", `attachment; filename="vehicles.csv"`)
+		ew.w.WriteHeader(http.StatusOK)
+		ew.cw = csv.NewWriter(ew.w)
+		return ew.cw.Write(exportColumns)
+	default:
+		ew.w.Header().Set("Content-Type", contentTypeNDJSON)
+		ew.w.WriteHeader(http.StatusOK)
+		ew.enc = json.NewEncoder(ew.w)
+		return nil
+	}
+}
+
+// Write is a method that writes a vehicle, flushing the response every exportFlushRows vehicles
+func (ew *exportWriter) Write(v internal.Vehicle) (err error) {
+	if !ew.started {
+		if err = ew.start(); err != nil {
+			return
+		}
+	}
+
+	switch ew.format {
+	case ExportCSV:
+		err = ew.cw.Write(vehicleRecord(v))
+	default:
+		err = ew.enc.Encode(serializeVehicle(v))
+	}
+	if err != nil {
+		return
+	}
+
+	ew.rows++
+	if ew.rows >= exportFlushRows {
+		err = ew.flush()
+	}
+	return
+}
+
+// Close is a method that writes what is pending: the headers of an empty export, or the last vehicles
+func (ew *exportWriter) Close() (err error) {
+	if !ew.started {
+		if err = ew.start(); err != nil {
+			return
+		}
+	}
+	err = ew.flush()
+	return
+}
+
+// flush is a method that sends the vehicles written to the client
+func (ew *exportWriter) flush() (err error) {
+	ew.rows = 0
+	if ew.cw != nil {
+		ew.cw.Flush()
+		if err = ew.cw.Error(); err != nil {
+			return
+		}
+	}
+	// a response that can not be flushed is sent when the handler returns
+	if err = ew.rc.Flush(); errors.Is(err, http.ErrNotSupported) {
+		err = nil
+	}
+	return
+}
+
+// vehicleRecord is a function that returns the CSV record of a vehicle, in the order of exportColumns
+func vehicleRecord(v internal.Vehicle) []string {
+	record := make([]string, 0, len(exportColumns))
+	for _, f := range internal.VehicleFields {
+		record = append(record, formatValue(f.Value(v)))
+	}
+	return append(record, strconv.Itoa(v.Version))
+}
+
+// formatValue is a function that returns the text of a value of a field
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// fieldNames is a function that returns the names of some fields
+func fieldNames(fields []internal.VehicleField) []string {
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, string(f))
+	}
+	return names
+}
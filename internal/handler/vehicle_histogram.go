@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bootcamp-go/web/response"
+)
+
+// queryParamsHistogram are the query parameters of the field, groups and buckets of a histogram, the rest are filters
+var queryParamsHistogram = []string{"field", "group_by", "mode", "buckets", "width"}
+
+// HistogramGroupJSON is a struct that represents the histogram of a group of vehicles in JSON format
+type HistogramGroupJSON struct {
+	// Group are the values of the fields the vehicles are grouped by
+	Group map[string]any `json:"group"`
+	// Count is the number of vehicles
+	Count int `json:"count"`
+	// Buckets are the buckets, from the least to the greatest values
+	Buckets []HistogramBucketJSON `json:"buckets"`
+}
+
+// HistogramBucketJSON is a struct that represents a bucket of a histogram in JSON format
+type HistogramBucketJSON struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+}
+
+// parseVehicleHistogram is a function that parses the query parameters of a histogram
+//   - filters: as in parseVehicleQuery
+//   - field: field=weight, a numeric field (required)
+//   - groups: group_by=field1,field2 as in parseVehicleAggregation
+//   - buckets: mode=fixed|quantile, buckets=n, and width=w for fixed buckets aligned to multiples of w
+func parseVehicleHistogram(values url.Values) (h internal.VehicleHistogram, err error) {
+	// filters
+	h.Filters, err = parseVehicleFilters(values, queryParamsHistogram...)
+	if err != nil {
+		return
+	}
+
+	// field and groups
+	h.Field = internal.VehicleField(values.Get("field"))
+	if h.Field == "" {
+		err = fmt.Errorf("%w: field is required", internal.ErrInvalidQuery)
+		return
+	}
+	h.GroupBy = make([]internal.VehicleField, 0)
+	if groupBy := values.Get("group_by"); groupBy != "" {
+		for _, g := range strings.Split(groupBy, ",") {
+			h.GroupBy = append(h.GroupBy, internal.VehicleField(g))
+		}
+	}
+
+	// buckets
+	h.Mode = internal.HistogramMode(values.Get("mode"))
+	if buckets := values.Get("buckets"); buckets != "" {
+		if h.Buckets, err = strconv.Atoi(buckets); err != nil || h.Buckets <= 0 {
+			err = fmt.Errorf("%w: buckets must be a positive number", internal.ErrInvalidQuery)
+			return
+		}
+	}
+	if width := values.Get("width"); width != "" {
+		if h.Width, err = strconv.ParseFloat(width, 64); err != nil || h.Width <= 0 {
+			err = fmt.Errorf("%w: width must be a positive number", internal.ErrInvalidQuery)
+			return
+		}
+	}
+
+	err = h.Validate()
+	return
+}
+
+// Histogram is a method that returns the histograms of a numeric field of the groups of the vehicles that
+// satisfy some filters
+// Pattern GET /vehicles/histogram (see parseVehicleHistogram)
+func (h *VehicleDefault) Histogram() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		hg, err := parseVehicleHistogram(r.URL.Query())
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// process
+		groups, err := h.sv.Histogram(hg)
+		if err != nil {
+			switch {
+			case errors.Is(err, internal.ErrInvalidQuery):
+				response.Error(w, http.StatusBadRequest, err.Error())
+			default:
+				response.Error(w, http.StatusInternalServerError, "Internal error")
+			}
+			return
+		}
+
+		// response
+		data := make([]HistogramGroupJSON, 0, len(groups))
+		for _, g := range groups {
+			gj := HistogramGroupJSON{
+				Group:   make(map[string]any, len(hg.GroupBy)),
+				Count:   g.Count,
+				Buckets: make([]HistogramBucketJSON, 0, len(g.Buckets)),
+			}
+			for i, f := range hg.GroupBy {
+				gj.Group[string(f)] = g.Keys[i]
+			}
+			for _, b := range g.Buckets {
+				gj.Buckets = append(gj.Buckets, HistogramBucketJSON{Lower: b.Lower, Upper: b.Upper, Count: b.Count})
+			}
+			data = append(data, gj)
+		}
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message":  "success",
+			"data":     data,
+			"field":    hg.Field,
+			"group_by": hg.GroupBy,
+		})
+	}
+}
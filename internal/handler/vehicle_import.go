@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootcamp-go/web/response"
+)
+
+// ImportReportJSON is a struct that represents the report of an import in JSON format
+type ImportReportJSON struct {
+	DryRun     bool                  `json:"dry_run"`
+	Rows       int                   `json:"rows"`
+	Created    int                   `json:"created"`
+	Rejected   int                   `json:"rejected"`
+	Rejections []ImportRejectionJSON `json:"rejections"`
+	Truncated  bool                  `json:"truncated"`
+}
+
+// ImportRejectionJSON is a struct that represents a rejected row of an import in JSON format
+type ImportRejectionJSON struct {
+	Row          int             `json:"row"`
+	ID           int             `json:"id,omitempty"`
+	Registration string          `json:"registration,omitempty"`
+	Error        string          `json:"error"`
+	Errors       []ViolationJSON `json:"errors,omitempty"`
+}
+
+// serializeImportReport is a function that returns the JSON representation of the report of an import
+func serializeImportReport(r internal.ImportReport) ImportReportJSON {
+	rj := ImportReportJSON{
+		DryRun:     r.DryRun,
+		Rows:       r.Rows,
+		Created:    r.Created,
+		Rejected:   r.Rejected,
+		Rejections: make([]ImportRejectionJSON, 0, len(r.Rejections)),
+		Truncated:  r.Truncated,
+	}
+	for _, rejection := range r.Rejections {
+		item := ImportRejectionJSON{
+			Row:          rejection.Row,
+			ID:           rejection.Id,
+			Registration: rejection.Registration,
+			Error:        rejection.Err.Error(),
+		}
+		var validationErr *internal.ValidationError
+		if errors.As(rejection.Err, &validationErr) {
+			item.Errors = serializeViolations(validationErr)
+		}
+		rj.Rejections = append(rj.Rejections, item)
+	}
+	return rj
+}
+
+// importReader is a function that returns the reader of the vehicles of the body of an import
+//   - format: the format query parameter (csv or ndjson), or else the Content-Type (text/csv or application/x-ndjson)
+//   - CSV: columns=column1:field1,column2:field2 maps the columns of the header to fields, and delimiter=; sets
+//     the delimiter of the values
+func importReader(r *http.Request) (vr internal.VehicleReader, err error) {
+	values := r.URL.Query()
+
+	// format
+	format := values.Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case contentTypeCSV:
+			format = ExportCSV
+		case contentTypeNDJSON, "application/ndjson":
+			format = ExportNDJSON
+		}
+	}
+
+	switch format {
+	case ExportNDJSON:
+		vr = loader.NewVehicleNDJSONReader(r.Body)
+	case ExportCSV:
+		var cfg *loader.ConfigVehicleCSV
+		if cfg, err = parseCSVConfig(values); err != nil {
+			return
+		}
+		vr = loader.NewVehicleCSVReader(r.Body, cfg)
+	default:
+		err = fmt.Errorf("the format must be %s or %s, as the format query parameter or the Content-Type", ExportCSV, ExportNDJSON)
+	}
+	return
+}
+
+// parseCSVConfig is a function that parses the configuration of a CSV import of the query parameters
+func parseCSVConfig(values url.Values) (cfg *loader.ConfigVehicleCSV, err error) {
+	cfg = &loader.ConfigVehicleCSV{}
+	if columns := values.Get("columns"); columns != "" {
+		cfg.Columns = make(map[string]internal.VehicleField)
+		for _, pair := range strings.Split(columns, ",") {
+			column, field, ok := strings.Cut(pair, ":")
+			if !ok || column == "" || !internal.VehicleField(field).Valid() {
+				err = fmt.Errorf("invalid column mapping %q, it must be column:field with a known field", pair)
+				return
+			}
+			cfg.Columns[column] = internal.VehicleField(field)
+		}
+	}
+	if delimiter := values.Get("delimiter"); delimiter != "" {
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || r == '"' || r == '\n' || r == '\r' {
+			err = fmt.Errorf("invalid delimiter %q, it must be a single character", delimiter)
+			return
+		}
+		cfg.Comma = r
+	}
+	return
+}
+
+// Import is a method that adds the vehicles of a CSV or NDJSON body, read as a stream, and responds with a report
+// of the rows created and rejected. With dry_run=true the vehicles are only checked
+// Pattern POST /vehicles/import (see importReader)
+func (h *VehicleDefault) Import() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		dryRun := false
+		if d := r.URL.Query().Get("dry_run"); d != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(d); err != nil {
+				response.Error(w, http.StatusBadRequest, "Invalid dry_run, it must be true or false")
+				return
+			}
+		}
+		vr, err := importReader(r)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// process
+		report, err := h.sv.Import(vr, dryRun)
+		if err != nil {
+			switch {
+			case errors.Is(err, loader.ErrInvalidColumns):
+				response.Error(w, http.StatusBadRequest, err.Error())
+			default:
+				// the body could not be read, the report has the rows processed until then
+				response.JSON(w, http.StatusBadRequest, map[string]any{
+					"message": "The import stopped: " + err.Error(),
+					"data":    serializeImportReport(report),
+				})
+			}
+			return
+		}
+
+		// response
+		message := "vehicles imported"
+		if dryRun {
+			message = "vehicles checked, nothing was created"
+		}
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": message,
+			"data":    serializeImportReport(report),
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch is the error returned when a patch is malformed or can not be applied to the document
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPatchTestFailed is the error returned when a test operation of a JSON Patch does not match
+	ErrPatchTestFailed = errors.New("patch test failed")
+)
+
+const (
+	// contentTypeMergePatch is the media type of a JSON Merge Patch (RFC 7386)
+	contentTypeMergePatch = "application/merge-patch+json"
+	// contentTypeJSONPatch is the media type of a JSON Patch (RFC 6902)
+	contentTypeJSONPatch = "application/json-patch+json"
+	// patchAttempts is the number of times a patch without If-Match is applied when the vehicle changes concurrently
+	patchAttempts = 3
+)
+
+// jsonPatchOperation is a struct that represents an operation of a JSON Patch
+type jsonPatchOperation struct {
+	// Op is the operation: add, remove, replace, move, copy or test
+	Op string `json:"op"`
+	// Path is the JSON Pointer of the target location
+	Path string `json:"path"`
+	// From is the JSON Pointer of the source location of move and copy
+	From string `json:"from"`
+	// Value is the value of add, replace and test
+	Value json.RawMessage `json:"value"`
+}
+
+// patchVehicle is a function that applies a patch to a vehicle, by its media type, and returns the patched vehicle
+// application/json is read as a JSON Merge Patch. The patched document must only have fields of VehicleJSON
+func patchVehicle(v VehicleJSON, contentType string, patch []byte) (p VehicleJSON, err error) {
+	// document
+	var doc any
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return
+	}
+
+	// patch
+	switch contentType {
+	case contentTypeMergePatch, "application/json":
+		var mp any
+		if err = json.Unmarshal(patch, &mp); err != nil {
+			err = fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+			return
+		}
+		doc = mergePatch(doc, mp)
+	case contentTypeJSONPatch:
+		var ops []jsonPatchOperation
+		if err = json.Unmarshal(patch, &ops); err != nil {
+			err = fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+			return
+		}
+		if doc, err = applyJSONPatch(doc, ops); err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf("%w: unsupported media type %q", ErrInvalidPatch, contentType)
+		return
+	}
+
+	// patched vehicle
+	if b, err = json.Marshal(doc); err != nil {
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&p); err != nil {
+		err = fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+	return
+}
+
+// mergePatch is a function that applies a JSON Merge Patch (RFC 7386) to a document
+// A null member of the patch removes the member from the document
+func mergePatch(doc, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	d, ok := doc.(map[string]any)
+	if !ok {
+		d = make(map[string]any)
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(d, key)
+			continue
+		}
+		d[key] = mergePatch(d[key], value)
+	}
+	return d
+}
+
+// applyJSONPatch is a function that applies the operations of a JSON Patch (RFC 6902) to a document, in order
+// If an operation fails the document is not changed and the error says which one
+func applyJSONPatch(doc any, ops []jsonPatchOperation) (any, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = applyJSONPatchOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+// applyJSONPatchOperation is a function that applies an operation of a JSON Patch to a document
+// Containers are copied before they are changed, so the original document is never modified
+func applyJSONPatchOperation(doc any, op jsonPatchOperation) (any, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: %s needs a value", ErrInvalidPatch, op.Op)
+		}
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+		}
+		switch op.Op {
+		case "add":
+			return jsonAdd(doc, path, value)
+		case "replace":
+			if _, err := jsonGet(doc, path); err != nil {
+				return nil, err
+			}
+			doc, _ = jsonRemove(doc, path)
+			return jsonAdd(doc, path, value)
+		default:
+			current, err := jsonGet(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !jsonEqual(current, value) {
+				return nil, fmt.Errorf("%w: %s", ErrPatchTestFailed, op.Path)
+			}
+			return doc, nil
+		}
+	case "remove":
+		return jsonRemove(doc, path)
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := jsonGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("%w: can not move %s into itself", ErrInvalidPatch, op.From)
+			}
+			if doc, err = jsonRemove(doc, from); err != nil {
+				return nil, err
+			}
+		}
+		return jsonAdd(doc, path, value)
+	}
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+}
+
+// parseJSONPointer is a function that returns the reference tokens of a JSON Pointer (RFC 6901)
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid path %q", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// jsonGet is a function that returns the value at a path of a document
+func jsonGet(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q not found", ErrInvalidPatch, token)
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%w: %q not found", ErrInvalidPatch, token)
+		}
+	}
+	return doc, nil
+}
+
+// jsonAdd is a function that returns the document with a value added at a path
+// A member of an object is set, and an element of an array is inserted ("-" appends)
+func jsonAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+	switch node := doc.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(node)+1)
+		for k, v := range node {
+			c[k] = v
+		}
+		if len(path) == 1 {
+			c[token] = value
+			return c, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q not found", ErrInvalidPatch, token)
+		}
+		child, err := jsonAdd(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		c[token] = child
+		return c, nil
+	case []any:
+		if len(path) == 1 {
+			i := len(node)
+			if token != "-" {
+				var err error
+				if i, err = arrayIndex(token, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			c := make([]any, 0, len(node)+1)
+			c = append(c, node[:i]...)
+			c = append(c, value)
+			return append(c, node[i:]...), nil
+		}
+		i, err := arrayIndex(token, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := jsonAdd(node[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		c := append([]any(nil), node...)
+		c[i] = child
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %q not found", ErrInvalidPatch, token)
+}
+
+// jsonRemove is a function that returns the document without the value at a path
+func jsonRemove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: can not remove the whole document", ErrInvalidPatch)
+	}
+	token := path[0]
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q not found", ErrInvalidPatch, token)
+		}
+		c := make(map[string]any, len(node))
+		for k, v := range node {
+			c[k] = v
+		}
+		if len(path) == 1 {
+			delete(c, token)
+			return c, nil
+		}
+		child, err := jsonRemove(child, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		c[token] = child
+		return c, nil
+	case []any:
+		i, err := arrayIndex(token, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			c := make([]any, 0, len(node)-1)
+			c = append(c, node[:i]...)
+			return append(c, node[i+1:]...), nil
+		}
+		child, err := jsonRemove(node[i], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		c := append([]any(nil), node...)
+		c[i] = child
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %q not found", ErrInvalidPatch, token)
+}
+
+// arrayIndex is a function that parses the index of an array element, from 0 to max
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	return i, nil
+}
+
+// jsonEqual is a function that returns if two decoded JSON values are equal
+func jsonEqual(a, b any) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
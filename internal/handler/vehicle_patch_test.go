@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPatchVehicle_MergePatch(t *testing.T) {
+	v := serializeVehicle(newTestVehicle(1))
+
+	// members are replaced, and removed by null
+	p, err := patchVehicle(v, contentTypeMergePatch, []byte(`{"color": "Red", "max_speed": 150, "model": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := v
+	expected.Color, expected.MaxSpeed, expected.Model = "Red", 150, ""
+	if p != expected {
+		t.Fatalf("expected %+v, got %+v", expected, p)
+	}
+
+	// application/json is a merge patch too, and the members must be fields of the vehicle
+	if _, err = patchVehicle(v, "application/json", []byte(`{"owner": "Alice"}`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Fatalf("expected ErrInvalidPatch for an unknown field, got %v", err)
+	}
+	if _, err = patchVehicle(v, contentTypeMergePatch, []byte(`{"color": `)); !errors.Is(err, ErrInvalidPatch) {
+		t.Fatalf("expected ErrInvalidPatch for malformed JSON, got %v", err)
+	}
+	if _, err = patchVehicle(v, "text/plain", []byte(`{}`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Fatalf("expected ErrInvalidPatch for another media type, got %v", err)
+	}
+}
+
+func TestPatchVehicle_JSONPatch(t *testing.T) {
+	v := serializeVehicle(newTestVehicle(1))
+
+	cases := []struct {
+		name   string
+		patch  string
+		change func(v *VehicleJSON)
+		err    error
+	}{
+		{
+			name:   "test then replace",
+			patch:  `[{"op": "test", "path": "/color", "value": "Blue"}, {"op": "replace", "path": "/color", "value": "Red"}]`,
+			change: func(v *VehicleJSON) { v.Color = "Red" },
+		},
+		{
+			name:   "move",
+			patch:  `[{"op": "move", "from": "/brand", "path": "/model"}]`,
+			change: func(v *VehicleJSON) { v.Model, v.Brand = v.Brand, "" },
+		},
+		{
+			name:   "copy",
+			patch:  `[{"op": "copy", "from": "/brand", "path": "/model"}]`,
+			change: func(v *VehicleJSON) { v.Model = v.Brand },
+		},
+		{
+			name:   "add and remove",
+			patch:  `[{"op": "add", "path": "/transmission", "value": "automatic"}, {"op": "remove", "path": "/fuel_type"}]`,
+			change: func(v *VehicleJSON) { v.Transmission, v.FuelType = "automatic", "" },
+		},
+		{
+			name:  "test after a replace",
+			patch: `[{"op": "replace", "path": "/color", "value": "Red"}, {"op": "test", "path": "/color", "value": "Blue"}]`,
+			err:   ErrPatchTestFailed,
+		},
+		{name: "path without a leading slash", patch: `[{"op": "replace", "path": "color", "value": "Red"}]`, err: ErrInvalidPatch},
+		{name: "replace of a missing member", patch: `[{"op": "replace", "path": "/owner", "value": "Alice"}]`, err: ErrInvalidPatch},
+		{name: "add of an unknown field", patch: `[{"op": "add", "path": "/owner", "value": "Alice"}]`, err: ErrInvalidPatch},
+		{name: "remove of a missing member", patch: `[{"op": "remove", "path": "/owner"}]`, err: ErrInvalidPatch},
+		{name: "add without a value", patch: `[{"op": "add", "path": "/color"}]`, err: ErrInvalidPatch},
+		{name: "unknown operation", patch: `[{"op": "rename", "path": "/color"}]`, err: ErrInvalidPatch},
+		{name: "not a list of operations", patch: `{"op": "remove", "path": "/color"}`, err: ErrInvalidPatch},
+	}
+	for _, c := range cases {
+		p, err := patchVehicle(v, contentTypeJSONPatch, []byte(c.patch))
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		expected := v
+		c.change(&expected)
+		if p != expected {
+			t.Errorf("%s: expected %+v, got %+v", c.name, expected, p)
+		}
+	}
+}
+
+func TestParseJSONPointer(t *testing.T) {
+	tokens, err := parseJSONPointer("/a~1b/c~0d/0")
+	if err != nil || !reflect.DeepEqual(tokens, []string{"a/b", "c~d", "0"}) {
+		t.Fatalf("unexpected tokens %q, %v", tokens, err)
+	}
+	if tokens, err = parseJSONPointer(""); err != nil || tokens != nil {
+		t.Fatalf("expected the whole document, got %q, %v", tokens, err)
+	}
+}
+
+func TestVehicleDefault_Patch(t *testing.T) {
+	rt, rp := newTestRouter(t, newTestVehicle(1), newTestVehicle(2))
+
+	// patched, at the next version
+	w := serve(rt, http.MethodPatch, "/vehicles/1", `{"color": "Red"}`, "Content-Type", contentTypeMergePatch)
+	if tag := tagOf(t, rp, 1); w.Code != http.StatusOK || w.Header().Get("ETag") != tag || !strings.HasPrefix(tag, `"2-`) {
+		t.Fatalf("expected 200 with ETag %s, got %d %q: %s", tag, w.Code, w.Header().Get("ETag"), w.Body)
+	}
+	var body struct {
+		Data VehicleJSON `json:"data"`
+	}
+	decodeBody(t, w, &body)
+	if body.Data.Color != "Red" || body.Data.Version != 2 {
+		t.Fatalf("unexpected vehicle %+v", body.Data)
+	}
+
+	for _, c := range []struct {
+		name, contentType, patch string
+		status                   int
+	}{
+		{"null removes a required field", contentTypeMergePatch, `{"model": null}`, http.StatusBadRequest},
+		{"failed test", contentTypeJSONPatch, `[{"op": "test", "path": "/color", "value": "Blue"}]`, http.StatusConflict},
+		{"invalid path", contentTypeJSONPatch, `[{"op": "remove", "path": "/owner"}]`, http.StatusBadRequest},
+		{"id changed", contentTypeMergePatch, `{"id": 3}`, http.StatusBadRequest},
+		{"registration of another vehicle", contentTypeMergePatch, `{"registration": "reg-2"}`, http.StatusConflict},
+		{"unsupported media type", "text/plain", `{}`, http.StatusUnsupportedMediaType},
+	} {
+		if w := serve(rt, http.MethodPatch, "/vehicles/1", c.patch, "Content-Type", c.contentType); w.Code != c.status {
+			t.Errorf("%s: expected %d, got %d: %s", c.name, c.status, w.Code, w.Body)
+		}
+	}
+	if w := serve(rt, http.MethodPatch, "/vehicles/9", `{}`, "Content-Type", contentTypeMergePatch); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown vehicle, got %d", w.Code)
+	}
+}
+
+// conflictingService is a vehicle service whose vehicles change between every read and update
+type conflictingService struct {
+	internal.VehicleService
+	// conflicts is the number of updates that fail with a version mismatch
+	conflicts int
+	// updates is the number of updates
+	updates int
+}
+
+// GetById is a method that returns the vehicle, at a version that changes with every update
+func (s *conflictingService) GetById(id int) (internal.Vehicle, error) {
+	v := newTestVehicle(id)
+	v.Version = s.updates + 1
+	return v, nil
+}
+
+// Update is a method that fails with a version mismatch until there are no conflicts left
+func (s *conflictingService) Update(v *internal.Vehicle) error {
+	s.updates++
+	if s.updates <= s.conflicts {
+		return internal.ErrVehicleVersionMismatch
+	}
+	v.Version++
+	return nil
+}
+
+func TestVehicleDefault_Patch_Conflicts(t *testing.T) {
+	patch := func(sv *conflictingService, headers ...string) int {
+		rt := chi.NewRouter()
+		rt.Patch("/vehicles/{id}", NewVehicleDefault(sv).Patch())
+		headers = append(headers, "Content-Type", contentTypeMergePatch)
+		return serve(rt, http.MethodPatch, "/vehicles/1", `{"color": "Red"}`, headers...).Code
+	}
+
+	// retried until it applies
+	sv := &conflictingService{conflicts: patchAttempts - 1}
+	if status := patch(sv); status != http.StatusOK || sv.updates != patchAttempts {
+		t.Fatalf("expected 200 after %d attempts, got %d after %d", patchAttempts, status, sv.updates)
+	}
+
+	// up to patchAttempts
+	sv = &conflictingService{conflicts: patchAttempts}
+	if status := patch(sv); status != http.StatusPreconditionFailed || sv.updates != patchAttempts {
+		t.Fatalf("expected 412 after %d attempts, got %d after %d", patchAttempts, status, sv.updates)
+	}
+
+	// never with If-Match
+	sv = &conflictingService{conflicts: 1}
+	current, _ := sv.GetById(1)
+	if status := patch(sv, "If-Match", etag(current)); status != http.StatusPreconditionFailed || sv.updates != 1 {
+		t.Fatalf("expected 412 after 1 attempt, got %d after %d", status, sv.updates)
+	}
+}
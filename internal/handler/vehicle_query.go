@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"app/internal"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// queryParamsPage are the query parameters of the page of a list query, the rest are filters
+var queryParamsPage = []string{"sort", "limit", "offset"}
+
+// parseVehicleQuery is a function that parses the query parameters of a list query
+//   - filters: field=value (equal), field[op]=value with op in eq, ne, gt, gte, lt, lte, and field[in]=v1,v2
+//   - sort: sort=field1,-field2 (a leading - sorts from the greatest to the least value)
+//   - page: limit=n&offset=n
+func parseVehicleQuery(values url.Values) (q internal.VehicleQuery, err error) {
+	// filters
+	q.Filters, err = parseVehicleFilters(values, queryParamsPage...)
+	if err != nil {
+		return
+	}
+
+	// sort
+	if sort := values.Get("sort"); sort != "" {
+		for _, key := range strings.Split(sort, ",") {
+			s := internal.VehicleSort{Field: internal.VehicleField(strings.TrimPrefix(key, "-")), Desc: strings.HasPrefix(key, "-")}
+			if !s.Field.Valid() {
+				err = fmt.Errorf("%w: unknown sort field %q", internal.ErrInvalidQuery, s.Field)
+				return
+			}
+			q.Sort = append(q.Sort, s)
+		}
+	}
+
+	// page
+	if limit := values.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 0 {
+			err = fmt.Errorf("%w: limit must be a non-negative integer", internal.ErrInvalidQuery)
+			return
+		}
+	}
+	if offset := values.Get("offset"); offset != "" {
+		if q.Offset, err = strconv.Atoi(offset); err != nil || q.Offset < 0 {
+			err = fmt.Errorf("%w: offset must be a non-negative integer", internal.ErrInvalidQuery)
+			return
+		}
+	}
+
+	return
+}
+
+// parseVehicleFilters is a function that parses the filters of the query parameters, ignoring the reserved ones
+// Every parameter that is not reserved must be a filter
+func parseVehicleFilters(values url.Values, reserved ...string) (filters []internal.VehicleFilter, err error) {
+	for key, params := range values {
+		if isReserved(key, reserved) {
+			continue
+		}
+
+		// field and operator: field or field[op]
+		field, operator := key, internal.FilterEq
+		if i := strings.Index(key, "["); i >= 0 && strings.HasSuffix(key, "]") {
+			field, operator = key[:i], internal.FilterOperator(key[i+1:len(key)-1])
+		}
+		f := internal.VehicleFilter{Field: internal.VehicleField(field), Operator: operator}
+		if !f.Field.Valid() {
+			err = fmt.Errorf("%w: unknown field %q", internal.ErrInvalidQuery, field)
+			return
+		}
+
+		// a repeated parameter is a filter for each value
+		for _, param := range params {
+			raw := []string{param}
+			if operator == internal.FilterIn {
+				raw = strings.Split(param, ",")
+			}
+
+			f.Values = make([]any, 0, len(raw))
+			for _, r := range raw {
+				var value any
+				if value, err = f.Field.ParseValue(r); err != nil {
+					return
+				}
+				f.Values = append(f.Values, value)
+			}
+			if err = f.Validate(); err != nil {
+				return
+			}
+			filters = append(filters, f)
+		}
+	}
+
+	return
+}
+
+// isReserved is a function that returns if a query parameter is in the reserved list
+func isReserved(key string, reserved []string) bool {
+	for _, r := range reserved {
+		if key == r {
+			return true
+		}
+	}
+	return false
+}
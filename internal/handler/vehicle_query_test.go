@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVehicleQuery(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected internal.VehicleQuery
+	}{
+		{
+			query: "brand=Ford",
+			expected: internal.VehicleQuery{Filters: []internal.VehicleFilter{
+				{Field: internal.VehicleFieldBrand, Operator: internal.FilterEq, Values: []any{"Ford"}},
+			}},
+		},
+		{
+			query: "year[gte]=2010&sort=-year,brand&limit=0&offset=20",
+			expected: internal.VehicleQuery{
+				Filters: []internal.VehicleFilter{
+					{Field: internal.VehicleFieldFabricationYear, Operator: internal.FilterGte, Values: []any{2010}},
+				},
+				Sort: []internal.VehicleSort{
+					{Field: internal.VehicleFieldFabricationYear, Desc: true},
+					{Field: internal.VehicleFieldBrand},
+				},
+				Offset: 20,
+			},
+		},
+		{
+			query: "max_speed[lt]=150.5&max_speed[lt]=200",
+			expected: internal.VehicleQuery{Filters: []internal.VehicleFilter{
+				{Field: internal.VehicleFieldMaxSpeed, Operator: internal.FilterLt, Values: []any{150.5}},
+				{Field: internal.VehicleFieldMaxSpeed, Operator: internal.FilterLt, Values: []any{200.0}},
+			}},
+		},
+		{
+			query: "color[in]=Red,Blue",
+			expected: internal.VehicleQuery{Filters: []internal.VehicleFilter{
+				{Field: internal.VehicleFieldColor, Operator: internal.FilterIn, Values: []any{"Red", "Blue"}},
+			}},
+		},
+	}
+	for _, c := range cases {
+		values, err := url.ParseQuery(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := parseVehicleQuery(values)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(q, c.expected) {
+			t.Errorf("%s: expected %+v, got %+v", c.query, c.expected, q)
+		}
+	}
+}
+
+func TestParseVehicleQuery_Invalid(t *testing.T) {
+	for query, message := range map[string]string{
+		"owner=Alice":        `unknown field "owner"`,
+		"year[between]=2010": `unknown operator "between"`,
+		"year[gte]=new":      "year must be a number",
+		"year[in]=2010,new":  "year must be a number",
+		"sort=owner":         `unknown sort field "owner"`,
+		"limit=-1":           "limit must be a non-negative integer",
+		"limit=ten":          "limit must be a non-negative integer",
+		"offset=1.5":         "offset must be a non-negative integer",
+	} {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = parseVehicleQuery(values)
+		if !errors.Is(err, internal.ErrInvalidQuery) || !strings.Contains(err.Error(), message) {
+			t.Errorf("%s: expected %q, got %v", query, message, err)
+		}
+	}
+}
+
+func TestVehicleDefault_GetAll_Query(t *testing.T) {
+	rt, _ := newTestRouter(t, newTestVehicle(1), newTestVehicle(2), newTestVehicle(3))
+
+	// filtered, sorted and paged
+	w := serve(rt, http.MethodGet, "/vehicles?year[gte]=2012&sort=-year&limit=1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Data  []VehicleJSON `json:"data"`
+		Total int           `json:"total"`
+	}
+	decodeBody(t, w, &body)
+	if body.Total != 2 || len(body.Data) != 1 || body.Data[0].ID != 3 {
+		t.Fatalf("expected vehicle 3 of 2, got %+v", body)
+	}
+
+	// bad values are rejected
+	for _, query := range []string{"year[gte]=new", "limit=-1", "owner=Alice"} {
+		if w := serve(rt, http.MethodGet, "/vehicles?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"app/internal/repository"
+	"app/internal/service"
+	"app/internal/validator"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestVehicle is a function that returns a valid vehicle with the given id and a registration derived from it
+func newTestVehicle(id int) internal.Vehicle {
+	return internal.Vehicle{
+		Id: id,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           "Ford",
+			Model:           "Fiesta",
+			Registration:    fmt.Sprintf("REG-%d", id),
+			Color:           "Blue",
+			FabricationYear: 2010 + id,
+			Capacity:        5,
+			MaxSpeed:        180,
+			FuelType:        "gasoline",
+			Transmission:    "manual",
+			Weight:          120,
+			Dimensions:      internal.Dimensions{Height: 150, Length: 400, Width: 180},
+		},
+	}
+}
+
+// newTestRouter is a function that returns a router with the routes of the vehicles, served by the default
+// service on a repository with the vehicles
+func newTestRouter(t *testing.T, vehicles ...internal.Vehicle) (rt chi.Router, rp *repository.VehicleMap) {
+	t.Helper()
+	rp = repository.NewVehicleMap(nil)
+	for i := range vehicles {
+		if err := rp.Add(&vehicles[i]); err != nil {
+			t.Fatalf("seed vehicle %d: %v", vehicles[i].Id, err)
+		}
+	}
+	vc, err := repository.NewVocabularyMap(loader.DefaultVocabularies(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := repository.NewCatalogMap([]internal.Brand{
+		{Name: "Ford", Models: []internal.Model{{Name: "Fiesta"}, {Name: "Focus"}}},
+		{Name: "Toyota", Models: []internal.Model{{Name: "Corolla"}}},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := service.NewVehicleDefault(rp, validator.NewDefaultVehicleRules(), vc, service.NewCatalogDefault(ct, rp))
+	hd := NewVehicleDefault(sv)
+
+	rt = chi.NewRouter()
+	rt.Route("/vehicles", func(rt chi.Router) {
+		rt.Get("/", hd.GetAll())
+		rt.Post("/", hd.AddVehicle())
+		rt.Get("/aggregate", hd.Aggregate())
+		rt.Get("/histogram", hd.Histogram())
+		rt.Get("/{id}", hd.GetById())
+		rt.Get("/registration/{registration}", hd.GetByRegistration())
+		rt.Post("/batch", hd.AddVehiclesByBatch())
+		rt.Put("/{id}/update_speed", hd.UpdateSpeed())
+		rt.Delete("/{id}", hd.DeleteVehicle())
+		rt.Put("/{id}", hd.Update())
+		rt.Patch("/{id}", hd.Patch())
+	})
+	return
+}
+
+// serve is a function that sends a request to the router, with the headers given as name and value pairs,
+// and returns the response
+func serve(rt http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	return w
+}
+
+// decodeBody is a function that decodes the JSON body of a response, failing the test on error
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+}
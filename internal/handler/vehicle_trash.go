@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootcamp-go/web/response"
+	"github.com/go-chi/chi/v5"
+)
+
+// TrashedVehicleJSON is a struct that represents a vehicle in the trash in JSON format
+type TrashedVehicleJSON struct {
+	VehicleJSON
+	DeletedAt    time.Time `json:"deleted_at"`
+	DeleteReason string    `json:"delete_reason"`
+}
+
+// Trash is a method that returns a handler for the route GET /vehicles/trash
+// It responds with the vehicles in the trash, sorted by id, with when and why they were deleted, and a weak ETag
+func (h *VehicleDefault) Trash() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// process
+		v, err := h.sv.Trash()
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Internal error")
+			return
+		}
+
+		// response
+		data := make([]TrashedVehicleJSON, 0, len(v))
+		for _, vh := range v {
+			data = append(data, TrashedVehicleJSON{
+				VehicleJSON:  serializeVehicle(vh),
+				DeletedAt:    vh.Deletion.At,
+				DeleteReason: vh.Deletion.Reason,
+			})
+		}
+		respondList(w, r, map[string]any{
+			"message": "success",
+			"data":    data,
+		})
+	}
+}
+
+// Restore is a method that returns a handler for the route POST /vehicles/{id}/restore
+// It moves a vehicle from the trash back to the vehicles, and responds with it and its ETag
+func (h *VehicleDefault) Restore() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || id <= 0 {
+			response.Text(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		// process
+		v, err := h.sv.Restore(id)
+		if err != nil {
+			var validationErr *internal.ValidationError
+			switch {
+			case errors.Is(err, internal.ErrVehicleIdNotFound):
+				response.Error(w, http.StatusNotFound, "Vehicle with that id not found in the trash")
+			case errors.Is(err, internal.ErrVehicleAlreadyExists):
+				response.Error(w, http.StatusConflict, "Another vehicle has the registration of the vehicle")
+			case errors.As(err, &validationErr):
+				respondValidationProblem(w, validationErr)
+			default:
+				response.Error(w, http.StatusInternalServerError, "Internal error")
+			}
+			return
+		}
+
+		// response
+		w.Header().Set("ETag", etag(v))
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "vehicle successfully restored",
+			"data":    serializeVehicle(v),
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"app/internal"
+	"errors"
+	"net/http"
+
+	"github.com/bootcamp-go/web/request"
+	"github.com/bootcamp-go/web/response"
+	"github.com/go-chi/chi/v5"
+)
+
+// VocabularyJSON is a struct that represents a vocabulary in JSON format
+type VocabularyJSON struct {
+	Field string     `json:"field"`
+	Terms []TermJSON `json:"terms"`
+}
+
+// TermJSON is a struct that represents a term of a vocabulary in JSON format
+type TermJSON struct {
+	Value   string   `json:"value"`
+	Aliases []string `json:"aliases"`
+}
+
+// serializeVocabulary is a function that returns the JSON representation of a vocabulary
+func serializeVocabulary(v internal.Vocabulary) VocabularyJSON {
+	vj := VocabularyJSON{Field: string(v.Field), Terms: make([]TermJSON, 0, len(v.Terms))}
+	for _, t := range v.Terms {
+		aliases := t.Aliases
+		if aliases == nil {
+			aliases = []string{}
+		}
+		vj.Terms = append(vj.Terms, TermJSON{Value: t.Value, Aliases: aliases})
+	}
+	return vj
+}
+
+// NewVocabularyDefault is a function that returns a new instance of VocabularyDefault
+func NewVocabularyDefault(sv internal.VocabularyService) *VocabularyDefault {
+	return &VocabularyDefault{sv: sv}
+}
+
+// VocabularyDefault is a struct with methods that represent handlers for vocabularies
+type VocabularyDefault struct {
+	// sv is the service that will be used by the handler
+	sv internal.VocabularyService
+}
+
+// GetAll is a method that returns the vocabularies of fuel type, transmission and color
+// Pattern GET /vocabularies
+func (h *VocabularyDefault) GetAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// process
+		v, err := h.sv.FindAll()
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Internal error")
+			return
+		}
+
+		// response
+		data := make([]VocabularyJSON, 0, len(v))
+		for _, vocabulary := range v {
+			data = append(data, serializeVocabulary(vocabulary))
+		}
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    data,
+		})
+	}
+}
+
+// Get is a method that returns the vocabulary of a field
+// Pattern GET /vocabularies/{field}
+func (h *VocabularyDefault) Get() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		f := internal.VehicleField(chi.URLParam(r, "field"))
+
+		// process
+		v, err := h.sv.Get(f)
+		if err != nil {
+			respondVocabularyError(w, err)
+			return
+		}
+
+		// response
+		response.JSON(w, http.StatusOK, map[string]any{
+			"message": "success",
+			"data":    serializeVocabulary(v),
+		})
+	}
+}
+
+// AddTerm is a method that adds a term to the vocabulary of a field
+// Pattern POST /vocabularies/{field}/terms
+func (h *VocabularyDefault) AddTerm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		f := internal.VehicleField(chi.URLParam(r, "field"))
+		var reqBody TermJSON
+		if err := request.JSON(r, &reqBody); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		// process
+		if err := h.sv.AddTerm(f, internal.Term{Value: reqBody.Value, Aliases: reqBody.Aliases}); err != nil {
+			respondVocabularyError(w, err)
+			return
+		}
+
+		// response
+		h.respondVocabulary(w, f, http.StatusCreated, "term created")
+	}
+}
+
+// UpdateTerm is a method that replaces a term of the vocabulary of a field, e.g. to rename it or change its aliases
+// Pattern PUT /vocabularies/{field}/terms/{value}
+func (h *VocabularyDefault) UpdateTerm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		f := internal.VehicleField(chi.URLParam(r, "field"))
+		value := chi.URLParam(r, "value")
+		var reqBody TermJSON
+		if err := request.JSON(r, &reqBody); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		// process
+		if err := h.sv.UpdateTerm(f, value, internal.Term{Value: reqBody.Value, Aliases: reqBody.Aliases}); err != nil {
+			respondVocabularyError(w, err)
+			return
+		}
+
+		// response
+		h.respondVocabulary(w, f, http.StatusOK, "term updated")
+	}
+}
+
+// DeleteTerm is a method that deletes a term of the vocabulary of a field
+// Pattern DELETE /vocabularies/{field}/terms/{value}
+func (h *VocabularyDefault) DeleteTerm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// request
+		f := internal.VehicleField(chi.URLParam(r, "field"))
+		value := chi.URLParam(r, "value")
+
+		// process
+		if err := h.sv.DeleteTerm(f, value); err != nil {
+			respondVocabularyError(w, err)
+			return
+		}
+
+		// response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// respondVocabulary is a method that responds with the vocabulary of a field after a change
+func (h *VocabularyDefault) respondVocabulary(w http.ResponseWriter, f internal.VehicleField, code int, message string) {
+	v, err := h.sv.Get(f)
+	if err != nil {
+		respondVocabularyError(w, err)
+		return
+	}
+	response.JSON(w, code, map[string]any{
+		"message": message,
+		"data":    serializeVocabulary(v),
+	})
+}
+
+// respondVocabularyError is a function that responds with the error of an operation over a vocabulary
+func respondVocabularyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, internal.ErrVocabularyNotFound):
+		response.Error(w, http.StatusNotFound, "Vocabulary not found, it must be fuel_type, transmission or color")
+	case errors.Is(err, internal.ErrTermNotFound):
+		response.Error(w, http.StatusNotFound, "Term not found")
+	case errors.Is(err, internal.ErrTermAlreadyExists):
+		response.Error(w, http.StatusConflict, "The value or an alias is used by another term")
+	case errors.Is(err, internal.ErrFieldRequired):
+		response.Error(w, http.StatusBadRequest, "The value of the term is required")
+	case errors.Is(err, internal.ErrInvalidFieldValue):
+		response.Error(w, http.StatusBadRequest, "The aliases of the term must not be empty")
+	default:
+		response.Error(w, http.StatusInternalServerError, "Internal error")
+	}
+}
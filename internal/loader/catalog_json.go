@@ -0,0 +1,118 @@
+package loader
+
+import (
+	"app/internal"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// NewCatalogJSONFile is a function that returns a new instance of CatalogJSONFile
+func NewCatalogJSONFile(path string) *CatalogJSONFile {
+	return &CatalogJSONFile{
+		path: path,
+	}
+}
+
+// CatalogJSONFile is a struct that implements the CatalogLoader interface
+type CatalogJSONFile struct {
+	// path is the path to the file that contains the catalog in JSON format
+	path string
+}
+
+// BrandJSON is a struct that represents a brand of the catalog in JSON format
+type BrandJSON struct {
+	Name   string      `json:"name"`
+	Models []ModelJSON `json:"models"`
+}
+
+// ModelJSON is a struct that represents a model of the catalog in JSON format
+type ModelJSON struct {
+	Name  string    `json:"name"`
+	Specs SpecsJSON `json:"specs"`
+}
+
+// SpecsJSON is a struct that represents the default attributes of a model in JSON format
+type SpecsJSON struct {
+	Capacity     int     `json:"passengers,omitempty"`
+	MaxSpeed     float64 `json:"max_speed,omitempty"`
+	FuelType     string  `json:"fuel_type,omitempty"`
+	Transmission string  `json:"transmission,omitempty"`
+	Weight       float64 `json:"weight,omitempty"`
+	Height       float64 `json:"height,omitempty"`
+	Length       float64 `json:"length,omitempty"`
+	Width        float64 `json:"width,omitempty"`
+}
+
+// Load is a method that loads the brands of the catalog
+func (l *CatalogJSONFile) Load() (b []internal.Brand, err error) {
+	// open file
+	file, err := os.Open(l.path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	// decode file
+	var brandsJSON []BrandJSON
+	if err = json.NewDecoder(file).Decode(&brandsJSON); err != nil {
+		err = fmt.Errorf("%s: %w", l.path, err)
+		return
+	}
+
+	// deserialize brands
+	b = make([]internal.Brand, 0, len(brandsJSON))
+	for _, bj := range brandsJSON {
+		brand := internal.Brand{Name: bj.Name, Models: make([]internal.Model, 0, len(bj.Models))}
+		for _, mj := range bj.Models {
+			brand.Models = append(brand.Models, internal.Model{
+				Name: mj.Name,
+				Specs: internal.ModelSpecs{
+					Capacity:     mj.Specs.Capacity,
+					MaxSpeed:     mj.Specs.MaxSpeed,
+					FuelType:     mj.Specs.FuelType,
+					Transmission: mj.Specs.Transmission,
+					Weight:       mj.Specs.Weight,
+					Dimensions: internal.Dimensions{
+						Height: mj.Specs.Height,
+						Length: mj.Specs.Length,
+						Width:  mj.Specs.Width,
+					},
+				},
+			})
+		}
+		b = append(b, brand)
+	}
+	return
+}
+
+// WriteCatalogJSON is a function that writes the brands of the catalog in the same JSON format read by CatalogJSONFile
+func WriteCatalogJSON(w io.Writer, b []internal.Brand) (err error) {
+	// serialize brands
+	brandsJSON := make([]BrandJSON, 0, len(b))
+	for _, brand := range b {
+		bj := BrandJSON{Name: brand.Name, Models: make([]ModelJSON, 0, len(brand.Models))}
+		for _, m := range brand.Models {
+			bj.Models = append(bj.Models, ModelJSON{
+				Name: m.Name,
+				Specs: SpecsJSON{
+					Capacity:     m.Specs.Capacity,
+					MaxSpeed:     m.Specs.MaxSpeed,
+					FuelType:     m.Specs.FuelType,
+					Transmission: m.Specs.Transmission,
+					Weight:       m.Specs.Weight,
+					Height:       m.Specs.Height,
+					Length:       m.Specs.Length,
+					Width:        m.Specs.Width,
+				},
+			})
+		}
+		brandsJSON = append(brandsJSON, bj)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(brandsJSON)
+	return
+}
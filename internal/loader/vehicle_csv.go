@@ -0,0 +1,197 @@
+package loader
+
+import (
+	"app/internal"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidColumns is the error returned when the header of a CSV file does not have the mapped columns
+	ErrInvalidColumns = errors.New("invalid columns")
+)
+
+// ConfigVehicleCSV is a struct that represents the configuration for VehicleCSVReader
+type ConfigVehicleCSV struct {
+	// Columns maps the names of the columns of the header to fields. The columns named as a field (ignoring case)
+	// that are not mapped are mapped to it, and the rest of the columns are ignored
+	Columns map[string]internal.VehicleField
+	// Comma is the delimiter of the values (',' by default)
+	Comma rune
+}
+
+// NewVehicleCSVReader is a function that returns a new instance of VehicleCSVReader
+// The first row of r must be the header
+func NewVehicleCSVReader(r io.Reader, cfg *ConfigVehicleCSV) *VehicleCSVReader {
+	// default values
+	defaultConfig := &ConfigVehicleCSV{
+		Comma: ',',
+	}
+	if cfg != nil {
+		if cfg.Columns != nil {
+			defaultConfig.Columns = cfg.Columns
+		}
+		if cfg.Comma != 0 {
+			defaultConfig.Comma = cfg.Comma
+		}
+	}
+
+	cr := csv.NewReader(r)
+	cr.Comma = defaultConfig.Comma
+	cr.ReuseRecord = true
+	return &VehicleCSVReader{cr: cr, mapping: defaultConfig.Columns}
+}
+
+// VehicleCSVReader is a struct that implements the VehicleReader interface for CSV files, a vehicle per row
+// Empty values are zero values, e.g. to be reported by the validation rules. A column named version is the version
+// of the vehicle
+type VehicleCSVReader struct {
+	// cr is the reader of the rows
+	cr *csv.Reader
+	// mapping is the configured mapping of columns to fields
+	mapping map[string]internal.VehicleField
+	// columns is the field of each column of the header, or empty for the ignored ones. It is nil until the
+	// header is read
+	columns []internal.VehicleField
+	// version is the column of the version, named version (as written by the export), or -1
+	version int
+}
+
+// Read is a method that returns the vehicle of the next row and its line, or io.EOF at the end
+func (r *VehicleCSVReader) Read() (v internal.Vehicle, row int, err error) {
+	if r.columns == nil {
+		if err = r.readHeader(); err != nil {
+			return
+		}
+	}
+
+	record, err := r.cr.Read()
+	var parseErr *csv.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		row = parseErr.StartLine
+		err = &internal.ImportRowError{Row: row, Err: parseErr.Err}
+		return
+	case err != nil:
+		return
+	}
+	row, _ = r.cr.FieldPos(0)
+
+	e := &internal.ValidationError{}
+	for i, value := range record {
+		f := r.columns[i]
+		if f == "" {
+			continue
+		}
+		if err := setValue(&v, f, strings.TrimSpace(value)); err != nil {
+			e.Add(string(f), internal.RuleFormat, err.Error())
+		}
+	}
+	if r.version >= 0 && r.version < len(record) {
+		if value := strings.TrimSpace(record[r.version]); value != "" {
+			if v.Version, err = strconv.Atoi(value); err != nil {
+				e.Add("version", internal.RuleFormat, "must be an integer")
+			}
+		}
+	}
+	if err = e.Err(); err != nil {
+		err = &internal.ImportRowError{Row: row, Err: err}
+	}
+	return
+}
+
+// readHeader is a method that reads the header and maps its columns to fields
+func (r *VehicleCSVReader) readHeader() (err error) {
+	header, err := r.cr.Read()
+	if errors.Is(err, io.EOF) {
+		err = fmt.Errorf("%w: the header is missing", ErrInvalidColumns)
+	}
+	if err != nil {
+		return
+	}
+
+	columns := make([]internal.VehicleField, len(header))
+	mapped := make(map[internal.VehicleField]string)
+	r.version = -1
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		f, ok := r.mapping[name]
+		if !ok && strings.EqualFold(name, "version") {
+			r.version = i
+			continue
+		}
+		if !ok && internal.VehicleField(strings.ToLower(name)).Valid() {
+			f = internal.VehicleField(strings.ToLower(name))
+			if r.mappedTo(f) {
+				continue
+			}
+		}
+		if f == "" {
+			continue
+		}
+		if !f.Valid() {
+			return fmt.Errorf("%w: unknown field %q for column %q", ErrInvalidColumns, f, name)
+		}
+		if other, ok := mapped[f]; ok {
+			return fmt.Errorf("%w: columns %q and %q are both %s", ErrInvalidColumns, other, name, f)
+		}
+		columns[i], mapped[f] = f, name
+	}
+	for name := range r.mapping {
+		if !headerHas(header, name) {
+			return fmt.Errorf("%w: column %q is not in the header", ErrInvalidColumns, name)
+		}
+	}
+
+	r.columns = columns
+	return
+}
+
+// mappedTo is a method that returns if a configured column is mapped to a field
+func (r *VehicleCSVReader) mappedTo(f internal.VehicleField) bool {
+	for _, mf := range r.mapping {
+		if mf == f {
+			return true
+		}
+	}
+	return false
+}
+
+// headerHas is a function that returns if a header has a column
+func headerHas(header []string, name string) bool {
+	for _, h := range header {
+		if strings.TrimSpace(h) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setValue is a function that sets a field of a vehicle to the value of a text, or fails when the text is not of
+// the kind of the field. An empty text is the zero value
+func setValue(v *internal.Vehicle, f internal.VehicleField, s string) error {
+	if s == "" {
+		return nil
+	}
+	switch f.Kind() {
+	case internal.FieldKindInt:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		f.SetValue(v, n)
+	case internal.FieldKindFloat:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		f.SetValue(v, n)
+	default:
+		f.SetValue(v, s)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package loader
+
+import (
+	"app/internal"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestVehicleCSVReader(t *testing.T) {
+	data := "Plate;BRAND;year;max_speed;notes\n" +
+		"AB 1;Ford;2010;180.5;first\n" +
+		"AB2;;20x0;fast;\n" +
+		"AB3;Fiat\n"
+	r := NewVehicleCSVReader(strings.NewReader(data), &ConfigVehicleCSV{
+		Columns: map[string]internal.VehicleField{"Plate": internal.VehicleFieldRegistration},
+		Comma:   ';',
+	})
+
+	// mapped, named (ignoring case) and ignored columns
+	v, row, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row != 2 || v.Registration != "AB 1" || v.Brand != "Ford" || v.FabricationYear != 2010 || v.MaxSpeed != 180.5 {
+		t.Fatalf("unexpected vehicle %+v at row %d", v, row)
+	}
+
+	// values that are not of the kind of their field
+	_, _, err = r.Read()
+	var rowErr *internal.ImportRowError
+	var validationErr *internal.ValidationError
+	if !errors.As(err, &rowErr) || rowErr.Row != 3 || !errors.As(err, &validationErr) || len(validationErr.Violations) != 2 {
+		t.Fatalf("expected the format errors of year and max_speed at row 3, got %v", err)
+	}
+
+	// rows with another number of columns
+	if _, _, err = r.Read(); !errors.As(err, &rowErr) || rowErr.Row != 4 {
+		t.Fatalf("expected an error at row 4, got %v", err)
+	}
+	if _, _, err = r.Read(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestVehicleCSVReader_InvalidColumns(t *testing.T) {
+	headers := map[string]string{
+		"missing mapped column": "registration,brand\n",
+		"field twice":           "Plate,registration\n",
+		"empty":                 "",
+	}
+	for name, header := range headers {
+		r := NewVehicleCSVReader(strings.NewReader(header), &ConfigVehicleCSV{
+			Columns: map[string]internal.VehicleField{"Plate": internal.VehicleFieldBrand, "registration": internal.VehicleFieldBrand},
+		})
+		if _, _, err := r.Read(); !errors.Is(err, ErrInvalidColumns) {
+			t.Errorf("%s: expected ErrInvalidColumns, got %v", name, err)
+		}
+	}
+}
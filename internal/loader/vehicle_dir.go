@@ -0,0 +1,131 @@
+package loader
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNoVehicleFiles is the error returned when a pattern does not match any file of vehicles
+	ErrNoVehicleFiles = errors.New("no vehicle files")
+)
+
+// IsPattern is a function that returns if a path is a pattern of filepath.Match, e.g. seeds/*.csv
+func IsPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// NewVehicleLoader is a function that returns the loader of the vehicles of a path: the files that match it when
+// it is a pattern (see IsPattern), the files of a directory, or a single file
+func NewVehicleLoader(path string, cfg *ConfigVehicleFile) internal.VehicleRecordLoader {
+	if IsPattern(path) {
+		return NewVehicleGlob(path, cfg)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return NewVehicleDir(path, cfg)
+	}
+	return NewVehicleFile(path, cfg)
+}
+
+// NewVehicleDir is a function that returns a new instance of VehicleDir
+func NewVehicleDir(path string, cfg *ConfigVehicleFile) *VehicleDir {
+	return &VehicleDir{path: path, cfg: cfg}
+}
+
+// VehicleDir is a struct that implements the VehicleRecordLoader interface for the files of a directory, merged
+// The files are loaded sorted by name, and the vehicles of the later files replace the ones with the same id
+// Only the files of a known format (of the configured format, if any) are loaded, and subdirectories are ignored
+type VehicleDir struct {
+	// path is the path to the directory
+	path string
+	// cfg is the configuration of the files
+	cfg *ConfigVehicleFile
+}
+
+// Load is a method that loads the vehicles of the files of the directory
+func (l *VehicleDir) Load() (v map[int]internal.Vehicle, err error) {
+	v, err = loadRecords(l)
+	return
+}
+
+// Records is a method that calls fn with every record of the files of the directory, in order
+func (l *VehicleDir) Records(fn func(r internal.VehicleRecord) error) (err error) {
+	entries, err := os.ReadDir(l.path)
+	if err != nil {
+		return
+	}
+
+	// entries are sorted by name
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		format, errFormat := DetectFormat(e.Name())
+		if errFormat != nil || (l.cfg != nil && l.cfg.Format != "" && format != l.cfg.Format) {
+			continue
+		}
+		paths = append(paths, filepath.Join(l.path, e.Name()))
+	}
+
+	err = recordsFiles(paths, l.cfg, fn)
+	return
+}
+
+// NewVehicleGlob is a function that returns a new instance of VehicleGlob
+func NewVehicleGlob(pattern string, cfg *ConfigVehicleFile) *VehicleGlob {
+	return &VehicleGlob{pattern: pattern, cfg: cfg}
+}
+
+// VehicleGlob is a struct that implements the VehicleRecordLoader interface for the files that match a pattern,
+// merged as the files of a directory (see VehicleDir). The pattern is matched on every load
+type VehicleGlob struct {
+	// pattern is the pattern of the paths of the files
+	pattern string
+	// cfg is the configuration of the files
+	cfg *ConfigVehicleFile
+}
+
+// Load is a method that loads the vehicles of the files that match the pattern, or ErrNoVehicleFiles
+func (l *VehicleGlob) Load() (v map[int]internal.Vehicle, err error) {
+	v, err = loadRecords(l)
+	return
+}
+
+// Records is a method that calls fn with every record of the files that match the pattern, in order, or returns
+// ErrNoVehicleFiles
+func (l *VehicleGlob) Records(fn func(r internal.VehicleRecord) error) (err error) {
+	paths, err := filepath.Glob(l.pattern)
+	if err != nil {
+		return
+	}
+	files := paths[:0]
+	for _, path := range paths {
+		if info, errStat := os.Stat(path); errStat == nil && info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		err = fmt.Errorf("%w: %s", ErrNoVehicleFiles, l.pattern)
+		return
+	}
+	sort.Strings(files)
+
+	err = recordsFiles(files, l.cfg, fn)
+	return
+}
+
+// recordsFiles is a function that calls fn with every record of some files, in order
+func recordsFiles(paths []string, cfg *ConfigVehicleFile, fn func(r internal.VehicleRecord) error) (err error) {
+	for _, path := range paths {
+		if err = NewVehicleFile(path, cfg).Records(fn); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,410 @@
+package loader
+
+import (
+	"app/internal"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// FormatJSON is the format of a JSON array of vehicles (.json)
+	FormatJSON = "json"
+	// FormatNDJSON is the format of a vehicle in JSON per line (.ndjson, .jsonl)
+	FormatNDJSON = "ndjson"
+	// FormatCSV is the format of a vehicle per row of a CSV file with a header (.csv)
+	FormatCSV = "csv"
+	// FormatYAML is the format of a YAML sequence of vehicles (.yaml, .yml)
+	FormatYAML = "yaml"
+)
+
+var (
+	// ErrUnknownFormat is the error returned when the format of a file of vehicles is not known
+	ErrUnknownFormat = errors.New("unknown format")
+	// ErrNoSchemaVersion is the error returned for the schema version of a format without it (see SchemaVersion)
+	ErrNoSchemaVersion = errors.New("the format has no schema version")
+)
+
+var (
+	// formatExtensions are the formats by the extension of their files
+	formatExtensions = map[string]string{
+		".json":   FormatJSON,
+		".ndjson": FormatNDJSON,
+		".jsonl":  FormatNDJSON,
+		".csv":    FormatCSV,
+		".yaml":   FormatYAML,
+		".yml":    FormatYAML,
+	}
+	// compressionExtensions are the extensions of the compressed files
+	compressionExtensions = []string{".gz", ".zst", ".zstd"}
+	// gzipMagic and zstdMagic are the first bytes of the compressed files
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// StripCompression is a function that returns a path without the extension of its compression, if any
+func StripCompression(path string) (stripped string, compressed bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, c := range compressionExtensions {
+		if ext == c {
+			return path[:len(path)-len(ext)], true
+		}
+	}
+	return path, false
+}
+
+// DetectFormat is a function that returns the format of a file of vehicles by its extension, ignoring the
+// extension of its compression, e.g. vehicles.csv.gz is FormatCSV
+func DetectFormat(path string) (format string, err error) {
+	stripped, _ := StripCompression(path)
+	format, ok := formatExtensions[strings.ToLower(filepath.Ext(stripped))]
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrUnknownFormat, path)
+	}
+	return
+}
+
+// validFormat is a function that returns if a format is known
+func validFormat(format string) bool {
+	for _, f := range formatExtensions {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// progressInterval is the time between the reports of the progress of the load of a file
+const progressInterval = time.Second
+
+// LoadProgress is a struct that represents the progress of the load of a file of vehicles
+type LoadProgress struct {
+	// Path is the path of the file
+	Path string
+	// Records is the number of records read
+	Records int
+	// Bytes is the number of bytes of the file read (compressed, for the compressed files)
+	Bytes int64
+	// Size is the size of the file
+	Size int64
+}
+
+// ConfigVehicleFile is a struct that represents the configuration for VehicleFile
+type ConfigVehicleFile struct {
+	// Format is the format of the file (detected by its extension by default)
+	Format string
+	// CSV is the configuration of the CSV files
+	CSV *ConfigVehicleCSV
+	// Progress is called every second while the file is read, so it is not called for the files read in less
+	// time. It is not called when it is nil
+	Progress func(p LoadProgress)
+}
+
+// NewVehicleFile is a function that returns a new instance of VehicleFile
+func NewVehicleFile(path string, cfg *ConfigVehicleFile) *VehicleFile {
+	// default values
+	defaultConfig := &ConfigVehicleFile{}
+	if cfg != nil {
+		if cfg.Format != "" {
+			defaultConfig.Format = cfg.Format
+		}
+		if cfg.CSV != nil {
+			defaultConfig.CSV = cfg.CSV
+		}
+		if cfg.Progress != nil {
+			defaultConfig.Progress = cfg.Progress
+		}
+	}
+
+	return &VehicleFile{
+		path:     path,
+		format:   defaultConfig.Format,
+		csv:      defaultConfig.CSV,
+		progress: defaultConfig.Progress,
+	}
+}
+
+// VehicleFile is a struct that implements the VehicleRecordLoader interface for a file in any of the formats, compressed
+// with gzip or zstd or not (detected by its first bytes)
+type VehicleFile struct {
+	// path is the path to the file that contains the vehicles
+	path string
+	// format is the format of the file, or empty to detect it by its extension
+	format string
+	// csv is the configuration of the CSV files
+	csv *ConfigVehicleCSV
+	// progress is called with the progress of the load, or nil
+	progress func(p LoadProgress)
+}
+
+// Load is a method that loads the vehicles. Vehicles without a version start at version 1
+func (l *VehicleFile) Load() (v map[int]internal.Vehicle, err error) {
+	v, err = loadRecords(l)
+	return
+}
+
+// Format is a method that returns the format of the file
+func (l *VehicleFile) Format() (format string, err error) {
+	format = l.format
+	if format == "" {
+		format, err = DetectFormat(l.path)
+	} else if !validFormat(format) {
+		err = fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	return
+}
+
+// SchemaVersion is a method that returns the schema version of the file, read from its header
+func (l *VehicleFile) SchemaVersion() (version int, err error) {
+	rd, _, closeFile, err := l.open()
+	if err != nil {
+		return
+	}
+	defer closeFile()
+
+	sv, ok := rd.(interface{ SchemaVersion() int })
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrNoSchemaVersion, l.path)
+		return
+	}
+	// the header is read with the first record, which may be invalid
+	_, _, err = rd.Read()
+	var rowErr *internal.ImportRowError
+	switch {
+	case err == nil, errors.Is(err, io.EOF), errors.As(err, &rowErr):
+		version, err = sv.SchemaVersion(), nil
+	default:
+		err = fmt.Errorf("%s: %w", l.path, err)
+	}
+	return
+}
+
+// Records is a method that calls fn with every record of the file, in order
+// The file is read record by record, so only a record is held in memory
+func (l *VehicleFile) Records(fn func(r internal.VehicleRecord) error) (err error) {
+	rd, cr, closeFile, err := l.open()
+	if err != nil {
+		return
+	}
+	defer closeFile()
+
+	p := LoadProgress{Path: l.path, Size: cr.size}
+	reported := time.Now()
+	for {
+		vh, row, errRead := rd.Read()
+		if errors.Is(errRead, io.EOF) {
+			return
+		}
+		if p.Records++; l.progress != nil && time.Since(reported) >= progressInterval {
+			p.Bytes = cr.n
+			l.progress(p)
+			reported = time.Now()
+		}
+		rec := internal.VehicleRecord{Path: l.path, Row: row}
+		var rowErr *internal.ImportRowError
+		switch {
+		case errors.As(errRead, &rowErr):
+			rec.Err = rowErr.Err
+		case errRead != nil:
+			return fmt.Errorf("%s: %w", l.path, errRead)
+		default:
+			if vh.Version == 0 {
+				vh.Version = 1
+			}
+			rec.Vehicle = vh
+		}
+		if err = fn(rec); err != nil {
+			return
+		}
+	}
+}
+
+// open is a method that opens the file and returns the reader of its records in its format, the reader of its
+// bytes, and the function that closes it
+func (l *VehicleFile) open() (rd internal.VehicleReader, cr *countReader, closeFile func(), err error) {
+	format, err := l.Format()
+	if err != nil {
+		return
+	}
+
+	// open file
+	file, err := os.Open(l.path)
+	if err != nil {
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return
+	}
+	cr = &countReader{r: file, size: info.Size()}
+	r, err := decompress(cr)
+	if err != nil {
+		_ = file.Close()
+		err = fmt.Errorf("%s: %w", l.path, err)
+		return
+	}
+	closeFile = func() {
+		_ = r.Close()
+		_ = file.Close()
+	}
+
+	// decode
+	switch format {
+	case FormatJSON:
+		rd = NewVehicleJSONReader(r)
+	case FormatYAML:
+		rd = NewVehicleYAMLReader(r)
+	case FormatNDJSON:
+		rd = NewVehicleNDJSONReader(r)
+	case FormatCSV:
+		rd = NewVehicleCSVReader(r, l.csv)
+	}
+	return
+}
+
+// countReader is a struct that counts the bytes read from a reader
+type countReader struct {
+	// r is the reader
+	r io.Reader
+	// n is the number of bytes read
+	n int64
+	// size is the size of the content of the reader
+	size int64
+}
+
+// Read is a method that reads from the reader, counting the bytes
+func (c *countReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	return
+}
+
+// decompress is a function that returns a reader of the decompressed content of r when it starts as a gzip or
+// zstd stream, or of its content as is
+func decompress(r io.Reader) (rc io.ReadCloser, err error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		rc, err = gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		var d *zstd.Decoder
+		if d, err = zstd.NewReader(br); err != nil {
+			return
+		}
+		rc = d.IOReadCloser()
+	default:
+		rc = io.NopCloser(br)
+	}
+	return
+}
+
+// CompressWriter is a function that returns a writer that compresses what is written to w with the compression of
+// the extension of path (see StripCompression), or that writes it as is. It must be closed to flush the content
+func CompressWriter(w io.Writer, path string) (wc io.WriteCloser, err error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		wc = gzip.NewWriter(w)
+	case ".zst", ".zstd":
+		wc, err = zstd.NewWriter(w)
+	default:
+		wc = nopWriteCloser{w}
+	}
+	return
+}
+
+// nopWriteCloser is a struct that implements io.WriteCloser for a writer that does not need to be closed
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close is a method that does nothing
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// WriteVehicles is a function that writes the vehicles in a format with the header of SchemaVersion, as read by
+// VehicleFile. CSV files have no schema version, so they fail with ErrNoSchemaVersion
+func WriteVehicles(w io.Writer, format string, v map[int]internal.Vehicle) (err error) {
+	switch format {
+	case FormatJSON:
+		err = WriteVehiclesJSON(w, v)
+	case FormatNDJSON:
+		err = WriteVehiclesNDJSON(w, v)
+	case FormatYAML:
+		err = WriteVehiclesYAML(w, v)
+	case FormatCSV:
+		err = fmt.Errorf("%w: %s", ErrNoSchemaVersion, format)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	return
+}
+
+// loadRecords is a function that loads the vehicles of the records of a loader by id, the later ones replacing
+// the ones with the same id. It fails on the first record that can not be read
+func loadRecords(l internal.VehicleRecordLoader) (v map[int]internal.Vehicle, err error) {
+	v = make(map[int]internal.Vehicle)
+	err = l.Records(func(r internal.VehicleRecord) error {
+		if r.Err != nil {
+			return fmt.Errorf("%s: %w", r.Path, &internal.ImportRowError{Row: r.Row, Err: r.Err})
+		}
+		v[r.Vehicle.Id] = r.Vehicle
+		return nil
+	})
+	if err != nil {
+		v = nil
+	}
+	return
+}
+
+// ChunkVehicles is a function that calls fn with the vehicles of the records of a loader in chunks of up to size
+// vehicles, in order, so they are never all in memory. It fails on the first record that can not be read
+// The chunk is reused by the next call, so fn must not keep it
+func ChunkVehicles(l internal.VehicleRecordLoader, size int, fn func(v []internal.Vehicle) error) (err error) {
+	chunk := make([]internal.Vehicle, 0, size)
+	err = l.Records(func(r internal.VehicleRecord) error {
+		if r.Err != nil {
+			return fmt.Errorf("%s: %w", r.Path, &internal.ImportRowError{Row: r.Row, Err: r.Err})
+		}
+		if chunk = append(chunk, r.Vehicle); len(chunk) < size {
+			return nil
+		}
+		err := fn(chunk)
+		chunk = chunk[:0]
+		return err
+	})
+	if err == nil && len(chunk) > 0 {
+		err = fn(chunk)
+	}
+	return
+}
+
+// readVehicles is a function that reads all the vehicles of a reader by id, failing on the first row that can
+// not be read. Vehicles without a version start at version 1
+func readVehicles(r internal.VehicleReader) (v map[int]internal.Vehicle, err error) {
+	v = make(map[int]internal.Vehicle)
+	for {
+		vh, _, errRead := r.Read()
+		if errors.Is(errRead, io.EOF) {
+			return
+		}
+		if errRead != nil {
+			return nil, errRead
+		}
+		if vh.Version == 0 {
+			vh.Version = 1
+		}
+		v[vh.Id] = vh
+	}
+}
@@ -0,0 +1,131 @@
+package loader
+
+import (
+	"app/internal"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// writeFile is a function that writes a file of a test, compressed by the extension of its name
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	var b bytes.Buffer
+	switch filepath.Ext(name) {
+	case ".gz":
+		w := gzip.NewWriter(&b)
+		w.Write([]byte(content))
+		w.Close()
+	case ".zst":
+		w, _ := zstd.NewWriter(&b)
+		w.Write([]byte(content))
+		w.Close()
+	default:
+		b.WriteString(content)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVehicleFile_Formats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.json":      `[{"id": 1, "brand": "Ford", "max_speed": 180.5}]`,
+		"b.ndjson.gz": "{\"id\": 1, \"brand\": \"Ford\", \"max_speed\": 180.5}\n\n",
+		"c.csv.zst":   "id,brand,max_speed\n1,Ford,180.5\n",
+		"d.yml":       "- id: 1\n  brand: Ford\n  max_speed: 180.5\n",
+	}
+	for name, content := range files {
+		v, err := NewVehicleFile(writeFile(t, dir, name, content), nil).Load()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if vh := v[1]; len(v) != 1 || vh.Brand != "Ford" || vh.MaxSpeed != 180.5 || vh.Version != 1 {
+			t.Errorf("%s: unexpected vehicles %+v", name, v)
+		}
+	}
+
+	// the format set explicitly, and unknown formats
+	path := writeFile(t, dir, "seed.txt", "id,brand\n2,Fiat\n")
+	if v, err := NewVehicleFile(path, &ConfigVehicleFile{Format: FormatCSV}).Load(); err != nil || v[2].Brand != "Fiat" {
+		t.Errorf("expected the vehicle of the CSV file, got %+v, %v", v, err)
+	}
+	if _, err := NewVehicleFile(path, nil).Load(); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+
+	// rows that can not be read fail the load
+	path = writeFile(t, dir, "bad.csv", "id,year\n3,20x0\n")
+	var rowErr *internal.ImportRowError
+	if _, err := NewVehicleFile(path, nil).Load(); !errors.As(err, &rowErr) || rowErr.Row != 2 {
+		t.Errorf("expected an error at row 2, got %v", err)
+	}
+}
+
+func TestVehicleLoader_Merge(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "1.json", `[{"id": 1, "brand": "Ford"}, {"id": 2, "brand": "Fiat"}]`)
+	writeFile(t, dir, "2.csv", "id,brand,version\n2,Fiat Spa,3\n3,Seat,\n")
+	writeFile(t, dir, "notes.txt", "ignored")
+	os.Mkdir(filepath.Join(dir, "sub.json"), 0o755)
+
+	// later files replace the vehicles with the same id
+	v, err := NewVehicleLoader(dir, nil).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 3 || v[2].Brand != "Fiat Spa" || v[2].Version != 3 || v[3].Version != 1 {
+		t.Errorf("unexpected vehicles %+v", v)
+	}
+
+	// patterns
+	v, err = NewVehicleLoader(filepath.Join(dir, "*.csv"), nil).Load()
+	if err != nil || len(v) != 2 {
+		t.Errorf("expected the vehicles of 2.csv, got %+v, %v", v, err)
+	}
+	if _, err = NewVehicleLoader(filepath.Join(dir, "*.yaml"), nil).Load(); !errors.Is(err, ErrNoVehicleFiles) {
+		t.Errorf("expected ErrNoVehicleFiles, got %v", err)
+	}
+}
+
+func TestVehicleJSONReader(t *testing.T) {
+	r := NewVehicleJSONReader(strings.NewReader(`[{"id": 1}, {"id": 2, "year": "old"}, {"id": 3}]`))
+
+	// a value of another kind does not stop the reader
+	var ids []int
+	for {
+		v, row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rowErr *internal.ImportRowError
+		if errors.As(err, &rowErr) {
+			if row != 2 || !errors.Is(err, internal.ErrInvalidFieldValue) {
+				t.Fatalf("expected a format error at row 2, got %v at row %d", err, row)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, v.Id)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Fatalf("expected vehicles 1 and 3, got %v", ids)
+	}
+
+	// not an array
+	if _, _, err := NewVehicleJSONReader(strings.NewReader(`{"id": 1}`)).Read(); err == nil {
+		t.Fatal("expected an error for an object")
+	}
+}
@@ -2,8 +2,14 @@ package loader
 
 import (
 	"app/internal"
+	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"sort"
+	"time"
 )
 
 // NewVehicleJSONFile is a function that returns a new instance of VehicleJSONFile
@@ -19,22 +25,26 @@ type VehicleJSONFile struct {
 	path string
 }
 
-// VehicleJSON is a struct that represents a vehicle in JSON format
+// VehicleJSON is a struct that represents a vehicle in JSON format, also used for YAML
 type VehicleJSON struct {
-	Id              int     `json:"id"`
-	Brand           string  `json:"brand"`
-	Model           string  `json:"model"`
-	Registration    string  `json:"registration"`
-	Color           string  `json:"color"`
-	FabricationYear int     `json:"year"`
-	Capacity        int     `json:"passengers"`
-	MaxSpeed        float64 `json:"max_speed"`
-	FuelType        string  `json:"fuel_type"`
-	Transmission    string  `json:"transmission"`
-	Weight          float64 `json:"weight"`
-	Height          float64 `json:"height"`
-	Length          float64 `json:"length"`
-	Width           float64 `json:"width"`
+	Id              int     `json:"id" yaml:"id"`
+	Brand           string  `json:"brand" yaml:"brand"`
+	Model           string  `json:"model" yaml:"model"`
+	Registration    string  `json:"registration" yaml:"registration"`
+	Color           string  `json:"color" yaml:"color"`
+	FabricationYear int     `json:"year" yaml:"year"`
+	Capacity        int     `json:"passengers" yaml:"passengers"`
+	MaxSpeed        float64 `json:"max_speed" yaml:"max_speed"`
+	FuelType        string  `json:"fuel_type" yaml:"fuel_type"`
+	Transmission    string  `json:"transmission" yaml:"transmission"`
+	Weight          float64 `json:"weight" yaml:"weight"`
+	Height          float64 `json:"height" yaml:"height"`
+	Length          float64 `json:"length" yaml:"length"`
+	Width           float64 `json:"width" yaml:"width"`
+	Version         int     `json:"version,omitempty" yaml:"version"`
+	// DeletedAt and DeleteReason are the deletion of a vehicle in the trash
+	DeletedAt    *time.Time `json:"deleted_at,omitempty" yaml:"deleted_at,omitempty"`
+	DeleteReason string     `json:"delete_reason,omitempty" yaml:"delete_reason,omitempty"`
 }
 
 // Load is a method that loads the vehicles
@@ -46,37 +56,262 @@ func (l *VehicleJSONFile) Load() (v map[int]internal.Vehicle, err error) {
 	}
 	defer file.Close()
 
-	// decode file
-	var vehiclesJSON []VehicleJSON
-	err = json.NewDecoder(file).Decode(&vehiclesJSON)
+	v, err = readVehicles(NewVehicleJSONReader(file))
+	return
+}
+
+// NewVehicleJSONReader is a function that returns a new instance of VehicleJSONReader
+func NewVehicleJSONReader(r io.Reader) *VehicleJSONReader {
+	dec := json.NewDecoder(r)
+	// the numbers of the records to migrate keep their digits
+	dec.UseNumber()
+	return &VehicleJSONReader{dec: dec}
+}
+
+// VehicleJSONReader is a struct that implements the VehicleReader interface for a JSON array of vehicles in the
+// format of VehicleJSON, with or without the header of its schema version (see SchemaVersion). The array is read
+// value by value, so only a vehicle is held in memory
+type VehicleJSONReader struct {
+	// dec is the decoder of the array
+	dec *json.Decoder
+	// row is the position of the last vehicle read, 0 until the array is opened
+	row int
+	// opened is true once the start of the array is read
+	opened bool
+	// header is true when the array is in a header
+	header bool
+	// version is the schema version of the records
+	version int
+}
+
+// Read is a method that returns the next vehicle of the array and its position (from 1), or io.EOF at the end
+// The records of older schema versions are upgraded to SchemaVersion
+func (r *VehicleJSONReader) Read() (v internal.Vehicle, row int, err error) {
+	if !r.opened {
+		if err = r.readHeader(); err != nil {
+			return
+		}
+		r.opened = true
+	}
+	if !r.dec.More() {
+		if err = r.expect(json.Delim(']')); err != nil {
+			return
+		}
+		if r.header {
+			if err = r.expect(json.Delim('}')); err != nil {
+				return
+			}
+		}
+		err = io.EOF
+		return
+	}
+
+	r.row++
+	row = r.row
+	var vh VehicleJSON
+	// a value of another kind is read whole, so the next vehicles can still be read
+	if needsMigration(r.version) {
+		var m map[string]any
+		if err = r.dec.Decode(&m); err == nil {
+			if err = unmarshalMigrated(m, r.version, &vh); err != nil {
+				err = &internal.ImportRowError{Row: row, Err: jsonRowError(err)}
+				return
+			}
+		}
+	} else {
+		err = r.dec.Decode(&vh)
+	}
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		err = &internal.ImportRowError{Row: row, Err: jsonRowError(err)}
+		return
+	case err != nil:
+		return
+	}
+	v = deserializeVehicleJSON(vh)
+	return
+}
+
+// SchemaVersion is a method that returns the schema version of the records, known once the first one is read
+func (r *VehicleJSONReader) SchemaVersion() int {
+	return r.version
+}
+
+// readHeader is a method that reads the start of the array, after the header if any
+func (r *VehicleJSONReader) readHeader() (err error) {
+	tok, err := r.token()
 	if err != nil {
 		return
 	}
+	switch tok {
+	case json.Delim('['):
+		r.version = 1
+		return
+	case json.Delim('{'):
+		r.header = true
+	default:
+		return fmt.Errorf("expected an array of vehicles or a header, got %v", tok)
+	}
 
-	// serialize vehicles
-	v = make(map[int]internal.Vehicle)
-	for _, vh := range vehiclesJSON {
-		v[vh.Id] = internal.Vehicle{
-			Id: vh.Id,
-			VehicleAttributes: internal.VehicleAttributes{
-				Brand:           vh.Brand,
-				Model:           vh.Model,
-				Registration:    vh.Registration,
-				Color:           vh.Color,
-				FabricationYear: vh.FabricationYear,
-				Capacity:        vh.Capacity,
-				MaxSpeed:        vh.MaxSpeed,
-				FuelType:        vh.FuelType,
-				Transmission:    vh.Transmission,
-				Weight:          vh.Weight,
-				Dimensions: internal.Dimensions{
-					Height: vh.Height,
-					Length: vh.Length,
-					Width:  vh.Width,
-				},
+	// the schema version first, so the records can be read as they come
+	if err = r.expectKey("schema_version"); err != nil {
+		return
+	}
+	var version int
+	if err = r.dec.Decode(&version); err != nil {
+		return fmt.Errorf("schema_version: %w", err)
+	}
+	if err = checkSchemaVersion(version); err != nil {
+		return
+	}
+	r.version = version
+	if err = r.expectKey("vehicles"); err != nil {
+		return
+	}
+	err = r.expect(json.Delim('['))
+	return
+}
+
+// expectKey is a method that reads a key of the header, or fails
+func (r *VehicleJSONReader) expectKey(key string) error {
+	tok, err := r.token()
+	if err != nil {
+		return err
+	}
+	if tok != key {
+		return fmt.Errorf("expected the key %s of the header, got %v", key, tok)
+	}
+	return nil
+}
+
+// expect is a method that reads a delimiter of the array or of the header, or fails
+func (r *VehicleJSONReader) expect(delim json.Delim) error {
+	tok, err := r.token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v of the array of vehicles, got %v", delim, tok)
+	}
+	return nil
+}
+
+// token is a method that reads the next token, io.ErrUnexpectedEOF at the end
+func (r *VehicleJSONReader) token() (tok json.Token, err error) {
+	tok, err = r.dec.Token()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// unmarshalMigrated is a function that upgrades a record in JSON from a schema version to SchemaVersion and decodes
+// it
+func unmarshalMigrated(m map[string]any, version int, vh *VehicleJSON) (err error) {
+	if err = Migrate(m, version); err != nil {
+		return
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, vh)
+	return
+}
+
+// deserializeVehicleJSON is a function that returns the vehicle of its JSON representation
+func deserializeVehicleJSON(vh VehicleJSON) (v internal.Vehicle) {
+	v = internal.Vehicle{
+		Id:      vh.Id,
+		Version: vh.Version,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           vh.Brand,
+			Model:           vh.Model,
+			Registration:    vh.Registration,
+			Color:           vh.Color,
+			FabricationYear: vh.FabricationYear,
+			Capacity:        vh.Capacity,
+			MaxSpeed:        vh.MaxSpeed,
+			FuelType:        vh.FuelType,
+			Transmission:    vh.Transmission,
+			Weight:          vh.Weight,
+			Dimensions: internal.Dimensions{
+				Height: vh.Height,
+				Length: vh.Length,
+				Width:  vh.Width,
 			},
+		},
+	}
+	if vh.DeletedAt != nil {
+		v.Deletion = &internal.VehicleDeletion{At: *vh.DeletedAt, Reason: vh.DeleteReason}
+	}
+	return
+}
+
+// serializeVehicleJSON is a function that returns the JSON representation of a vehicle
+func serializeVehicleJSON(vh internal.Vehicle) (v VehicleJSON) {
+	v = VehicleJSON{
+		Id:              vh.Id,
+		Brand:           vh.Brand,
+		Model:           vh.Model,
+		Registration:    vh.Registration,
+		Color:           vh.Color,
+		FabricationYear: vh.FabricationYear,
+		Capacity:        vh.Capacity,
+		MaxSpeed:        vh.MaxSpeed,
+		FuelType:        vh.FuelType,
+		Transmission:    vh.Transmission,
+		Weight:          vh.Weight,
+		Height:          vh.Height,
+		Length:          vh.Length,
+		Width:           vh.Width,
+		Version:         vh.Version,
+	}
+	if vh.Deleted() {
+		v.DeletedAt, v.DeleteReason = &vh.Deletion.At, vh.Deletion.Reason
+	}
+	return
+}
+
+// sortedIds is a function that returns the ids of the vehicles sorted, so the output is stable
+func sortedIds(v map[int]internal.Vehicle) []int {
+	ids := make([]int, 0, len(v))
+	for id := range v {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// WriteVehiclesJSON is a function that writes the vehicles in the same JSON format read by VehicleJSONFile, with
+// the header of SchemaVersion. Vehicles are written sorted by id, one per line
+func WriteVehiclesJSON(w io.Writer, v map[int]internal.Vehicle) (err error) {
+	ids := sortedIds(v)
+
+	// serialize vehicles
+	bw := bufio.NewWriter(w)
+	if _, err = fmt.Fprintf(bw, "{\"schema_version\": %d, \"vehicles\": [\n", SchemaVersion); err != nil {
+		return
+	}
+	for i, id := range ids {
+		b, err := json.Marshal(serializeVehicleJSON(v[id]))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err = bw.WriteString(",\n"); err != nil {
+				return err
+			}
+		}
+		if _, err = bw.Write(b); err != nil {
+			return err
 		}
 	}
+	if _, err = bw.WriteString("\n]}\n"); err != nil {
+		return
+	}
 
+	err = bw.Flush()
 	return
 }
@@ -0,0 +1,175 @@
+package loader_test
+
+import (
+	"app/internal/loader"
+	"app/internal/repository"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// benchmarkSeedSizes are the sizes of the JSON files of BenchmarkChunkVehicles_JSON, up to the 5 GB of the
+// largest seed files, overridden by the LOADER_BENCH_SIZE environment variable, e.g. LOADER_BENCH_SIZE=64MB
+var benchmarkSeedSizes = []int64{64 << 20, 512 << 20, 5 << 30}
+
+// BenchmarkChunkVehicles_JSON imports JSON files of increasing sizes into a SQLite repository in chunks of 1000
+// vehicles, as the application does on start. The peak-heap-MiB and peak-rss-MiB metrics stay the same whatever
+// the size of the file, as only a chunk is held in memory. The files and the databases need about twice the size
+// of the largest file on disk
+func BenchmarkChunkVehicles_JSON(b *testing.B) {
+	sizes := benchmarkSeedSizes
+	if s := os.Getenv("LOADER_BENCH_SIZE"); s != "" {
+		size, err := parseSize(s)
+		if err != nil {
+			b.Fatal(err)
+		}
+		sizes = []int64{size}
+	}
+
+	for _, size := range sizes {
+		b.Run(fmt.Sprintf("%dMiB", size>>20), func(b *testing.B) {
+			path := writeSeed(b, size)
+			b.SetBytes(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				db, err := repository.OpenSQLite(filepath.Join(b.TempDir(), "vehicles.db"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				rp := repository.NewVehicleSQLite(db)
+				if err = rp.Migrate(); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				var n int
+				heap, rss := peakMemory(func() {
+					im, err := rp.BeginImport()
+					if err != nil {
+						b.Fatal(err)
+					}
+					if err = loader.ChunkVehicles(loader.NewVehicleFile(path, nil), 1000, im.Add); err != nil {
+						b.Fatal(err)
+					}
+					if n, err = im.Commit(); err != nil {
+						b.Fatal(err)
+					}
+				})
+
+				b.StopTimer()
+				if err = rp.Close(); err != nil {
+					b.Fatal(err)
+				}
+				b.ReportMetric(float64(heap)/(1<<20), "peak-heap-MiB")
+				if rss > 0 {
+					b.ReportMetric(float64(rss)/(1<<20), "peak-rss-MiB")
+				}
+				b.ReportMetric(float64(n), "vehicles")
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// peakMemory is a function that returns the peaks of the heap in use and of the resident memory of the process
+// (0 where /proc is not available) while fn runs, sampled every few milliseconds. The resident memory includes the
+// memory of SQLite, which is not in the heap
+func peakMemory(fn func()) (heap, rss uint64) {
+	runtime.GC()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			heap = max(heap, m.HeapInuse)
+			rss = max(rss, residentMemory())
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+	fn()
+	close(done)
+	wg.Wait()
+	return
+}
+
+// residentMemory is a function that returns the resident memory of the process in bytes, read from
+// /proc/self/statm, or 0 when it can not be read
+func residentMemory() uint64 {
+	b, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := bytes.Fields(b)
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseUint(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * uint64(os.Getpagesize())
+}
+
+// writeSeed is a function that writes a JSON array of vehicles of about size bytes to a temporary file
+func writeSeed(b *testing.B, size int64) string {
+	b.Helper()
+	path := filepath.Join(b.TempDir(), "seed.json")
+	file, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriterSize(file, 1<<20)
+	var n int64
+	write := func(s string) {
+		m, _ := io.WriteString(w, s)
+		n += int64(m)
+	}
+	write("[")
+	for id := 1; n < size; id++ {
+		if id > 1 {
+			write(",\n")
+		}
+		write(fmt.Sprintf(`{"id": %d, "brand": "Ford", "model": "Focus", "registration": "AB%d", "color": "Red", `+
+			`"year": 2010, "passengers": 5, "max_speed": 180.5, "fuel_type": "gas", "transmission": "manual", `+
+			`"weight": 1200.5, "height": 150, "length": 400, "width": 180}`, id, id))
+	}
+	write("]\n")
+	if err = w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// parseSize is a function that parses a size in bytes with an optional KB, MB or GB suffix (powers of 1024)
+func parseSize(s string) (size int64, err error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for suffix, u := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(s, suffix) {
+			s, unit = strings.TrimSuffix(s, suffix), u
+			break
+		}
+	}
+	size, err = strconv.ParseInt(s, 10, 64)
+	size *= unit
+	return
+}
@@ -0,0 +1,143 @@
+package loader
+
+import (
+	"app/internal"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// maxNDJSONLine is the maximum size of a line of NDJSON
+const maxNDJSONLine = 1 << 20
+
+// NewVehicleNDJSONReader is a function that returns a new instance of VehicleNDJSONReader
+func NewVehicleNDJSONReader(r io.Reader) *VehicleNDJSONReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxNDJSONLine)
+	return &VehicleNDJSONReader{sc: sc}
+}
+
+// VehicleNDJSONReader is a struct that implements the VehicleReader interface for NDJSON, a vehicle in the format
+// of VehicleJSON per line, after the header of its schema version if any (see SchemaVersion). Blank lines are
+// skipped
+type VehicleNDJSONReader struct {
+	// sc is the scanner of the lines
+	sc *bufio.Scanner
+	// line is the number of the last line read
+	line int
+	// version is the schema version of the records, 0 until the first line is read
+	version int
+}
+
+// ndjsonHeader is a struct that represents the header of NDJSON
+type ndjsonHeader struct {
+	SchemaVersion *int `json:"schema_version"`
+}
+
+// Read is a method that returns the vehicle of the next line and its number, or io.EOF at the end
+// The records of older schema versions are upgraded to SchemaVersion
+func (r *VehicleNDJSONReader) Read() (v internal.Vehicle, row int, err error) {
+	for r.sc.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		// the first line may be the header
+		if r.version == 0 {
+			r.version = 1
+			var h ndjsonHeader
+			if json.Unmarshal(line, &h) == nil && h.SchemaVersion != nil {
+				if err = checkSchemaVersion(*h.SchemaVersion); err != nil {
+					return
+				}
+				r.version = *h.SchemaVersion
+				continue
+			}
+		}
+
+		row = r.line
+		var vh VehicleJSON
+		if needsMigration(r.version) {
+			err = r.unmarshalMigrated(line, &vh)
+		} else {
+			err = json.Unmarshal(line, &vh)
+		}
+		if err != nil {
+			err = &internal.ImportRowError{Row: row, Err: jsonRowError(err)}
+			return
+		}
+		v = deserializeVehicleJSON(vh)
+		return
+	}
+
+	err = r.sc.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+// SchemaVersion is a method that returns the schema version of the records, known once the first one is read
+func (r *VehicleNDJSONReader) SchemaVersion() int {
+	return r.version
+}
+
+// unmarshalMigrated is a method that upgrades the record of a line to SchemaVersion and decodes it
+func (r *VehicleNDJSONReader) unmarshalMigrated(line []byte, vh *VehicleJSON) (err error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var m map[string]any
+	if err = dec.Decode(&m); err != nil {
+		return
+	}
+	err = unmarshalMigrated(m, r.version, vh)
+	return
+}
+
+// WriteVehiclesNDJSON is a function that writes the vehicles in the NDJSON format read by VehicleNDJSONReader, with
+// the header of SchemaVersion. Vehicles are written sorted by id
+func WriteVehiclesNDJSON(w io.Writer, v map[int]internal.Vehicle) (err error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	version := SchemaVersion
+	if err = enc.Encode(ndjsonHeader{SchemaVersion: &version}); err != nil {
+		return
+	}
+	for _, id := range sortedIds(v) {
+		if err = enc.Encode(serializeVehicleJSON(v[id])); err != nil {
+			return
+		}
+	}
+	err = bw.Flush()
+	return
+}
+
+// jsonRowError is a function that returns the error of a line of JSON: a *ValidationError when a value is not of
+// the kind of its field
+func jsonRowError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Field == "" {
+		return err
+	}
+	e := &internal.ValidationError{}
+	e.Add(typeErr.Field, internal.RuleFormat, formatMessage(typeErr.Field))
+	return e
+}
+
+// formatMessage is a function that returns the message of a value that is not of the kind of its field
+func formatMessage(field string) string {
+	switch internal.VehicleField(field).Kind() {
+	case internal.FieldKindInt:
+		return "must be an integer"
+	case internal.FieldKindFloat:
+		return "must be a number"
+	}
+	if field == "version" {
+		return "must be an integer"
+	}
+	return "must be a string"
+}
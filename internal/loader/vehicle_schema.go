@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SchemaVersion is the version of the schema of the files of vehicles written, declared by their header:
+// - JSON: {"schema_version": 3, "vehicles": [...]}, with schema_version first
+// - NDJSON: a first line {"schema_version": 3}
+// - YAML: a mapping with the keys schema_version and vehicles
+// The files without a header have schema version 1. The records of older files are upgraded to SchemaVersion by
+// the migrations when they are read. CSV files have no schema version, as their columns are mapped by name
+// (see ConfigVehicleCSV)
+const SchemaVersion = 3
+
+var (
+	// ErrUnknownSchemaVersion is the error returned when a file has a schema version that can not be read
+	ErrUnknownSchemaVersion = errors.New("unknown schema version")
+)
+
+// Migration is a function that upgrades a record of a vehicle, its values by the names of the fields, from a
+// schema version to the next one
+type Migration func(r map[string]any) error
+
+// migrations are the migrations by the schema version they upgrade from, one for each version before
+// SchemaVersion. A nil migration leaves the records as they are, so they are read without being upgraded
+// To change the schema, increment SchemaVersion and add the migration from the previous version, e.g. to rename a
+// field:
+//
+//	3: func(r map[string]any) error { r["seats"] = r["passengers"]; delete(r, "passengers"); return nil },
+var migrations = map[int]Migration{
+	// schema 2 adds the header, the records are the same
+	1: nil,
+	// schema 3 adds deleted_at and delete_reason to the vehicles in the trash, which an older reader would load
+	// as vehicles that are not deleted
+	2: nil,
+}
+
+// checkSchemaVersion is a function that returns an error when the records of a schema version can not be
+// upgraded to SchemaVersion
+func checkSchemaVersion(version int) error {
+	if version < 1 || version > SchemaVersion {
+		return fmt.Errorf("%w: %d (the latest is %d)", ErrUnknownSchemaVersion, version, SchemaVersion)
+	}
+	for v := version; v < SchemaVersion; v++ {
+		if _, ok := migrations[v]; !ok {
+			return fmt.Errorf("%w: no migration from %d", ErrUnknownSchemaVersion, v)
+		}
+	}
+	return nil
+}
+
+// needsMigration is a function that returns if the records of a schema version change when they are upgraded
+func needsMigration(version int) bool {
+	for v := version; v < SchemaVersion; v++ {
+		if migrations[v] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Migrate is a function that upgrades a record of a vehicle from a schema version to SchemaVersion, applying the
+// migrations in order
+func Migrate(r map[string]any, version int) (err error) {
+	if err = checkSchemaVersion(version); err != nil {
+		return
+	}
+	for v := version; v < SchemaVersion; v++ {
+		if m := migrations[v]; m != nil {
+			if err = m(r); err != nil {
+				return fmt.Errorf("migration from schema version %d: %w", v, err)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package loader
+
+import (
+	"app/internal"
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestVehicleFile_SchemaVersion(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		// without a header
+		"v1.json":   `[{"id": 1, "passengers": 5}]`,
+		"v1.ndjson": `{"id": 1, "passengers": 5}`,
+		"v1.yaml":   "- {id: 1, passengers: 5}\n",
+		// with a header
+		"v2.json":   `{"schema_version": 2, "vehicles": [{"id": 1, "passengers": 5}]}`,
+		"v2.ndjson": "{\"schema_version\": 2}\n{\"id\": 1, \"passengers\": 5}\n",
+		"v2.yaml":   "schema_version: 2\nvehicles:\n  - {id: 1, passengers: 5}\n",
+	}
+	for name, content := range files {
+		l := NewVehicleFile(writeFile(t, dir, name, content), nil)
+		version, err := l.SchemaVersion()
+		if err != nil || version != int(name[1]-'0') {
+			t.Errorf("%s: unexpected schema version %d, %v", name, version, err)
+		}
+		if v, err := l.Load(); err != nil || len(v) != 1 || v[1].Capacity != 5 {
+			t.Errorf("%s: unexpected vehicles %+v, %v", name, v, err)
+		}
+	}
+
+	// versions that can not be read
+	for name, content := range map[string]string{
+		"v0.json":   `{"schema_version": 0, "vehicles": []}`,
+		"v9.ndjson": `{"schema_version": 9}`,
+		"v9.yaml":   "schema_version: 9\nvehicles: []\n",
+	} {
+		if _, err := NewVehicleFile(writeFile(t, dir, name, content), nil).Load(); !errors.Is(err, ErrUnknownSchemaVersion) {
+			t.Errorf("%s: expected ErrUnknownSchemaVersion, got %v", name, err)
+		}
+	}
+	if _, err := NewVehicleFile(writeFile(t, dir, "a.csv", "id\n1\n"), nil).SchemaVersion(); !errors.Is(err, ErrNoSchemaVersion) {
+		t.Errorf("expected ErrNoSchemaVersion, got %v", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	// the records of schema 1 had seats instead of passengers
+	original := migrations
+	t.Cleanup(func() { migrations = original })
+	migrations = make(map[int]Migration)
+	for v, m := range original {
+		migrations[v] = m
+	}
+	migrations[1] = func(r map[string]any) error {
+		if seats, ok := r["seats"]; ok {
+			r["passengers"] = seats
+			delete(r, "seats")
+		}
+		if r["id"] == nil {
+			return errors.New("the id is required")
+		}
+		return nil
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.json":   `[{"id": 1, "seats": 5}, {"seats": 2}, {"id": 3, "seats": "five"}, {"id": 12345678901, "seats": 7}]`,
+		"b.ndjson": "{\"id\": 1, \"seats\": 5}\n{\"seats\": 2}\n{\"id\": 3, \"seats\": \"five\"}\n{\"id\": 12345678901, \"seats\": 7}\n",
+		"c.yaml":   "- {id: 1, seats: 5}\n- {seats: 2}\n- {id: 3, seats: five}\n- {id: 12345678901, seats: 7}\n",
+	}
+	for name, content := range files {
+		var rows []int
+		v := make(map[int]internal.Vehicle)
+		err := NewVehicleFile(writeFile(t, dir, name, content), nil).Records(func(r internal.VehicleRecord) error {
+			if r.Err != nil {
+				rows = append(rows, r.Row)
+				return nil
+			}
+			v[r.Vehicle.Id] = r.Vehicle
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// the migration fails for 2, and the upgraded value of 3 is not a number
+		if v[1].Capacity != 5 || v[12345678901].Capacity != 7 || len(v) != 2 {
+			t.Errorf("%s: unexpected vehicles %+v", name, v)
+		}
+		if fmt.Sprint(rows) != "[2 3]" {
+			t.Errorf("%s: expected errors at rows 2 and 3, got %v", name, rows)
+		}
+	}
+
+	// the files written are not upgraded again
+	var b bytes.Buffer
+	if err := WriteVehiclesJSON(&b, map[int]internal.Vehicle{1: {Id: 1, VehicleAttributes: internal.VehicleAttributes{Capacity: 5}}}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := readVehicles(NewVehicleJSONReader(&b)); err != nil || v[1].Capacity != 5 {
+		t.Errorf("unexpected vehicles %+v, %v", v, err)
+	}
+}
@@ -0,0 +1,223 @@
+package loader
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+)
+
+// LoadPolicy is what a strict load does with the records that have issues
+type LoadPolicy string
+
+const (
+	// LoadPolicyFail fails the load when any record has issues
+	LoadPolicyFail LoadPolicy = "fail"
+	// LoadPolicySkip loads only the records without issues
+	LoadPolicySkip LoadPolicy = "skip"
+	// LoadPolicyWarn loads every record that can be read, as a load that is not strict, and only reports the issues
+	LoadPolicyWarn LoadPolicy = "warn"
+)
+
+// MaxLoadIssues is the maximum number of issues described in a LoadReport
+const MaxLoadIssues = 1000
+
+var (
+	// ErrLoadIssues is the error returned by a strict load with LoadPolicyFail when records have issues
+	ErrLoadIssues = errors.New("the vehicles loaded have issues")
+	// ErrUnknownLoadPolicy is the error returned when a load policy is not known
+	ErrUnknownLoadPolicy = errors.New("unknown load policy")
+)
+
+// ParseLoadPolicy is a function that returns the load policy with a name
+func ParseLoadPolicy(name string) (p LoadPolicy, err error) {
+	switch p = LoadPolicy(name); p {
+	case LoadPolicyFail, LoadPolicySkip, LoadPolicyWarn:
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownLoadPolicy, name)
+	}
+	return
+}
+
+// LoadIssue is a struct that represents an issue of a record of a strict load
+type LoadIssue struct {
+	// Path is the path of the file of the record
+	Path string
+	// Row is the row of the record (see internal.VehicleRecord)
+	Row int
+	// Id is the id of the vehicle, if it was read
+	Id int
+	// Registration is the registration of the vehicle, if it was read
+	Registration string
+	// Err is the issue: a *ValidationError for the invalid fields, ErrVehicleIdAlreadyExists or
+	// ErrVehicleRegistrationAlreadyExists for the records with the id or the registration of an earlier one
+	Err error
+}
+
+// LoadReport is a struct that represents the result of a strict load
+type LoadReport struct {
+	// Policy is the policy of the load
+	Policy LoadPolicy
+	// Records is the number of records read
+	Records int
+	// Loaded is the number of records loaded
+	Loaded int
+	// Rejected is the number of records with issues
+	Rejected int
+	// Issues are the first MaxLoadIssues issues, in the order of the records
+	Issues []LoadIssue
+	// Truncated is true when there are more issues than Issues
+	Truncated bool
+}
+
+// add is a method that describes an issue, up to MaxLoadIssues issues
+func (r *LoadReport) add(issue LoadIssue) {
+	if len(r.Issues) >= MaxLoadIssues {
+		r.Truncated = true
+		return
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// ConfigVehicleStrict is a struct that represents the configuration for VehicleStrict
+type ConfigVehicleStrict struct {
+	// Policy is what is done with the records that have issues (LoadPolicyFail by default)
+	Policy LoadPolicy
+	// Check checks a vehicle, e.g. with the validation rules, and may replace its values with their canonical
+	// values. It returns a *ValidationError for the invalid fields. Vehicles are not checked when it is nil
+	Check func(v *internal.Vehicle) error
+	// Report is called with the report of every load, also when it fails with LoadPolicyFail
+	Report func(r LoadReport)
+}
+
+// NewVehicleStrict is a function that returns a new instance of VehicleStrict
+func NewVehicleStrict(ld internal.VehicleRecordLoader, cfg *ConfigVehicleStrict) *VehicleStrict {
+	// default values
+	defaultConfig := &ConfigVehicleStrict{
+		Policy: LoadPolicyFail,
+	}
+	if cfg != nil {
+		if cfg.Policy != "" {
+			defaultConfig.Policy = cfg.Policy
+		}
+		if cfg.Check != nil {
+			defaultConfig.Check = cfg.Check
+		}
+		if cfg.Report != nil {
+			defaultConfig.Report = cfg.Report
+		}
+	}
+
+	return &VehicleStrict{
+		ld:     ld,
+		policy: defaultConfig.Policy,
+		check:  defaultConfig.Check,
+		report: defaultConfig.Report,
+	}
+}
+
+// VehicleStrict is a struct that implements the VehicleRecordLoader interface checking every record of another
+// loader:
+// the records that can not be read, that are invalid, or that have the id or the registration (in its normalized
+// form) of an earlier record have issues, which are reported and handled by the policy
+type VehicleStrict struct {
+	// ld is the loader of the records
+	ld internal.VehicleRecordLoader
+	// policy is what is done with the records that have issues
+	policy LoadPolicy
+	// check checks a vehicle, or nil
+	check func(v *internal.Vehicle) error
+	// report is called with the report of every load, or nil
+	report func(r LoadReport)
+}
+
+// Load is a method that loads the vehicles of the records, according to the policy
+func (l *VehicleStrict) Load() (v map[int]internal.Vehicle, err error) {
+	v = make(map[int]internal.Vehicle)
+	err = l.Records(func(r internal.VehicleRecord) error {
+		v[r.Vehicle.Id] = r.Vehicle
+		return nil
+	})
+	if err != nil {
+		v = nil
+	}
+	return
+}
+
+// Records is a method that calls fn with the records loaded according to the policy, in order: the ones without
+// issues, or with LoadPolicyWarn every record that can be read and does not have the id of an earlier record. With LoadPolicyFail the records are passed to fn
+// before the issues of the later ones are known, so the caller must discard them when it fails with ErrLoadIssues
+func (l *VehicleStrict) Records(fn func(r internal.VehicleRecord) error) (err error) {
+	if _, err = ParseLoadPolicy(string(l.policy)); err != nil {
+		return
+	}
+
+	report := LoadReport{Policy: l.policy}
+	ids := make(map[int]bool)
+	registrations := make(map[string]bool)
+	err = l.ld.Records(func(r internal.VehicleRecord) error {
+		report.Records++
+		issue := LoadIssue{Path: r.Path, Row: r.Row, Id: r.Vehicle.Id, Registration: r.Vehicle.Registration}
+		if r.Err != nil {
+			// nothing to load, whatever the policy
+			report.Rejected++
+			issue.Err = r.Err
+			report.add(issue)
+			return nil
+		}
+
+		vh := r.Vehicle
+		var issues []error
+		if l.check != nil {
+			err := l.check(&vh)
+			var validationErr *internal.ValidationError
+			switch {
+			case errors.As(err, &validationErr):
+				issues = append(issues, err)
+			case err != nil:
+				return err
+			}
+		}
+		// the registrations of the vehicles in the trash can be taken by other vehicles
+		registration := ""
+		if !vh.Deleted() {
+			registration = internal.NormalizeRegistration(vh.Registration)
+		}
+		if ids[vh.Id] {
+			issues = append(issues, internal.ErrVehicleIdAlreadyExists)
+		}
+		if registration != "" && registrations[registration] {
+			issues = append(issues, internal.ErrVehicleRegistrationAlreadyExists)
+		}
+		if len(issues) > 0 {
+			report.Rejected++
+			for _, err := range issues {
+				issue.Err = err
+				report.add(issue)
+			}
+			// a record with the id of an earlier one would replace it, so it is not loaded whatever the policy
+			if l.policy != LoadPolicyWarn || ids[vh.Id] {
+				return nil
+			}
+		}
+
+		ids[vh.Id] = true
+		if registration != "" {
+			registrations[registration] = true
+		}
+		report.Loaded++
+		r.Vehicle = vh
+		return fn(r)
+	})
+	if err != nil {
+		return
+	}
+	if l.policy == LoadPolicyFail && report.Rejected > 0 {
+		report.Loaded = 0
+		err = fmt.Errorf("%w: %d of %d records", ErrLoadIssues, report.Rejected, report.Records)
+	}
+
+	if l.report != nil {
+		l.report(report)
+	}
+	return
+}
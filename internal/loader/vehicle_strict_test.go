@@ -0,0 +1,79 @@
+package loader
+
+import (
+	"app/internal"
+	"errors"
+	"testing"
+)
+
+func TestVehicleStrict(t *testing.T) {
+	dir := t.TempDir()
+	// 2 has the id of 1, 3 the registration of 1, 4 is invalid and 5 can not be read
+	path := writeFile(t, dir, "seed.yaml", ""+
+		"- {id: 1, registration: ab1, length: 400}\n"+
+		"- {id: 1, registration: AB2, length: 400}\n"+
+		"- {id: 3, registration: A B1, length: 400}\n"+
+		"- {id: 4, registration: AB4}\n"+
+		"- {id: 5, registration: AB5, length: long}\n"+
+		"- {id: 6, registration: AB6, length: 400}\n")
+	check := func(v *internal.Vehicle) error {
+		if v.Length == 0 {
+			e := &internal.ValidationError{}
+			e.Add("length", internal.RuleRequired, "is required")
+			return e
+		}
+		return nil
+	}
+
+	cases := map[LoadPolicy][]int{
+		LoadPolicyFail: nil,
+		LoadPolicySkip: {1, 6},
+		LoadPolicyWarn: {1, 3, 4, 6},
+	}
+	for policy, ids := range cases {
+		var report LoadReport
+		v, err := NewVehicleStrict(NewVehicleLoader(path, nil), &ConfigVehicleStrict{
+			Policy: policy,
+			Check:  check,
+			Report: func(r LoadReport) { report = r },
+		}).Load()
+
+		if policy == LoadPolicyFail {
+			if !errors.Is(err, ErrLoadIssues) {
+				t.Errorf("%s: expected ErrLoadIssues, got %v", policy, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", policy, err)
+		}
+		if len(v) != len(ids) {
+			t.Errorf("%s: expected vehicles %v, got %+v", policy, ids, v)
+		}
+		for _, id := range ids {
+			if _, ok := v[id]; !ok {
+				t.Errorf("%s: expected vehicle %d", policy, id)
+			}
+		}
+
+		if len(ids) > 0 && v[1].Registration != "ab1" {
+			t.Errorf("%s: expected the first vehicle 1, got %+v", policy, v[1])
+		}
+
+		if report.Records != 6 || report.Rejected != 4 || report.Loaded != len(ids) || len(report.Issues) != 4 {
+			t.Fatalf("%s: unexpected report %+v", policy, report)
+		}
+		expected := []struct {
+			row int
+			err error
+		}{
+			{2, internal.ErrVehicleIdAlreadyExists},
+			{3, internal.ErrVehicleRegistrationAlreadyExists},
+			{4, internal.ErrFieldRequired},
+			{5, internal.ErrInvalidFieldValue},
+		}
+		for i, issue := range report.Issues {
+			if issue.Row != expected[i].row || !errors.Is(issue.Err, expected[i].err) {
+				t.Errorf("%s: expected %v at row %d, got %+v", policy, expected[i].err, expected[i].row, issue)
+			}
+		}
+	}
+}
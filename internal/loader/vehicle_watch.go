@@ -0,0 +1,120 @@
+package loader
+
+import (
+	"app/internal"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConfigVehicleWatcher is a struct that represents the configuration for VehicleWatcher
+type ConfigVehicleWatcher struct {
+	// Interval is the time between the checks of the files (1 second by default)
+	Interval time.Duration
+}
+
+// NewVehicleWatcher is a function that returns a new instance of VehicleWatcher
+// path is the path of the files of ld: a file, a directory or a pattern (see NewVehicleLoader)
+func NewVehicleWatcher(path string, ld internal.VehicleLoader, cfg *ConfigVehicleWatcher) *VehicleWatcher {
+	// default values
+	defaultConfig := &ConfigVehicleWatcher{
+		Interval: time.Second,
+	}
+	if cfg != nil {
+		if cfg.Interval > 0 {
+			defaultConfig.Interval = cfg.Interval
+		}
+	}
+
+	return &VehicleWatcher{path: path, ld: ld, interval: defaultConfig.Interval}
+}
+
+// VehicleWatcher is a struct that polls the files of a loader and loads the vehicles again when they change
+// The files are compared by their names, sizes and modification times, so it works on any file system
+type VehicleWatcher struct {
+	// path is the path of the files
+	path string
+	// ld is the loader of the vehicles of the files
+	ld internal.VehicleLoader
+	// interval is the time between the checks of the files
+	interval time.Duration
+}
+
+// Watch is a method that checks the files every interval until ctx is done, and calls fn with the vehicles
+// loaded when they change from how they were when Watch was called
+// Files are loaded once they are the same in two checks in a row, so a file being written is not loaded halfway
+// The errors of the load (e.g. a malformed file) and of fn are passed to onError, and the files are not loaded
+// again until they change again
+func (w *VehicleWatcher) Watch(ctx context.Context, fn func(v map[int]internal.Vehicle) error, onError func(err error)) {
+	loaded := w.fingerprint()
+	pending := loaded
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fp := w.fingerprint()
+		if fp != pending {
+			// changing, wait until it is stable
+			pending = fp
+			continue
+		}
+		if fp == loaded {
+			continue
+		}
+		loaded = fp
+
+		v, err := w.ld.Load()
+		if err == nil {
+			err = fn(v)
+		}
+		if err != nil {
+			onError(err)
+		}
+	}
+}
+
+// fingerprint is a method that returns the names, sizes and modification times of the files (of a known format,
+// for a directory), or the error that lists them, so any change of the files changes it
+func (w *VehicleWatcher) fingerprint() string {
+	var paths []string
+	var err error
+	switch info, errStat := os.Stat(w.path); {
+	case IsPattern(w.path):
+		paths, err = filepath.Glob(w.path)
+	case errStat == nil && info.IsDir():
+		var entries []os.DirEntry
+		entries, err = os.ReadDir(w.path)
+		for _, e := range entries {
+			if _, errFormat := DetectFormat(e.Name()); errFormat == nil {
+				paths = append(paths, filepath.Join(w.path, e.Name()))
+			}
+		}
+	default:
+		paths = []string{w.path}
+	}
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&b, "%s: %v\n", path, err)
+			continue
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package loader
+
+import (
+	"app/internal"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestVehicleWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "seed.json", `[{"id": 1}]`)
+
+	loaded := make(chan map[int]internal.Vehicle, 1)
+	failed := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewVehicleWatcher(path, NewVehicleLoader(path, nil), &ConfigVehicleWatcher{Interval: 5 * time.Millisecond}).Watch(ctx,
+			func(v map[int]internal.Vehicle) error {
+				loaded <- v
+				return nil
+			},
+			func(err error) {
+				failed <- err
+			},
+		)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// a malformed file is reported, and loaded again once it changes
+	time.Sleep(20 * time.Millisecond)
+	writeFile(t, dir, "seed.json", `[{"id": 1}, {"id":`)
+	select {
+	case <-failed:
+	case v := <-loaded:
+		t.Fatalf("expected the malformed file to fail, got %+v", v)
+	case <-time.After(time.Second):
+		t.Fatal("expected the malformed file to be loaded")
+	}
+
+	writeFile(t, dir, "seed.json", `[{"id": 1}, {"id": 2}]`)
+	select {
+	case v := <-loaded:
+		if len(v) != 2 {
+			t.Fatalf("expected 2 vehicles, got %+v", v)
+		}
+	case err := <-failed:
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("expected the changed file to be loaded")
+	}
+}
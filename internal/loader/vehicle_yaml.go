@@ -0,0 +1,183 @@
+package loader
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NewVehicleYAMLReader is a function that returns a new instance of VehicleYAMLReader
+func NewVehicleYAMLReader(r io.Reader) *VehicleYAMLReader {
+	return &VehicleYAMLReader{dec: yaml.NewDecoder(r)}
+}
+
+// VehicleYAMLReader is a struct that implements the VehicleReader interface for a YAML sequence of vehicles, with
+// the keys of VehicleJSON, with or without the header of its schema version (see SchemaVersion). An empty document
+// has no vehicles
+type VehicleYAMLReader struct {
+	// dec is the decoder of the document
+	dec *yaml.Decoder
+	// nodes are the nodes of the vehicles, nil until the document is read
+	nodes []*yaml.Node
+	// row is the position of the last vehicle read
+	row int
+	// version is the schema version of the records
+	version int
+}
+
+// yamlHeader is a struct that represents a YAML document with a header
+type yamlHeader struct {
+	SchemaVersion int           `yaml:"schema_version"`
+	Vehicles      []VehicleJSON `yaml:"vehicles"`
+}
+
+// Read is a method that returns the next vehicle of the sequence and its position (from 1), or io.EOF at the end
+// The records of older schema versions are upgraded to SchemaVersion
+func (r *VehicleYAMLReader) Read() (v internal.Vehicle, row int, err error) {
+	if r.nodes == nil {
+		if err = r.readDocument(); err != nil {
+			return
+		}
+	}
+	if r.row >= len(r.nodes) {
+		err = io.EOF
+		return
+	}
+
+	n := r.nodes[r.row]
+	r.row++
+	row = r.row
+	if needsMigration(r.version) {
+		if n, err = migrateYAML(n, r.version); err != nil {
+			err = &internal.ImportRowError{Row: row, Err: err}
+			return
+		}
+	}
+	var vh VehicleJSON
+	if err = n.Decode(&vh); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			err = &internal.ImportRowError{Row: row, Err: yamlRowError(n, err)}
+		}
+		return
+	}
+	v = deserializeVehicleJSON(vh)
+	return
+}
+
+// SchemaVersion is a method that returns the schema version of the records, known once the first one is read
+func (r *VehicleYAMLReader) SchemaVersion() int {
+	return r.version
+}
+
+// readDocument is a method that reads the sequence of the vehicles of the document, in its header if any
+func (r *VehicleYAMLReader) readDocument() (err error) {
+	r.version = 1
+	var doc yaml.Node
+	err = r.dec.Decode(&doc)
+	switch {
+	case errors.Is(err, io.EOF):
+		r.nodes = []*yaml.Node{}
+		return nil
+	case err != nil:
+		return
+	}
+
+	seq := &doc
+	if seq.Kind == yaml.DocumentNode && len(seq.Content) == 1 {
+		seq = seq.Content[0]
+	}
+	if seq.Kind == yaml.MappingNode {
+		if seq, err = r.readHeader(seq); err != nil {
+			return
+		}
+	}
+	if seq.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: expected a sequence of vehicles", seq.Line)
+	}
+	r.nodes = seq.Content
+	return
+}
+
+// readHeader is a method that reads the schema version of a header and returns the sequence of its vehicles
+func (r *VehicleYAMLReader) readHeader(n *yaml.Node) (seq *yaml.Node, err error) {
+	version := 0
+	seq = &yaml.Node{Kind: yaml.SequenceNode}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		switch key.Value {
+		case "schema_version":
+			if err = value.Decode(&version); err != nil {
+				err = fmt.Errorf("line %d: schema_version: %w", value.Line, err)
+				return
+			}
+		case "vehicles":
+			seq = value
+		default:
+			err = fmt.Errorf("line %d: unknown key %s of the header", key.Line, key.Value)
+			return
+		}
+	}
+	if err = checkSchemaVersion(version); err != nil {
+		err = fmt.Errorf("line %d: %w", n.Line, err)
+		return
+	}
+	r.version = version
+	return
+}
+
+// migrateYAML is a function that returns the node of a vehicle in YAML upgraded from a schema version to
+// SchemaVersion
+func migrateYAML(n *yaml.Node, version int) (migrated *yaml.Node, err error) {
+	var m map[string]any
+	if err = n.Decode(&m); err != nil {
+		return
+	}
+	if err = Migrate(m, version); err != nil {
+		return
+	}
+	migrated = &yaml.Node{}
+	err = migrated.Encode(m)
+	return
+}
+
+// WriteVehiclesYAML is a function that writes the vehicles in the YAML format read by VehicleYAMLReader, with the
+// header of SchemaVersion. Vehicles are written sorted by id
+func WriteVehiclesYAML(w io.Writer, v map[int]internal.Vehicle) (err error) {
+	doc := yamlHeader{SchemaVersion: SchemaVersion, Vehicles: make([]VehicleJSON, 0, len(v))}
+	for _, id := range sortedIds(v) {
+		doc.Vehicles = append(doc.Vehicles, serializeVehicleJSON(v[id]))
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err = enc.Encode(doc); err != nil {
+		return
+	}
+	err = enc.Close()
+	return
+}
+
+// yamlRowError is a function that returns the error of a vehicle in YAML whose values are not of the kind of their
+// fields: a *ValidationError with a violation for each one, or err when it is not a mapping
+func yamlRowError(n *yaml.Node, err error) error {
+	if n.Kind != yaml.MappingNode {
+		return err
+	}
+	e := &internal.ValidationError{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		// each key alone, to find the ones that fail
+		pair := &yaml.Node{Kind: yaml.MappingNode, Content: n.Content[i : i+2]}
+		var vh VehicleJSON
+		if pair.Decode(&vh) != nil {
+			field := n.Content[i].Value
+			e.Add(field, internal.RuleFormat, formatMessage(field))
+		}
+	}
+	if e.Err() == nil {
+		return err
+	}
+	return e
+}
@@ -0,0 +1,109 @@
+package loader
+
+import (
+	"app/internal"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// defaultVocabularies are the vocabularies used when there is no vocabularies file
+//
+//go:embed vocabularies_default.json
+var defaultVocabularies []byte
+
+// NewVocabularyJSONFile is a function that returns a new instance of VocabularyJSONFile
+func NewVocabularyJSONFile(path string) *VocabularyJSONFile {
+	return &VocabularyJSONFile{
+		path: path,
+	}
+}
+
+// VocabularyJSONFile is a struct that implements the VocabularyLoader interface
+type VocabularyJSONFile struct {
+	// path is the path to the file that contains the vocabularies in JSON format
+	path string
+}
+
+// VocabularyJSON is a struct that represents a vocabulary in JSON format
+type VocabularyJSON struct {
+	Field string     `json:"field"`
+	Terms []TermJSON `json:"terms"`
+}
+
+// TermJSON is a struct that represents a term of a vocabulary in JSON format
+type TermJSON struct {
+	Value   string   `json:"value"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// Load is a method that loads the vocabularies
+func (l *VocabularyJSONFile) Load() (v []internal.Vocabulary, err error) {
+	// open file
+	file, err := os.Open(l.path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	v, err = readVocabulariesJSON(file)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", l.path, err)
+	}
+	return
+}
+
+// DefaultVocabularies is a function that returns the default vocabularies
+func DefaultVocabularies() []internal.Vocabulary {
+	v, err := readVocabulariesJSON(bytes.NewReader(defaultVocabularies))
+	if err != nil {
+		panic(fmt.Sprintf("invalid default vocabularies: %v", err))
+	}
+	return v
+}
+
+// readVocabulariesJSON is a function that decodes vocabularies in JSON format
+func readVocabulariesJSON(r io.Reader) (v []internal.Vocabulary, err error) {
+	// decode
+	var vocabulariesJSON []VocabularyJSON
+	if err = json.NewDecoder(r).Decode(&vocabulariesJSON); err != nil {
+		return
+	}
+
+	// deserialize vocabularies
+	v = make([]internal.Vocabulary, 0, len(vocabulariesJSON))
+	for _, vj := range vocabulariesJSON {
+		f := internal.VehicleField(vj.Field)
+		if !internal.IsVocabularyField(f) {
+			err = fmt.Errorf("%w: %q has no vocabulary", internal.ErrVocabularyNotFound, vj.Field)
+			return
+		}
+		vocabulary := internal.Vocabulary{Field: f, Terms: make([]internal.Term, 0, len(vj.Terms))}
+		for _, tj := range vj.Terms {
+			vocabulary.Terms = append(vocabulary.Terms, internal.Term{Value: tj.Value, Aliases: tj.Aliases})
+		}
+		v = append(v, vocabulary)
+	}
+	return
+}
+
+// WriteVocabulariesJSON is a function that writes vocabularies in the same JSON format read by VocabularyJSONFile
+func WriteVocabulariesJSON(w io.Writer, v []internal.Vocabulary) (err error) {
+	// serialize vocabularies
+	vocabulariesJSON := make([]VocabularyJSON, 0, len(v))
+	for _, vocabulary := range v {
+		vj := VocabularyJSON{Field: string(vocabulary.Field), Terms: make([]TermJSON, 0, len(vocabulary.Terms))}
+		for _, t := range vocabulary.Terms {
+			vj.Terms = append(vj.Terms, TermJSON{Value: t.Value, Aliases: t.Aliases})
+		}
+		vocabulariesJSON = append(vocabulariesJSON, vj)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(vocabulariesJSON)
+	return
+}
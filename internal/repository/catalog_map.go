@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// NewCatalogMap is a function that returns a new instance of CatalogMap with some brands
+// When path is not empty every change is written to that file
+func NewCatalogMap(b []internal.Brand, path string) (r *CatalogMap, err error) {
+	brands := copyBrands(b)
+	if err = checkBrands(brands); err != nil {
+		return
+	}
+	r = &CatalogMap{brands: brands, path: path}
+	return
+}
+
+// CatalogMap is a struct that represents a catalog repository in memory, optionally persisted in a JSON file
+type CatalogMap struct {
+	// mu guards brands
+	mu sync.RWMutex
+	// brands are the brands with their models, in the order they were added
+	brands []internal.Brand
+	// path is the path to the file where the catalog is persisted, or empty
+	path string
+}
+
+// FindAll is a method that returns all the brands with their models
+func (r *CatalogMap) FindAll() (b []internal.Brand, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	b = copyBrands(r.brands)
+	return
+}
+
+// GetBrand is a method that returns a brand with its models
+func (r *CatalogMap) GetBrand(name string) (b internal.Brand, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := brandIndex(r.brands, name)
+	if i < 0 {
+		err = internal.ErrBrandNotFound
+		return
+	}
+	b = copyBrands(r.brands[i : i+1])[0]
+	return
+}
+
+// AddBrand is a method that adds a brand with its models
+func (r *CatalogMap) AddBrand(b internal.Brand) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if brandIndex(r.brands, b.Name) >= 0 {
+		return internal.ErrBrandAlreadyExists
+	}
+	updated := append(copyBrands(r.brands), copyBrands([]internal.Brand{b})...)
+	if err = checkBrands(updated); err != nil {
+		return
+	}
+
+	err = r.commit(updated)
+	return
+}
+
+// DeleteBrand is a method that deletes a brand with its models
+func (r *CatalogMap) DeleteBrand(name string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := brandIndex(r.brands, name)
+	if i < 0 {
+		return internal.ErrBrandNotFound
+	}
+	updated := append(copyBrands(r.brands[:i]), copyBrands(r.brands[i+1:])...)
+
+	err = r.commit(updated)
+	return
+}
+
+// AddModel is a method that adds a model to a brand
+func (r *CatalogMap) AddModel(brand string, m internal.Model) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := brandIndex(r.brands, brand)
+	if i < 0 {
+		return internal.ErrBrandNotFound
+	}
+	if _, ok := r.brands[i].Model(m.Name); ok {
+		return internal.ErrModelAlreadyExists
+	}
+	updated := copyBrands(r.brands)
+	updated[i].Models = append(updated[i].Models, m)
+	if err = checkBrands(updated); err != nil {
+		return
+	}
+
+	err = r.commit(updated)
+	return
+}
+
+// UpdateModel is a method that replaces a model of a brand
+func (r *CatalogMap) UpdateModel(brand, name string, m internal.Model) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := brandIndex(r.brands, brand)
+	if i < 0 {
+		return internal.ErrBrandNotFound
+	}
+	j := modelIndex(r.brands[i].Models, name)
+	if j < 0 {
+		return internal.ErrModelNotFound
+	}
+	updated := copyBrands(r.brands)
+	updated[i].Models[j] = m
+	if err = checkBrands(updated); err != nil {
+		return
+	}
+
+	err = r.commit(updated)
+	return
+}
+
+// DeleteModel is a method that deletes a model of a brand
+func (r *CatalogMap) DeleteModel(brand, name string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := brandIndex(r.brands, brand)
+	if i < 0 {
+		return internal.ErrBrandNotFound
+	}
+	j := modelIndex(r.brands[i].Models, name)
+	if j < 0 {
+		return internal.ErrModelNotFound
+	}
+	updated := copyBrands(r.brands)
+	updated[i].Models = append(updated[i].Models[:j], updated[i].Models[j+1:]...)
+
+	err = r.commit(updated)
+	return
+}
+
+// Save is a method that writes the catalog to its file, e.g. after it is created from the vehicles
+func (r *CatalogMap) Save() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.commit(r.brands)
+	return
+}
+
+// commit is a method that replaces the brands, writing them to the file first (if any) so a failed write leaves
+// the catalog unchanged. It must be called with mu locked
+func (r *CatalogMap) commit(brands []internal.Brand) (err error) {
+	if r.path != "" {
+		err = WriteFileAtomic(r.path, func(w io.Writer) error {
+			return loader.WriteCatalogJSON(w, brands)
+		})
+		if err != nil {
+			return
+		}
+	}
+	r.brands = brands
+	return
+}
+
+// checkBrands is a function that checks that brands and models have a name and that no brand, or model of a brand,
+// has the key of another one
+func checkBrands(brands []internal.Brand) error {
+	seen := make(map[string]bool, len(brands))
+	for _, b := range brands {
+		key := internal.CatalogKey(b.Name)
+		if key == "" {
+			return fmt.Errorf("%w: brand name", internal.ErrFieldRequired)
+		}
+		if seen[key] {
+			return fmt.Errorf("%w: %q", internal.ErrBrandAlreadyExists, b.Name)
+		}
+		seen[key] = true
+
+		models := make(map[string]bool, len(b.Models))
+		for _, m := range b.Models {
+			key := internal.CatalogKey(m.Name)
+			if key == "" {
+				return fmt.Errorf("%w: model name of %q", internal.ErrFieldRequired, b.Name)
+			}
+			if models[key] {
+				return fmt.Errorf("%w: %q of %q", internal.ErrModelAlreadyExists, m.Name, b.Name)
+			}
+			models[key] = true
+		}
+	}
+	return nil
+}
+
+// brandIndex is a function that returns the position of the brand with a name, compared by its key, or -1
+func brandIndex(brands []internal.Brand, name string) int {
+	key := internal.CatalogKey(name)
+	for i, b := range brands {
+		if internal.CatalogKey(b.Name) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// modelIndex is a function that returns the position of the model with a name, compared by its key, or -1
+func modelIndex(models []internal.Model, name string) int {
+	key := internal.CatalogKey(name)
+	for i, m := range models {
+		if internal.CatalogKey(m.Name) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// copyBrands is a function that returns a deep copy of brands
+func copyBrands(brands []internal.Brand) []internal.Brand {
+	c := make([]internal.Brand, 0, len(brands))
+	for _, b := range brands {
+		c = append(c, internal.Brand{Name: b.Name, Models: append([]internal.Model{}, b.Models...)})
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCatalogMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	rp, err := NewCatalogMap([]internal.Brand{
+		{Name: "Ford", Models: []internal.Model{{Name: "Focus", Specs: internal.ModelSpecs{Capacity: 5}}}},
+	}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// brands and models are unique, ignoring case and spaces
+	if err := rp.AddBrand(internal.Brand{Name: " FORD"}); !errors.Is(err, internal.ErrBrandAlreadyExists) {
+		t.Fatalf("expected ErrBrandAlreadyExists, got %v", err)
+	}
+	if err := rp.AddModel("ford", internal.Model{Name: "focus"}); !errors.Is(err, internal.ErrModelAlreadyExists) {
+		t.Fatalf("expected ErrModelAlreadyExists, got %v", err)
+	}
+	if err := rp.AddModel("Toyota", internal.Model{Name: "Corolla"}); !errors.Is(err, internal.ErrBrandNotFound) {
+		t.Fatalf("expected ErrBrandNotFound, got %v", err)
+	}
+
+	// changes
+	if err := rp.AddBrand(internal.Brand{Name: "Toyota", Models: []internal.Model{{Name: "Corolla"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.AddModel("ford", internal.Model{Name: "Fiesta"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.UpdateModel("Ford", "FOCUS", internal.Model{Name: "Focus", Specs: internal.ModelSpecs{MaxSpeed: 190}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.UpdateModel("Ford", "Fiesta", internal.Model{Name: "Focus"}); !errors.Is(err, internal.ErrModelAlreadyExists) {
+		t.Fatalf("renamed to another model: expected ErrModelAlreadyExists, got %v", err)
+	}
+	if err := rp.DeleteModel("Toyota", "Yaris"); !errors.Is(err, internal.ErrModelNotFound) {
+		t.Fatalf("expected ErrModelNotFound, got %v", err)
+	}
+	if err := rp.DeleteBrand("toyota"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := rp.GetBrand("ford")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := internal.Brand{Name: "Ford", Models: []internal.Model{
+		{Name: "Focus", Specs: internal.ModelSpecs{MaxSpeed: 190}},
+		{Name: "Fiesta"},
+	}}
+	if !reflect.DeepEqual(b, expected) {
+		t.Fatalf("expected %v, got %v", expected, b)
+	}
+
+	// the file has the same catalog
+	all, err := rp.FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := loader.NewCatalogJSONFile(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, all) {
+		t.Fatalf("expected %v in the file, got %v", all, got)
+	}
+}
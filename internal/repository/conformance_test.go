@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/repository/repositorytest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestVehicleFile_Conformance runs the conformance test suite against VehicleFile
+func TestVehicleFile_Conformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) internal.VehicleRepository {
+		rp := NewVehicleFile(nil, filepath.Join(t.TempDir(), "vehicles.json"), time.Millisecond)
+		t.Cleanup(func() {
+			if err := rp.Close(); err != nil {
+				t.Errorf("close: %v", err)
+			}
+		})
+		return rp
+	})
+}
+
+// TestVehicleFile_ConformanceSync runs the conformance test suite against VehicleFile writing every change
+func TestVehicleFile_ConformanceSync(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) internal.VehicleRepository {
+		rp := NewVehicleFile(nil, filepath.Join(t.TempDir(), "vehicles.json"), 0)
+		t.Cleanup(func() {
+			if err := rp.Close(); err != nil {
+				t.Errorf("close: %v", err)
+			}
+		})
+		return rp
+	})
+}
+
+// TestVehicleWAL_Conformance runs the conformance test suite against VehicleWAL
+func TestVehicleWAL_Conformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) internal.VehicleRepository {
+		rp, err := NewVehicleWAL(nil, &ConfigVehicleWAL{
+			SnapshotPath:     filepath.Join(t.TempDir(), "vehicles.json"),
+			CompactThreshold: 2,
+		})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := rp.Close(); err != nil {
+				t.Errorf("close: %v", err)
+			}
+		})
+		return rp
+	})
+}
+
+// TestVehicleSQLite_Conformance runs the conformance test suite against VehicleSQLite
+func TestVehicleSQLite_Conformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) internal.VehicleRepository {
+		db, err := OpenSQLite(filepath.Join(t.TempDir(), "vehicles.db"))
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		rp := NewVehicleSQLite(db)
+		t.Cleanup(func() {
+			if err := rp.Close(); err != nil {
+				t.Errorf("close: %v", err)
+			}
+		})
+		if err := rp.Migrate(); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		return rp
+	})
+}
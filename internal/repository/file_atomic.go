@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic is a function that replaces the file at path with the content written by write
+// The content is written to a temporary file in the same directory, synced and then renamed over path,
+// so readers (and a crash) see either the old file or the new one, never a half-written file
+func WriteFileAtomic(path string, write func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(path)
+
+	// temporary file
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		// on error the temporary file is removed, on success it does not exist anymore
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	// write and sync content
+	if err = write(tmp); err != nil {
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	// replace file
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return
+	}
+
+	// sync directory so the rename is durable
+	err = syncDir(dir)
+	return
+}
+
+// syncDir is a function that flushes the directory entry changes to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// some platforms do not support syncing directories, so a failure here is not fatal
+	_ = d.Sync()
+	return nil
+}
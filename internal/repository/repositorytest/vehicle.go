@@ -0,0 +1,1118 @@
+// Package repositorytest implements a conformance test suite for implementations of internal.VehicleRepository
+package repositorytest
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// NewVehicleRepositoryFunc is a function that returns a new, empty repository for a test
+// Resources of the repository should be released with t.Cleanup
+type NewVehicleRepositoryFunc func(t *testing.T) internal.VehicleRepository
+
+// Run is a function that runs the conformance test suite against the repositories returned by newRepository
+// Every test case gets its own repository
+func Run(t *testing.T, newRepository NewVehicleRepositoryFunc) {
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepository(t))
+		})
+	}
+}
+
+// testCase is a struct that represents a test case of the suite
+type testCase struct {
+	// name is the name of the test case
+	name string
+	// run is the function that runs the test case
+	run func(t *testing.T, rp internal.VehicleRepository)
+}
+
+// NewVehicle is a function that returns a valid vehicle with the given id and a registration derived from it
+func NewVehicle(id int) internal.Vehicle {
+	return internal.Vehicle{
+		Id: id,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           "Ford",
+			Model:           "Fiesta",
+			Registration:    fmt.Sprintf("REG-%d", id),
+			Color:           "Red",
+			FabricationYear: 2010,
+			Capacity:        4,
+			MaxSpeed:        180,
+			FuelType:        "gas",
+			Transmission:    "manual",
+			Weight:          100,
+			Dimensions: internal.Dimensions{
+				Height: 150,
+				Length: 400,
+				Width:  180,
+			},
+		},
+	}
+}
+
+// seed is a function that adds the vehicles to the repository, failing the test on error
+func seed(t *testing.T, rp internal.VehicleRepository, vehicles ...internal.Vehicle) {
+	t.Helper()
+	for i := range vehicles {
+		if err := rp.Add(&vehicles[i]); err != nil {
+			t.Fatalf("seed vehicle %d: unexpected error: %v", vehicles[i].Id, err)
+		}
+	}
+}
+
+// expectIds is a function that checks that the vehicles have exactly the expected ids
+func expectIds(t *testing.T, v map[int]internal.Vehicle, ids ...int) {
+	t.Helper()
+	if len(v) != len(ids) {
+		t.Fatalf("expected %d vehicles %v, got %d", len(ids), ids, len(v))
+	}
+	for _, id := range ids {
+		vh, ok := v[id]
+		if !ok {
+			t.Fatalf("expected vehicle %d in result", id)
+		}
+		if vh.Id != id {
+			t.Fatalf("expected vehicle at key %d to have id %d, got %d", id, id, vh.Id)
+		}
+	}
+}
+
+// expectBatchError is a function that checks that err is a *internal.VehicleBatchError with errors at exactly
+// the expected indexes, and returns it
+func expectBatchError(t *testing.T, err error, indexes ...int) *internal.VehicleBatchError {
+	t.Helper()
+	var batchErr *internal.VehicleBatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a batch error, got %v", err)
+	}
+	if len(batchErr.Errors) != len(indexes) {
+		t.Fatalf("expected errors at %v, got %v", indexes, batchErr.Indexes())
+	}
+	for _, i := range indexes {
+		if batchErr.Errors[i] == nil {
+			t.Fatalf("expected errors at %v, got %v", indexes, batchErr.Indexes())
+		}
+	}
+	return batchErr
+}
+
+// expectError is a function that checks that err matches target
+func expectError(t *testing.T, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("expected error %v, got %v", target, err)
+	}
+}
+
+// expectNoError is a function that checks that err is nil
+func expectNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// cases is the list of test cases of the suite
+var cases = []testCase{
+	{
+		name: "FindAll returns an empty map without error on an empty repository",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, v)
+		},
+	},
+	{
+		name: "Add stores the vehicle with all its attributes",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			expected := NewVehicle(1)
+			seed(t, rp, expected)
+			expected.Version = 1
+
+			v, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, v, 1)
+			if v[1] != expected {
+				t.Fatalf("expected %+v, got %+v", expected, v[1])
+			}
+		},
+	},
+	{
+		name: "Add rejects a duplicate id",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			v := NewVehicle(1)
+			v.Registration = "OTHER"
+			expectError(t, rp.Add(&v), internal.ErrVehicleIdAlreadyExists)
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 1)
+			if all[1].Registration != "REG-1" {
+				t.Fatalf("expected the stored vehicle to be unchanged, got registration %q", all[1].Registration)
+			}
+		},
+	},
+	{
+		name: "Add rejects a duplicate registration",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			v := NewVehicle(2)
+			v.Registration = "REG-1"
+			expectError(t, rp.Add(&v), internal.ErrVehicleRegistrationAlreadyExists)
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 1)
+		},
+	},
+	{
+		name: "Add rejects a registration that differs only in spaces and case",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			v := NewVehicle(2)
+			v.Registration = " reg -1"
+			expectError(t, rp.Add(&v), internal.ErrVehicleRegistrationAlreadyExists)
+		},
+	},
+	{
+		name: "GetById returns the vehicle or ErrVehicleIdNotFound",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2))
+
+			v, err := rp.GetById(2)
+			expectNoError(t, err)
+			expected := NewVehicle(2)
+			expected.Version = 1
+			if v != expected {
+				t.Fatalf("expected %+v, got %+v", expected, v)
+			}
+
+			_, err = rp.GetById(3)
+			expectError(t, err, internal.ErrVehicleIdNotFound)
+		},
+	},
+	{
+		name: "GetByRegistration ignores spaces and case",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2))
+
+			for _, registration := range []string{"REG-2", "reg-2", " Reg - 2 "} {
+				v, err := rp.GetByRegistration(registration)
+				expectNoError(t, err)
+				if v.Id != 2 {
+					t.Fatalf("%q: expected vehicle 2, got %d", registration, v.Id)
+				}
+			}
+
+			_, err := rp.GetByRegistration("REG-3")
+			expectError(t, err, internal.ErrVehicleIdNotFound)
+		},
+	},
+	{
+		name: "AddBatch stores every vehicle",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3 := NewVehicle(1), NewVehicle(2), NewVehicle(3)
+			expectNoError(t, rp.AddBatch([]*internal.Vehicle{&v1, &v2, &v3}, internal.BatchModeAtomic))
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 1, 2, 3)
+		},
+	},
+	{
+		name: "AddBatch rejects the whole batch on a duplicate id",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			v2, dup := NewVehicle(2), NewVehicle(1)
+			dup.Registration = "OTHER"
+			expectError(t, rp.AddBatch([]*internal.Vehicle{&v2, &dup}, internal.BatchModeAtomic), internal.ErrVehicleIdAlreadyExists)
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 1)
+		},
+	},
+	{
+		name: "AddBatch rejects the whole batch on a duplicate registration",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			v2, dup := NewVehicle(2), NewVehicle(3)
+			dup.Registration = "REG-1"
+			expectError(t, rp.AddBatch([]*internal.Vehicle{&v2, &dup}, internal.BatchModeAtomic), internal.ErrVehicleRegistrationAlreadyExists)
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 1)
+		},
+	},
+	{
+		name: "AddBatch detects duplicates inside the batch",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, dupId, v2, dupRegistration := NewVehicle(1), NewVehicle(1), NewVehicle(2), NewVehicle(3)
+			dupId.Registration = "OTHER"
+			dupRegistration.Registration = " reg-2"
+			err := rp.AddBatch([]*internal.Vehicle{&v1, &dupId, &v2, &dupRegistration}, internal.BatchModeAtomic)
+
+			batchErr := expectBatchError(t, err, 1, 3)
+			expectError(t, batchErr.Errors[1], internal.ErrVehicleIdAlreadyExists)
+			expectError(t, batchErr.Errors[3], internal.ErrVehicleRegistrationAlreadyExists)
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all)
+		},
+	},
+	{
+		name: "AddBatch in best effort mode adds the vehicles that can be added",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			dup, v2, v3, dupInBatch := NewVehicle(1), NewVehicle(2), NewVehicle(3), NewVehicle(3)
+			dup.Registration = "OTHER"
+			dupInBatch.Registration = "OTHER-3"
+			err := rp.AddBatch([]*internal.Vehicle{&dup, &v2, &v3, &dupInBatch}, internal.BatchModeBestEffort)
+
+			batchErr := expectBatchError(t, err, 0, 3)
+			expectError(t, batchErr.Errors[0], internal.ErrVehicleIdAlreadyExists)
+			expectError(t, batchErr.Errors[3], internal.ErrVehicleIdAlreadyExists)
+			if v2.Version != 1 || v3.Version != 1 || dup.Version != 0 {
+				t.Fatalf("expected only the added vehicles at version 1, got %d, %d, %d", dup.Version, v2.Version, v3.Version)
+			}
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 1, 2, 3)
+			if all[3].Registration != "REG-3" {
+				t.Fatalf("expected the first vehicle 3 of the batch, got registration %q", all[3].Registration)
+			}
+		},
+	},
+	{
+		name: "UpdateSpeed changes only the max speed",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			expectNoError(t, rp.UpdateSpeed(99.5, 1, 0))
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expected := NewVehicle(1)
+			expected.MaxSpeed = 99.5
+			expected.Version = 2
+			if all[1] != expected {
+				t.Fatalf("expected %+v, got %+v", expected, all[1])
+			}
+		},
+	},
+	{
+		name: "UpdateSpeed returns ErrVehicleIdNotFound for an unknown id",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			expectError(t, rp.UpdateSpeed(100, 1, 0), internal.ErrVehicleIdNotFound)
+		},
+	},
+	{
+		name: "Update replaces every attribute",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2))
+
+			expected := NewVehicle(1)
+			expected.Brand, expected.Model, expected.Registration = "Fiat", "Uno", "NEW-1"
+			expected.FabricationYear, expected.Weight, expected.Width = 2015, 120, 170
+			v := expected
+			expectNoError(t, rp.Update(&v))
+			expected.Version = 2
+			if v.Version != 2 {
+				t.Fatalf("expected the updated vehicle at version 2, got %d", v.Version)
+			}
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 1, 2)
+			if all[1] != expected {
+				t.Fatalf("expected %+v, got %+v", expected, all[1])
+			}
+			if all[2].Version != 1 || all[2].Registration != "REG-2" {
+				t.Fatalf("expected vehicle 2 unchanged, got %+v", all[2])
+			}
+
+			// indexed lookups see the new values
+			byRegistration, err := rp.GetByRegistration("NEW-1")
+			expectNoError(t, err)
+			if byRegistration.Id != 1 {
+				t.Fatalf("expected vehicle 1 by its new registration, got %d", byRegistration.Id)
+			}
+			_, err = rp.GetByRegistration("REG-1")
+			expectError(t, err, internal.ErrVehicleIdNotFound)
+			byBrand, err := rp.GetByBrand("Fiat")
+			expectNoError(t, err)
+			expectIds(t, byBrand, 1)
+		},
+	},
+	{
+		name: "Update rejects the registration of another vehicle",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2))
+
+			v := NewVehicle(1)
+			v.Registration = "reg-2"
+			expectError(t, rp.Update(&v), internal.ErrVehicleRegistrationAlreadyExists)
+
+			// its own registration, even written differently, is not a collision
+			v.Registration = "reg-1"
+			expectNoError(t, rp.Update(&v))
+		},
+	},
+	{
+		name: "Update returns ErrVehicleIdNotFound for an unknown id",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v := NewVehicle(1)
+			expectError(t, rp.Update(&v), internal.ErrVehicleIdNotFound)
+		},
+	},
+	{
+		name: "Add and AddBatch set version 1",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3 := NewVehicle(1), NewVehicle(2), NewVehicle(3)
+			v1.Version = 7
+			expectNoError(t, rp.Add(&v1))
+			expectNoError(t, rp.AddBatch([]*internal.Vehicle{&v2, &v3}, internal.BatchModeAtomic))
+			if v1.Version != 1 || v2.Version != 1 || v3.Version != 1 {
+				t.Fatalf("expected the added vehicles at version 1, got %d, %d, %d", v1.Version, v2.Version, v3.Version)
+			}
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			for id, v := range all {
+				if v.Version != 1 {
+					t.Fatalf("expected vehicle %d stored at version 1, got %d", id, v.Version)
+				}
+			}
+		},
+	},
+	{
+		name: "Changes at an expected version fail with ErrVehicleVersionMismatch when it is not the current one",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			// version 1 to 2
+			expectError(t, rp.UpdateSpeed(10, 1, 2), internal.ErrVehicleVersionMismatch)
+			expectNoError(t, rp.UpdateSpeed(10, 1, 1))
+
+			// version 2 to 3
+			v := NewVehicle(1)
+			v.Version = 1
+			expectError(t, rp.Update(&v), internal.ErrVehicleVersionMismatch)
+			v.Version = 2
+			expectNoError(t, rp.Update(&v))
+			if v.Version != 3 {
+				t.Fatalf("expected version 3, got %d", v.Version)
+			}
+
+			// deleted at version 3
+			expectError(t, rp.DeleteVehicle(1, 2, ""), internal.ErrVehicleVersionMismatch)
+			expectNoError(t, rp.DeleteVehicle(1, 3, ""))
+			_, err := rp.GetById(1)
+			expectError(t, err, internal.ErrVehicleIdNotFound)
+
+			// an unknown id is not found, whatever the version
+			expectError(t, rp.UpdateSpeed(10, 1, 3), internal.ErrVehicleIdNotFound)
+		},
+	},
+	{
+		name: "DeleteVehicle returns ErrVehicleIdNotFound for an unknown id",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+			expectError(t, rp.DeleteVehicle(2, 0, ""), internal.ErrVehicleIdNotFound)
+		},
+	},
+	{
+		name: "DeleteVehicle moves the vehicle to the trash, keeping its id and releasing its registration",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2))
+
+			expectNoError(t, rp.DeleteVehicle(1, 0, "sold"))
+			expectError(t, rp.DeleteVehicle(1, 0, ""), internal.ErrVehicleIdNotFound)
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 2)
+			_, err = rp.GetByRegistration("REG-1")
+			expectError(t, err, internal.ErrVehicleIdNotFound)
+
+			// in the trash
+			trash, err := rp.Trash()
+			expectNoError(t, err)
+			if len(trash) != 1 || trash[0].Id != 1 || !trash[0].Deleted() || trash[0].Deletion.Reason != "sold" {
+				t.Fatalf("expected vehicle 1 in the trash, got %+v", trash)
+			}
+
+			// the id is reserved while the vehicle is in the trash
+			readded := NewVehicle(1)
+			expectError(t, rp.Add(&readded), internal.ErrVehicleIdAlreadyExists)
+
+			// the registration is not
+			other := NewVehicle(3)
+			other.Registration = "REG-1"
+			expectNoError(t, rp.Add(&other))
+		},
+	},
+	{
+		name: "Restore moves the vehicle back at the next version unless its registration was taken",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2))
+			expectNoError(t, rp.DeleteVehicle(1, 0, ""))
+			expectNoError(t, rp.DeleteVehicle(2, 0, ""))
+			_, err := rp.Restore(3)
+			expectError(t, err, internal.ErrVehicleIdNotFound)
+
+			// restored
+			v, err := rp.Restore(1)
+			expectNoError(t, err)
+			if v.Version != 2 || v.Deleted() {
+				t.Fatalf("expected vehicle 1 restored at version 2, got %+v", v)
+			}
+			v, err = rp.GetById(1)
+			expectNoError(t, err)
+			if v.Version != 2 || v.Deleted() {
+				t.Fatalf("expected vehicle 1 stored at version 2, got %+v", v)
+			}
+			_, err = rp.Restore(1)
+			expectError(t, err, internal.ErrVehicleIdNotFound)
+
+			// the registration of 2 was taken by another vehicle
+			other := NewVehicle(3)
+			other.Registration = "REG-2"
+			seed(t, rp, other)
+			_, err = rp.Restore(2)
+			expectError(t, err, internal.ErrVehicleRegistrationAlreadyExists)
+			trash, err := rp.Trash()
+			expectNoError(t, err)
+			if len(trash) != 1 || trash[0].Id != 2 {
+				t.Fatalf("expected vehicle 2 kept in the trash, got %+v", trash)
+			}
+		},
+	},
+	{
+		name: "Purge removes the vehicles deleted before a time for good",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2), NewVehicle(3))
+			expectNoError(t, rp.DeleteVehicle(1, 0, ""))
+			expectNoError(t, rp.DeleteVehicle(2, 0, ""))
+
+			// none deleted before
+			n, err := rp.Purge(time.Now().Add(-time.Hour))
+			expectNoError(t, err)
+			if n != 0 {
+				t.Fatalf("expected no vehicles purged, got %d", n)
+			}
+
+			n, err = rp.Purge(time.Now().Add(time.Second))
+			expectNoError(t, err)
+			if n != 2 {
+				t.Fatalf("expected 2 vehicles purged, got %d", n)
+			}
+			trash, err := rp.Trash()
+			expectNoError(t, err)
+			if len(trash) != 0 {
+				t.Fatalf("expected an empty trash, got %+v", trash)
+			}
+
+			// the id is released
+			readded := NewVehicle(1)
+			readded.Color = "Blue"
+			expectNoError(t, rp.Add(&readded))
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 1, 3)
+			if all[1].Color != "Blue" {
+				t.Fatalf("expected the re-added vehicle, got color %q", all[1].Color)
+			}
+		},
+	},
+	{
+		name: "Queries return ErrVehiclesNotFound on an empty result",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			queries := map[string]func() (map[int]internal.Vehicle, error){
+				"GetByColorAndYear":  func() (map[int]internal.Vehicle, error) { return rp.GetByColorAndYear("Blue", 2010) },
+				"GetByBrandAndYears": func() (map[int]internal.Vehicle, error) { return rp.GetByBrandAndYears("Ford", 2011, 2020) },
+				"GetByBrand":         func() (map[int]internal.Vehicle, error) { return rp.GetByBrand("Fiat") },
+				"GetByFuelType":      func() (map[int]internal.Vehicle, error) { return rp.GetByFuelType("diesel") },
+				"GetByDimensions":    func() (map[int]internal.Vehicle, error) { return rp.GetByDimensions(0, 399, 0, 500) },
+				"GetByWeight":        func() (map[int]internal.Vehicle, error) { return rp.GetByWeight(101, 200) },
+			}
+			for name, query := range queries {
+				v, err := query()
+				if !errors.Is(err, internal.ErrVehiclesNotFound) {
+					t.Errorf("%s: expected ErrVehiclesNotFound, got %v", name, err)
+				}
+				if len(v) != 0 {
+					t.Errorf("%s: expected no vehicles, got %d", name, len(v))
+				}
+			}
+		},
+	},
+	{
+		name: "GetByColorAndYear matches both color and year",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3 := NewVehicle(1), NewVehicle(2), NewVehicle(3)
+			v2.Color = "Blue"
+			v3.FabricationYear = 2011
+			seed(t, rp, v1, v2, v3)
+
+			v, err := rp.GetByColorAndYear("Red", 2010)
+			expectNoError(t, err)
+			expectIds(t, v, 1)
+		},
+	},
+	{
+		name: "GetByBrandAndYears includes both bounds",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3, v4 := NewVehicle(1), NewVehicle(2), NewVehicle(3), NewVehicle(4)
+			v1.FabricationYear = 2000
+			v2.FabricationYear = 2005
+			v3.FabricationYear = 2006
+			v4.FabricationYear = 2003
+			v4.Brand = "Fiat"
+			seed(t, rp, v1, v2, v3, v4)
+
+			v, err := rp.GetByBrandAndYears("Ford", 2000, 2005)
+			expectNoError(t, err)
+			expectIds(t, v, 1, 2)
+		},
+	},
+	{
+		name: "GetByBrand and GetByFuelType match exactly",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2 := NewVehicle(1), NewVehicle(2)
+			v2.Brand = "Fiat"
+			v2.FuelType = "diesel"
+			seed(t, rp, v1, v2)
+
+			v, err := rp.GetByBrand("Fiat")
+			expectNoError(t, err)
+			expectIds(t, v, 2)
+			v, err = rp.GetByFuelType("gas")
+			expectNoError(t, err)
+			expectIds(t, v, 1)
+		},
+	},
+	{
+		name: "GetByDimensions includes the bounds of length and width",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3, v4, v5 := NewVehicle(1), NewVehicle(2), NewVehicle(3), NewVehicle(4), NewVehicle(5)
+			v1.Length, v1.Width = 300, 150
+			v2.Length, v2.Width = 400, 200
+			v3.Length, v3.Width = 299.99, 170
+			v4.Length, v4.Width = 350, 200.01
+			v5.Length, v5.Width = 350, 175
+			seed(t, rp, v1, v2, v3, v4, v5)
+
+			v, err := rp.GetByDimensions(300, 400, 150, 200)
+			expectNoError(t, err)
+			expectIds(t, v, 1, 2, 5)
+		},
+	},
+	{
+		name: "GetByWeight includes both bounds",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3, v4 := NewVehicle(1), NewVehicle(2), NewVehicle(3), NewVehicle(4)
+			v1.Weight = 50
+			v2.Weight = 75.5
+			v3.Weight = 49.99
+			v4.Weight = 75.51
+			seed(t, rp, v1, v2, v3, v4)
+
+			v, err := rp.GetByWeight(50, 75.5)
+			expectNoError(t, err)
+			expectIds(t, v, 1, 2)
+		},
+	},
+	{
+		name: "Results are copies that do not change the repository",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1))
+
+			v, err := rp.FindAll()
+			expectNoError(t, err)
+			delete(v, 1)
+			v[2] = NewVehicle(2)
+
+			all, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, all, 1)
+		},
+	},
+	{
+		name: "Query filters with every operator",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3, v4 := NewVehicle(1), NewVehicle(2), NewVehicle(3), NewVehicle(4)
+			v1.Brand, v1.Weight, v1.FabricationYear = "Ford", 50, 2000
+			v2.Brand, v2.Weight, v2.FabricationYear = "Fiat", 75.5, 2005
+			v3.Brand, v3.Weight, v3.FabricationYear = "Audi", 80, 2010
+			v4.Brand, v4.Weight, v4.FabricationYear = "Ford", 100, 2015
+			seed(t, rp, v1, v2, v3, v4)
+
+			filter := func(field internal.VehicleField, op internal.FilterOperator, values ...any) internal.VehicleQuery {
+				return internal.VehicleQuery{Filters: []internal.VehicleFilter{{Field: field, Operator: op, Values: values}}}
+			}
+			queries := map[string]struct {
+				q   internal.VehicleQuery
+				ids []int
+			}{
+				"eq":        {filter(internal.VehicleFieldBrand, internal.FilterEq, "Ford"), []int{1, 4}},
+				"ne":        {filter(internal.VehicleFieldBrand, internal.FilterNe, "Ford"), []int{2, 3}},
+				"gt":        {filter(internal.VehicleFieldWeight, internal.FilterGt, 75.5), []int{3, 4}},
+				"gte":       {filter(internal.VehicleFieldWeight, internal.FilterGte, 75.5), []int{2, 3, 4}},
+				"lt":        {filter(internal.VehicleFieldFabricationYear, internal.FilterLt, 2005), []int{1}},
+				"lte":       {filter(internal.VehicleFieldFabricationYear, internal.FilterLte, 2005), []int{1, 2}},
+				"in":        {filter(internal.VehicleFieldBrand, internal.FilterIn, "Audi", "Fiat", "Kia"), []int{2, 3}},
+				"int value": {filter(internal.VehicleFieldWeight, internal.FilterEq, 80), []int{3}},
+				"and": {internal.VehicleQuery{Filters: []internal.VehicleFilter{
+					{Field: internal.VehicleFieldBrand, Operator: internal.FilterEq, Values: []any{"Ford"}},
+					{Field: internal.VehicleFieldWeight, Operator: internal.FilterLte, Values: []any{50.0}},
+				}}, []int{1}},
+				"none": {filter(internal.VehicleFieldBrand, internal.FilterEq, "Kia"), []int{}},
+			}
+			for name, tc := range queries {
+				v, total, err := rp.Query(tc.q)
+				if err != nil {
+					t.Errorf("%s: unexpected error: %v", name, err)
+					continue
+				}
+				if total != len(tc.ids) || len(v) != len(tc.ids) {
+					t.Errorf("%s: expected %d vehicles, got %d (total %d)", name, len(tc.ids), len(v), total)
+					continue
+				}
+				for i, id := range tc.ids {
+					if v[i].Id != id {
+						t.Errorf("%s: expected vehicle %d at position %d, got %d", name, id, i, v[i].Id)
+					}
+				}
+			}
+		},
+	},
+	{
+		name: "Query sorts by several keys and then by id",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3, v4 := NewVehicle(1), NewVehicle(2), NewVehicle(3), NewVehicle(4)
+			v1.Brand, v1.FabricationYear = "Ford", 2000
+			v2.Brand, v2.FabricationYear = "Audi", 2000
+			v3.Brand, v3.FabricationYear = "Ford", 2010
+			v4.Brand, v4.FabricationYear = "Ford", 2010
+			seed(t, rp, v4, v3, v2, v1)
+
+			v, total, err := rp.Query(internal.VehicleQuery{Sort: []internal.VehicleSort{
+				{Field: internal.VehicleFieldBrand, Desc: true},
+				{Field: internal.VehicleFieldFabricationYear},
+			}})
+			expectNoError(t, err)
+			if total != 4 {
+				t.Fatalf("expected total 4, got %d", total)
+			}
+			for i, id := range []int{1, 3, 4, 2} {
+				if v[i].Id != id {
+					t.Fatalf("expected vehicle %d at position %d, got %d", id, i, v[i].Id)
+				}
+			}
+		},
+	},
+	{
+		name: "Query pages the sorted result and counts the total",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			for id := 1; id <= 5; id++ {
+				seed(t, rp, NewVehicle(id))
+			}
+
+			pages := []struct {
+				offset, limit int
+				ids           []int
+			}{
+				{0, 2, []int{1, 2}},
+				{2, 2, []int{3, 4}},
+				{4, 2, []int{5}},
+				{6, 2, []int{}},
+				{1, 0, []int{2, 3, 4, 5}},
+			}
+			for _, p := range pages {
+				v, total, err := rp.Query(internal.VehicleQuery{Offset: p.offset, Limit: p.limit})
+				expectNoError(t, err)
+				if total != 5 {
+					t.Fatalf("offset %d limit %d: expected total 5, got %d", p.offset, p.limit, total)
+				}
+				if len(v) != len(p.ids) {
+					t.Fatalf("offset %d limit %d: expected %d vehicles, got %d", p.offset, p.limit, len(p.ids), len(v))
+				}
+				for i, id := range p.ids {
+					if v[i].Id != id {
+						t.Fatalf("offset %d limit %d: expected vehicle %d at position %d, got %d", p.offset, p.limit, id, i, v[i].Id)
+					}
+				}
+			}
+		},
+	},
+	{
+		name: "Aggregate computes the metrics of each group sorted by keys",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3, v4, v5 := NewVehicle(1), NewVehicle(2), NewVehicle(3), NewVehicle(4), NewVehicle(5)
+			v1.Brand, v1.FabricationYear, v1.MaxSpeed, v1.Capacity = "Ford", 2000, 100, 2
+			v2.Brand, v2.FabricationYear, v2.MaxSpeed, v2.Capacity = "Ford", 2000, 140, 4
+			v3.Brand, v3.FabricationYear, v3.MaxSpeed, v3.Capacity = "Ford", 2000, 120, 5
+			v4.Brand, v4.FabricationYear, v4.MaxSpeed, v4.Capacity = "Audi", 2010, 200, 4
+			v5.Brand, v5.FabricationYear, v5.MaxSpeed, v5.Capacity = "Ford", 2010, 180, 2
+			seed(t, rp, v1, v2, v3, v4, v5)
+
+			speed := internal.VehicleFieldMaxSpeed
+			groups, err := rp.Aggregate(internal.VehicleAggregation{
+				GroupBy: []internal.VehicleField{internal.VehicleFieldBrand, internal.VehicleFieldFabricationYear},
+				Metrics: []internal.VehicleMetric{
+					{Func: internal.AggregateCount},
+					{Func: internal.AggregateSum, Field: internal.VehicleFieldCapacity},
+					{Func: internal.AggregateMin, Field: speed},
+					{Func: internal.AggregateMax, Field: speed},
+					{Func: internal.AggregateAvg, Field: speed},
+					{Func: internal.AggregateMedian, Field: speed},
+					{Func: internal.AggregatePercentile, Field: speed, Percentile: 25},
+					{Func: internal.AggregatePercentile, Field: internal.VehicleFieldCapacity, Percentile: 100},
+				},
+			})
+			expectNoError(t, err)
+			expectGroups(t, groups, []internal.VehicleGroup{
+				{Keys: []any{"Audi", 2010}, Values: []float64{1, 4, 200, 200, 200, 200, 200, 4}},
+				{Keys: []any{"Ford", 2000}, Values: []float64{3, 11, 100, 140, 120, 120, 110, 5}},
+				{Keys: []any{"Ford", 2010}, Values: []float64{1, 2, 180, 180, 180, 180, 180, 2}},
+			})
+		},
+	},
+	{
+		name: "Aggregate applies the filters and has no groups without vehicles",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3 := NewVehicle(1), NewVehicle(2), NewVehicle(3)
+			v1.Weight, v2.Weight, v3.Weight = 50, 75, 100
+			seed(t, rp, v1, v2, v3)
+
+			a := internal.VehicleAggregation{
+				Filters: []internal.VehicleFilter{{Field: internal.VehicleFieldWeight, Operator: internal.FilterGte, Values: []any{60}}},
+				Metrics: []internal.VehicleMetric{
+					{Func: internal.AggregateCount},
+					{Func: internal.AggregatePercentile, Field: internal.VehicleFieldWeight, Percentile: 90},
+				},
+			}
+			groups, err := rp.Aggregate(a)
+			expectNoError(t, err)
+			expectGroups(t, groups, []internal.VehicleGroup{{Keys: []any{}, Values: []float64{2, 97.5}}})
+
+			a.Filters[0].Values = []any{500}
+			groups, err = rp.Aggregate(a)
+			expectNoError(t, err)
+			expectGroups(t, groups, []internal.VehicleGroup{})
+
+			_, err = rp.Aggregate(internal.VehicleAggregation{Metrics: []internal.VehicleMetric{
+				{Func: internal.AggregateAvg, Field: internal.VehicleFieldBrand},
+			}})
+			if !errors.Is(err, internal.ErrInvalidQuery) {
+				t.Fatalf("expected ErrInvalidQuery, got %v", err)
+			}
+		},
+	},
+	{
+		name: "Histogram counts the values in fixed, width and quantile buckets",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			for i, weight := range []float64{10, 20, 30, 40, 50, 100} {
+				v := NewVehicle(i + 1)
+				v.Weight = weight
+				seed(t, rp, v)
+			}
+
+			histograms := map[string]struct {
+				h       internal.VehicleHistogram
+				buckets []internal.HistogramBucket
+			}{
+				"fixed": {
+					internal.VehicleHistogram{Buckets: 2},
+					[]internal.HistogramBucket{{Lower: 10, Upper: 55, Count: 5}, {Lower: 55, Upper: 100, Count: 1}},
+				},
+				"width": {
+					internal.VehicleHistogram{Width: 50},
+					[]internal.HistogramBucket{{Lower: 0, Upper: 50, Count: 4}, {Lower: 50, Upper: 100, Count: 1}, {Lower: 100, Upper: 150, Count: 1}},
+				},
+				"quantile": {
+					internal.VehicleHistogram{Mode: internal.HistogramQuantile, Buckets: 2},
+					[]internal.HistogramBucket{{Lower: 10, Upper: 35, Count: 3}, {Lower: 35, Upper: 100, Count: 3}},
+				},
+				"filters": {
+					internal.VehicleHistogram{Buckets: 1, Filters: []internal.VehicleFilter{
+						{Field: internal.VehicleFieldWeight, Operator: internal.FilterGt, Values: []any{30}},
+					}},
+					[]internal.HistogramBucket{{Lower: 40, Upper: 100, Count: 3}},
+				},
+			}
+			for name, tc := range histograms {
+				tc.h.Field = internal.VehicleFieldWeight
+				groups, err := rp.Histogram(tc.h)
+				if err != nil {
+					t.Errorf("%s: unexpected error: %v", name, err)
+					continue
+				}
+				if len(groups) != 1 || !reflect.DeepEqual(groups[0].Buckets, tc.buckets) {
+					t.Errorf("%s: expected buckets %v, got %v", name, tc.buckets, groups)
+				}
+			}
+		},
+	},
+	{
+		name: "Histogram has a histogram for each group",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			v1, v2, v3 := NewVehicle(1), NewVehicle(2), NewVehicle(3)
+			v1.FuelType, v1.MaxSpeed = "gas", 100
+			v2.FuelType, v2.MaxSpeed = "gas", 200
+			v3.FuelType, v3.MaxSpeed = "diesel", 150
+			seed(t, rp, v1, v2, v3)
+
+			groups, err := rp.Histogram(internal.VehicleHistogram{
+				Field:   internal.VehicleFieldMaxSpeed,
+				GroupBy: []internal.VehicleField{internal.VehicleFieldFuelType},
+				Buckets: 2,
+			})
+			expectNoError(t, err)
+			expected := []internal.HistogramGroup{
+				{Keys: []any{"diesel"}, Count: 1, Buckets: []internal.HistogramBucket{{Lower: 150, Upper: 150, Count: 1}}},
+				{Keys: []any{"gas"}, Count: 2, Buckets: []internal.HistogramBucket{
+					{Lower: 100, Upper: 150, Count: 1}, {Lower: 150, Upper: 200, Count: 1},
+				}},
+			}
+			if !reflect.DeepEqual(groups, expected) {
+				t.Fatalf("expected %v, got %v", expected, groups)
+			}
+		},
+	},
+	{
+		name: "Stream calls fn with the filtered vehicles sorted by id and stops on error",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			for _, id := range []int{5, 3, 1, 4, 2} {
+				v := NewVehicle(id)
+				if id%2 == 0 {
+					v.Brand = "Audi"
+				}
+				seed(t, rp, v)
+			}
+
+			var ids []int
+			err := rp.Stream([]internal.VehicleFilter{
+				{Field: internal.VehicleFieldBrand, Operator: internal.FilterEq, Values: []any{"Ford"}},
+			}, func(v internal.Vehicle) error {
+				ids = append(ids, v.Id)
+				return nil
+			})
+			expectNoError(t, err)
+			if !reflect.DeepEqual(ids, []int{1, 3, 5}) {
+				t.Fatalf("expected vehicles [1 3 5], got %v", ids)
+			}
+
+			errStop := errors.New("stop")
+			ids = nil
+			err = rp.Stream(nil, func(v internal.Vehicle) error {
+				ids = append(ids, v.Id)
+				if len(ids) == 2 {
+					return errStop
+				}
+				return nil
+			})
+			if !errors.Is(err, errStop) || !reflect.DeepEqual(ids, []int{1, 2}) {
+				t.Fatalf("expected to stop after [1 2] with the error of fn, got %v and %v", ids, err)
+			}
+		},
+	},
+	{
+		name: "NormalizeTerms replaces aliases with canonical values and increments versions",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			tn, ok := rp.(interface {
+				NormalizeTerms(ix internal.VocabularyIndex) (int, error)
+			})
+			if !ok {
+				t.Skip("the repository does not normalize terms")
+			}
+			v1, v2 := NewVehicle(1), NewVehicle(2)
+			v1.FuelType, v1.Color = "Petrol", " red "
+			seed(t, rp, v1, v2)
+
+			ix := internal.NewVocabularyIndex([]internal.Vocabulary{
+				{Field: internal.VehicleFieldFuelType, Terms: []internal.Term{
+					{Value: "gasoline", Aliases: []string{"petrol"}}, {Value: "gas"},
+				}},
+				{Field: internal.VehicleFieldColor, Terms: []internal.Term{{Value: "Red"}}},
+			})
+			n, err := tn.NormalizeTerms(ix)
+			expectNoError(t, err)
+			if n != 1 {
+				t.Fatalf("expected 1 vehicle normalized, got %d", n)
+			}
+
+			got, err := rp.GetById(1)
+			expectNoError(t, err)
+			if got.FuelType != "gasoline" || got.Color != "Red" || got.Version != 2 {
+				t.Fatalf("expected gasoline, Red at version 2, got %s, %s at version %d", got.FuelType, got.Color, got.Version)
+			}
+			v, err := rp.GetByFuelType("gasoline")
+			expectNoError(t, err)
+			expectIds(t, v, 1)
+			if got, err = rp.GetById(2); err != nil || got.Version != 1 {
+				t.Fatalf("expected vehicle 2 unchanged at version 1, got version %d, error %v", got.Version, err)
+			}
+		},
+	},
+	{
+		name: "Reload ignores the vehicles in the trash and moves the deleted ones to the trash",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2), NewVehicle(3))
+			expectNoError(t, rp.DeleteVehicle(1, 0, "sold"))
+
+			// 1 is still in the file, 2 is deleted in the file and 3 is not in it
+			v1, v2 := NewVehicle(1), NewVehicle(2)
+			v1.Color = "Blue"
+			v2.Deletion = &internal.VehicleDeletion{At: time.Now()}
+			d, err := rp.Reload(map[int]internal.Vehicle{1: v1, 2: v2}, nil)
+			expectNoError(t, err)
+			if len(d.Added) != 0 || len(d.Updated) != 0 || !reflect.DeepEqual(d.Deleted, []int{2, 3}) {
+				t.Fatalf("expected 2 and 3 deleted, got %+v", d)
+			}
+
+			v, err := rp.FindAll()
+			expectNoError(t, err)
+			if len(v) != 0 {
+				t.Fatalf("expected no vehicles, got %+v", v)
+			}
+			trash, err := rp.Trash()
+			expectNoError(t, err)
+			reasons := make(map[int]string, len(trash))
+			for _, vh := range trash {
+				if !vh.Deleted() {
+					t.Fatalf("expected vehicle %d deleted, got %+v", vh.Id, vh)
+				}
+				reasons[vh.Id] = vh.Deletion.Reason
+			}
+			expected := map[int]string{1: "sold", 2: internal.ReloadDeletionReason, 3: internal.ReloadDeletionReason}
+			if !reflect.DeepEqual(reasons, expected) {
+				t.Fatalf("expected the trash %v, got %v", expected, reasons)
+			}
+			if trash[0].Color != NewVehicle(1).Color {
+				t.Fatalf("expected vehicle 1 unchanged in the trash, got %+v", trash[0])
+			}
+
+			// the vehicles in the trash are restored, not reloaded
+			_, err = rp.Restore(2)
+			expectNoError(t, err)
+			d, err = rp.Reload(map[int]internal.Vehicle{1: v1, 2: NewVehicle(2)}, nil)
+			expectNoError(t, err)
+			if !d.Empty() {
+				t.Fatalf("expected no changes, got %+v", d)
+			}
+		},
+	},
+	{
+		name: "Reload applies the changes as checked and nothing when the check fails",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2))
+
+			// 1 changes, 2 is deleted and 3 is added
+			v1 := NewVehicle(1)
+			v1.Color = "Blue"
+			next := map[int]internal.Vehicle{1: v1, 3: NewVehicle(3)}
+			errCheck := errors.New("check")
+			d, err := rp.Reload(next, func(current map[int]internal.Vehicle, d *internal.VehicleDiff) error {
+				if len(current) != 2 || len(d.Added) != 1 || len(d.Updated) != 1 || len(d.Deleted) != 1 {
+					t.Errorf("expected the current vehicles and the changes, got %d vehicles and %+v", len(current), d)
+				}
+				return errCheck
+			})
+			if !errors.Is(err, errCheck) || !d.Empty() {
+				t.Fatalf("expected the error of the check and no changes, got %+v, %v", d, err)
+			}
+			v, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, v, 1, 2)
+			if v[1].Color != NewVehicle(1).Color {
+				t.Fatalf("expected vehicle 1 unchanged, got %+v", v[1])
+			}
+
+			// the check replaces the vehicles added and updated
+			d, err = rp.Reload(next, func(current map[int]internal.Vehicle, d *internal.VehicleDiff) error {
+				d.Added[0].Color, d.Updated[0].Color = "Green", "Black"
+				return nil
+			})
+			expectNoError(t, err)
+			v, err = rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, v, 1, 3)
+			if v[1].Color != "Black" || v[1].Version != 2 || v[3].Color != "Green" {
+				t.Fatalf("expected the vehicles of the check, got %+v", v)
+			}
+		},
+	},
+	{
+		name: "Reload replaces the vehicles and keeps the versions of the unchanged ones",
+		run: func(t *testing.T, rp internal.VehicleRepository) {
+			seed(t, rp, NewVehicle(1), NewVehicle(2), NewVehicle(3))
+			expectNoError(t, rp.UpdateSpeed(200, 1, 0))
+
+			// 1 is the same as stored, 2 changes, 3 is deleted and 4 is added
+			v1, v2, v4 := NewVehicle(1), NewVehicle(2), NewVehicle(4)
+			v1.MaxSpeed, v2.Color, v4.Version = 200, "Blue", 3
+			d, err := rp.Reload(map[int]internal.Vehicle{1: v1, 2: v2, 4: v4}, nil)
+			expectNoError(t, err)
+			if len(d.Added) != 1 || d.Added[0].Id != 4 || len(d.Updated) != 1 || d.Updated[0].Id != 2 ||
+				!reflect.DeepEqual(d.Deleted, []int{3}) {
+				t.Fatalf("expected 4 added, 2 updated and 3 deleted, got %+v", d)
+			}
+
+			v, err := rp.FindAll()
+			expectNoError(t, err)
+			expectIds(t, v, 1, 2, 4)
+			if v[1].Version != 2 || v[2].Version != 2 || v[2].Color != "Blue" || v[4].Version != 3 {
+				t.Fatalf("expected versions 2, 2 and 3 and the new color, got %+v", v)
+			}
+			if _, err = rp.GetByRegistration("REG-3"); !errors.Is(err, internal.ErrVehicleIdNotFound) {
+				t.Fatalf("expected the registration of vehicle 3 to be gone, got %v", err)
+			}
+
+			// the same vehicles again
+			d, err = rp.Reload(map[int]internal.Vehicle{1: v1, 2: v2, 4: v4}, nil)
+			expectNoError(t, err)
+			if !d.Empty() {
+				t.Fatalf("expected no changes, got %+v", d)
+			}
+		},
+	},
+}
+
+// expectGroups is a function that checks the keys and the values of the groups of an aggregation
+func expectGroups(t *testing.T, groups, expected []internal.VehicleGroup) {
+	t.Helper()
+	if len(groups) != len(expected) {
+		t.Fatalf("expected %d groups %v, got %d %v", len(expected), expected, len(groups), groups)
+	}
+	for i, e := range expected {
+		if internal.CompareGroupKeys(groups[i].Keys, e.Keys) != 0 || len(groups[i].Keys) != len(e.Keys) {
+			t.Fatalf("expected group %v at position %d, got %v", e.Keys, i, groups[i].Keys)
+		}
+		for j, value := range e.Values {
+			if math.Abs(groups[i].Values[j]-value) > 1e-9 {
+				t.Fatalf("group %v: expected %v, got %v", e.Keys, e.Values, groups[i].Values)
+			}
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// NewVehicleFile is a function that returns a new instance of VehicleFile
+// db is the initial content (usually loaded from path) and flushInterval is the time that writes are
+// debounced before being written to disk. A flushInterval of 0 writes synchronously every change before it is
+// applied, so a change that can not be written is not applied either
+func NewVehicleFile(db map[int]internal.Vehicle, path string, flushInterval time.Duration) *VehicleFile {
+	r := &VehicleFile{
+		rp:            NewVehicleMap(db),
+		path:          path,
+		flushInterval: flushInterval,
+		dirty:         make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if flushInterval > 0 {
+		go r.run()
+	} else {
+		r.rp.journal = r.write
+		close(r.done)
+	}
+
+	return r
+}
+
+// VehicleFile is a struct that represents a vehicle repository persisted in a JSON file, with its trash
+// Reads are served from memory and every change is written back to the file, atomically
+type VehicleFile struct {
+	// rp is the in-memory repository that holds the current state
+	rp *VehicleMap
+	// path is the path to the file where the vehicles are persisted
+	path string
+	// flushInterval is the time that writes are debounced before being written to disk
+	flushInterval time.Duration
+
+	// flushMu serializes the writes to disk
+	// It is locked while holding the lock of rp, so a snapshot is written before the changes that follow it
+	flushMu sync.Mutex
+
+	// dirty signals the background writer that there are pending changes
+	dirty chan struct{}
+	// stop signals the background writer to finish
+	stop chan struct{}
+	// done is closed when the background writer finished
+	done chan struct{}
+	// closeOnce guards stop
+	closeOnce sync.Once
+}
+
+// FindAll is a method that returns a map of all vehicles
+func (r *VehicleFile) FindAll() (v map[int]internal.Vehicle, err error) {
+	v, err = r.rp.FindAll()
+	return
+}
+
+// GetById is a method that returns the vehicle with an id
+func (r *VehicleFile) GetById(id int) (v internal.Vehicle, err error) {
+	return r.rp.GetById(id)
+}
+
+// GetByRegistration is a method that returns the vehicle with a registration, compared in its normalized form
+func (r *VehicleFile) GetByRegistration(registration string) (v internal.Vehicle, err error) {
+	return r.rp.GetByRegistration(registration)
+}
+
+// Add is a method that adds a new vehicle to the repository
+func (r *VehicleFile) Add(v *internal.Vehicle) (err error) {
+	if err = r.rp.Add(v); err != nil {
+		return
+	}
+	err = r.changed()
+	return
+}
+
+// GetByColorAndYear is a method that returns a map of vehicles with a specific color and year
+func (r *VehicleFile) GetByColorAndYear(color string, year int) (v map[int]internal.Vehicle, err error) {
+	v, err = r.rp.GetByColorAndYear(color, year)
+	return
+}
+
+// GetByBrandAndYears is a method that returns a map of vehicles with a specific brand
+// and between two years
+func (r *VehicleFile) GetByBrandAndYears(brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	v, err = r.rp.GetByBrandAndYears(brand, startYear, endYear)
+	return
+}
+
+// GetByBrand is a method that returns the vehicles of a brand
+func (r *VehicleFile) GetByBrand(brand string) (v map[int]internal.Vehicle, err error) {
+	v, err = r.rp.GetByBrand(brand)
+	return
+}
+
+// AddBatch is a method that adds a new vehicles to the repository
+func (r *VehicleFile) AddBatch(vSlice []*internal.Vehicle, mode internal.BatchMode) (err error) {
+	err = r.rp.AddBatch(vSlice, mode)
+
+	// in best effort mode some vehicles may have been added despite the error
+	var batchErr *internal.VehicleBatchError
+	if err != nil && !(mode == internal.BatchModeBestEffort && errors.As(err, &batchErr)) {
+		return
+	}
+	if changedErr := r.changed(); changedErr != nil {
+		err = changedErr
+	}
+	return
+}
+
+// UpdateSpeed is a method that updates the speed of a vehicle
+func (r *VehicleFile) UpdateSpeed(speed float64, id int, version int) (err error) {
+	if err = r.rp.UpdateSpeed(speed, id, version); err != nil {
+		return
+	}
+	err = r.changed()
+	return
+}
+
+// Update is a method that replaces a vehicle
+func (r *VehicleFile) Update(v *internal.Vehicle) (err error) {
+	if err = r.rp.Update(v); err != nil {
+		return
+	}
+	err = r.changed()
+	return
+}
+
+// NormalizeTerms is a method that replaces the values of fuel type, transmission and color of the vehicles
+// with their canonical values
+func (r *VehicleFile) NormalizeTerms(ix internal.VocabularyIndex) (n int, err error) {
+	if n, err = r.rp.NormalizeTerms(ix); err != nil || n == 0 {
+		return
+	}
+	err = r.changed()
+	return
+}
+
+// Reload is a method that replaces the vehicles with v and returns the changes
+func (r *VehicleFile) Reload(v map[int]internal.Vehicle, check internal.ReloadCheck) (d internal.VehicleDiff, err error) {
+	if d, err = r.rp.Reload(v, check); err != nil || d.Empty() {
+		return
+	}
+	err = r.changed()
+	return
+}
+
+// GetByFuelType is a method that returns a map of vehicles with a type of fuel
+func (r *VehicleFile) GetByFuelType(fuelType string) (v map[int]internal.Vehicle, err error) {
+	v, err = r.rp.GetByFuelType(fuelType)
+	return
+}
+
+// DeleteVehicle is a method that moves a vehicle to the trash
+func (r *VehicleFile) DeleteVehicle(id int, version int, reason string) (err error) {
+	if err = r.rp.DeleteVehicle(id, version, reason); err != nil {
+		return
+	}
+	err = r.changed()
+	return
+}
+
+// Trash is a method that returns the vehicles in the trash, sorted by id
+func (r *VehicleFile) Trash() (v []internal.Vehicle, err error) {
+	v, err = r.rp.Trash()
+	return
+}
+
+// Restore is a method that moves a vehicle from the trash back to the vehicles
+func (r *VehicleFile) Restore(id int) (v internal.Vehicle, err error) {
+	if v, err = r.rp.Restore(id); err != nil {
+		return
+	}
+	err = r.changed()
+	return
+}
+
+// Purge is a method that removes for good the vehicles of the trash deleted before a time
+func (r *VehicleFile) Purge(before time.Time) (n int, err error) {
+	if n, err = r.rp.Purge(before); err != nil || n == 0 {
+		return
+	}
+	err = r.changed()
+	return
+}
+
+// GetByDimensions is a method that returns vehicles with a specific dimension
+func (r *VehicleFile) GetByDimensions(minLength, maxLength, minWidth, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	v, err = r.rp.GetByDimensions(minLength, maxLength, minWidth, maxWidth)
+	return
+}
+
+// GetByWeight is a method that returns vehicles with a specific weight
+func (r *VehicleFile) GetByWeight(minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	v, err = r.rp.GetByWeight(minWeight, maxWeight)
+	return
+}
+
+// Query is a method that returns the page of vehicles that satisfy the filters of a query, sorted,
+// and the total number of vehicles that satisfy them
+func (r *VehicleFile) Query(q internal.VehicleQuery) (v []internal.Vehicle, total int, err error) {
+	v, total, err = r.rp.Query(q)
+	return
+}
+
+// Aggregate is a method that returns the metrics of the groups of the vehicles that satisfy the filters of
+// an aggregation, sorted by their keys
+func (r *VehicleFile) Aggregate(a internal.VehicleAggregation) (groups []internal.VehicleGroup, err error) {
+	groups, err = r.rp.Aggregate(a)
+	return
+}
+
+// Histogram is a method that returns the histograms of the groups of the vehicles that satisfy the filters of
+// a histogram, sorted by their keys
+func (r *VehicleFile) Histogram(h internal.VehicleHistogram) (groups []internal.HistogramGroup, err error) {
+	groups, err = r.rp.Histogram(h)
+	return
+}
+
+// Stream is a method that calls fn with every vehicle that satisfies the filters, sorted by id
+func (r *VehicleFile) Stream(filters []internal.VehicleFilter, fn func(v internal.Vehicle) error) (err error) {
+	err = r.rp.Stream(filters, fn)
+	return
+}
+
+// Flush is a method that writes the current state to disk
+func (r *VehicleFile) Flush() (err error) {
+	// snapshot, with the trash
+	r.rp.mu.RLock()
+	v := r.rp.snapshot()
+	r.flushMu.Lock()
+	r.rp.mu.RUnlock()
+	defer r.flushMu.Unlock()
+
+	// write
+	err = r.writeFile(v)
+	return
+}
+
+// Close is a method that stops the background writer and writes the pending changes to disk
+func (r *VehicleFile) Close() (err error) {
+	r.closeOnce.Do(func() {
+		if r.flushInterval > 0 {
+			close(r.stop)
+		}
+	})
+	<-r.done
+
+	err = r.Flush()
+	return
+}
+
+// write is a method that writes the current state with a change applied, before the change is applied
+// It is the journal of the map in synchronous mode, so it is called while holding the write lock
+func (r *VehicleFile) write(c change) (err error) {
+	v := r.rp.snapshot()
+	applySnapshot(v, c)
+
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	err = r.writeFile(v)
+	return
+}
+
+// writeFile is a method that writes the vehicles to the file, atomically
+// The caller must hold flushMu
+func (r *VehicleFile) writeFile(v map[int]internal.Vehicle) error {
+	return WriteFileAtomic(r.path, func(w io.Writer) error {
+		return loader.WriteVehiclesJSON(w, v)
+	})
+}
+
+// changed is a method that registers a change in the repository
+// In synchronous mode the change was already written by the journal, otherwise the background writer is notified
+func (r *VehicleFile) changed() error {
+	if r.flushInterval <= 0 {
+		return nil
+	}
+
+	select {
+	case r.dirty <- struct{}{}:
+	default:
+		// a flush is already pending
+	}
+	return nil
+}
+
+// run is a method that writes the pending changes to disk in the background
+// Changes that arrive during flushInterval are written together
+func (r *VehicleFile) run() {
+	defer close(r.done)
+
+	timer := time.NewTimer(r.flushInterval)
+	timer.Stop()
+	for {
+		// wait for a change
+		select {
+		case <-r.stop:
+			return
+		case <-r.dirty:
+		}
+
+		// debounce
+		timer.Reset(r.flushInterval)
+		select {
+		case <-r.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// write, a failed write is retried on the next change or on Close
+		if err := r.Flush(); err != nil {
+			fmt.Println("repository: failed to write", r.path+":", err)
+		}
+	}
+}
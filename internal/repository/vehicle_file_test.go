@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readVehicleFile is a function that returns the vehicles persisted at path
+func readVehicleFile(t *testing.T, path string) map[int]internal.Vehicle {
+	t.Helper()
+	v, err := loader.NewVehicleFile(path, nil).Load()
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return v
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vehicles.json")
+	if err := os.WriteFile(path, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed write keeps the previous content and leaves no temporary file
+	errWrite := errors.New("write failed")
+	err := WriteFileAtomic(path, func(w io.Writer) error {
+		_, _ = w.Write([]byte("partial"))
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("expected the error of the write, got %v", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "previous" {
+		t.Errorf("expected the previous content, got %q", b)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only the file, got %d entries", len(entries))
+	}
+
+	// a successful write replaces it
+	err = WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("next"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "next" {
+		t.Errorf("expected the new content, got %q", b)
+	}
+}
+
+func TestVehicleFile_Sync(t *testing.T) {
+	// the directory of the file does not exist yet, so the writes fail
+	dir := filepath.Join(t.TempDir(), "data")
+	path := filepath.Join(dir, "vehicles.json")
+	rp := NewVehicleFile(nil, path, 0)
+
+	// a change that can not be written is not applied
+	v := newTestVehicle(1)
+	if err := rp.Add(&v); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	if _, err := rp.GetById(1); !errors.Is(err, internal.ErrVehicleIdNotFound) {
+		t.Fatalf("expected the vehicle not to be added, got %v", err)
+	}
+
+	// so it can be retried
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	v = newTestVehicle(1)
+	if err := rp.Add(&v); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if got := readVehicleFile(t, path); len(got) != 1 || got[1].Version != 1 {
+		t.Fatalf("expected vehicle 1 written, got %+v", got)
+	}
+
+	// every change is written before returning
+	if err := rp.DeleteVehicle(1, 1, "sold"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readVehicleFile(t, path); !got[1].Deleted() || got[1].Deletion.Reason != "sold" {
+		t.Fatalf("expected vehicle 1 written in the trash, got %+v", got)
+	}
+	if err := rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVehicleFile_Debounce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.json")
+	rp := NewVehicleFile(nil, path, 50*time.Millisecond)
+	defer rp.Close()
+
+	// the changes are written together after the interval
+	for id := 1; id <= 3; id++ {
+		v := newTestVehicle(id)
+		if err := rp.Add(&v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing written before the interval, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the changes written after the interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := readVehicleFile(t, path); len(got) != 3 {
+		t.Fatalf("expected 3 vehicles written, got %d", len(got))
+	}
+}
+
+func TestVehicleFile_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.json")
+	rp := NewVehicleFile(nil, path, time.Hour)
+
+	// the pending changes are written on Close
+	v := newTestVehicle(1)
+	if err := rp.Add(&v); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readVehicleFile(t, path); len(got) != 1 {
+		t.Fatalf("expected vehicle 1 written on Close, got %+v", got)
+	}
+}
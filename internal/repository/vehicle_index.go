@@ -0,0 +1,443 @@
+package repository
+
+import (
+	"app/internal"
+	"math"
+	"sort"
+)
+
+var (
+	// negInf is the lower bound of an open range
+	negInf = math.Inf(-1)
+	// posInf is the upper bound of an open range
+	posInf = math.Inf(1)
+)
+
+// hashIndex is an index of the ids of the vehicles by the value of a text field
+type hashIndex struct {
+	// key returns the indexed value of a vehicle
+	key func(v internal.Vehicle) string
+	// normalize, when set, is applied to the indexed values and to the values looked up, so values with the
+	// same normalized form share their ids
+	normalize func(s string) string
+	// ids is the set of ids of each value
+	ids map[string]map[int]struct{}
+}
+
+// newHashIndex is a function that returns an empty hashIndex
+func newHashIndex(key func(v internal.Vehicle) string) *hashIndex {
+	return &hashIndex{key: key, ids: make(map[string]map[int]struct{})}
+}
+
+// newNormalizedHashIndex is a function that returns an empty hashIndex of normalized values
+func newNormalizedHashIndex(key func(v internal.Vehicle) string, normalize func(s string) string) *hashIndex {
+	return &hashIndex{key: key, normalize: normalize, ids: make(map[string]map[int]struct{})}
+}
+
+// indexed is a method that returns the value of a vehicle as it is stored in the index
+func (x *hashIndex) indexed(v internal.Vehicle) string {
+	if x.normalize != nil {
+		return x.normalize(x.key(v))
+	}
+	return x.key(v)
+}
+
+// add is a method that adds a vehicle to the index
+func (x *hashIndex) add(v internal.Vehicle) {
+	k := x.indexed(v)
+	set, ok := x.ids[k]
+	if !ok {
+		set = make(map[int]struct{})
+		x.ids[k] = set
+	}
+	set[v.Id] = struct{}{}
+}
+
+// remove is a method that removes a vehicle from the index
+func (x *hashIndex) remove(v internal.Vehicle) {
+	k := x.indexed(v)
+	set := x.ids[k]
+	delete(set, v.Id)
+	if len(set) == 0 {
+		delete(x.ids, k)
+	}
+}
+
+// get is a method that returns the set of ids with a value
+// The set belongs to the index: it must not be changed, nor used after the lock is released
+func (x *hashIndex) get(k string) map[int]struct{} {
+	if x.normalize != nil {
+		k = x.normalize(k)
+	}
+	return x.ids[k]
+}
+
+// sortedEntry is an entry of a sortedIndex
+type sortedEntry struct {
+	// key is the indexed value
+	key float64
+	// id is the id of the vehicle
+	id int
+}
+
+// less is a method that returns if the entry goes before another one: by key and then by id
+func (e sortedEntry) less(o sortedEntry) bool {
+	return e.key < o.key || (e.key == o.key && e.id < o.id)
+}
+
+// sortedBlockSize is the maximum number of entries of a block of a sortedIndex
+const sortedBlockSize = 512
+
+// sortedIndex is an index of the ids of the vehicles sorted by the value of a numeric field
+// The entries are kept in sorted blocks of at most sortedBlockSize entries, so lookups are binary searches and
+// inserting or removing an entry only moves the entries of its block
+type sortedIndex struct {
+	// key returns the indexed value of a vehicle
+	key func(v internal.Vehicle) float64
+	// blocks are the entries sorted by key and id, split in non-empty blocks
+	blocks [][]sortedEntry
+	// size is the number of entries
+	size int
+}
+
+// newSortedIndex is a function that returns an empty sortedIndex
+func newSortedIndex(key func(v internal.Vehicle) float64) *sortedIndex {
+	return &sortedIndex{key: key}
+}
+
+// search is a method that returns the position (block and entry) of the first entry that satisfies pred
+// pred must be false for a prefix of the entries and true for the rest
+func (x *sortedIndex) search(pred func(e sortedEntry) bool) (b, i int) {
+	b = sort.Search(len(x.blocks), func(b int) bool {
+		blk := x.blocks[b]
+		return pred(blk[len(blk)-1])
+	})
+	if b < len(x.blocks) {
+		blk := x.blocks[b]
+		i = sort.Search(len(blk), func(i int) bool { return pred(blk[i]) })
+	}
+	return
+}
+
+// add is a method that adds a vehicle to the index
+func (x *sortedIndex) add(v internal.Vehicle) {
+	e := sortedEntry{key: x.key(v), id: v.Id}
+	x.size++
+
+	// first entry
+	if len(x.blocks) == 0 {
+		x.blocks = append(x.blocks, []sortedEntry{e})
+		return
+	}
+
+	// position, past the end goes at the end of the last block
+	b, i := x.search(func(o sortedEntry) bool { return !o.less(e) })
+	if b == len(x.blocks) {
+		b = len(x.blocks) - 1
+		i = len(x.blocks[b])
+	}
+
+	// insert
+	blk := append(x.blocks[b], sortedEntry{})
+	copy(blk[i+1:], blk[i:])
+	blk[i] = e
+	x.blocks[b] = blk
+
+	// split a full block in halves
+	if len(blk) > sortedBlockSize {
+		half := len(blk) / 2
+		right := append([]sortedEntry(nil), blk[half:]...)
+		x.blocks[b] = blk[:half:half]
+		x.blocks = append(x.blocks, nil)
+		copy(x.blocks[b+2:], x.blocks[b+1:])
+		x.blocks[b+1] = right
+	}
+}
+
+// addAll is a method that adds many vehicles to the index
+// When there are many compared to the size of the index, the new entries are sorted and merged with the
+// existing ones in a single pass, instead of being inserted one by one
+func (x *sortedIndex) addAll(vs []internal.Vehicle) {
+	if len(vs)*sortedBlockSize < x.size || len(vs) < 16 {
+		for _, v := range vs {
+			x.add(v)
+		}
+		return
+	}
+
+	added := make([]sortedEntry, 0, len(vs))
+	for _, v := range vs {
+		added = append(added, sortedEntry{key: x.key(v), id: v.Id})
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].less(added[j]) })
+
+	// merge
+	merged := make([]sortedEntry, 0, x.size+len(added))
+	j := 0
+	for _, blk := range x.blocks {
+		for _, e := range blk {
+			for j < len(added) && added[j].less(e) {
+				merged = append(merged, added[j])
+				j++
+			}
+			merged = append(merged, e)
+		}
+	}
+	merged = append(merged, added[j:]...)
+
+	// split in half-full blocks, so the next inserts do not split them right away
+	x.blocks = x.blocks[:0]
+	for len(merged) > 0 {
+		n := sortedBlockSize / 2
+		if n > len(merged) {
+			n = len(merged)
+		}
+		x.blocks = append(x.blocks, merged[:n:n])
+		merged = merged[n:]
+	}
+	x.size += len(added)
+}
+
+// remove is a method that removes a vehicle from the index
+func (x *sortedIndex) remove(v internal.Vehicle) {
+	e := sortedEntry{key: x.key(v), id: v.Id}
+	b, i := x.search(func(o sortedEntry) bool { return !o.less(e) })
+	if b == len(x.blocks) || x.blocks[b][i] != e {
+		return
+	}
+
+	// remove the entry, and the block if it is empty
+	blk := x.blocks[b]
+	x.blocks[b] = append(blk[:i], blk[i+1:]...)
+	if len(x.blocks[b]) == 0 {
+		x.blocks = append(x.blocks[:b], x.blocks[b+1:]...)
+	}
+	x.size--
+}
+
+// ascend is a method that calls fn for each entry with a key in [min, max], in order
+func (x *sortedIndex) ascend(min, max float64, fn func(e sortedEntry)) {
+	b, i := x.search(func(e sortedEntry) bool { return e.key >= min })
+	for ; b < len(x.blocks); b, i = b+1, 0 {
+		for _, e := range x.blocks[b][i:] {
+			if e.key > max {
+				return
+			}
+			fn(e)
+		}
+	}
+}
+
+// count is a method that returns the number of entries with a key in [min, max]
+func (x *sortedIndex) count(min, max float64) (n int) {
+	lb, li := x.search(func(e sortedEntry) bool { return e.key >= min })
+	hb, hi := x.search(func(e sortedEntry) bool { return e.key > max })
+	if lb > hb || (lb == hb && li >= hi) {
+		return 0
+	}
+	if lb == hb {
+		return hi - li
+	}
+	n = len(x.blocks[lb]) - li
+	for b := lb + 1; b < hb; b++ {
+		n += len(x.blocks[b])
+	}
+	return n + hi
+}
+
+// vehicleIndexes is a struct that represents the secondary indexes of a VehicleMap
+type vehicleIndexes struct {
+	// brand is the index by brand
+	brand *hashIndex
+	// color is the index by color
+	color *hashIndex
+	// fuelType is the index by fuel type
+	fuelType *hashIndex
+	// registration is the index by normalized registration
+	registration *hashIndex
+	// year is the index by fabrication year
+	year *sortedIndex
+	// weight is the index by weight
+	weight *sortedIndex
+	// length is the index by length
+	length *sortedIndex
+	// width is the index by width
+	width *sortedIndex
+}
+
+// registrationKey is a function that returns the registration of a vehicle
+func registrationKey(v internal.Vehicle) string {
+	return v.Registration
+}
+
+// newVehicleIndexes is a function that returns the indexes of the vehicles in db
+func newVehicleIndexes(db map[int]internal.Vehicle) *vehicleIndexes {
+	x := &vehicleIndexes{
+		brand:        newHashIndex(func(v internal.Vehicle) string { return v.Brand }),
+		color:        newHashIndex(func(v internal.Vehicle) string { return v.Color }),
+		fuelType:     newHashIndex(func(v internal.Vehicle) string { return v.FuelType }),
+		registration: newNormalizedHashIndex(registrationKey, internal.NormalizeRegistration),
+		year:         newSortedIndex(func(v internal.Vehicle) float64 { return float64(v.FabricationYear) }),
+		weight:       newSortedIndex(func(v internal.Vehicle) float64 { return v.Weight }),
+		length:       newSortedIndex(func(v internal.Vehicle) float64 { return v.Length }),
+		width:        newSortedIndex(func(v internal.Vehicle) float64 { return v.Width }),
+	}
+
+	vs := make([]internal.Vehicle, 0, len(db))
+	for _, v := range db {
+		vs = append(vs, v)
+	}
+	x.addAll(vs)
+
+	return x
+}
+
+// addAll is a method that adds vehicles to every index
+func (x *vehicleIndexes) addAll(vs []internal.Vehicle) {
+	for _, v := range vs {
+		x.brand.add(v)
+		x.color.add(v)
+		x.fuelType.add(v)
+		x.registration.add(v)
+	}
+	x.year.addAll(vs)
+	x.weight.addAll(vs)
+	x.length.addAll(vs)
+	x.width.addAll(vs)
+}
+
+// remove is a method that removes a vehicle from every index
+func (x *vehicleIndexes) remove(v internal.Vehicle) {
+	x.brand.remove(v)
+	x.color.remove(v)
+	x.fuelType.remove(v)
+	x.registration.remove(v)
+	x.year.remove(v)
+	x.weight.remove(v)
+	x.length.remove(v)
+	x.width.remove(v)
+}
+
+// hash is a method that returns the hash index of a field, or nil if the field has none
+func (x *vehicleIndexes) hash(f internal.VehicleField) *hashIndex {
+	switch f {
+	case internal.VehicleFieldBrand:
+		return x.brand
+	case internal.VehicleFieldColor:
+		return x.color
+	case internal.VehicleFieldFuelType:
+		return x.fuelType
+	case internal.VehicleFieldRegistration:
+		return x.registration
+	}
+	return nil
+}
+
+// sorted is a method that returns the sorted index of a field, or nil if the field has none
+func (x *vehicleIndexes) sorted(f internal.VehicleField) *sortedIndex {
+	switch f {
+	case internal.VehicleFieldFabricationYear:
+		return x.year
+	case internal.VehicleFieldWeight:
+		return x.weight
+	case internal.VehicleFieldLength:
+		return x.length
+	case internal.VehicleFieldWidth:
+		return x.width
+	}
+	return nil
+}
+
+// candidates is a method that returns the ids of the vehicles that may satisfy a filter, using an index
+// ok is false when the filter can not use an index
+func (x *vehicleIndexes) candidates(f internal.VehicleFilter) (ids []int, ok bool) {
+	if _, ok = x.estimate(f); !ok {
+		return
+	}
+
+	// hash index: equal or in
+	// a normalized index may return more candidates than the filter matches, the filter refines them afterwards
+	if h := x.hash(f.Field); h != nil {
+		seen := make(map[string]bool, len(f.Values))
+		for _, value := range f.Values {
+			k := value.(string)
+			if h.normalize != nil {
+				k = h.normalize(k)
+			}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			for id := range h.get(k) {
+				ids = append(ids, id)
+			}
+		}
+		return ids, true
+	}
+
+	// sorted index: equal or range
+	if s := x.sorted(f.Field); s != nil {
+		min, max := negInf, posInf
+		value := toFloat(f.Values[0])
+		switch f.Operator {
+		case internal.FilterEq:
+			min, max = value, value
+		case internal.FilterGt, internal.FilterGte:
+			// gt is refined by the filter afterwards
+			min = value
+		case internal.FilterLt, internal.FilterLte:
+			max = value
+		}
+		ids = make([]int, 0, s.count(min, max))
+		s.ascend(min, max, func(e sortedEntry) {
+			ids = append(ids, e.id)
+		})
+		return ids, true
+	}
+
+	return nil, false
+}
+
+// estimate is a method that returns how many ids candidates would return for a filter, without building them
+// ok is false when the filter can not use an index
+func (x *vehicleIndexes) estimate(f internal.VehicleFilter) (n int, ok bool) {
+	if len(f.Values) == 0 {
+		return 0, false
+	}
+	if h := x.hash(f.Field); h != nil {
+		if f.Operator != internal.FilterEq && f.Operator != internal.FilterIn {
+			return 0, false
+		}
+		for _, value := range f.Values {
+			k, isString := value.(string)
+			if !isString {
+				return 0, false
+			}
+			n += len(h.get(k))
+		}
+		return n, true
+	}
+	if s := x.sorted(f.Field); s != nil {
+		value := toFloat(f.Values[0])
+		switch f.Operator {
+		case internal.FilterEq:
+			return s.count(value, value), true
+		case internal.FilterGt, internal.FilterGte:
+			return s.count(value, posInf), true
+		case internal.FilterLt, internal.FilterLte:
+			return s.count(negInf, value), true
+		}
+	}
+	return 0, false
+}
+
+// toFloat is a function that converts a numeric value of a filter to float64
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
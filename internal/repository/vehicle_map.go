@@ -1,25 +1,175 @@
 package repository
 
-import "app/internal"
+import (
+	"app/internal"
+	"sort"
+	"sync"
+	"time"
+)
 
 // NewVehicleMap is a function that returns a new instance of VehicleMap
+// The vehicles of db with a Deletion are moved to the trash
 func NewVehicleMap(db map[int]internal.Vehicle) *VehicleMap {
 	// default db
 	defaultDb := make(map[int]internal.Vehicle)
 	if db != nil {
 		defaultDb = db
 	}
-	return &VehicleMap{db: defaultDb}
+	trash := make(map[int]internal.Vehicle)
+	for id, v := range defaultDb {
+		if v.Deleted() {
+			trash[id] = v
+			delete(defaultDb, id)
+		}
+	}
+	return &VehicleMap{db: defaultDb, trash: trash, idx: newVehicleIndexes(defaultDb)}
 }
 
 // VehicleMap is a struct that represents a vehicle repository
+// It is safe for concurrent use: reads share the lock and writes are exclusive
+// Lookups by brand, color, fuel type and registration use hash indexes, and range lookups by fabrication year,
+// weight, length and width use sorted indexes
+// The vehicles in the trash are kept apart, out of db and its indexes
 type VehicleMap struct {
+	// mu guards db and trash
+	mu sync.RWMutex
 	// db is a map of vehicles
 	db map[int]internal.Vehicle
+	// trash is a map of the vehicles in the trash
+	trash map[int]internal.Vehicle
+	// idx are the secondary indexes of db
+	idx *vehicleIndexes
+	// journal, when set, is called with every change before it is applied, while holding the lock
+	// If it returns an error the change is not applied
+	journal func(c change) error
+}
+
+const (
+	// opAdd is the operation of Add
+	opAdd = "add"
+	// opAddBatch is the operation of AddBatch
+	opAddBatch = "add_batch"
+	// opUpdateSpeed is the operation of UpdateSpeed
+	opUpdateSpeed = "update_speed"
+	// opUpdate is the operation of Update
+	opUpdate = "update"
+	// opDelete is the operation of DeleteVehicle
+	opDelete = "delete"
+	// opRestore is the operation of Restore
+	opRestore = "restore"
+	// opPurge is the operation of Purge
+	opPurge = "purge"
+	// opNormalizeTerms is the operation of NormalizeTerms
+	opNormalizeTerms = "normalize_terms"
+	// opReload is the operation of Reload
+	opReload = "reload"
+)
+
+// change is a struct that represents a change applied to a VehicleMap
+type change struct {
+	// Op is the operation that produced the change
+	Op string `json:"op"`
+	// Vehicles are the vehicles created or updated by the change, with their final values
+	Vehicles []internal.Vehicle `json:"vehicles,omitempty"`
+	// Ids are the ids of the vehicles deleted for good by the change
+	Ids []int `json:"ids,omitempty"`
+	// Trashed are the vehicles moved to the trash by the change, with their Deletion
+	Trashed []internal.Vehicle `json:"trashed,omitempty"`
+	// Purged are the ids of the vehicles removed from the trash by the change
+	Purged []int `json:"purged,omitempty"`
+}
+
+// commit is a method that journals and applies a change
+// The caller must hold the write lock
+func (r *VehicleMap) commit(c change) (err error) {
+	if r.journal != nil {
+		if err = r.journal(c); err != nil {
+			return
+		}
+	}
+	r.apply(c)
+	return
+}
+
+// apply is a method that applies a change to db and its indexes
+// Applying the same change twice has the same result as applying it once
+// The caller must hold the write lock
+func (r *VehicleMap) apply(c change) {
+	// vehicles removed from the trash
+	for _, id := range c.Purged {
+		delete(r.trash, id)
+	}
+
+	// vehicles created or updated, the last one of each id wins
+	last := make(map[int]int, len(c.Vehicles))
+	for i, v := range c.Vehicles {
+		last[v.Id] = i
+	}
+	added := make([]internal.Vehicle, 0, len(c.Vehicles))
+	for i, v := range c.Vehicles {
+		if last[v.Id] != i {
+			continue
+		}
+		if old, ok := r.db[v.Id]; ok {
+			r.idx.remove(old)
+		}
+		r.db[v.Id] = v
+		added = append(added, v)
+	}
+	r.idx.addAll(added)
+
+	// vehicles deleted
+	for _, id := range c.Ids {
+		if old, ok := r.db[id]; ok {
+			r.idx.remove(old)
+			delete(r.db, id)
+		}
+	}
+
+	// vehicles moved to the trash
+	for _, v := range c.Trashed {
+		if old, ok := r.db[v.Id]; ok {
+			r.idx.remove(old)
+			delete(r.db, v.Id)
+		}
+		r.trash[v.Id] = v
+	}
+}
+
+// snapshot is a method that returns a copy of the vehicles, the ones in the trash included
+// The caller must hold the lock
+func (r *VehicleMap) snapshot() (v map[int]internal.Vehicle) {
+	v = make(map[int]internal.Vehicle, len(r.db)+len(r.trash))
+	for key, value := range r.db {
+		v[key] = value
+	}
+	for key, value := range r.trash {
+		v[key] = value
+	}
+	return
+}
+
+// applySnapshot is a function that applies a change to a snapshot of the vehicles, the same way as apply
+func applySnapshot(v map[int]internal.Vehicle, c change) {
+	for _, id := range c.Purged {
+		delete(v, id)
+	}
+	for _, vh := range c.Vehicles {
+		v[vh.Id] = vh
+	}
+	for _, id := range c.Ids {
+		delete(v, id)
+	}
+	for _, vh := range c.Trashed {
+		v[vh.Id] = vh
+	}
 }
 
 // FindAll is a method that returns a map of all vehicles
 func (r *VehicleMap) FindAll() (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	v = make(map[int]internal.Vehicle)
 
 	// copy db
@@ -30,26 +180,76 @@ func (r *VehicleMap) FindAll() (v map[int]internal.Vehicle, err error) {
 	return
 }
 
+// GetById is a method that returns the vehicle with an id
+func (r *VehicleMap) GetById(id int) (v internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.db[id]
+	if !ok {
+		err = internal.ErrVehicleIdNotFound
+	}
+
+	return
+}
+
+// GetByRegistration is a method that returns the vehicle with a registration, compared in its normalized form
+// If several vehicles match, the one with the lowest id
+func (r *VehicleMap) GetByRegistration(registration string) (v internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// lowest id with the registration
+	found := false
+	for id := range r.idx.registration.get(registration) {
+		if !found || id < v.Id {
+			v, found = r.db[id], true
+		}
+	}
+
+	if !found {
+		err = internal.ErrVehicleIdNotFound
+	}
+
+	return
+}
+
 // Add is a method that adds a new vehicle to the repository
 func (r *VehicleMap) Add(v *internal.Vehicle) error {
-	err := checkExistence(*v, r.db)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.checkExistence(*v)
 	if err != nil {
 		return err
 	}
-	r.db[v.Id] = *v
 
-	return nil
+	v.Version = 1
+	return r.commit(change{Op: opAdd, Vehicles: []internal.Vehicle{*v}})
 }
 
 // GetByColorAndYear is a method that returns a map of vehicles with a specific color and year
 func (r *VehicleMap) GetByColorAndYear(color string, year int) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	v = make(map[int]internal.Vehicle)
 
 	// copy db with the specific vehicles considering color and year
-	for key, value := range r.db {
-		if value.FabricationYear == year && value.Color == color {
-			v[key] = value
+	// starting from the smallest of the color and the year indexes
+	byColor := r.idx.color.get(color)
+	if len(byColor) <= r.idx.year.count(float64(year), float64(year)) {
+		for id := range byColor {
+			if value := r.db[id]; value.FabricationYear == year {
+				v[id] = value
+			}
 		}
+	} else {
+		r.idx.year.ascend(float64(year), float64(year), func(e sortedEntry) {
+			if value := r.db[e.id]; value.Color == color {
+				v[e.id] = value
+			}
+		})
 	}
 
 	if len(v) == 0 {
@@ -62,13 +262,26 @@ func (r *VehicleMap) GetByColorAndYear(color string, year int) (v map[int]intern
 // GetByBrandAndYears is a method that returns a map of vehicles with a specific brand
 // and between two years
 func (r *VehicleMap) GetByBrandAndYears(brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	v = make(map[int]internal.Vehicle)
 
 	// copy db with the specific vehicles considering brand and between two years
-	for key, value := range r.db {
-		if value.FabricationYear >= startYear && value.FabricationYear <= endYear && value.Brand == brand {
-			v[key] = value
+	// starting from the smallest of the brand and the years indexes
+	byBrand := r.idx.brand.get(brand)
+	if len(byBrand) <= r.idx.year.count(float64(startYear), float64(endYear)) {
+		for id := range byBrand {
+			if value := r.db[id]; value.FabricationYear >= startYear && value.FabricationYear <= endYear {
+				v[id] = value
+			}
 		}
+	} else {
+		r.idx.year.ascend(float64(startYear), float64(endYear), func(e sortedEntry) {
+			if value := r.db[e.id]; value.Brand == brand {
+				v[e.id] = value
+			}
+		})
 	}
 
 	if len(v) == 0 {
@@ -80,13 +293,14 @@ func (r *VehicleMap) GetByBrandAndYears(brand string, startYear, endYear int) (v
 
 // GetByBrand is a method that returns a map with vehicles from a specific brand
 func (r *VehicleMap) GetByBrand(brand string) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	v = make(map[int]internal.Vehicle)
 
-	// copy db with the specific vehicles considering color and year
-	for key, value := range r.db {
-		if value.Brand == brand {
-			v[key] = value
-		}
+	// copy db with the specific vehicles considering the brand
+	for id := range r.idx.brand.get(brand) {
+		v[id] = r.db[id]
 	}
 
 	if len(v) == 0 {
@@ -97,56 +311,199 @@ func (r *VehicleMap) GetByBrand(brand string) (v map[int]internal.Vehicle, err e
 }
 
 // AddBatch is a method that adds a new vehicles to the repository
-func (r *VehicleMap) AddBatch(vSlice []*internal.Vehicle) error {
-	for _, value := range vSlice {
-		err := checkExistence(*value, r.db)
+// The existence checks and the insertion run under the same lock, and the vehicles are inserted in a single change
+func (r *VehicleMap) AddBatch(vSlice []*internal.Vehicle, mode internal.BatchMode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// existence, in db and earlier in the batch
+	batchErr := &internal.VehicleBatchError{Errors: make(map[int]error)}
+	ids := make(map[int]bool, len(vSlice))
+	registrations := make(map[string]bool, len(vSlice))
+	added := make([]*internal.Vehicle, 0, len(vSlice))
+	for i, v := range vSlice {
+		registration := internal.NormalizeRegistration(v.Registration)
+		err := r.checkExistence(*v)
+		switch {
+		case err != nil:
+		case ids[v.Id]:
+			err = internal.ErrVehicleIdAlreadyExists
+		case registrations[registration]:
+			err = internal.ErrVehicleRegistrationAlreadyExists
+		}
 		if err != nil {
-			return err
+			batchErr.Errors[i] = err
+			continue
 		}
+		ids[v.Id] = true
+		registrations[registration] = true
+		added = append(added, v)
+	}
+	if len(batchErr.Errors) > 0 && mode != internal.BatchModeBestEffort {
+		return batchErr
 	}
 
-	for _, v := range vSlice {
-		r.db[v.Id] = *v
+	// insert
+	if len(added) > 0 {
+		c := change{Op: opAddBatch, Vehicles: make([]internal.Vehicle, 0, len(added))}
+		for _, v := range added {
+			vh := *v
+			vh.Version = 1
+			c.Vehicles = append(c.Vehicles, vh)
+		}
+		if err := r.commit(c); err != nil {
+			return err
+		}
+		for _, v := range added {
+			v.Version = 1
+		}
 	}
 
+	if len(batchErr.Errors) > 0 {
+		return batchErr
+	}
 	return nil
 }
 
-func checkExistence(v internal.Vehicle, db map[int]internal.Vehicle) error {
-	for _, vdb := range db {
-		if vdb.Id == v.Id {
-			return internal.ErrVehicleIdAlreadyExists
-		}
+// checkExistence is a method that checks if the id of a vehicle is already in db or in the trash, or its
+// registration in db. Registrations are compared in their normalized form
+// The caller must hold the lock
+func (r *VehicleMap) checkExistence(v internal.Vehicle) error {
+	if _, ok := r.db[v.Id]; ok {
+		return internal.ErrVehicleIdAlreadyExists
+	}
+	if _, ok := r.trash[v.Id]; ok {
+		return internal.ErrVehicleIdAlreadyExists
+	}
+	if len(r.idx.registration.get(v.Registration)) > 0 {
+		return internal.ErrVehicleRegistrationAlreadyExists
+	}
+	return nil
+}
 
-		if vdb.Registration == v.Registration {
-			return internal.ErrVehicleRegistrationAlreadyExists
-		}
+// checkVersion is a function that checks that a vehicle is at the expected version, if any (not 0)
+func checkVersion(v internal.Vehicle, version int) error {
+	if version != 0 && v.Version != version {
+		return internal.ErrVehicleVersionMismatch
 	}
 	return nil
 }
 
 // UpdateSpeed is a method that updates the max speed of a vehicle
-func (r *VehicleMap) UpdateSpeed(speed float64, id int) error {
+func (r *VehicleMap) UpdateSpeed(speed float64, id int, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	v, ok := r.db[id]
 
 	if !ok {
 		return internal.ErrVehicleIdNotFound
 	}
+	if err := checkVersion(v, version); err != nil {
+		return err
+	}
 	v.MaxSpeed = speed
-	r.db[id] = v
+	v.Version++
+
+	return r.commit(change{Op: opUpdateSpeed, Vehicles: []internal.Vehicle{v}})
+}
+
+// Update is a method that replaces a vehicle
+// The registration is checked against the other vehicles only when it changes, so vehicles that already
+// share a registration can still be updated
+func (r *VehicleMap) Update(v *internal.Vehicle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.db[v.Id]
+	if !ok {
+		return internal.ErrVehicleIdNotFound
+	}
+	if err := checkVersion(old, v.Version); err != nil {
+		return err
+	}
+	if internal.NormalizeRegistration(v.Registration) != internal.NormalizeRegistration(old.Registration) {
+		if len(r.idx.registration.get(v.Registration)) > 0 {
+			return internal.ErrVehicleRegistrationAlreadyExists
+		}
+	}
 
+	updated := *v
+	updated.Version = old.Version + 1
+	if err := r.commit(change{Op: opUpdate, Vehicles: []internal.Vehicle{updated}}); err != nil {
+		return err
+	}
+	v.Version = updated.Version
 	return nil
 }
 
+// NormalizeTerms is a method that replaces the values of fuel type, transmission and color of the vehicles
+// with their canonical values, in a single change. The version of each changed vehicle is incremented
+// It returns the number of vehicles changed
+func (r *VehicleMap) NormalizeTerms(ix internal.VocabularyIndex) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changed []internal.Vehicle
+	for _, v := range r.db {
+		if ok, _ := ix.Normalize(&v); ok {
+			v.Version++
+			changed = append(changed, v)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	if err = r.commit(change{Op: opNormalizeTerms, Vehicles: changed}); err != nil {
+		return
+	}
+	n = len(changed)
+	return
+}
+
+// Reload is a method that replaces the vehicles with v in a single change and returns the changes
+// The vehicles whose attributes are the same keep their version, and the vehicles deleted are moved to the trash
+// The changes are checked with check, if any, under the write lock
+func (r *VehicleMap) Reload(v map[int]internal.Vehicle, check internal.ReloadCheck) (d internal.VehicleDiff, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d = internal.DiffVehicles(r.db, v, r.trash)
+	if d.Empty() {
+		return
+	}
+	if check != nil {
+		if err = check(r.db, &d); err != nil {
+			d = internal.VehicleDiff{}
+			return
+		}
+	}
+
+	c := change{Op: opReload, Vehicles: make([]internal.Vehicle, 0, len(d.Added)+len(d.Updated))}
+	c.Vehicles = append(append(c.Vehicles, d.Added...), d.Updated...)
+	deletion := &internal.VehicleDeletion{At: time.Now().UTC(), Reason: internal.ReloadDeletionReason}
+	for _, id := range d.Deleted {
+		vh := r.db[id]
+		vh.Deletion = deletion
+		c.Trashed = append(c.Trashed, vh)
+	}
+	if err = r.commit(c); err != nil {
+		d = internal.VehicleDiff{}
+	}
+	return
+}
+
 // GetByFuelType is a method that returns a map of vehicles with a type of fuel
 func (r *VehicleMap) GetByFuelType(fuelType string) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	v = make(map[int]internal.Vehicle)
 
 	// copy db with the specific vehicles considering fuel type
-	for key, value := range r.db {
-		if value.FuelType == fuelType {
-			v[key] = value
-		}
+	for id := range r.idx.fuelType.get(fuelType) {
+		v[id] = r.db[id]
 	}
 
 	if len(v) == 0 {
@@ -156,27 +513,104 @@ func (r *VehicleMap) GetByFuelType(fuelType string) (v map[int]internal.Vehicle,
 	return
 }
 
-// DeleteVehicle is a method that deletes a vehicle
-func (r *VehicleMap) DeleteVehicle(id int) (err error) {
-	_, ok := r.db[id]
+// DeleteVehicle is a method that moves a vehicle to the trash
+func (r *VehicleMap) DeleteVehicle(id int, version int, reason string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.db[id]
 
 	if !ok {
 		return internal.ErrVehicleIdNotFound
 	}
-	delete(r.db, id)
+	if err = checkVersion(v, version); err != nil {
+		return
+	}
 
-	return nil
+	v.Deletion = &internal.VehicleDeletion{At: time.Now().UTC(), Reason: reason}
+	return r.commit(change{Op: opDelete, Trashed: []internal.Vehicle{v}})
+}
+
+// Trash is a method that returns the vehicles in the trash, sorted by id
+func (r *VehicleMap) Trash() (v []internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v = make([]internal.Vehicle, 0, len(r.trash))
+	for _, value := range r.trash {
+		v = append(v, value)
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i].Id < v[j].Id })
+	return
+}
+
+// Restore is a method that moves a vehicle from the trash back to the vehicles, at its next version
+func (r *VehicleMap) Restore(id int) (v internal.Vehicle, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.trash[id]
+	if !ok {
+		err = internal.ErrVehicleIdNotFound
+		return
+	}
+	if len(r.idx.registration.get(v.Registration)) > 0 {
+		err = internal.ErrVehicleRegistrationAlreadyExists
+		return
+	}
+
+	v.Deletion = nil
+	v.Version++
+	if err = r.commit(change{Op: opRestore, Vehicles: []internal.Vehicle{v}, Purged: []int{id}}); err != nil {
+		v = internal.Vehicle{}
+	}
+	return
+}
+
+// Purge is a method that removes for good the vehicles of the trash deleted before a time, in a single change
+func (r *VehicleMap) Purge(before time.Time) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []int
+	for id, v := range r.trash {
+		if v.Deletion.At.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	sort.Ints(ids)
+
+	if err = r.commit(change{Op: opPurge, Purged: ids}); err != nil {
+		return
+	}
+	n = len(ids)
+	return
 }
 
 // GetByDimensions is a method that returns vehicles with a specific dimension
 func (r *VehicleMap) GetByDimensions(minLength, maxLength, minWidth, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	v = make(map[int]internal.Vehicle)
 
 	// copy db with the specific vehicles considering the dimension
-	for key, value := range r.db {
-		if (value.Length >= minLength && value.Length <= maxLength) && (value.Width >= minWidth && value.Width <= maxWidth) {
-			v[key] = value
-		}
+	// starting from the smallest of the length and the width indexes
+	if r.idx.length.count(minLength, maxLength) <= r.idx.width.count(minWidth, maxWidth) {
+		r.idx.length.ascend(minLength, maxLength, func(e sortedEntry) {
+			if value := r.db[e.id]; value.Width >= minWidth && value.Width <= maxWidth {
+				v[e.id] = value
+			}
+		})
+	} else {
+		r.idx.width.ascend(minWidth, maxWidth, func(e sortedEntry) {
+			if value := r.db[e.id]; value.Length >= minLength && value.Length <= maxLength {
+				v[e.id] = value
+			}
+		})
 	}
 
 	if len(v) == 0 {
@@ -188,14 +622,15 @@ func (r *VehicleMap) GetByDimensions(minLength, maxLength, minWidth, maxWidth fl
 
 // GetByWeight is a method that returns vehicles with a specific weight
 func (r *VehicleMap) GetByWeight(minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	v = make(map[int]internal.Vehicle)
 
 	// copy db with the specific vehicles considering the weight
-	for key, value := range r.db {
-		if value.Weight >= minWeight && value.Weight <= maxWeight {
-			v[key] = value
-		}
-	}
+	r.idx.weight.ascend(minWeight, maxWeight, func(e sortedEntry) {
+		v[e.id] = r.db[e.id]
+	})
 
 	if len(v) == 0 {
 		err = internal.ErrVehiclesNotFound
@@ -203,3 +638,135 @@ func (r *VehicleMap) GetByWeight(minWeight, maxWeight float64) (v map[int]intern
 
 	return
 }
+
+// Query is a method that returns the page of vehicles that satisfy the filters of a query, sorted,
+// and the total number of vehicles that satisfy them
+// The most selective filter that has an index gives the candidates, otherwise every vehicle is checked
+func (r *VehicleMap) Query(q internal.VehicleQuery) (v []internal.Vehicle, total int, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// filter
+	v = make([]internal.Vehicle, 0)
+	r.match(q.Filters, func(value internal.Vehicle) {
+		v = append(v, value)
+	})
+	total = len(v)
+
+	// sort and page
+	sort.Slice(v, func(i, j int) bool {
+		return q.Compare(v[i], v[j]) < 0
+	})
+	v = q.Page(v)
+
+	return
+}
+
+// Aggregate is a method that returns the metrics of the groups of the vehicles that satisfy the filters of
+// an aggregation, sorted by their keys
+// The vehicles are selected as in Query and aggregated in a single pass
+func (r *VehicleMap) Aggregate(a internal.VehicleAggregation) (groups []internal.VehicleGroup, err error) {
+	if err = a.Validate(); err != nil {
+		return
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ag := internal.NewVehicleAggregator(a)
+	r.match(a.Filters, ag.Add)
+	groups = ag.Groups()
+	return
+}
+
+// Histogram is a method that returns the histograms of the groups of the vehicles that satisfy the filters of
+// a histogram, sorted by their keys
+// The vehicles are selected as in Query
+func (r *VehicleMap) Histogram(h internal.VehicleHistogram) (groups []internal.HistogramGroup, err error) {
+	if err = h.Validate(); err != nil {
+		return
+	}
+
+	r.mu.RLock()
+	hb := internal.NewHistogramBuilder(h)
+	r.match(h.Filters, hb.Add)
+	r.mu.RUnlock()
+
+	groups, err = hb.Groups()
+	return
+}
+
+// streamChunk is the number of vehicles that Stream copies each time it holds the lock
+const streamChunk = 256
+
+// Stream is a method that calls fn with every vehicle that satisfies the filters, sorted by id
+// Only the ids of the vehicles are kept: they are copied by chunks, and fn is called without holding the lock so
+// a slow consumer does not block the writers. A vehicle deleted before its chunk is copied is skipped, and one
+// changed is streamed as it is then
+func (r *VehicleMap) Stream(filters []internal.VehicleFilter, fn func(v internal.Vehicle) error) (err error) {
+	q := internal.VehicleQuery{Filters: filters}
+	if err = q.Validate(); err != nil {
+		return
+	}
+
+	// ids
+	r.mu.RLock()
+	ids := make([]int, 0)
+	r.match(filters, func(v internal.Vehicle) {
+		ids = append(ids, v.Id)
+	})
+	r.mu.RUnlock()
+	sort.Ints(ids)
+
+	// chunks
+	chunk := make([]internal.Vehicle, 0, streamChunk)
+	for start := 0; start < len(ids); start += streamChunk {
+		end := min(start+streamChunk, len(ids))
+
+		chunk = chunk[:0]
+		r.mu.RLock()
+		for _, id := range ids[start:end] {
+			if v, ok := r.db[id]; ok && q.Match(v) {
+				chunk = append(chunk, v)
+			}
+		}
+		r.mu.RUnlock()
+
+		for _, v := range chunk {
+			if err = fn(v); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// match is a method that calls fn with every vehicle that satisfies all the filters
+// The most selective filter that has an index gives the candidates, otherwise every vehicle is checked.
+// It must be called with mu locked
+func (r *VehicleMap) match(filters []internal.VehicleFilter, fn func(v internal.Vehicle)) {
+	q := internal.VehicleQuery{Filters: filters}
+
+	// most selective indexed filter
+	best, bestCount := -1, 0
+	for i, f := range filters {
+		if n, ok := r.idx.estimate(f); ok && (best < 0 || n < bestCount) {
+			best, bestCount = i, n
+		}
+	}
+
+	if best >= 0 {
+		ids, _ := r.idx.candidates(filters[best])
+		for _, id := range ids {
+			if value := r.db[id]; q.Match(value) {
+				fn(value)
+			}
+		}
+		return
+	}
+	for _, value := range r.db {
+		if q.Match(value) {
+			fn(value)
+		}
+	}
+}
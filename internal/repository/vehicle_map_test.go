@@ -0,0 +1,507 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/repository/repositorytest"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestVehicle is a function that returns a valid vehicle with the given id
+func newTestVehicle(id int) internal.Vehicle {
+	return internal.Vehicle{
+		Id: id,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           "Ford",
+			Model:           "Fiesta",
+			Registration:    "REG-" + strconv.Itoa(id),
+			Color:           "Red",
+			FabricationYear: 2000 + id%20,
+			Capacity:        4,
+			MaxSpeed:        180,
+			FuelType:        "gas",
+			Transmission:    "manual",
+			Weight:          100 + float64(id%50),
+			Dimensions: internal.Dimensions{
+				Height: 150,
+				Length: 400 + float64(id%10),
+				Width:  180 + float64(id%10),
+			},
+		},
+	}
+}
+
+// TestVehicleMap_Conformance runs the conformance test suite against VehicleMap
+func TestVehicleMap_Conformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) internal.VehicleRepository {
+		return NewVehicleMap(nil)
+	})
+}
+
+// TestVehicleMap_ConcurrentAccess runs every repository method at the same time.
+// It is meant to be run with the race detector: go test -race ./...
+// A reload moves the vehicles added after its snapshot to the trash and a purge removes the vehicles of the trash,
+// so a goroutine may not find its own vehicles, and the test checks that no vehicle is lost and the indexes match
+// the vehicles instead of their number
+func TestVehicleMap_ConcurrentAccess(t *testing.T) {
+	// arrange
+	const (
+		seed        = 100
+		goroutines  = 8
+		iterations  = 100
+		reloadEvery = 10
+		purgeEvery  = 10
+	)
+	db := make(map[int]internal.Vehicle)
+	for i := 1; i <= seed; i++ {
+		db[i] = newTestVehicle(i)
+	}
+	var rp internal.VehicleRepository = NewVehicleMap(db)
+
+	// act
+	var wg sync.WaitGroup
+	var purged, added atomic.Int64
+	errCh := make(chan error, goroutines*iterations)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				// ids of this goroutine never overlap with other goroutines
+				id := seed + 1 + (g*iterations+i)*3
+
+				// writes
+				v := newTestVehicle(id)
+				if err := rp.Add(&v); err != nil {
+					errCh <- err
+				}
+				b1, b2 := newTestVehicle(id+1), newTestVehicle(id+2)
+				if err := rp.AddBatch([]*internal.Vehicle{&b1, &b2}, internal.BatchModeAtomic); err != nil {
+					errCh <- err
+				}
+				if err := rp.UpdateSpeed(float64(i%300), 1+i%seed, 0); err != nil {
+					errCh <- err
+				}
+				v.Color = "Blue"
+				if err := rp.Update(&v); err != nil && !errors.Is(err, internal.ErrVehicleIdNotFound) {
+					errCh <- err
+				}
+				if err := rp.DeleteVehicle(id+1, 0, ""); err != nil && !errors.Is(err, internal.ErrVehicleIdNotFound) {
+					errCh <- err
+				}
+				if _, err := rp.Restore(id + 1); err != nil && !errors.Is(err, internal.ErrVehicleIdNotFound) {
+					errCh <- err
+				}
+				if err := rp.DeleteVehicle(id+1, 0, ""); err != nil && !errors.Is(err, internal.ErrVehicleIdNotFound) {
+					errCh <- err
+				}
+				if i%purgeEvery == purgeEvery/2 {
+					n, err := rp.Purge(time.Now())
+					if err != nil {
+						errCh <- err
+					}
+					purged.Add(int64(n))
+				}
+				if i%reloadEvery == 0 {
+					next, err := rp.FindAll()
+					if err != nil {
+						errCh <- err
+						continue
+					}
+					s := next[1+i%seed]
+					s.Color = "Green"
+					next[s.Id] = s
+					// the vehicles of the snapshot purged since then are added again
+					d, err := rp.Reload(next, func(current map[int]internal.Vehicle, d *internal.VehicleDiff) error {
+						for _, a := range d.Added {
+							if _, ok := current[a.Id]; ok {
+								return fmt.Errorf("reload: vehicle %d added twice", a.Id)
+							}
+						}
+						return nil
+					})
+					if err != nil {
+						errCh <- err
+					}
+					added.Add(int64(len(d.Added)))
+				}
+
+				// reads
+				if _, err := rp.FindAll(); err != nil {
+					errCh <- err
+				}
+				_, _ = rp.GetByColorAndYear("Red", 2000+i%20)
+				_, _ = rp.GetByBrandAndYears("Ford", 2000, 2010)
+				_, _ = rp.GetByBrand("Ford")
+				_, _ = rp.GetByFuelType("gas")
+				_, _ = rp.GetByDimensions(400, 405, 180, 185)
+				_, _ = rp.GetByWeight(100, 120)
+				if _, err := rp.Trash(); err != nil {
+					errCh <- err
+				}
+				if _, err := rp.GetById(id); err != nil && !errors.Is(err, internal.ErrVehicleIdNotFound) {
+					errCh <- err
+				}
+				if _, err := rp.GetByRegistration("reg-" + strconv.Itoa(id+2)); err != nil && !errors.Is(err, internal.ErrVehicleIdNotFound) {
+					errCh <- err
+				}
+				if _, _, err := rp.Query(internal.VehicleQuery{
+					Filters: []internal.VehicleFilter{{Field: internal.VehicleFieldColor, Operator: internal.FilterEq, Values: []any{"Red"}}},
+					Sort:    []internal.VehicleSort{{Field: internal.VehicleFieldMaxSpeed, Desc: true}},
+					Limit:   10,
+				}); err != nil {
+					errCh <- err
+				}
+				if _, err := rp.Aggregate(internal.VehicleAggregation{
+					GroupBy: []internal.VehicleField{internal.VehicleFieldColor},
+					Metrics: []internal.VehicleMetric{
+						{Func: internal.AggregateCount},
+						{Func: internal.AggregateMax, Field: internal.VehicleFieldMaxSpeed},
+					},
+				}); err != nil {
+					errCh <- err
+				}
+				if _, err := rp.Histogram(internal.VehicleHistogram{
+					Field:   internal.VehicleFieldMaxSpeed,
+					GroupBy: []internal.VehicleField{internal.VehicleFieldColor},
+					Mode:    internal.HistogramQuantile,
+					Buckets: 4,
+				}); err != nil {
+					errCh <- err
+				}
+				last := 0
+				if err := rp.Stream(nil, func(v internal.Vehicle) error {
+					if v.Id <= last {
+						return fmt.Errorf("stream: vehicle %d after %d", v.Id, last)
+					}
+					last = v.Id
+					return nil
+				}); err != nil {
+					errCh <- err
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errCh)
+
+	// assert
+	for err := range errCh {
+		t.Errorf("unexpected error: %v", err)
+	}
+	all, err := rp.FindAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	trash, err := rp.Trash()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, v := range trash {
+		if _, ok := all[v.Id]; ok {
+			t.Errorf("vehicle %d is both in the trash and in the repository", v.Id)
+		}
+	}
+	if expected := seed + goroutines*iterations*3 - int(purged.Load()) + int(added.Load()); len(all)+len(trash) != expected {
+		t.Errorf("expected %d vehicles with the trash, got %d and %d (%d purged, %d added again)",
+			expected, len(all), len(trash), purged.Load(), added.Load())
+	}
+	for id, v := range all {
+		if got, err := rp.GetByRegistration(v.Registration); err != nil || got.Id != id {
+			t.Errorf("registration %s: expected vehicle %d, got %d, %v", v.Registration, id, got.Id, err)
+		}
+	}
+	if byBrand, _ := rp.GetByBrand("Ford"); len(byBrand) != len(all) {
+		t.Errorf("expected %d vehicles by brand, got %d", len(all), len(byBrand))
+	}
+}
+
+// TestVehicleMap_ConcurrentAddBatchIsAtomic checks that competing batches with the same ids
+// are either fully inserted or fully rejected
+func TestVehicleMap_ConcurrentAddBatchIsAtomic(t *testing.T) {
+	// arrange
+	const goroutines = 16
+	rp := NewVehicleMap(nil)
+
+	// act
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted := 0
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := make([]*internal.Vehicle, 0, 10)
+			for id := 1; id <= 10; id++ {
+				v := newTestVehicle(id)
+				batch = append(batch, &v)
+			}
+			err := rp.AddBatch(batch, internal.BatchModeAtomic)
+			switch {
+			case err == nil:
+				mu.Lock()
+				inserted++
+				mu.Unlock()
+			case !errors.Is(err, internal.ErrVehicleIdAlreadyExists):
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// assert
+	if inserted != 1 {
+		t.Errorf("expected exactly one batch to be inserted, got %d", inserted)
+	}
+	all, _ := rp.FindAll()
+	if len(all) != 10 {
+		t.Errorf("expected 10 vehicles, got %d", len(all))
+	}
+}
+
+// scanVehicles is a function that returns the vehicles of db that satisfy match, scanning all of them
+// It is the reference that the indexed lookups are checked and measured against
+func scanVehicles(db map[int]internal.Vehicle, match func(v internal.Vehicle) bool) map[int]internal.Vehicle {
+	v := make(map[int]internal.Vehicle)
+	for key, value := range db {
+		if match(value) {
+			v[key] = value
+		}
+	}
+	return v
+}
+
+// randomVehicle is a function that returns a vehicle with random attributes from a small set of values
+func randomVehicle(rd *rand.Rand, id int) internal.Vehicle {
+	brands := []string{"Ford", "Fiat", "Audi", "Kia", "Volvo"}
+	colors := []string{"Red", "Blue", "Green", "Black"}
+	fuelTypes := []string{"gas", "diesel", "biodiesel", "gasoline"}
+	v := newTestVehicle(id)
+	v.Brand = brands[rd.Intn(len(brands))]
+	v.Color = colors[rd.Intn(len(colors))]
+	v.FuelType = fuelTypes[rd.Intn(len(fuelTypes))]
+	v.FabricationYear = 1990 + rd.Intn(30)
+	v.Weight = float64(rd.Intn(5000)) / 10
+	v.Length = float64(rd.Intn(500))
+	v.Width = float64(rd.Intn(300))
+	return v
+}
+
+// TestVehicleMap_IndexesStayConsistent applies random changes and checks every indexed lookup against a scan
+func TestVehicleMap_IndexesStayConsistent(t *testing.T) {
+	// arrange
+	rd := rand.New(rand.NewSource(1))
+	db := make(map[int]internal.Vehicle)
+	for id := 1; id <= 200; id++ {
+		db[id] = randomVehicle(rd, id)
+	}
+	rp := NewVehicleMap(db)
+	nextId := 201
+
+	for round := 0; round < 200; round++ {
+		// act
+		switch rd.Intn(4) {
+		case 0:
+			v := randomVehicle(rd, nextId)
+			nextId++
+			if err := rp.Add(&v); err != nil {
+				t.Fatalf("add: %v", err)
+			}
+		case 1:
+			batch := make([]*internal.Vehicle, 0, 20)
+			for i := 0; i < 20; i++ {
+				v := randomVehicle(rd, nextId)
+				nextId++
+				batch = append(batch, &v)
+			}
+			if err := rp.AddBatch(batch, internal.BatchModeAtomic); err != nil {
+				t.Fatalf("add batch: %v", err)
+			}
+		case 2:
+			_ = rp.UpdateSpeed(float64(rd.Intn(300)), 1+rd.Intn(nextId), 0)
+		case 3:
+			_ = rp.DeleteVehicle(1+rd.Intn(nextId), 0, "")
+		}
+
+		// assert
+		all, _ := rp.FindAll()
+		brand, color, fuelType := "Ford", "Red", "diesel"
+		year, minWeight, maxWeight := 1990+rd.Intn(30), float64(rd.Intn(250)), float64(250+rd.Intn(250))
+		checks := map[string]struct {
+			get   func() (map[int]internal.Vehicle, error)
+			match func(v internal.Vehicle) bool
+		}{
+			"GetByColorAndYear": {
+				func() (map[int]internal.Vehicle, error) { return rp.GetByColorAndYear(color, year) },
+				func(v internal.Vehicle) bool { return v.Color == color && v.FabricationYear == year },
+			},
+			"GetByBrandAndYears": {
+				func() (map[int]internal.Vehicle, error) { return rp.GetByBrandAndYears(brand, year-5, year) },
+				func(v internal.Vehicle) bool {
+					return v.Brand == brand && v.FabricationYear >= year-5 && v.FabricationYear <= year
+				},
+			},
+			"GetByBrand": {
+				func() (map[int]internal.Vehicle, error) { return rp.GetByBrand(brand) },
+				func(v internal.Vehicle) bool { return v.Brand == brand },
+			},
+			"GetByFuelType": {
+				func() (map[int]internal.Vehicle, error) { return rp.GetByFuelType(fuelType) },
+				func(v internal.Vehicle) bool { return v.FuelType == fuelType },
+			},
+			"GetByDimensions": {
+				func() (map[int]internal.Vehicle, error) { return rp.GetByDimensions(100, 300, 50, 150) },
+				func(v internal.Vehicle) bool {
+					return v.Length >= 100 && v.Length <= 300 && v.Width >= 50 && v.Width <= 150
+				},
+			},
+			"GetByWeight": {
+				func() (map[int]internal.Vehicle, error) { return rp.GetByWeight(minWeight, maxWeight) },
+				func(v internal.Vehicle) bool { return v.Weight >= minWeight && v.Weight <= maxWeight },
+			},
+		}
+		for name, c := range checks {
+			got, _ := c.get()
+			expected := scanVehicles(all, c.match)
+			if len(got) != len(expected) {
+				t.Fatalf("round %d: %s: expected %d vehicles, got %d", round, name, len(expected), len(got))
+			}
+			for id, v := range expected {
+				if got[id] != v {
+					t.Fatalf("round %d: %s: expected %+v, got %+v", round, name, v, got[id])
+				}
+			}
+		}
+
+		q := internal.VehicleQuery{Filters: []internal.VehicleFilter{
+			{Field: internal.VehicleFieldColor, Operator: internal.FilterIn, Values: []any{"Red", "Blue"}},
+			{Field: internal.VehicleFieldWeight, Operator: internal.FilterGt, Values: []any{minWeight}},
+		}}
+		got, total, _ := rp.Query(q)
+		expected := scanVehicles(all, q.Match)
+		if total != len(expected) || len(got) != len(expected) {
+			t.Fatalf("round %d: Query: expected %d vehicles, got %d (total %d)", round, len(expected), len(got), total)
+		}
+
+		reg := all[1+rd.Intn(nextId)].Registration
+		if reg != "" && rp.checkExistence(internal.Vehicle{Id: -1, VehicleAttributes: internal.VehicleAttributes{Registration: reg}}) == nil {
+			t.Fatalf("round %d: registration %q not found in index", round, reg)
+		}
+	}
+}
+
+// benchmarkSize is the number of vehicles of the benchmarks
+const benchmarkSize = 1_000_000
+
+var (
+	// benchmarkOnce guards benchmarkDb
+	benchmarkOnce sync.Once
+	// benchmarkDb is the dataset of the benchmarks, shared because it is expensive to build
+	benchmarkDb map[int]internal.Vehicle
+	// benchmarkRepository is the repository over benchmarkDb
+	benchmarkRepository *VehicleMap
+)
+
+// benchmarkData is a function that returns the dataset of the benchmarks and a repository over it
+func benchmarkData(b *testing.B) (map[int]internal.Vehicle, *VehicleMap) {
+	b.Helper()
+	benchmarkOnce.Do(func() {
+		rd := rand.New(rand.NewSource(1))
+		benchmarkDb = make(map[int]internal.Vehicle, benchmarkSize)
+		for id := 1; id <= benchmarkSize; id++ {
+			benchmarkDb[id] = randomVehicle(rd, id)
+		}
+		// the repository gets its own copy, so the reference scans are not affected by the changes
+		db := make(map[int]internal.Vehicle, benchmarkSize)
+		for id, v := range benchmarkDb {
+			db[id] = v
+		}
+		benchmarkRepository = NewVehicleMap(db)
+	})
+	b.ResetTimer()
+	return benchmarkDb, benchmarkRepository
+}
+
+// BenchmarkVehicleMap_GetByWeight compares the weight range lookup with a scan on 1M vehicles
+func BenchmarkVehicleMap_GetByWeight(b *testing.B) {
+	db, rp := benchmarkData(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rp.GetByWeight(100, 100.5)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scanVehicles(db, func(v internal.Vehicle) bool { return v.Weight >= 100 && v.Weight <= 100.5 })
+		}
+	})
+}
+
+// BenchmarkVehicleMap_GetByColorAndYear compares the color and year lookup with a scan on 1M vehicles
+func BenchmarkVehicleMap_GetByColorAndYear(b *testing.B) {
+	db, rp := benchmarkData(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rp.GetByColorAndYear("Red", 2000)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scanVehicles(db, func(v internal.Vehicle) bool { return v.Color == "Red" && v.FabricationYear == 2000 })
+		}
+	})
+}
+
+// BenchmarkVehicleMap_GetByDimensions compares the dimensions lookup with a scan on 1M vehicles
+func BenchmarkVehicleMap_GetByDimensions(b *testing.B) {
+	db, rp := benchmarkData(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = rp.GetByDimensions(100, 101, 0, 300)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scanVehicles(db, func(v internal.Vehicle) bool {
+				return v.Length >= 100 && v.Length <= 101 && v.Width >= 0 && v.Width <= 300
+			})
+		}
+	})
+}
+
+// BenchmarkVehicleMap_Add compares the existence check of Add with a scan on 1M vehicles
+// Each added vehicle is deleted and purged from the trash, which keeps its id taken, so the repository keeps its
+// size and the id can be added again
+func BenchmarkVehicleMap_Add(b *testing.B) {
+	db, rp := benchmarkData(b)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			v := newTestVehicle(benchmarkSize + 1)
+			v.Registration = "BENCH"
+			if err := rp.Add(&v); err != nil {
+				b.Fatal(err)
+			}
+			if err := rp.DeleteVehicle(v.Id, 0, ""); err != nil {
+				b.Fatal(err)
+			}
+			if n, err := rp.Purge(time.Now().Add(time.Minute)); err != nil || n != 1 {
+				b.Fatalf("expected 1 vehicle purged, got %d, %v", n, err)
+			}
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scanVehicles(db, func(v internal.Vehicle) bool { return v.Id == benchmarkSize+1 || v.Registration == "BENCH" })
+		}
+	})
+}
@@ -0,0 +1,1204 @@
+package repository
+
+import (
+	"app/internal"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	// sqlite driver, pure Go (no cgo)
+	"modernc.org/sqlite"
+)
+
+func init() {
+	// normalize_registration(registration) is internal.NormalizeRegistration, available in every connection
+	sqlite.MustRegisterDeterministicScalarFunction(
+		"normalize_registration", 1,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			registration, _ := args[0].(string)
+			return internal.NormalizeRegistration(registration), nil
+		},
+	)
+}
+
+var (
+	// ErrNotEmpty is the error returned when vehicles are imported into a repository that already has vehicles
+	ErrNotEmpty = errors.New("the repository is not empty")
+)
+
+// migrations is the ordered list of schema migrations of the vehicles database
+// A migration is never changed once released: new changes are appended as new migrations
+var migrations = []string{
+	// 1: vehicles table
+	`CREATE TABLE vehicles (
+		id               INTEGER PRIMARY KEY,
+		brand            TEXT    NOT NULL,
+		model            TEXT    NOT NULL,
+		registration     TEXT    NOT NULL,
+		color            TEXT    NOT NULL,
+		fabrication_year INTEGER NOT NULL,
+		capacity         INTEGER NOT NULL,
+		max_speed        REAL    NOT NULL,
+		fuel_type        TEXT    NOT NULL,
+		transmission     TEXT    NOT NULL,
+		weight           REAL    NOT NULL,
+		height           REAL    NOT NULL,
+		length           REAL    NOT NULL,
+		width            REAL    NOT NULL
+	);
+	CREATE INDEX idx_vehicles_registration ON vehicles (registration);
+	CREATE INDEX idx_vehicles_brand_year ON vehicles (brand, fabrication_year);
+	CREATE INDEX idx_vehicles_color_year ON vehicles (color, fabrication_year);
+	CREATE INDEX idx_vehicles_fuel_type ON vehicles (fuel_type);
+	CREATE INDEX idx_vehicles_length_width ON vehicles (length, width);
+	CREATE INDEX idx_vehicles_weight ON vehicles (weight);`,
+	// 2: normalized registration, for lookups and uniqueness
+	`ALTER TABLE vehicles ADD COLUMN registration_key TEXT
+		GENERATED ALWAYS AS (normalize_registration(registration)) VIRTUAL;
+	CREATE INDEX idx_vehicles_registration_key ON vehicles (registration_key);`,
+	// 3: version of each vehicle, for optimistic concurrency
+	`ALTER TABLE vehicles ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+	// 4: trash of the deleted vehicles, apart so the queries of the vehicles do not see them
+	// deleted_at is in nanoseconds since the Unix epoch
+	`CREATE TABLE vehicles_trash (
+		id               INTEGER PRIMARY KEY,
+		brand            TEXT    NOT NULL,
+		model            TEXT    NOT NULL,
+		registration     TEXT    NOT NULL,
+		color            TEXT    NOT NULL,
+		fabrication_year INTEGER NOT NULL,
+		capacity         INTEGER NOT NULL,
+		max_speed        REAL    NOT NULL,
+		fuel_type        TEXT    NOT NULL,
+		transmission     TEXT    NOT NULL,
+		weight           REAL    NOT NULL,
+		height           REAL    NOT NULL,
+		length           REAL    NOT NULL,
+		width            REAL    NOT NULL,
+		version          INTEGER NOT NULL,
+		deleted_at       INTEGER NOT NULL,
+		delete_reason    TEXT    NOT NULL
+	);
+	CREATE INDEX idx_vehicles_trash_deleted_at ON vehicles_trash (deleted_at);`,
+}
+
+// vehicleColumns is the list of columns of a vehicle, in the order of vehicleValues and vehicleFields
+const vehicleColumns = `id, brand, model, registration, color, fabrication_year, capacity, max_speed,
+	fuel_type, transmission, weight, height, length, width, version`
+
+// vehiclePlaceholders is the list of placeholders of the values of vehicleColumns
+const vehiclePlaceholders = `?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?`
+
+// trashColumns is the list of columns of a vehicle in the trash, in the order of trashValues and trashFields
+const trashColumns = vehicleColumns + `, deleted_at, delete_reason`
+
+// trashPlaceholders is the list of placeholders of the values of trashColumns
+const trashPlaceholders = vehiclePlaceholders + `, ?, ?`
+
+// vehicleFieldColumns is the column of each field of a vehicle
+var vehicleFieldColumns = map[internal.VehicleField]string{
+	internal.VehicleFieldId:              "id",
+	internal.VehicleFieldBrand:           "brand",
+	internal.VehicleFieldModel:           "model",
+	internal.VehicleFieldRegistration:    "registration",
+	internal.VehicleFieldColor:           "color",
+	internal.VehicleFieldFabricationYear: "fabrication_year",
+	internal.VehicleFieldCapacity:        "capacity",
+	internal.VehicleFieldMaxSpeed:        "max_speed",
+	internal.VehicleFieldFuelType:        "fuel_type",
+	internal.VehicleFieldTransmission:    "transmission",
+	internal.VehicleFieldWeight:          "weight",
+	internal.VehicleFieldHeight:          "height",
+	internal.VehicleFieldLength:          "length",
+	internal.VehicleFieldWidth:           "width",
+}
+
+// filterOperators is the SQL operator of each filter operator
+var filterOperators = map[internal.FilterOperator]string{
+	internal.FilterEq:  "=",
+	internal.FilterNe:  "<>",
+	internal.FilterGt:  ">",
+	internal.FilterGte: ">=",
+	internal.FilterLt:  "<",
+	internal.FilterLte: "<=",
+	internal.FilterIn:  "IN",
+}
+
+// OpenSQLite is a function that opens the SQLite database at path, configured for concurrent use
+// Transactions take the write lock when they begin, so the checks of a write and the write itself are atomic
+func OpenSQLite(path string) (db *sql.DB, err error) {
+	// the path is escaped, so its ?, # and % are not read as the parameters of the URI
+	dsn := (&url.URL{
+		Scheme: "file",
+		Opaque: (&url.URL{Path: path}).EscapedPath(),
+		RawQuery: url.Values{
+			"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)", "synchronous(NORMAL)"},
+			"_txlock": {"immediate"},
+		}.Encode(),
+	}).String()
+	db, err = sql.Open("sqlite", dsn)
+	if err != nil {
+		return
+	}
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		db = nil
+	}
+	return
+}
+
+// NewVehicleSQLite is a function that returns a new instance of VehicleSQLite
+func NewVehicleSQLite(db *sql.DB) *VehicleSQLite {
+	return &VehicleSQLite{db: db}
+}
+
+// VehicleSQLite is a struct that represents a vehicle repository stored in a SQLite database
+type VehicleSQLite struct {
+	// db is the database
+	db *sql.DB
+}
+
+// Migrate is a method that applies the pending schema migrations
+func (r *VehicleSQLite) Migrate() (err error) {
+	_, err = r.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return
+	}
+
+	// current version
+	var version int
+	err = r.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return
+	}
+
+	// pending migrations, each one in its own transaction
+	for i := version; i < len(migrations); i++ {
+		if err = r.migrate(i+1, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+
+	return
+}
+
+// migrate is a method that applies a migration and records its version
+func (r *VehicleSQLite) migrate(version int, stmt string) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(stmt); err != nil {
+		return
+	}
+	if _, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// BeginImport is a method that starts an import of vehicles into the repository, in a single transaction, only if
+// it is empty. Otherwise it returns ErrNotEmpty
+func (r *VehicleSQLite) BeginImport() (im *VehicleSQLiteImport, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// only into an empty repository
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM vehicles UNION ALL SELECT 1 FROM vehicles_trash)`).Scan(&exists)
+	if err != nil {
+		return
+	}
+	if exists {
+		err = ErrNotEmpty
+		return
+	}
+
+	// the vehicles of the import with the same id replace the earlier ones, as in a map
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO vehicles (` + vehicleColumns + `) VALUES (` + vehiclePlaceholders + `)`)
+	if err != nil {
+		return
+	}
+	trashStmt, err := tx.Prepare(`INSERT OR REPLACE INTO vehicles_trash (` + trashColumns + `) VALUES (` + trashPlaceholders + `)`)
+	if err != nil {
+		_ = stmt.Close()
+		return
+	}
+	im = &VehicleSQLiteImport{tx: tx, stmt: stmt, trashStmt: trashStmt}
+	return
+}
+
+// VehicleSQLiteImport is a struct that represents an import of vehicles into a VehicleSQLite, by chunks, so the
+// vehicles are never all in memory. It must end with Commit or Rollback
+type VehicleSQLiteImport struct {
+	// tx is the transaction of the import
+	tx *sql.Tx
+	// stmt is the statement that inserts a vehicle
+	stmt *sql.Stmt
+	// trashStmt is the statement that inserts a vehicle in the trash
+	trashStmt *sql.Stmt
+}
+
+// Add is a method that inserts some vehicles, the ones with a Deletion in the trash. Vehicles without a version
+// start at version 1
+func (im *VehicleSQLiteImport) Add(v []internal.Vehicle) (err error) {
+	for _, vh := range v {
+		if vh.Version == 0 {
+			vh.Version = 1
+		}
+		if vh.Deleted() {
+			_, err = im.trashStmt.Exec(trashValues(vh)...)
+		} else {
+			_, err = im.stmt.Exec(vehicleValues(vh)...)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Commit is a method that ends the import keeping the vehicles, and returns the number of vehicles imported
+func (im *VehicleSQLiteImport) Commit() (n int, err error) {
+	im.close()
+	err = im.tx.QueryRow(`SELECT (SELECT COUNT(*) FROM vehicles) + (SELECT COUNT(*) FROM vehicles_trash)`).Scan(&n)
+	if err != nil {
+		_ = im.tx.Rollback()
+		return
+	}
+	err = im.tx.Commit()
+	return
+}
+
+// Rollback is a method that ends the import discarding the vehicles
+func (im *VehicleSQLiteImport) Rollback() error {
+	im.close()
+	return im.tx.Rollback()
+}
+
+// close is a method that closes the statements of the import
+func (im *VehicleSQLiteImport) close() {
+	_ = im.stmt.Close()
+	_ = im.trashStmt.Close()
+}
+
+// NormalizeTerms is a method that replaces the values of fuel type, transmission and color of the stored vehicles
+// with their canonical values, in a single transaction. The version of each changed vehicle is incremented
+// It returns the number of vehicles changed
+func (r *VehicleSQLite) NormalizeTerms(ix internal.VocabularyIndex) (n int, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// changes, read before any update so the cursor is not changed while it is read
+	rows, err := tx.Query(`SELECT id, fuel_type, transmission, color FROM vehicles`)
+	if err != nil {
+		return
+	}
+	var changed []internal.Vehicle
+	for rows.Next() {
+		var v internal.Vehicle
+		if err = rows.Scan(&v.Id, &v.FuelType, &v.Transmission, &v.Color); err != nil {
+			_ = rows.Close()
+			return
+		}
+		if ok, _ := ix.Normalize(&v); ok {
+			changed = append(changed, v)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	// update
+	stmt, err := tx.Prepare(`UPDATE vehicles SET fuel_type = ?, transmission = ?, color = ?, version = version + 1 WHERE id = ?`)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	for _, v := range changed {
+		if _, err = stmt.Exec(v.FuelType, v.Transmission, v.Color, v.Id); err != nil {
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	n = len(changed)
+	return
+}
+
+// Reload is a method that replaces the vehicles with v in a single transaction and returns the changes
+// The vehicles whose attributes are the same keep their version, and the vehicles deleted are moved to the trash
+// The changes are checked with check, if any, inside the transaction
+func (r *VehicleSQLite) Reload(v map[int]internal.Vehicle, check internal.ReloadCheck) (d internal.VehicleDiff, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			d = internal.VehicleDiff{}
+		}
+	}()
+
+	// changes, read before any write so the cursor is not changed while it is read
+	rows, err := tx.Query(`SELECT ` + vehicleColumns + ` FROM vehicles`)
+	if err != nil {
+		return
+	}
+	current := make(map[int]internal.Vehicle)
+	for rows.Next() {
+		var vh internal.Vehicle
+		if err = rows.Scan(vehicleFields(&vh)...); err != nil {
+			_ = rows.Close()
+			return
+		}
+		current[vh.Id] = vh
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	trash := make(map[int]internal.Vehicle)
+	if rows, err = tx.Query(`SELECT ` + trashColumns + ` FROM vehicles_trash`); err != nil {
+		return
+	}
+	for rows.Next() {
+		var vh internal.Vehicle
+		if vh, err = scanTrash(rows); err != nil {
+			_ = rows.Close()
+			return
+		}
+		trash[vh.Id] = vh
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	d = internal.DiffVehicles(current, v, trash)
+	if d.Empty() {
+		err = tx.Rollback()
+		return
+	}
+	if check != nil {
+		if err = check(current, &d); err != nil {
+			return
+		}
+	}
+
+	// write, moving the vehicles deleted to the trash
+	for _, vh := range d.Added {
+		if _, err = tx.Exec(`INSERT INTO vehicles (`+vehicleColumns+`) VALUES (`+vehiclePlaceholders+`)`, vehicleValues(vh)...); err != nil {
+			return
+		}
+	}
+	for _, vh := range d.Updated {
+		_, err = tx.Exec(
+			`UPDATE vehicles SET brand = ?, model = ?, registration = ?, color = ?, fabrication_year = ?,
+				capacity = ?, max_speed = ?, fuel_type = ?, transmission = ?, weight = ?, height = ?, length = ?,
+				width = ?, version = ?
+			WHERE id = ?`,
+			append(vehicleValues(vh)[1:], vh.Id)...,
+		)
+		if err != nil {
+			return
+		}
+	}
+	deletedAt := time.Now().UnixNano()
+	for _, id := range d.Deleted {
+		_, err = tx.Exec(
+			`INSERT INTO vehicles_trash (`+trashColumns+`) SELECT `+vehicleColumns+`, ?, ? FROM vehicles WHERE id = ?`,
+			deletedAt, internal.ReloadDeletionReason, id,
+		)
+		if err != nil {
+			return
+		}
+		if _, err = tx.Exec(`DELETE FROM vehicles WHERE id = ?`, id); err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// Close is a method that closes the database
+func (r *VehicleSQLite) Close() error {
+	return r.db.Close()
+}
+
+// FindAll is a method that returns a map of all vehicles
+func (r *VehicleSQLite) FindAll() (v map[int]internal.Vehicle, err error) {
+	v, err = r.query(`SELECT ` + vehicleColumns + ` FROM vehicles`)
+	return
+}
+
+// GetById is a method that returns the vehicle with an id
+func (r *VehicleSQLite) GetById(id int) (v internal.Vehicle, err error) {
+	v, err = r.queryOne(`SELECT `+vehicleColumns+` FROM vehicles WHERE id = ?`, id)
+	return
+}
+
+// GetByRegistration is a method that returns the vehicle with a registration, compared in its normalized form
+// If several vehicles match, the one with the lowest id
+func (r *VehicleSQLite) GetByRegistration(registration string) (v internal.Vehicle, err error) {
+	v, err = r.queryOne(
+		`SELECT `+vehicleColumns+` FROM vehicles WHERE registration_key = ? ORDER BY id LIMIT 1`,
+		internal.NormalizeRegistration(registration),
+	)
+	return
+}
+
+// Add is a method that adds a new vehicle to the repository
+func (r *VehicleSQLite) Add(v *internal.Vehicle) (err error) {
+	err = r.AddBatch([]*internal.Vehicle{v}, internal.BatchModeAtomic)
+
+	// the error of the vehicle itself
+	var batchErr *internal.VehicleBatchError
+	if errors.As(err, &batchErr) {
+		err = batchErr.Errors[0]
+	}
+	return
+}
+
+// GetByColorAndYear is a method that returns a map of vehicles with a specific color and year
+func (r *VehicleSQLite) GetByColorAndYear(color string, year int) (v map[int]internal.Vehicle, err error) {
+	v, err = r.queryFound(
+		`SELECT `+vehicleColumns+` FROM vehicles WHERE color = ? AND fabrication_year = ?`,
+		color, year,
+	)
+	return
+}
+
+// GetByBrandAndYears is a method that returns a map of vehicles with a specific brand
+// and between two years
+func (r *VehicleSQLite) GetByBrandAndYears(brand string, startYear, endYear int) (v map[int]internal.Vehicle, err error) {
+	v, err = r.queryFound(
+		`SELECT `+vehicleColumns+` FROM vehicles WHERE brand = ? AND fabrication_year BETWEEN ? AND ?`,
+		brand, startYear, endYear,
+	)
+	return
+}
+
+// GetByBrand is a method that returns the vehicles of a brand
+func (r *VehicleSQLite) GetByBrand(brand string) (v map[int]internal.Vehicle, err error) {
+	v, err = r.queryFound(`SELECT `+vehicleColumns+` FROM vehicles WHERE brand = ?`, brand)
+	return
+}
+
+// AddBatch is a method that adds a new vehicles to the repository
+// The vehicles are inserted one by one in a single transaction, so the checks see the vehicles inserted earlier
+// in the batch
+func (r *VehicleSQLite) AddBatch(vSlice []*internal.Vehicle, mode internal.BatchMode) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	batchErr := &internal.VehicleBatchError{Errors: make(map[int]error)}
+	added := make([]*internal.Vehicle, 0, len(vSlice))
+	for i, v := range vSlice {
+		err = insertVehicle(tx, *v)
+		switch {
+		case errors.Is(err, internal.ErrVehicleIdAlreadyExists), errors.Is(err, internal.ErrVehicleRegistrationAlreadyExists):
+			batchErr.Errors[i] = err
+			err = nil
+			continue
+		case err != nil:
+			return
+		}
+		added = append(added, v)
+	}
+	if len(batchErr.Errors) > 0 && mode != internal.BatchModeBestEffort {
+		err = batchErr
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	for _, v := range added {
+		v.Version = 1
+	}
+
+	if len(batchErr.Errors) > 0 {
+		return batchErr
+	}
+	return
+}
+
+// insertVehicle is a function that inserts a vehicle at version 1, if its id and its registration are not in use
+// The ids of the vehicles in the trash are in use, their registrations are not
+func insertVehicle(tx *sql.Tx, v internal.Vehicle) (err error) {
+	// existence
+	var exists bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM vehicles WHERE id = ? UNION ALL SELECT 1 FROM vehicles_trash WHERE id = ?)`,
+		v.Id, v.Id,
+	).Scan(&exists)
+	if err != nil {
+		return
+	}
+	if exists {
+		return internal.ErrVehicleIdAlreadyExists
+	}
+	err = tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM vehicles WHERE registration_key = ?)`,
+		internal.NormalizeRegistration(v.Registration),
+	).Scan(&exists)
+	if err != nil {
+		return
+	}
+	if exists {
+		return internal.ErrVehicleRegistrationAlreadyExists
+	}
+
+	// insert
+	v.Version = 1
+	_, err = tx.Exec(`INSERT INTO vehicles (`+vehicleColumns+`) VALUES (`+vehiclePlaceholders+`)`, vehicleValues(v)...)
+	return
+}
+
+// UpdateSpeed is a method that updates the speed of a vehicle
+func (r *VehicleSQLite) UpdateSpeed(speed float64, id int, version int) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = checkVersionTx(tx, id, version); err != nil {
+		return
+	}
+	if _, err = tx.Exec(`UPDATE vehicles SET max_speed = ?, version = version + 1 WHERE id = ?`, speed, id); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// Update is a method that replaces a vehicle
+// The registration is checked against the other vehicles only when it changes, so vehicles that already
+// share a registration can still be updated
+func (r *VehicleSQLite) Update(v *internal.Vehicle) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// existence and version
+	current, err := checkVersionTx(tx, v.Id, v.Version)
+	if err != nil {
+		return
+	}
+	var registration string
+	if err = tx.QueryRow(`SELECT registration_key FROM vehicles WHERE id = ?`, v.Id).Scan(&registration); err != nil {
+		return
+	}
+
+	// registration of other vehicles
+	if key := internal.NormalizeRegistration(v.Registration); key != registration {
+		var exists bool
+		err = tx.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM vehicles WHERE registration_key = ? AND id <> ?)`, key, v.Id,
+		).Scan(&exists)
+		if err != nil {
+			return
+		}
+		if exists {
+			err = internal.ErrVehicleRegistrationAlreadyExists
+			return
+		}
+	}
+
+	// update
+	updated := *v
+	updated.Version = current + 1
+	_, err = tx.Exec(
+		`UPDATE vehicles SET brand = ?, model = ?, registration = ?, color = ?, fabrication_year = ?,
+			capacity = ?, max_speed = ?, fuel_type = ?, transmission = ?, weight = ?, height = ?, length = ?, width = ?,
+			version = ?
+		WHERE id = ?`,
+		append(vehicleValues(updated)[1:], updated.Id)...,
+	)
+	if err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	v.Version = updated.Version
+	return
+}
+
+// GetByFuelType is a method that returns a map of vehicles with a type of fuel
+func (r *VehicleSQLite) GetByFuelType(fuelType string) (v map[int]internal.Vehicle, err error) {
+	v, err = r.queryFound(`SELECT `+vehicleColumns+` FROM vehicles WHERE fuel_type = ?`, fuelType)
+	return
+}
+
+// DeleteVehicle is a method that moves a vehicle to the trash
+func (r *VehicleSQLite) DeleteVehicle(id int, version int, reason string) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = checkVersionTx(tx, id, version); err != nil {
+		return
+	}
+	_, err = tx.Exec(
+		`INSERT INTO vehicles_trash (`+trashColumns+`) SELECT `+vehicleColumns+`, ?, ? FROM vehicles WHERE id = ?`,
+		time.Now().UnixNano(), reason, id,
+	)
+	if err != nil {
+		return
+	}
+	if _, err = tx.Exec(`DELETE FROM vehicles WHERE id = ?`, id); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// Trash is a method that returns the vehicles in the trash, sorted by id
+func (r *VehicleSQLite) Trash() (v []internal.Vehicle, err error) {
+	rows, err := r.db.Query(`SELECT ` + trashColumns + ` FROM vehicles_trash ORDER BY id`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	v = make([]internal.Vehicle, 0)
+	for rows.Next() {
+		var vh internal.Vehicle
+		if vh, err = scanTrash(rows); err != nil {
+			return
+		}
+		v = append(v, vh)
+	}
+	err = rows.Err()
+	return
+}
+
+// Restore is a method that moves a vehicle from the trash back to the vehicles, at its next version
+func (r *VehicleSQLite) Restore(id int) (v internal.Vehicle, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			v = internal.Vehicle{}
+		}
+	}()
+
+	// the vehicle, and its registration in the other vehicles
+	v, err = scanTrash(tx.QueryRow(`SELECT `+trashColumns+` FROM vehicles_trash WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = internal.ErrVehicleIdNotFound
+	}
+	if err != nil {
+		return
+	}
+	var exists bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM vehicles WHERE registration_key = ?)`,
+		internal.NormalizeRegistration(v.Registration),
+	).Scan(&exists)
+	if err != nil {
+		return
+	}
+	if exists {
+		err = internal.ErrVehicleRegistrationAlreadyExists
+		return
+	}
+
+	// move
+	v.Deletion = nil
+	v.Version++
+	if _, err = tx.Exec(`INSERT INTO vehicles (`+vehicleColumns+`) VALUES (`+vehiclePlaceholders+`)`, vehicleValues(v)...); err != nil {
+		return
+	}
+	if _, err = tx.Exec(`DELETE FROM vehicles_trash WHERE id = ?`, id); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// Purge is a method that removes for good the vehicles of the trash deleted before a time
+func (r *VehicleSQLite) Purge(before time.Time) (n int, err error) {
+	res, err := r.db.Exec(`DELETE FROM vehicles_trash WHERE deleted_at < ?`, before.UnixNano())
+	if err != nil {
+		return
+	}
+	purged, err := res.RowsAffected()
+	n = int(purged)
+	return
+}
+
+// GetByDimensions is a method that returns vehicles with a specific dimension
+func (r *VehicleSQLite) GetByDimensions(minLength, maxLength, minWidth, maxWidth float64) (v map[int]internal.Vehicle, err error) {
+	v, err = r.queryFound(
+		`SELECT `+vehicleColumns+` FROM vehicles WHERE length BETWEEN ? AND ? AND width BETWEEN ? AND ?`,
+		minLength, maxLength, minWidth, maxWidth,
+	)
+	return
+}
+
+// GetByWeight is a method that returns vehicles with a specific weight
+func (r *VehicleSQLite) GetByWeight(minWeight, maxWeight float64) (v map[int]internal.Vehicle, err error) {
+	v, err = r.queryFound(`SELECT `+vehicleColumns+` FROM vehicles WHERE weight BETWEEN ? AND ?`, minWeight, maxWeight)
+	return
+}
+
+// Query is a method that returns the page of vehicles that satisfy the filters of a query, sorted,
+// and the total number of vehicles that satisfy them
+func (r *VehicleSQLite) Query(q internal.VehicleQuery) (v []internal.Vehicle, total int, err error) {
+	where, args, err := whereClause(q.Filters)
+	if err != nil {
+		return
+	}
+
+	// order, ties by id
+	order := make([]string, 0, len(q.Sort)+1)
+	for _, s := range q.Sort {
+		column, ok := vehicleFieldColumns[s.Field]
+		if !ok {
+			err = fmt.Errorf("%w: unknown sort field %q", internal.ErrInvalidQuery, s.Field)
+			return
+		}
+		if s.Desc {
+			column += " DESC"
+		}
+		order = append(order, column)
+	}
+	order = append(order, "id")
+
+	// page, LIMIT -1 is no limit
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	// the total is counted in the same query with a window function
+	rows, err := r.db.Query(
+		`SELECT `+vehicleColumns+`, COUNT(*) OVER () FROM vehicles`+where+
+			` ORDER BY `+strings.Join(order, ", ")+` LIMIT ? OFFSET ?`,
+		append(args, limit, q.Offset)...,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	v = make([]internal.Vehicle, 0)
+	for rows.Next() {
+		var vh internal.Vehicle
+		if err = rows.Scan(append(vehicleFields(&vh), &total)...); err != nil {
+			return
+		}
+		v = append(v, vh)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	// a page past the end has no rows to read the total from
+	if len(v) == 0 && q.Offset > 0 {
+		err = r.db.QueryRow(`SELECT COUNT(*) FROM vehicles`+where, args...).Scan(&total)
+	}
+	return
+}
+
+// aggregateFunctions is the SQL function of each aggregate function that SQLite has
+var aggregateFunctions = map[internal.AggregateFunc]string{
+	internal.AggregateSum: "TOTAL",
+	internal.AggregateMin: "MIN",
+	internal.AggregateMax: "MAX",
+	internal.AggregateAvg: "AVG",
+}
+
+// Aggregate is a method that returns the metrics of the groups of the vehicles that satisfy the filters of
+// an aggregation, sorted by their keys
+// Everything is computed by a single statement: medians and percentiles rank the values of their field in each
+// group with a window function, and select the two values they are interpolated between
+func (r *VehicleSQLite) Aggregate(a internal.VehicleAggregation) (groups []internal.VehicleGroup, err error) {
+	if err = a.Validate(); err != nil {
+		return
+	}
+	where, args, err := whereClause(a.Filters)
+	if err != nil {
+		return
+	}
+
+	// groups
+	groupColumns := make([]string, 0, len(a.GroupBy))
+	for _, g := range a.GroupBy {
+		groupColumns = append(groupColumns, vehicleFieldColumns[g])
+	}
+	partition, groupBy := "", ""
+	if len(groupColumns) > 0 {
+		partition = "PARTITION BY " + strings.Join(groupColumns, ", ")
+		groupBy = " GROUP BY " + strings.Join(groupColumns, ", ") + " ORDER BY " + strings.Join(groupColumns, ", ")
+	}
+
+	// ranked rows: the filtered vehicles with the rank of the value of each field of a quantile in its group
+	ranked := append(append([]string{}, groupColumns...), "COUNT(*) OVER ("+partition+") AS n")
+	columns, ranks := make(map[internal.VehicleField]bool), make(map[internal.VehicleField]bool)
+	for _, m := range a.Metrics {
+		if m.Func == internal.AggregateCount {
+			continue
+		}
+		column := vehicleFieldColumns[m.Field]
+		if !columns[m.Field] {
+			ranked = append(ranked, column)
+			columns[m.Field] = true
+		}
+		if _, ok := m.Quantile(); ok && !ranks[m.Field] {
+			ranked = append(ranked, "ROW_NUMBER() OVER ("+partition+" ORDER BY "+column+") - 1 AS rank_"+column)
+			ranks[m.Field] = true
+		}
+	}
+
+	// metrics: quantiles select lo and hi (see internal.QuantileValue)
+	selected := append(append([]string{}, groupColumns...), "COUNT(*)")
+	for _, m := range a.Metrics {
+		column := vehicleFieldColumns[m.Field]
+		if q, ok := m.Quantile(); ok {
+			selected = append(selected,
+				"MAX(CASE WHEN rank_"+column+" = CAST(? * (n - 1) AS INTEGER) THEN "+column+" END)",
+				"MAX(CASE WHEN rank_"+column+" = CAST(? * (n - 1) AS INTEGER) + 1 THEN "+column+" END)",
+			)
+			args = append(args, q, q)
+			continue
+		}
+		if fn, ok := aggregateFunctions[m.Func]; ok {
+			selected = append(selected, fn+"("+column+")")
+		}
+	}
+
+	rows, err := r.db.Query(
+		`WITH ranked AS (SELECT `+strings.Join(ranked, ", ")+` FROM vehicles`+where+`) `+
+			`SELECT `+strings.Join(selected, ", ")+` FROM ranked`+groupBy,
+		args...,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	groups = make([]internal.VehicleGroup, 0)
+	for rows.Next() {
+		// scan
+		keys := make([]any, len(a.GroupBy))
+		dest := make([]any, 0, len(selected))
+		for i, g := range a.GroupBy {
+			if g.Kind() == internal.FieldKindString {
+				keys[i] = new(string)
+			} else {
+				keys[i] = new(int)
+			}
+			dest = append(dest, keys[i])
+		}
+		var count int
+		dest = append(dest, &count)
+		values := make([]sql.NullFloat64, len(selected)-len(keys)-1)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		// without groups the only row has no vehicles when none satisfies the filters
+		if count == 0 {
+			continue
+		}
+
+		// group
+		group := internal.VehicleGroup{Keys: make([]any, 0, len(keys)), Values: make([]float64, 0, len(a.Metrics))}
+		for _, key := range keys {
+			switch k := key.(type) {
+			case *string:
+				group.Keys = append(group.Keys, *k)
+			case *int:
+				group.Keys = append(group.Keys, *k)
+			}
+		}
+		for _, m := range a.Metrics {
+			switch q, ok := m.Quantile(); {
+			case m.Func == internal.AggregateCount:
+				group.Values = append(group.Values, float64(count))
+			case ok:
+				lo, hi := values[0], values[1]
+				if !hi.Valid {
+					hi = lo
+				}
+				group.Values = append(group.Values, internal.QuantileValue(q, count, lo.Float64, hi.Float64))
+				values = values[2:]
+			default:
+				group.Values = append(group.Values, values[0].Float64)
+				values = values[1:]
+			}
+		}
+		groups = append(groups, group)
+	}
+	err = rows.Err()
+	return
+}
+
+// Histogram is a method that returns the histograms of the groups of the vehicles that satisfy the filters of
+// a histogram, sorted by their keys
+// The values of the field and of the groups are read in a single query, without the rest of the columns
+func (r *VehicleSQLite) Histogram(h internal.VehicleHistogram) (groups []internal.HistogramGroup, err error) {
+	if err = h.Validate(); err != nil {
+		return
+	}
+	where, args, err := whereClause(h.Filters)
+	if err != nil {
+		return
+	}
+
+	fields := append(append([]internal.VehicleField{}, h.GroupBy...), h.Field)
+	columns := make([]string, 0, len(fields))
+	for _, f := range fields {
+		columns = append(columns, vehicleFieldColumns[f])
+	}
+	rows, err := r.db.Query(`SELECT `+strings.Join(columns, ", ")+` FROM vehicles`+where, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	hb := internal.NewHistogramBuilder(h)
+	dest := make([]any, len(fields))
+	for rows.Next() {
+		for i, f := range fields {
+			switch f.Kind() {
+			case internal.FieldKindString:
+				dest[i] = new(string)
+			case internal.FieldKindInt:
+				dest[i] = new(int)
+			default:
+				dest[i] = new(float64)
+			}
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		var v internal.Vehicle
+		for i, f := range fields {
+			switch d := dest[i].(type) {
+			case *string:
+				f.SetValue(&v, *d)
+			case *int:
+				f.SetValue(&v, *d)
+			case *float64:
+				f.SetValue(&v, *d)
+			}
+		}
+		hb.Add(v)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	groups, err = hb.Groups()
+	return
+}
+
+// Stream is a method that calls fn with every vehicle that satisfies the filters, sorted by id
+// The vehicles are read from the cursor of a single query, as fn consumes them
+func (r *VehicleSQLite) Stream(filters []internal.VehicleFilter, fn func(v internal.Vehicle) error) (err error) {
+	where, args, err := whereClause(filters)
+	if err != nil {
+		return
+	}
+	rows, err := r.db.Query(`SELECT `+vehicleColumns+` FROM vehicles`+where+` ORDER BY id`, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v internal.Vehicle
+		if err = rows.Scan(vehicleFields(&v)...); err != nil {
+			return
+		}
+		if err = fn(v); err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// whereClause is a function that returns the WHERE clause, and its arguments, of a list of filters
+func whereClause(filters []internal.VehicleFilter) (clause string, args []any, err error) {
+	if len(filters) == 0 {
+		return
+	}
+
+	conditions := make([]string, 0, len(filters))
+	for _, f := range filters {
+		column, ok := vehicleFieldColumns[f.Field]
+		if !ok {
+			err = fmt.Errorf("%w: unknown field %q", internal.ErrInvalidQuery, f.Field)
+			return
+		}
+		operator, ok := filterOperators[f.Operator]
+		if !ok || len(f.Values) == 0 {
+			err = fmt.Errorf("%w: unknown operator %q", internal.ErrInvalidQuery, f.Operator)
+			return
+		}
+
+		if f.Operator == internal.FilterIn {
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(f.Values)), ", ")
+			conditions = append(conditions, column+" IN ("+placeholders+")")
+			args = append(args, f.Values...)
+			continue
+		}
+		conditions = append(conditions, column+" "+operator+" ?")
+		args = append(args, f.Values[0])
+	}
+
+	clause = " WHERE " + strings.Join(conditions, " AND ")
+	return
+}
+
+// query is a method that returns the vehicles selected by a query
+func (r *VehicleSQLite) query(query string, args ...any) (v map[int]internal.Vehicle, err error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	v = make(map[int]internal.Vehicle)
+	for rows.Next() {
+		var vh internal.Vehicle
+		if err = rows.Scan(vehicleFields(&vh)...); err != nil {
+			return
+		}
+		v[vh.Id] = vh
+	}
+	err = rows.Err()
+	return
+}
+
+// queryFound is a method that returns the vehicles selected by a query, or ErrVehiclesNotFound if there are none
+func (r *VehicleSQLite) queryFound(query string, args ...any) (v map[int]internal.Vehicle, err error) {
+	v, err = r.query(query, args...)
+	if err == nil && len(v) == 0 {
+		err = internal.ErrVehiclesNotFound
+	}
+	return
+}
+
+// queryOne is a method that returns the vehicle selected by a query, or ErrVehicleIdNotFound if there is none
+func (r *VehicleSQLite) queryOne(query string, args ...any) (v internal.Vehicle, err error) {
+	err = r.db.QueryRow(query, args...).Scan(vehicleFields(&v)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = internal.ErrVehicleIdNotFound
+	}
+	return
+}
+
+// vehicleValues is a function that returns the values of a vehicle in the order of vehicleColumns
+func vehicleValues(v internal.Vehicle) []any {
+	return []any{
+		v.Id, v.Brand, v.Model, v.Registration, v.Color, v.FabricationYear, v.Capacity, v.MaxSpeed,
+		v.FuelType, v.Transmission, v.Weight, v.Height, v.Length, v.Width, v.Version,
+	}
+}
+
+// vehicleFields is a function that returns pointers to the fields of a vehicle in the order of vehicleColumns
+func vehicleFields(v *internal.Vehicle) []any {
+	return []any{
+		&v.Id, &v.Brand, &v.Model, &v.Registration, &v.Color, &v.FabricationYear, &v.Capacity, &v.MaxSpeed,
+		&v.FuelType, &v.Transmission, &v.Weight, &v.Height, &v.Length, &v.Width, &v.Version,
+	}
+}
+
+// trashValues is a function that returns the values of a vehicle in the trash in the order of trashColumns
+func trashValues(v internal.Vehicle) []any {
+	return append(vehicleValues(v), v.Deletion.At.UnixNano(), v.Deletion.Reason)
+}
+
+// scanTrash is a function that scans a vehicle in the trash selected with trashColumns
+func scanTrash(row interface{ Scan(dest ...any) error }) (v internal.Vehicle, err error) {
+	var deletedAt int64
+	var reason string
+	if err = row.Scan(append(vehicleFields(&v), &deletedAt, &reason)...); err != nil {
+		return
+	}
+	v.Deletion = &internal.VehicleDeletion{At: time.Unix(0, deletedAt).UTC(), Reason: reason}
+	return
+}
+
+// checkVersionTx is a function that returns the version of a vehicle, checking that it exists and that it is at
+// the expected version, if any (not 0)
+func checkVersionTx(tx *sql.Tx, id int, version int) (current int, err error) {
+	err = tx.QueryRow(`SELECT version FROM vehicles WHERE id = ?`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = internal.ErrVehicleIdNotFound
+	}
+	if err == nil && version != 0 && current != version {
+		err = internal.ErrVehicleVersionMismatch
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"app/internal"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenSQLite(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"vehicles 100%.db",
+		"vehicles#1.db",
+		"vehicles.db?_pragma=journal_mode(DELETE)",
+	} {
+		path := filepath.Join(dir, name)
+		db, err := OpenSQLite(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// the pragmas are the ones of OpenSQLite, and the file is created at the path as it is
+		var mode string
+		if err = db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+			t.Errorf("%s: expected journal mode wal, got %q, %v", name, mode, err)
+		}
+		rp := NewVehicleSQLite(db)
+		if err = rp.Migrate(); err != nil {
+			t.Fatalf("%s: migrate: %v", name, err)
+		}
+		if err = rp.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = os.Stat(path); err != nil {
+			t.Errorf("%s: expected the database at its path: %v", name, err)
+		}
+	}
+}
+
+func TestVehicleSQLite_Migrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.db")
+	db, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := NewVehicleSQLite(db)
+	if err = rp.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVehicle(1)
+	if err = rp.Add(&v); err != nil {
+		t.Fatal(err)
+	}
+	if err = rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the migrations already applied are not applied again, and the vehicles are kept
+	if db, err = OpenSQLite(path); err != nil {
+		t.Fatal(err)
+	}
+	rp = NewVehicleSQLite(db)
+	defer rp.Close()
+	if err = rp.Migrate(); err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+	var version, count int
+	if err = db.QueryRow(`SELECT MAX(version), COUNT(*) FROM schema_migrations`).Scan(&version, &count); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) || count != len(migrations) {
+		t.Errorf("expected %d migrations applied once, got version %d and %d rows", len(migrations), version, count)
+	}
+	if got, err := rp.GetById(1); err != nil || got.Registration != v.Registration {
+		t.Errorf("expected vehicle 1 kept, got %+v, %v", got, err)
+	}
+}
+
+func TestVehicleSQLite_Import(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "vehicles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := NewVehicleSQLite(db)
+	defer rp.Close()
+	if err = rp.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a rolled back import leaves the repository empty
+	im, err := rp.BeginImport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = im.Add([]internal.Vehicle{newTestVehicle(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err = im.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	// chunks, the later vehicles with the same id replacing the earlier ones
+	if im, err = rp.BeginImport(); err != nil {
+		t.Fatal(err)
+	}
+	dup := newTestVehicle(2)
+	dup.Color = "Blue"
+	for _, chunk := range [][]internal.Vehicle{{newTestVehicle(1), newTestVehicle(2)}, {dup}} {
+		if err = im.Add(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := im.Commit()
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 vehicles imported, got %d, %v", n, err)
+	}
+	if v, err := rp.GetById(2); err != nil || v.Color != "Blue" || v.Version != 1 {
+		t.Errorf("expected the last vehicle 2 at version 1, got %+v, %v", v, err)
+	}
+
+	// only into an empty repository
+	if _, err = rp.BeginImport(); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("expected ErrNotEmpty, got %v", err)
+	}
+}
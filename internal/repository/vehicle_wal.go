@@ -0,0 +1,393 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrWALCorrupted is the error returned when a record in the middle of the log is damaged
+	ErrWALCorrupted = errors.New("write-ahead log corrupted")
+)
+
+const (
+	// walHeaderSize is the size of the header of a record: payload length and payload checksum
+	walHeaderSize = 8
+	// walMaxRecordSize is the maximum size of the payload of a record
+	walMaxRecordSize = 1 << 30
+)
+
+// walTable is the CRC32 table used to checksum the records
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ConfigVehicleWAL is a struct that represents the configuration for VehicleWAL
+type ConfigVehicleWAL struct {
+	// SnapshotPath is the path of the snapshot, in the format read by loader.VehicleJSONFile
+	SnapshotPath string
+	// LogPath is the path of the write-ahead log (SnapshotPath + ".wal" by default)
+	LogPath string
+	// CompactInterval is the time between compactions (1 minute by default)
+	CompactInterval time.Duration
+	// CompactThreshold is the number of records that triggers a compaction before the interval (10000 by default)
+	CompactThreshold int
+}
+
+// NewVehicleWAL is a function that returns a new instance of VehicleWAL
+// db is the content of the last snapshot; the log is replayed on top of it. A torn record at the end of the
+// log (e.g. after a crash in the middle of a write) is truncated
+func NewVehicleWAL(db map[int]internal.Vehicle, cfg *ConfigVehicleWAL) (r *VehicleWAL, err error) {
+	// default config
+	defaultConfig := &ConfigVehicleWAL{
+		CompactInterval:  time.Minute,
+		CompactThreshold: 10000,
+	}
+	if cfg != nil {
+		defaultConfig.SnapshotPath = cfg.SnapshotPath
+		defaultConfig.LogPath = cfg.LogPath
+		if cfg.CompactInterval > 0 {
+			defaultConfig.CompactInterval = cfg.CompactInterval
+		}
+		if cfg.CompactThreshold > 0 {
+			defaultConfig.CompactThreshold = cfg.CompactThreshold
+		}
+	}
+	if defaultConfig.LogPath == "" {
+		defaultConfig.LogPath = defaultConfig.SnapshotPath + ".wal"
+	}
+
+	r = &VehicleWAL{
+		VehicleMap:       NewVehicleMap(db),
+		snapshotPath:     defaultConfig.SnapshotPath,
+		logPath:          defaultConfig.LogPath,
+		compactInterval:  defaultConfig.CompactInterval,
+		compactThreshold: defaultConfig.CompactThreshold,
+		compact:          make(chan struct{}, 1),
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+
+	// recovery
+	if err = r.open(); err != nil {
+		return nil, err
+	}
+
+	// journal every change of the map in the log
+	r.VehicleMap.journal = r.append
+
+	go r.run()
+	return
+}
+
+// VehicleWAL is a struct that represents a vehicle repository persisted in a snapshot and a write-ahead log
+// Every change is appended to the log, and synced, before it is applied in memory. The log is periodically
+// compacted into a new snapshot
+type VehicleWAL struct {
+	// VehicleMap is the in-memory repository that holds the current state
+	// Its lock also guards the log: records are appended while holding the write lock
+	*VehicleMap
+
+	// snapshotPath is the path of the snapshot
+	snapshotPath string
+	// logPath is the path of the write-ahead log
+	logPath string
+	// log is the write-ahead log, opened for appending
+	log *os.File
+	// size is the size of the log
+	size int64
+	// records is the number of records in the log
+	records int
+
+	// compactInterval is the time between compactions
+	compactInterval time.Duration
+	// compactThreshold is the number of records that triggers a compaction
+	compactThreshold int
+	// compactMu serializes the compactions
+	compactMu sync.Mutex
+
+	// compact signals the background worker that the log reached the threshold
+	compact chan struct{}
+	// stop signals the background worker to finish
+	stop chan struct{}
+	// done is closed when the background worker finished
+	done chan struct{}
+	// closeOnce guards stop
+	closeOnce sync.Once
+}
+
+// Compact is a method that writes the current state as a new snapshot and removes the records it includes from the log
+func (r *VehicleWAL) Compact() (err error) {
+	r.compactMu.Lock()
+	defer r.compactMu.Unlock()
+
+	// snapshot of the current state, with the trash, and the position of the log it includes
+	r.mu.RLock()
+	snapshot := make(map[int]internal.Vehicle, len(r.db)+len(r.trash))
+	for key, value := range r.db {
+		snapshot[key] = value
+	}
+	for key, value := range r.trash {
+		snapshot[key] = value
+	}
+	offset := r.size
+	r.mu.RUnlock()
+
+	// write snapshot
+	// a crash from here until the log is rewritten replays records already in the snapshot, which is harmless
+	// because replaying a record is idempotent
+	err = WriteFileAtomic(r.snapshotPath, func(w io.Writer) error {
+		return loader.WriteVehiclesJSON(w, snapshot)
+	})
+	if err != nil {
+		return
+	}
+
+	// rewrite the log keeping only the records appended after the snapshot
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tail := make([]byte, r.size-offset)
+	if _, err = r.log.ReadAt(tail, offset); err != nil {
+		return
+	}
+	err = WriteFileAtomic(r.logPath, func(w io.Writer) error {
+		_, err := w.Write(tail)
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	// reopen log
+	f, err := os.OpenFile(r.logPath, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+	_ = r.log.Close()
+	r.log = f
+	r.size = int64(len(tail))
+	r.records = countRecords(tail)
+
+	return
+}
+
+// Close is a method that stops the background compaction and closes the log
+func (r *VehicleWAL) Close() (err error) {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.log.Close()
+	return
+}
+
+// open is a method that opens the log and replays it on top of the snapshot
+func (r *VehicleWAL) open() (err error) {
+	f, err := os.OpenFile(r.logPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+
+	// replay
+	offset, records, err := r.replay(f)
+	if err != nil {
+		_ = f.Close()
+		return
+	}
+
+	// truncate the torn record, if any
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return
+	}
+	if info.Size() > offset {
+		fmt.Printf("repository: truncating torn record at offset %d of %s\n", offset, r.logPath)
+		if err = f.Truncate(offset); err != nil {
+			_ = f.Close()
+			return
+		}
+		if err = f.Sync(); err != nil {
+			_ = f.Close()
+			return
+		}
+	}
+
+	r.log = f
+	r.size = offset
+	r.records = records
+	return
+}
+
+// replay is a method that applies the records of the log to the map
+// It returns the offset where the valid records end and the number of valid records
+// A damaged record is accepted only at the end of the log: it is a write that was interrupted. A record whose
+// length is damaged has no known end, so it is the last one only when no valid record follows it
+func (r *VehicleWAL) replay(f *os.File) (offset int64, records int, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	size := info.Size()
+
+	rd := io.NewSectionReader(f, 0, size)
+	header := make([]byte, walHeaderSize)
+	for offset < size {
+		// header
+		if _, err = io.ReadFull(rd, header); err != nil {
+			// incomplete header: torn record
+			err = nil
+			return
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		checksum := binary.BigEndian.Uint32(header[4:8])
+		end := offset + walHeaderSize + length
+		if length > walMaxRecordSize || end > size {
+			// incomplete payload: torn record, unless the length is damaged and valid records follow
+			var found bool
+			if found, err = validRecordAfter(f, offset+walHeaderSize, size); err == nil && found {
+				err = fmt.Errorf("%w: record at offset %d", ErrWALCorrupted, offset)
+			}
+			return
+		}
+
+		// payload
+		payload := make([]byte, length)
+		if _, err = io.ReadFull(rd, payload); err != nil {
+			return
+		}
+		var c change
+		if crc32.Checksum(payload, walTable) != checksum || json.Unmarshal(payload, &c) != nil {
+			if end == size {
+				// damaged last record: torn record
+				return
+			}
+			err = fmt.Errorf("%w: record at offset %d", ErrWALCorrupted, offset)
+			return
+		}
+
+		// apply
+		r.apply(c)
+		offset = end
+		records++
+	}
+
+	return
+}
+
+// validRecordAfter is a function that returns if there is a valid record at any offset of the log from offset
+// to size
+func validRecordAfter(f *os.File, offset, size int64) (found bool, err error) {
+	tail := make([]byte, size-offset)
+	if _, err = f.ReadAt(tail, offset); err != nil {
+		return
+	}
+	for i := 0; i+walHeaderSize <= len(tail); i++ {
+		length := int(binary.BigEndian.Uint32(tail[i : i+4]))
+		if length == 0 || length > len(tail)-i-walHeaderSize {
+			continue
+		}
+		payload := tail[i+walHeaderSize : i+walHeaderSize+length]
+		var c change
+		if crc32.Checksum(payload, walTable) == binary.BigEndian.Uint32(tail[i+4:i+8]) && json.Unmarshal(payload, &c) == nil {
+			found = true
+			return
+		}
+	}
+	return
+}
+
+// append is a method that writes a change to the log and syncs it
+// It is the journal of the map, so it is called while holding the write lock
+func (r *VehicleWAL) append(c change) (err error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+
+	// record
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, walTable))
+	copy(record[walHeaderSize:], payload)
+
+	// write
+	n, err := r.log.Write(record)
+	if err != nil {
+		// remove the partial record so the next one is not appended after garbage
+		_ = r.log.Truncate(r.size)
+		return
+	}
+	if err = r.log.Sync(); err != nil {
+		_ = r.log.Truncate(r.size)
+		return
+	}
+	r.size += int64(n)
+	r.records++
+
+	// compaction
+	if r.records >= r.compactThreshold {
+		select {
+		case r.compact <- struct{}{}:
+		default:
+		}
+	}
+
+	return
+}
+
+// run is a method that compacts the log in the background
+func (r *VehicleWAL) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.compactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		case <-r.compact:
+		}
+
+		// nothing to compact
+		r.mu.RLock()
+		records := r.records
+		r.mu.RUnlock()
+		if records == 0 {
+			continue
+		}
+
+		if err := r.Compact(); err != nil {
+			fmt.Println("repository: failed to compact", r.logPath+":", err)
+		}
+	}
+}
+
+// countRecords is a function that returns the number of records in a valid log
+func countRecords(b []byte) (n int) {
+	rd := bytes.NewReader(b)
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err := io.ReadFull(rd, header); err != nil {
+			return
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if _, err := rd.Seek(length, io.SeekCurrent); err != nil {
+			return
+		}
+		n++
+	}
+}
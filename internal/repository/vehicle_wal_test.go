@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestWAL is a function that opens a VehicleWAL on the snapshot at path, without background compactions
+func openTestWAL(t *testing.T, path string) *VehicleWAL {
+	t.Helper()
+	var db map[int]internal.Vehicle
+	if _, err := os.Stat(path); err == nil {
+		db = readVehicleFile(t, path)
+	}
+	rp, err := NewVehicleWAL(db, &ConfigVehicleWAL{SnapshotPath: path, CompactInterval: time.Hour, CompactThreshold: 1 << 20})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return rp
+}
+
+// addTestVehicles is a function that adds the vehicles with the ids to the repository
+func addTestVehicles(t *testing.T, rp internal.VehicleRepository, ids ...int) {
+	t.Helper()
+	for _, id := range ids {
+		v := newTestVehicle(id)
+		if err := rp.Add(&v); err != nil {
+			t.Fatalf("add %d: %v", id, err)
+		}
+	}
+}
+
+func TestVehicleWAL_TornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.json")
+	rp := openTestWAL(t, path)
+	addTestVehicles(t, rp, 1, 2)
+	valid := rp.size
+	addTestVehicles(t, rp, 3)
+	if err := rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last record is cut off in the middle, as in a crash during the write
+	if err := os.Truncate(path+".wal", valid+walHeaderSize+5); err != nil {
+		t.Fatal(err)
+	}
+	rp = openTestWAL(t, path)
+	v, err := rp.FindAll()
+	if err != nil || len(v) != 2 || v[1].Id != 1 || v[2].Id != 2 {
+		t.Fatalf("expected vehicles 1 and 2, got %+v, %v", v, err)
+	}
+	if info, err := os.Stat(path + ".wal"); err != nil || info.Size() != valid || rp.size != valid || rp.records != 2 {
+		t.Fatalf("expected the log truncated to %d bytes and 2 records, got %v, %d, %d", valid, info.Size(), rp.size, rp.records)
+	}
+
+	// the next records are appended after the valid ones
+	addTestVehicles(t, rp, 3)
+	if err := rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rp = openTestWAL(t, path)
+	defer rp.Close()
+	if v, err := rp.FindAll(); err != nil || len(v) != 3 {
+		t.Fatalf("expected 3 vehicles, got %d, %v", len(v), err)
+	}
+}
+
+func TestVehicleWAL_DamagedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.json")
+	rp := openTestWAL(t, path)
+	addTestVehicles(t, rp, 1, 2)
+	if err := rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a damaged record followed by a valid one is not a torn write
+	f, err := os.OpenFile(path+".wal", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("X"), walHeaderSize+2); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if _, err = NewVehicleWAL(nil, &ConfigVehicleWAL{SnapshotPath: path}); !errors.Is(err, ErrWALCorrupted) {
+		t.Fatalf("expected ErrWALCorrupted, got %v", err)
+	}
+}
+
+func TestVehicleWAL_DamagedLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.json")
+	rp := openTestWAL(t, path)
+	addTestVehicles(t, rp, 1)
+	second := rp.size
+	addTestVehicles(t, rp, 2)
+	third := rp.size
+	addTestVehicles(t, rp, 3)
+	if err := rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	damage := func(offset int64, length []byte) {
+		t.Helper()
+		f, err := os.OpenFile(path+".wal", os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err = f.WriteAt(length, offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the length of the last record past the end of the log is a torn write
+	damage(third, []byte{0, 0, 0xff, 0xff})
+	rp = openTestWAL(t, path)
+	if v, err := rp.FindAll(); err != nil || len(v) != 2 || rp.size != third {
+		t.Fatalf("expected vehicles 1 and 2 and the log truncated to %d bytes, got %+v, %d, %v", third, v, rp.size, err)
+	}
+	addTestVehicles(t, rp, 3)
+	if err := rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same length on a record followed by valid ones is a damaged log, which is kept as it is
+	for _, length := range [][]byte{{0, 0, 0xff, 0xff}, {0xff, 0xff, 0xff, 0xff}} {
+		damage(second, length)
+		if _, err := NewVehicleWAL(nil, &ConfigVehicleWAL{SnapshotPath: path}); !errors.Is(err, ErrWALCorrupted) {
+			t.Fatalf("expected ErrWALCorrupted, got %v", err)
+		}
+		if info, err := os.Stat(path + ".wal"); err != nil || info.Size() <= third {
+			t.Fatalf("expected the log kept, got %v, %v", info, err)
+		}
+	}
+}
+
+func TestVehicleWAL_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.json")
+	rp := openTestWAL(t, path)
+	addTestVehicles(t, rp, 1, 2, 3)
+	if err := rp.UpdateSpeed(120, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.DeleteVehicle(2, 1, "sold"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash after the snapshot is written and before the log is rewritten: the records already in the
+	// snapshot are replayed on top of it
+	rp.mu.RLock()
+	snapshot := rp.snapshot()
+	rp.mu.RUnlock()
+	err := WriteFileAtomic(path, func(w io.Writer) error { return loader.WriteVehiclesJSON(w, snapshot) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rp = openTestWAL(t, path)
+	expectCompacted := func() {
+		t.Helper()
+		v, err := rp.FindAll()
+		if err != nil || len(v) != 2 || v[1].MaxSpeed != 120 || v[1].Version != 2 || v[3].Version != 1 {
+			t.Fatalf("expected vehicle 1 at version 2 and vehicle 3, got %+v, %v", v, err)
+		}
+		trash, err := rp.Trash()
+		if err != nil || len(trash) != 1 || trash[0].Id != 2 || trash[0].Deletion.Reason != "sold" {
+			t.Fatalf("expected vehicle 2 in the trash, got %+v, %v", trash, err)
+		}
+	}
+	expectCompacted()
+
+	// a compaction keeps only the records after the snapshot
+	if err = rp.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if rp.size != 0 || rp.records != 0 {
+		t.Fatalf("expected an empty log, got %d bytes and %d records", rp.size, rp.records)
+	}
+	addTestVehicles(t, rp, 4)
+	if err = rp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rp = openTestWAL(t, path)
+	defer rp.Close()
+	if rp.records != 1 {
+		t.Fatalf("expected 1 record in the log, got %d", rp.records)
+	}
+	if v, err := rp.FindAll(); err != nil || len(v) != 3 || v[1].Version != 2 || v[4].Version != 1 {
+		t.Fatalf("expected vehicles 1, 3 and 4 replayed on the snapshot, got %+v, %v", v, err)
+	}
+}
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// NewVocabularyMap is a function that returns a new instance of VocabularyMap with some vocabularies
+// Fields without a vocabulary get an empty one. When path is not empty every change is written to that file
+func NewVocabularyMap(v []internal.Vocabulary, path string) (r *VocabularyMap, err error) {
+	terms := make(map[internal.VehicleField][]internal.Term, len(internal.VocabularyFields))
+	for _, vocabulary := range v {
+		if !internal.IsVocabularyField(vocabulary.Field) {
+			err = fmt.Errorf("%w: %q", internal.ErrVocabularyNotFound, vocabulary.Field)
+			return
+		}
+		if _, ok := terms[vocabulary.Field]; ok {
+			err = fmt.Errorf("the vocabulary of %s is repeated", vocabulary.Field)
+			return
+		}
+		if err = checkTerms(vocabulary.Terms); err != nil {
+			err = fmt.Errorf("%s: %w", vocabulary.Field, err)
+			return
+		}
+		terms[vocabulary.Field] = copyTerms(vocabulary.Terms)
+	}
+	for _, f := range internal.VocabularyFields {
+		if _, ok := terms[f]; !ok {
+			terms[f] = []internal.Term{}
+		}
+	}
+
+	r = &VocabularyMap{terms: terms, path: path}
+	r.ix = internal.NewVocabularyIndex(r.vocabularies())
+	return
+}
+
+// VocabularyMap is a struct that represents a vocabulary repository in memory, optionally persisted in a JSON file
+type VocabularyMap struct {
+	// mu guards terms and ix
+	mu sync.RWMutex
+	// terms are the terms of each vocabulary, in the order they were added
+	terms map[internal.VehicleField][]internal.Term
+	// ix are the canonical values of the terms. It is replaced, never modified, on every change
+	ix internal.VocabularyIndex
+	// path is the path to the file where the vocabularies are persisted, or empty
+	path string
+}
+
+// FindAll is a method that returns the vocabularies of all the vocabulary fields
+func (r *VocabularyMap) FindAll() (v []internal.Vocabulary, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v = r.vocabularies()
+	return
+}
+
+// Get is a method that returns the vocabulary of a field
+func (r *VocabularyMap) Get(f internal.VehicleField) (v internal.Vocabulary, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	terms, ok := r.terms[f]
+	if !ok {
+		err = internal.ErrVocabularyNotFound
+		return
+	}
+	v = internal.Vocabulary{Field: f, Terms: copyTerms(terms)}
+	return
+}
+
+// Index is a method that returns the canonical values of all the vocabularies, as they are now
+// The index is shared and must not be modified
+func (r *VocabularyMap) Index() (ix internal.VocabularyIndex, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ix = r.ix
+	return
+}
+
+// AddTerm is a method that adds a term to the vocabulary of a field
+func (r *VocabularyMap) AddTerm(f internal.VehicleField, t internal.Term) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	terms, ok := r.terms[f]
+	if !ok {
+		return internal.ErrVocabularyNotFound
+	}
+	updated := append(copyTerms(terms), t)
+	if err = checkTerms(updated); err != nil {
+		return
+	}
+
+	err = r.commit(f, updated)
+	return
+}
+
+// UpdateTerm is a method that replaces the term with a value in the vocabulary of a field
+func (r *VocabularyMap) UpdateTerm(f internal.VehicleField, value string, t internal.Term) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	terms, ok := r.terms[f]
+	if !ok {
+		return internal.ErrVocabularyNotFound
+	}
+	i := termIndex(terms, value)
+	if i < 0 {
+		return internal.ErrTermNotFound
+	}
+	updated := copyTerms(terms)
+	updated[i] = t
+	if err = checkTerms(updated); err != nil {
+		return
+	}
+
+	err = r.commit(f, updated)
+	return
+}
+
+// DeleteTerm is a method that deletes the term with a value from the vocabulary of a field
+func (r *VocabularyMap) DeleteTerm(f internal.VehicleField, value string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	terms, ok := r.terms[f]
+	if !ok {
+		return internal.ErrVocabularyNotFound
+	}
+	i := termIndex(terms, value)
+	if i < 0 {
+		return internal.ErrTermNotFound
+	}
+	updated := append(copyTerms(terms[:i]), terms[i+1:]...)
+
+	err = r.commit(f, updated)
+	return
+}
+
+// commit is a method that replaces the terms of a vocabulary, writing them to the file first (if any)
+// so a failed write leaves the vocabularies unchanged. It must be called with mu locked
+func (r *VocabularyMap) commit(f internal.VehicleField, terms []internal.Term) (err error) {
+	previous := r.terms[f]
+	r.terms[f] = terms
+	v := r.vocabularies()
+
+	if r.path != "" {
+		err = WriteFileAtomic(r.path, func(w io.Writer) error {
+			return loader.WriteVocabulariesJSON(w, v)
+		})
+		if err != nil {
+			r.terms[f] = previous
+			return
+		}
+	}
+
+	r.ix = internal.NewVocabularyIndex(v)
+	return
+}
+
+// vocabularies is a method that returns a copy of the vocabularies, in the order of internal.VocabularyFields
+// It must be called with mu locked
+func (r *VocabularyMap) vocabularies() (v []internal.Vocabulary) {
+	v = make([]internal.Vocabulary, 0, len(internal.VocabularyFields))
+	for _, f := range internal.VocabularyFields {
+		v = append(v, internal.Vocabulary{Field: f, Terms: copyTerms(r.terms[f])})
+	}
+	return
+}
+
+// checkTerms is a function that checks that the terms of a vocabulary have a value and that no value or alias
+// matches another term
+func checkTerms(terms []internal.Term) error {
+	owners := make(map[string]int)
+	for i, t := range terms {
+		if internal.TermKey(t.Value) == "" {
+			return fmt.Errorf("%w: value", internal.ErrFieldRequired)
+		}
+		for _, key := range t.Keys() {
+			if key == "" {
+				return fmt.Errorf("%w: aliases of %q", internal.ErrInvalidFieldValue, t.Value)
+			}
+			if owner, ok := owners[key]; ok && owner != i {
+				return fmt.Errorf("%w: %q is used by %q", internal.ErrTermAlreadyExists, key, terms[owner].Value)
+			}
+			owners[key] = i
+		}
+	}
+	return nil
+}
+
+// termIndex is a function that returns the position of the term with a value, compared by its key, or -1
+func termIndex(terms []internal.Term, value string) int {
+	key := internal.TermKey(value)
+	for i, t := range terms {
+		if internal.TermKey(t.Value) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// copyTerms is a function that returns a deep copy of terms
+func copyTerms(terms []internal.Term) []internal.Term {
+	c := make([]internal.Term, 0, len(terms))
+	for _, t := range terms {
+		c = append(c, internal.Term{Value: t.Value, Aliases: append([]string(nil), t.Aliases...)})
+	}
+	return c
+}
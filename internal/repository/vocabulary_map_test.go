@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVocabularyMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vocabularies.json")
+	rp, err := NewVocabularyMap([]internal.Vocabulary{
+		{Field: internal.VehicleFieldFuelType, Terms: []internal.Term{{Value: "diesel", Aliases: []string{"gasoil"}}}},
+	}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// values and aliases are unique in a vocabulary, ignoring case and spaces
+	for _, term := range []internal.Term{{Value: "Diesel"}, {Value: "other", Aliases: []string{" GASOIL"}}} {
+		if err := rp.AddTerm(internal.VehicleFieldFuelType, term); !errors.Is(err, internal.ErrTermAlreadyExists) {
+			t.Fatalf("add %v: expected ErrTermAlreadyExists, got %v", term, err)
+		}
+	}
+	if err := rp.AddTerm("brand", internal.Term{Value: "Ford"}); !errors.Is(err, internal.ErrVocabularyNotFound) {
+		t.Fatalf("expected ErrVocabularyNotFound, got %v", err)
+	}
+
+	// changes
+	if err := rp.AddTerm(internal.VehicleFieldFuelType, internal.Term{Value: "gasoline", Aliases: []string{"petrol"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.UpdateTerm(internal.VehicleFieldFuelType, "DIESEL", internal.Term{Value: "diesel"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.DeleteTerm(internal.VehicleFieldFuelType, "petrol"); !errors.Is(err, internal.ErrTermNotFound) {
+		t.Fatalf("an alias is not a term: expected ErrTermNotFound, got %v", err)
+	}
+
+	ix, err := rp.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if canonical, known := ix.Canonical(internal.VehicleFieldFuelType, "Petrol"); !known || canonical != "gasoline" {
+		t.Fatalf("expected gasoline, got %q (known %v)", canonical, known)
+	}
+	if _, known := ix.Canonical(internal.VehicleFieldFuelType, "gasoil"); known {
+		t.Fatal("expected the removed alias to be unknown")
+	}
+	if canonical, known := ix.Canonical(internal.VehicleFieldColor, "any"); !known || canonical != "any" {
+		t.Fatal("expected an empty vocabulary to accept any value")
+	}
+
+	// the file has the same vocabularies
+	expected, err := rp.FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := loader.NewVocabularyJSONFile(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v in the file, got %v", expected, got)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// NewCatalogDefault is a function that returns a new instance of CatalogDefault
+// rpVehicle is the repository of the vehicles that reference the catalog
+func NewCatalogDefault(rp internal.CatalogRepository, rpVehicle internal.VehicleRepository) *CatalogDefault {
+	return &CatalogDefault{rp: rp, rpVehicle: rpVehicle}
+}
+
+// CatalogDefault is a struct that represents the default service for the catalog of brands and models
+type CatalogDefault struct {
+	// rp is the repository that will be used by the service
+	rp internal.CatalogRepository
+	// rpVehicle is the repository of the vehicles, to check the references to the catalog
+	rpVehicle internal.VehicleRepository
+	// mu is shared by the changes of vehicles (see Reference) and exclusive for the deletions and renames of
+	// the catalog, so a brand or a model is never deleted while a vehicle that references it is written
+	mu sync.RWMutex
+}
+
+// FindAll is a method that returns all the brands with their models
+func (s *CatalogDefault) FindAll() (b []internal.Brand, err error) {
+	b, err = s.rp.FindAll()
+	return
+}
+
+// GetBrand is a method that returns a brand with its models
+func (s *CatalogDefault) GetBrand(name string) (b internal.Brand, err error) {
+	b, err = s.rp.GetBrand(name)
+	return
+}
+
+// AddBrand is a method that adds a brand with its models
+func (s *CatalogDefault) AddBrand(b internal.Brand) (err error) {
+	c := internal.Brand{Name: cleanName(b.Name), Models: make([]internal.Model, 0, len(b.Models))}
+	for _, m := range b.Models {
+		m.Name = cleanName(m.Name)
+		c.Models = append(c.Models, m)
+	}
+	err = s.rp.AddBrand(c)
+	return
+}
+
+// DeleteBrand is a method that deletes a brand with its models, or ErrCatalogEntryInUse if vehicles reference it
+func (s *CatalogDefault) DeleteBrand(name string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.rp.GetBrand(name)
+	if err != nil {
+		return
+	}
+	if err = s.checkReferences(b.Name, ""); err != nil {
+		return
+	}
+	err = s.rp.DeleteBrand(b.Name)
+	return
+}
+
+// AddModel is a method that adds a model to a brand
+func (s *CatalogDefault) AddModel(brand string, m internal.Model) (err error) {
+	m.Name = cleanName(m.Name)
+	err = s.rp.AddModel(brand, m)
+	return
+}
+
+// UpdateModel is a method that replaces a model of a brand. It can not be renamed while vehicles reference it
+func (s *CatalogDefault) UpdateModel(brand, name string, m internal.Model) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.Name = cleanName(m.Name)
+	if internal.CatalogKey(m.Name) != internal.CatalogKey(name) {
+		b, err := s.rp.GetBrand(brand)
+		if err != nil {
+			return err
+		}
+		if err = s.checkReferences(b.Name, name); err != nil {
+			return err
+		}
+	}
+	err = s.rp.UpdateModel(brand, name, m)
+	return
+}
+
+// DeleteModel is a method that deletes a model of a brand, or ErrCatalogEntryInUse if vehicles reference it
+func (s *CatalogDefault) DeleteModel(brand, name string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.rp.GetBrand(brand)
+	if err != nil {
+		return
+	}
+	if err = s.checkReferences(b.Name, name); err != nil {
+		return
+	}
+	err = s.rp.DeleteModel(brand, name)
+	return
+}
+
+// Resolve is a method that checks the brand and the model of a vehicle against the catalog, replaces them with
+// the names of the catalog and fills the missing attributes with the specs of the model
+// Missing brands and models are not checked, they are reported by the validation rules
+func (s *CatalogDefault) Resolve(v *internal.Vehicle) (err error) {
+	if v.Brand == "" {
+		return
+	}
+
+	e := &internal.ValidationError{}
+	b, err := s.rp.GetBrand(v.Brand)
+	switch {
+	case errors.Is(err, internal.ErrBrandNotFound):
+		e.Add(string(internal.VehicleFieldBrand), internal.RuleCatalog, "is not in the catalog")
+		return e
+	case err != nil:
+		return
+	}
+	v.Brand = b.Name
+
+	if v.Model == "" {
+		return
+	}
+	m, ok := b.Model(v.Model)
+	if !ok {
+		e.Add(string(internal.VehicleFieldModel), internal.RuleCatalog, "is not a model of "+b.Name+" in the catalog")
+		return e
+	}
+	v.Model = m.Name
+	m.Specs.Fill(v)
+	return
+}
+
+// Reference is a method that runs fn, which adds or changes vehicles that reference the catalog, while no brand
+// or model can be deleted or renamed
+func (s *CatalogDefault) Reference(fn func() error) (err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	err = fn()
+	return
+}
+
+// checkReferences is a method that returns ErrCatalogEntryInUse if vehicles reference a brand, or a model of it
+// when model is not empty. The names are compared by their keys, as the vehicles stored before the catalog
+// existed may not have the names of the catalog
+func (s *CatalogDefault) checkReferences(brand, model string) error {
+	v, err := s.rpVehicle.FindAll()
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, vh := range v {
+		if internal.CatalogKey(vh.Brand) != internal.CatalogKey(brand) {
+			continue
+		}
+		if model == "" || internal.CatalogKey(vh.Model) == internal.CatalogKey(model) {
+			n++
+		}
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: %d vehicles", internal.ErrCatalogEntryInUse, n)
+	}
+	return nil
+}
+
+// cleanName is a function that removes leading, trailing and repeated spaces from a name of the catalog
+func cleanName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
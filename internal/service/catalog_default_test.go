@@ -0,0 +1,82 @@
+package service
+
+import (
+	"app/internal"
+	"app/internal/repository"
+	"errors"
+	"testing"
+)
+
+func TestCatalogDefault(t *testing.T) {
+	ct, err := repository.NewCatalogMap([]internal.Brand{
+		{Name: "Ford", Models: []internal.Model{
+			{Name: "Focus", Specs: internal.ModelSpecs{Capacity: 5, FuelType: "gasoline"}},
+			{Name: "Fiesta"},
+		}},
+		{Name: "Toyota", Models: []internal.Model{{Name: "Corolla"}}},
+		{Name: "Kia"},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := repository.NewVehicleMap(map[int]internal.Vehicle{
+		1: {Id: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Ford", Model: "Focus"}},
+		// stored before the catalog existed, with other names than the ones of the catalog
+		2: {Id: 2, VehicleAttributes: internal.VehicleAttributes{Brand: "TOYOTA ", Model: "corolla"}},
+	})
+	sv := NewCatalogDefault(ct, rp)
+
+	t.Run("resolve fills the missing attributes", func(t *testing.T) {
+		v := internal.Vehicle{VehicleAttributes: internal.VehicleAttributes{Brand: "ford", Model: "FOCUS", Capacity: 4}}
+		if err := sv.Resolve(&v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Brand != "Ford" || v.Model != "Focus" || v.Capacity != 4 || v.FuelType != "gasoline" {
+			t.Fatalf("unexpected vehicle %+v", v.VehicleAttributes)
+		}
+	})
+
+	t.Run("resolve reports brands and models out of the catalog", func(t *testing.T) {
+		for field, v := range map[internal.VehicleField]internal.Vehicle{
+			internal.VehicleFieldBrand: {VehicleAttributes: internal.VehicleAttributes{Brand: "Fiat", Model: "Punto"}},
+			internal.VehicleFieldModel: {VehicleAttributes: internal.VehicleAttributes{Brand: "Ford", Model: "Punto"}},
+		} {
+			var validationErr *internal.ValidationError
+			if err := sv.Resolve(&v); !errors.As(err, &validationErr) {
+				t.Fatalf("%s: expected a ValidationError, got %v", field, err)
+			}
+			if vl := validationErr.Violations; len(vl) != 1 || vl[0].Field != string(field) || vl[0].Rule != internal.RuleCatalog {
+				t.Fatalf("%s: unexpected violations %v", field, vl)
+			}
+		}
+	})
+
+	t.Run("referenced entries are not deleted or renamed", func(t *testing.T) {
+		if err := sv.DeleteBrand("ford"); !errors.Is(err, internal.ErrCatalogEntryInUse) {
+			t.Fatalf("delete brand: expected ErrCatalogEntryInUse, got %v", err)
+		}
+		if err := sv.DeleteModel("Ford", "focus"); !errors.Is(err, internal.ErrCatalogEntryInUse) {
+			t.Fatalf("delete model: expected ErrCatalogEntryInUse, got %v", err)
+		}
+		if err := sv.UpdateModel("Ford", "Focus", internal.Model{Name: "Focus 2"}); !errors.Is(err, internal.ErrCatalogEntryInUse) {
+			t.Fatalf("rename model: expected ErrCatalogEntryInUse, got %v", err)
+		}
+		if err := sv.DeleteBrand("Toyota"); !errors.Is(err, internal.ErrCatalogEntryInUse) {
+			t.Fatalf("delete brand of other names: expected ErrCatalogEntryInUse, got %v", err)
+		}
+		if err := sv.DeleteModel("Toyota", "Corolla"); !errors.Is(err, internal.ErrCatalogEntryInUse) {
+			t.Fatalf("delete model of other names: expected ErrCatalogEntryInUse, got %v", err)
+		}
+
+		// the specs of a referenced model can change, and entries without vehicles can be deleted
+		if err := sv.UpdateModel("Ford", "Focus", internal.Model{Name: "focus"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := sv.DeleteModel("Ford", "Fiesta"); err != nil {
+			t.Fatal(err)
+		}
+		if err := sv.DeleteBrand("Kia"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
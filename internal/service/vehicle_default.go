@@ -4,18 +4,25 @@ import (
 	"app/internal"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 )
 
 // NewVehicleDefault is a function that returns a new instance of VehicleDefault
-func NewVehicleDefault(rp internal.VehicleRepository) *VehicleDefault {
-	return &VehicleDefault{rp: rp}
+func NewVehicleDefault(rp internal.VehicleRepository, vl internal.VehicleValidator, vc internal.VocabularyRepository, ct internal.CatalogService) *VehicleDefault {
+	return &VehicleDefault{rp: rp, vl: vl, vc: vc, ct: ct}
 }
 
 // VehicleDefault is a struct that represents the default service for vehicles
 type VehicleDefault struct {
 	// rp is the repository that will be used by the service
 	rp internal.VehicleRepository
+	// vl is the validator of the vehicles that are added or changed
+	vl internal.VehicleValidator
+	// vc are the vocabularies of the values of fuel type, transmission and color
+	vc internal.VocabularyRepository
+	// ct is the catalog the brand and the model of the vehicles are checked against
+	ct internal.CatalogService
 }
 
 // FindAll is a method that returns a map of all vehicles
@@ -24,111 +31,111 @@ func (s *VehicleDefault) FindAll() (v map[int]internal.Vehicle, err error) {
 	return
 }
 
+// GetById is a method that returns the vehicle with an id
+func (s *VehicleDefault) GetById(id int) (v internal.Vehicle, err error) {
+	v, err = s.rp.GetById(id)
+	return
+}
+
+// GetByRegistration is a method that returns the vehicle with a registration, compared in its normalized form
+func (s *VehicleDefault) GetByRegistration(registration string) (v internal.Vehicle, err error) {
+	v, err = s.rp.GetByRegistration(registration)
+	return
+}
+
 // Add is a method that adds a vehicle to the repository
 func (s *VehicleDefault) Add(v *internal.Vehicle) error {
-	err := validateAddVehicleRequestData(v)
-	if err != nil {
-		return err
-	}
+	return s.ct.Reference(func() error {
+		err := s.validate(v)
+		if err != nil {
+			return err
+		}
 
-	err = s.rp.Add(v)
+		err = s.rp.Add(v)
 
-	if err != nil {
-		switch {
-		case errors.Is(err, internal.ErrVehicleIdAlreadyExists):
-			err = fmt.Errorf("%w: id", internal.ErrVehicleAlreadyExists)
-		case errors.Is(err, internal.ErrVehicleRegistrationAlreadyExists):
-			err = fmt.Errorf("%w: registration", internal.ErrVehicleAlreadyExists)
+		if err != nil {
+			return alreadyExists(err)
 		}
-		return err
-	}
 
-	return nil
+		return nil
+	})
 }
 
-// validateAddVehicleRequestData is a function that validates the required fields of a vehicle
-func validateAddVehicleRequestData(v *internal.Vehicle) error {
-	// missing fields
-	if v.Brand == "" {
-		return fmt.Errorf("%w: brand", internal.ErrFieldRequired)
-	}
-	if v.Model == "" {
-		return fmt.Errorf("%w: model", internal.ErrFieldRequired)
-	}
-	if v.Registration == "" {
-		return fmt.Errorf("%w: brand", internal.ErrFieldRequired)
-	}
-	if v.Color == "" {
-		return fmt.Errorf("%w: color", internal.ErrFieldRequired)
-	}
-	if v.FabricationYear == 0 {
-		return fmt.Errorf("%w: year", internal.ErrFieldRequired)
-	}
-	if v.Capacity == 0 {
-		return fmt.Errorf("%w: passenger", internal.ErrFieldRequired)
-	}
-	if v.MaxSpeed == 0 {
-		return fmt.Errorf("%w: max_speed", internal.ErrFieldRequired)
-	}
-
-	if v.FuelType == "" {
-		return fmt.Errorf("%w: fuel_type", internal.ErrFieldRequired)
-	}
-
-	if v.Transmission == "" {
-		return fmt.Errorf("%w: transmission", internal.ErrFieldRequired)
-	}
-
-	if v.Weight == 0 {
-		return fmt.Errorf("%w: weight", internal.ErrFieldRequired)
-	}
-
-	if v.Height == 0 {
-		return fmt.Errorf("%w: height", internal.ErrFieldRequired)
-	}
-
-	if v.Length == 0 {
-		return fmt.Errorf("%w: length", internal.ErrFieldRequired)
+// validate is a method that resolves the brand and the model of a vehicle in the catalog, filling the missing
+// attributes with the specs of the model, replaces the values of the vocabulary fields with their canonical values
+// and checks the rules of the vehicle. A brand, model or value that is not in the catalog or its vocabulary is a
+// violation too
+func (s *VehicleDefault) validate(v *internal.Vehicle) error {
+	e := &internal.ValidationError{}
+	var validationErr *internal.ValidationError
+	if err := s.ct.Resolve(v); err != nil {
+		if !errors.As(err, &validationErr) {
+			return err
+		}
+		e.Violations = append(e.Violations, validationErr.Violations...)
 	}
 
-	if v.Width == 0 {
-		return fmt.Errorf("%w: width", internal.ErrFieldRequired)
-	}
-	// valid field values
-	year, _, _ := time.Now().Date()
-	if v.FabricationYear < 1900 || v.FabricationYear > year {
-		return fmt.Errorf("%w: year", internal.ErrInvalidFieldValue)
+	if err := checkVehicle(v, s.vl, s.vc, e); err != nil {
+		return err
 	}
+	return e.Err()
+}
 
-	if v.Capacity <= 0 || v.Capacity > 6 {
-		return fmt.Errorf("%w: passenger", internal.ErrInvalidFieldValue)
+// NewVehicleCheck is a function that returns the checks of the service on a vehicle that is added, but the
+// catalog, e.g. for the vehicles that are loaded before the catalog exists: the values of the vocabulary fields
+// are replaced with their canonical values, and the values that are not in their vocabulary and the broken rules
+// are violations
+func NewVehicleCheck(vl internal.VehicleValidator, vc internal.VocabularyRepository) func(v *internal.Vehicle) error {
+	return func(v *internal.Vehicle) error {
+		e := &internal.ValidationError{}
+		if err := checkVehicle(v, vl, vc, e); err != nil {
+			return err
+		}
+		return e.Err()
 	}
+}
 
-	if v.MaxSpeed < 0 || v.MaxSpeed > 300 {
-		return fmt.Errorf("%w: max_speed", internal.ErrInvalidFieldValue)
+// checkVehicle is a function that replaces the values of the vocabulary fields of a vehicle with their canonical
+// values and adds to e the values that are not in their vocabulary and the rules broken by the vehicle
+func checkVehicle(v *internal.Vehicle, vl internal.VehicleValidator, vc internal.VocabularyRepository, e *internal.ValidationError) error {
+	ix, err := vc.Index()
+	if err != nil {
+		return err
 	}
+	_, unknown := ix.Normalize(v)
 
-	if v.Weight < 0 || v.Weight > 500 {
-		return fmt.Errorf("%w: weight", internal.ErrInvalidFieldValue)
+	for _, f := range unknown {
+		e.Add(string(f), internal.RuleVocabulary, "is not in the vocabulary of "+string(f))
 	}
-
-	if v.Height < 0 || v.Height > 500 {
-		return fmt.Errorf("%w: height", internal.ErrInvalidFieldValue)
+	if err = vl.Validate(*v); err != nil {
+		var validationErr *internal.ValidationError
+		if !errors.As(err, &validationErr) {
+			return err
+		}
+		e.Violations = append(e.Violations, validationErr.Violations...)
 	}
+	return nil
+}
 
-	if v.Length < 0 || v.Length > 500 {
-		return fmt.Errorf("%w: length", internal.ErrInvalidFieldValue)
+// canonical is a method that returns the canonical value of a value of a vocabulary field, or the value itself
+// when it is not in the vocabulary
+func (s *VehicleDefault) canonical(f internal.VehicleField, value string) (string, error) {
+	ix, err := s.vc.Index()
+	if err != nil {
+		return "", err
 	}
-
-	if v.Width < 0 || v.Width > 0 {
-		return fmt.Errorf("%w: width", internal.ErrInvalidFieldValue)
+	if canonical, known := ix.Canonical(f, value); known {
+		return canonical, nil
 	}
-
-	return nil
+	return value, nil
 }
 
 // GetByColorAndYear is a method that returns a map of vehicles with a specific color and year
+// The color is matched by its vocabulary, e.g. "grey" matches "Gray"
 func (s *VehicleDefault) GetByColorAndYear(color string, year int) (v map[int]internal.Vehicle, err error) {
+	if color, err = s.canonical(internal.VehicleFieldColor, color); err != nil {
+		return
+	}
 	v, err = s.rp.GetByColorAndYear(color, year)
 	return
 }
@@ -158,37 +165,137 @@ func (s *VehicleDefault) GetAverageSpeedByBrand(brand string) (as float64, err e
 	return
 }
 
-// AddBatch is a method that adds a new vehicles to the repository
-func (s *VehicleDefault) AddBatch(vSlice []*internal.Vehicle) error {
-	for _, v := range vSlice {
-		err := validateAddVehicleRequestData(v)
+// AddBatch is a method that adds a new vehicles to the repository, with the same checks as Add
+// In BatchModeAtomic an invalid vehicle rejects the whole batch before the repository is changed, and in
+// BatchModeBestEffort it is skipped. The errors are reported by index in a *VehicleBatchError: in BatchModeAtomic
+// the ones of every vehicle, invalid or already existing, so the batch can be fixed at once
+func (s *VehicleDefault) AddBatch(vSlice []*internal.Vehicle, mode internal.BatchMode) error {
+	if !mode.Valid() {
+		return fmt.Errorf("%w: %q", internal.ErrInvalidBatchMode, mode)
+	}
+	return s.ct.Reference(func() error {
+		return s.addBatch(vSlice, mode)
+	})
+}
+
+// addBatch is a method that validates and adds the vehicles of a batch (see AddBatch)
+func (s *VehicleDefault) addBatch(vSlice []*internal.Vehicle, mode internal.BatchMode) error {
+	// validation
+	batchErr := &internal.VehicleBatchError{Errors: make(map[int]error)}
+	valid := make([]*internal.Vehicle, 0, len(vSlice))
+	indexes := make([]int, 0, len(vSlice))
+	for i, v := range vSlice {
+		err := s.validate(v)
+		if err != nil {
+			batchErr.Errors[i] = err
+			continue
+		}
+		valid = append(valid, v)
+		indexes = append(indexes, i)
+	}
+	if len(batchErr.Errors) > 0 && mode == internal.BatchModeAtomic {
+		// the valid vehicles are checked as the repository would, without adding them
+		existing, err := s.existing(valid)
 		if err != nil {
 			return err
 		}
+		for i, e := range existing {
+			batchErr.Errors[indexes[i]] = e
+		}
+		return batchErr
 	}
 
-	err := s.rp.AddBatch(vSlice)
+	// insertion, with the errors of the repository by the index in vSlice
+	err := s.rp.AddBatch(valid, mode)
 
-	if err != nil {
-		switch {
-		case errors.Is(err, internal.ErrVehicleIdAlreadyExists):
-			err = fmt.Errorf("%w: id", internal.ErrVehicleAlreadyExists)
-		case errors.Is(err, internal.ErrVehicleRegistrationAlreadyExists):
-			err = fmt.Errorf("%w: registration", internal.ErrVehicleAlreadyExists)
+	var rpErr *internal.VehicleBatchError
+	switch {
+	case errors.As(err, &rpErr):
+		for i, e := range rpErr.Errors {
+			batchErr.Errors[indexes[i]] = alreadyExists(e)
 		}
+	case err != nil:
 		return err
 	}
 
+	if len(batchErr.Errors) > 0 {
+		return batchErr
+	}
 	return nil
 }
 
+// existing is a method that returns the errors of the vehicles whose id or registration already exist, in the
+// repository, in its trash (ids only) or earlier in the vehicles, by their index
+func (s *VehicleDefault) existing(vSlice []*internal.Vehicle) (errs map[int]error, err error) {
+	trash, err := s.rp.Trash()
+	if err != nil {
+		return
+	}
+	ids := make(map[int]bool, len(trash)+len(vSlice))
+	for _, v := range trash {
+		ids[v.Id] = true
+	}
+	registrations := make(map[string]bool, len(vSlice))
+
+	errs = make(map[int]error)
+	for i, v := range vSlice {
+		registration := internal.NormalizeRegistration(v.Registration)
+		idExists := ids[v.Id]
+		if !idExists {
+			if _, err = s.rp.GetById(v.Id); err == nil {
+				idExists = true
+			} else if !errors.Is(err, internal.ErrVehicleIdNotFound) {
+				return
+			}
+		}
+		registrationExists := registrations[registration]
+		if !idExists && !registrationExists {
+			if _, err = s.rp.GetByRegistration(v.Registration); err == nil {
+				registrationExists = true
+			} else if !errors.Is(err, internal.ErrVehicleIdNotFound) {
+				return
+			}
+		}
+		err = nil
+
+		switch {
+		case idExists:
+			errs[i] = alreadyExists(internal.ErrVehicleIdAlreadyExists)
+		case registrationExists:
+			errs[i] = alreadyExists(internal.ErrVehicleRegistrationAlreadyExists)
+		default:
+			ids[v.Id] = true
+			registrations[registration] = true
+		}
+	}
+	return
+}
+
+// alreadyExists is a function that returns the existence errors of the repository as ErrVehicleAlreadyExists,
+// with the field that already exists
+func alreadyExists(err error) error {
+	switch {
+	case errors.Is(err, internal.ErrVehicleIdAlreadyExists):
+		return fmt.Errorf("%w: id", internal.ErrVehicleAlreadyExists)
+	case errors.Is(err, internal.ErrVehicleRegistrationAlreadyExists):
+		return fmt.Errorf("%w: registration", internal.ErrVehicleAlreadyExists)
+	}
+	return err
+}
+
 // UpdateSpeed is a method that updates the max speed of a vehicle
-func (s *VehicleDefault) UpdateSpeed(speed float64, id int) error {
-	if speed < 0 || speed > 300 {
-		return internal.ErrInvalidFieldValue
+func (s *VehicleDefault) UpdateSpeed(speed float64, id int, version int) error {
+	// the rules of the speed depend on the category of the vehicle
+	v, err := s.rp.GetById(id)
+	if err != nil {
+		return err
+	}
+	v.MaxSpeed = speed
+	if err = s.vl.ValidateFields(v, internal.VehicleFieldMaxSpeed); err != nil {
+		return err
 	}
 
-	err := s.rp.UpdateSpeed(speed, id)
+	err = s.rp.UpdateSpeed(speed, id, version)
 
 	if err != nil {
 		return err
@@ -197,15 +304,76 @@ func (s *VehicleDefault) UpdateSpeed(speed float64, id int) error {
 	return nil
 }
 
+// Update is a method that replaces a vehicle, with the same checks as Add
+func (s *VehicleDefault) Update(v *internal.Vehicle) error {
+	return s.ct.Reference(func() error {
+		err := s.validate(v)
+		if err != nil {
+			return err
+		}
+
+		err = s.rp.Update(v)
+
+		if err != nil {
+			return alreadyExists(err)
+		}
+
+		return nil
+	})
+}
+
 // GetByFuelType is a method that returns a map of vehicles with a type of fuel
+// The fuel type is matched by its vocabulary, e.g. "Diesel" or "gasoil" match "diesel"
 func (s *VehicleDefault) GetByFuelType(fuelType string) (v map[int]internal.Vehicle, err error) {
+	if fuelType, err = s.canonical(internal.VehicleFieldFuelType, fuelType); err != nil {
+		return
+	}
 	v, err = s.rp.GetByFuelType(fuelType)
 	return
 }
 
-// DeleteVehicle is a method that deletes a vehicle
-func (s *VehicleDefault) DeleteVehicle(id int) (err error) {
-	err = s.rp.DeleteVehicle(id)
+// DeleteVehicle is a method that moves a vehicle to the trash
+func (s *VehicleDefault) DeleteVehicle(id int, version int, reason string) (err error) {
+	err = s.rp.DeleteVehicle(id, version, reason)
+	return
+}
+
+// Trash is a method that returns the vehicles in the trash, sorted by id
+func (s *VehicleDefault) Trash() (v []internal.Vehicle, err error) {
+	v, err = s.rp.Trash()
+	return
+}
+
+// Restore is a method that moves a vehicle from the trash back to the vehicles
+// The vehicles in the trash do not reference the catalog, so its brand and its model must still be in the catalog,
+// otherwise it returns a *ValidationError. A vehicle that took its registration is reported as
+// ErrVehicleAlreadyExists
+func (s *VehicleDefault) Restore(id int) (v internal.Vehicle, err error) {
+	err = s.ct.Reference(func() error {
+		trash, err := s.rp.Trash()
+		if err != nil {
+			return err
+		}
+		i := sort.Search(len(trash), func(i int) bool { return trash[i].Id >= id })
+		if i == len(trash) || trash[i].Id != id {
+			return internal.ErrVehicleIdNotFound
+		}
+		vh := trash[i]
+		if err = s.ct.Resolve(&vh); err != nil {
+			return err
+		}
+
+		if v, err = s.rp.Restore(id); err != nil {
+			return alreadyExists(err)
+		}
+		return nil
+	})
+	return
+}
+
+// Purge is a method that removes for good the vehicles of the trash deleted before a time
+func (s *VehicleDefault) Purge(before time.Time) (n int, err error) {
+	n, err = s.rp.Purge(before)
 	return
 }
 
@@ -238,3 +406,160 @@ func (s *VehicleDefault) GetByWeight(minWeight, maxWeight float64) (v map[int]in
 	v, err = s.rp.GetByWeight(minWeight, maxWeight)
 	return
 }
+
+// Query is a method that returns the page of vehicles that satisfy the filters of a query, sorted,
+// and the total number of vehicles that satisfy them
+// The values of the filters of equality over vocabulary fields are matched by their vocabulary
+func (s *VehicleDefault) Query(q internal.VehicleQuery) (v []internal.Vehicle, total int, err error) {
+	if err = q.Validate(); err != nil {
+		return
+	}
+	if q.Filters, err = s.canonicalFilters(q.Filters); err != nil {
+		return
+	}
+
+	v, total, err = s.rp.Query(q)
+	return
+}
+
+// Aggregate is a method that returns the metrics of the groups of the vehicles that satisfy the filters of
+// an aggregation, sorted by their keys
+// The values of the filters are matched as in Query
+func (s *VehicleDefault) Aggregate(a internal.VehicleAggregation) (groups []internal.VehicleGroup, err error) {
+	if err = a.Validate(); err != nil {
+		return
+	}
+	if a.Filters, err = s.canonicalFilters(a.Filters); err != nil {
+		return
+	}
+
+	groups, err = s.rp.Aggregate(a)
+	return
+}
+
+// Histogram is a method that returns the histograms of a numeric field of the groups of the vehicles that
+// satisfy the filters of a histogram, sorted by their keys
+// The values of the filters are matched as in Query
+func (s *VehicleDefault) Histogram(h internal.VehicleHistogram) (groups []internal.HistogramGroup, err error) {
+	if err = h.Validate(); err != nil {
+		return
+	}
+	if h.Filters, err = s.canonicalFilters(h.Filters); err != nil {
+		return
+	}
+
+	groups, err = s.rp.Histogram(h)
+	return
+}
+
+// Stream is a method that calls fn with every vehicle that satisfies the filters, sorted by id
+// The values of the filters are matched as in Query
+func (s *VehicleDefault) Stream(filters []internal.VehicleFilter, fn func(v internal.Vehicle) error) (err error) {
+	if err = (internal.VehicleQuery{Filters: filters}).Validate(); err != nil {
+		return
+	}
+	if filters, err = s.canonicalFilters(filters); err != nil {
+		return
+	}
+
+	err = s.rp.Stream(filters, fn)
+	return
+}
+
+// Reload is a method that replaces the vehicles of the repository with a new set of vehicles, e.g. the seed file
+// edited, and returns the changes. The values of the vocabulary fields are replaced with their canonical values,
+// so they compare equal to the stored ones. The vehicles that the reload adds or changes are checked as when they
+// are added or updated: they are validated and their registrations must not be the ones of other vehicles. When
+// any of them fails, nothing is reloaded and the error is a *internal.VehicleReloadError. The vehicles that do not
+// change are not checked, as when they are first loaded
+func (s *VehicleDefault) Reload(v map[int]internal.Vehicle) (d internal.VehicleDiff, err error) {
+	ix, err := s.vc.Index()
+	if err != nil {
+		return
+	}
+	next := make(map[int]internal.Vehicle, len(v))
+	for id, vh := range v {
+		ix.Normalize(&vh)
+		next[id] = vh
+	}
+
+	err = s.ct.Reference(func() (err error) {
+		d, err = s.rp.Reload(next, func(current map[int]internal.Vehicle, d *internal.VehicleDiff) error {
+			return s.checkReload(next, current, d)
+		})
+		return
+	})
+	return
+}
+
+// checkReload is a method that validates the vehicles that a reload from the current vehicles to next adds or
+// changes, replacing them in d with the vehicles resolved in the catalog, and checks that their registrations are
+// not the ones of other vehicles after the reload (see Reload). It is the check of the reload in the repository,
+// so the changes can not be changed by others before they are applied
+func (s *VehicleDefault) checkReload(next, current map[int]internal.Vehicle, d *internal.VehicleDiff) (err error) {
+	e := &internal.VehicleReloadError{Errors: make(map[int]error)}
+	changed := make([]*internal.Vehicle, 0, len(d.Added)+len(d.Updated))
+	for i := range d.Added {
+		changed = append(changed, &d.Added[i])
+	}
+	for i := range d.Updated {
+		changed = append(changed, &d.Updated[i])
+	}
+	for _, v := range changed {
+		var validationErr *internal.ValidationError
+		switch err = s.validate(v); {
+		case errors.As(err, &validationErr):
+			e.Errors[v.Id] = err
+		case err != nil:
+			return
+		}
+	}
+
+	// the vehicles after the reload: the ones of next that are kept, updated or added (not the ones of next with
+	// the ids of the vehicles in the trash, which the reload ignores)
+	added := make(map[int]bool, len(d.Added))
+	for _, v := range d.Added {
+		added[v.Id] = true
+	}
+	registrations := make(map[string]int, len(next))
+	for id, v := range next {
+		if _, ok := current[id]; (ok || added[id]) && !v.Deleted() {
+			registrations[internal.NormalizeRegistration(v.Registration)]++
+		}
+	}
+	for _, v := range changed {
+		if _, ok := e.Errors[v.Id]; !ok && registrations[internal.NormalizeRegistration(v.Registration)] > 1 {
+			e.Errors[v.Id] = alreadyExists(internal.ErrVehicleRegistrationAlreadyExists)
+		}
+	}
+
+	err = nil
+	if len(e.Errors) > 0 {
+		err = e
+	}
+	return
+}
+
+// canonicalFilters is a method that returns the filters with the values of the filters of equality over
+// vocabulary fields replaced with their canonical values
+func (s *VehicleDefault) canonicalFilters(in []internal.VehicleFilter) (filters []internal.VehicleFilter, err error) {
+	filters = make([]internal.VehicleFilter, 0, len(in))
+	for _, f := range in {
+		switch f.Operator {
+		case internal.FilterEq, internal.FilterNe, internal.FilterIn:
+			if !internal.IsVocabularyField(f.Field) {
+				break
+			}
+			values := make([]any, 0, len(f.Values))
+			for _, value := range f.Values {
+				if value, err = s.canonical(f.Field, value.(string)); err != nil {
+					return
+				}
+				values = append(values, value)
+			}
+			f.Values = values
+		}
+		filters = append(filters, f)
+	}
+	return
+}
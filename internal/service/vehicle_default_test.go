@@ -0,0 +1,146 @@
+package service
+
+import (
+	"app/internal"
+	"errors"
+	"testing"
+)
+
+// newTestVehicle is a function that returns a valid vehicle of the service of newImportService
+func newTestVehicle(id int, registration string) *internal.Vehicle {
+	return &internal.Vehicle{Id: id, VehicleAttributes: internal.VehicleAttributes{
+		Brand: "Ford", Model: "Fiesta", Registration: registration, Color: "Red", FabricationYear: 2010,
+		Capacity: 4, MaxSpeed: 180, FuelType: "gas", Transmission: "manual", Weight: 100,
+		Dimensions: internal.Dimensions{Height: 150, Length: 400, Width: 180},
+	}}
+}
+
+func TestVehicleDefault_AddBatch(t *testing.T) {
+	batch := func() []*internal.Vehicle {
+		invalid := newTestVehicle(3, "NEW-3")
+		invalid.Capacity = 9
+		return []*internal.Vehicle{
+			newTestVehicle(2, "NEW-2"),  // valid
+			invalid,                     // invalid
+			newTestVehicle(1, "NEW-4"),  // id of the repository
+			newTestVehicle(5, " old-1"), // registration of the repository
+			newTestVehicle(6, "new-2"),  // registration earlier in the batch
+			newTestVehicle(7, "NEW-7"),  // valid
+		}
+	}
+	expectErrors := func(t *testing.T, err error, kinds map[int]error) {
+		t.Helper()
+		var batchErr *internal.VehicleBatchError
+		if !errors.As(err, &batchErr) || len(batchErr.Errors) != len(kinds) {
+			t.Fatalf("expected errors at %d indexes, got %v", len(kinds), err)
+		}
+		for i, kind := range kinds {
+			var validationErr *internal.ValidationError
+			if kind == nil && !errors.As(batchErr.Errors[i], &validationErr) || kind != nil && !errors.Is(batchErr.Errors[i], kind) {
+				t.Errorf("index %d: expected %v, got %v", i, kind, batchErr.Errors[i])
+			}
+		}
+	}
+
+	t.Run("atomic reports every invalid and existing vehicle", func(t *testing.T) {
+		sv, rp := newImportService(t)
+		expectErrors(t, sv.AddBatch(batch(), internal.BatchModeAtomic), map[int]error{
+			1: nil, 2: internal.ErrVehicleAlreadyExists, 3: internal.ErrVehicleAlreadyExists, 4: internal.ErrVehicleAlreadyExists,
+		})
+		if v, _ := rp.FindAll(); len(v) != 1 {
+			t.Fatalf("expected the repository unchanged, got %d vehicles", len(v))
+		}
+	})
+
+	t.Run("atomic reports the ids in the trash", func(t *testing.T) {
+		sv, rp := newImportService(t)
+		if err := rp.DeleteVehicle(1, 0, ""); err != nil {
+			t.Fatal(err)
+		}
+		expectErrors(t, sv.AddBatch(batch(), internal.BatchModeAtomic), map[int]error{
+			1: nil, 2: internal.ErrVehicleAlreadyExists, 4: internal.ErrVehicleAlreadyExists,
+		})
+	})
+
+	t.Run("best effort adds the valid vehicles", func(t *testing.T) {
+		sv, rp := newImportService(t)
+		expectErrors(t, sv.AddBatch(batch(), internal.BatchModeBestEffort), map[int]error{
+			1: nil, 2: internal.ErrVehicleAlreadyExists, 3: internal.ErrVehicleAlreadyExists, 4: internal.ErrVehicleAlreadyExists,
+		})
+		v, _ := rp.FindAll()
+		if len(v) != 3 || v[2].Version != 1 || v[7].Version != 1 {
+			t.Fatalf("expected vehicles 2 and 7 added, got %d vehicles", len(v))
+		}
+	})
+}
+
+func TestVehicleDefault_Reload(t *testing.T) {
+	sv, rp := newImportService(t)
+	// vehicle 1 does not pass the checks, but it is not checked as long as it does not change
+	unchanged, err := rp.GetById(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := newTestVehicle(3, "NEW-3")
+	invalid.Capacity = 9
+	_, err = sv.Reload(map[int]internal.Vehicle{
+		1: unchanged,
+		2: *newTestVehicle(2, "NEW-2"),
+		3: *invalid,
+		4: *newTestVehicle(4, " old-1"),
+	})
+	var reloadErr *internal.VehicleReloadError
+	if !errors.As(err, &reloadErr) || len(reloadErr.Errors) != 2 {
+		t.Fatalf("expected the reload rejected for 2 vehicles, got %v", err)
+	}
+	var validationErr *internal.ValidationError
+	if !errors.As(reloadErr.Errors[3], &validationErr) || !errors.Is(reloadErr.Errors[4], internal.ErrVehicleAlreadyExists) {
+		t.Fatalf("expected vehicle 3 invalid and the registration of 4 existing, got %v", reloadErr.Errors)
+	}
+	if v, _ := rp.FindAll(); len(v) != 1 {
+		t.Fatalf("expected nothing reloaded, got %d vehicles", len(v))
+	}
+
+	// the added vehicles are resolved in the catalog
+	added := newTestVehicle(2, "NEW-2")
+	added.Brand = "ford"
+	d, err := sv.Reload(map[int]internal.Vehicle{1: unchanged, 2: *added})
+	if err != nil || len(d.Added) != 1 || len(d.Updated) != 0 {
+		t.Fatalf("expected vehicle 2 added, got %+v, %v", d, err)
+	}
+	if v, err := rp.GetById(2); err != nil || v.Brand != "Ford" {
+		t.Fatalf("expected vehicle 2 of Ford, got %+v, %v", v, err)
+	}
+}
+
+// changingRepository is a repository that changes vehicle 1 when a reload starts, as a concurrent update
+type changingRepository struct {
+	internal.VehicleRepository
+}
+
+// Reload is a method that changes the speed of vehicle 1 and then reloads
+func (r changingRepository) Reload(v map[int]internal.Vehicle, check internal.ReloadCheck) (internal.VehicleDiff, error) {
+	if err := r.UpdateSpeed(200, 1, 0); err != nil {
+		return internal.VehicleDiff{}, err
+	}
+	return r.VehicleRepository.Reload(v, check)
+}
+
+func TestVehicleDefault_Reload_ConcurrentChange(t *testing.T) {
+	sv, rp := newImportService(t)
+	unchanged, err := rp.GetById(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.rp = changingRepository{rp}
+
+	// vehicle 1 changed by the update is changed back by the reload, so it is checked
+	var reloadErr *internal.VehicleReloadError
+	if _, err = sv.Reload(map[int]internal.Vehicle{1: unchanged}); !errors.As(err, &reloadErr) || reloadErr.Errors[1] == nil {
+		t.Fatalf("expected vehicle 1 rejected, got %v", err)
+	}
+	if v, err := rp.GetById(1); err != nil || v.MaxSpeed != 200 {
+		t.Fatalf("expected the update kept, got %+v, %v", v, err)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// importChunk is the number of vehicles of an import that are checked and added together
+const importChunk = 500
+
+// importRow is a struct that represents a row of an import waiting in a chunk
+type importRow struct {
+	// row is the row (line) of the vehicle
+	row int
+	// v is the vehicle, nil when the row could not be read
+	v *internal.Vehicle
+	// err is the error of the row
+	err error
+}
+
+// Import is a method that adds the vehicles of a reader with the same checks as AddBatch, in best effort mode,
+// and reports the rows created and rejected. With dryRun the vehicles are only checked, also against the
+// vehicles of the repository and the earlier rows
+// The vehicles are read and added by chunks, so only a chunk is held in memory (and, with dryRun, the ids and
+// registrations of the rows that would be created)
+func (s *VehicleDefault) Import(r internal.VehicleReader, dryRun bool) (report internal.ImportReport, err error) {
+	report.DryRun = dryRun
+	chunk := make([]importRow, 0, importChunk)
+	seen := newImportSeen()
+
+	flush := func() (err error) {
+		if dryRun {
+			err = s.checkImport(chunk, seen)
+		} else {
+			err = s.addImport(chunk)
+		}
+		if err != nil {
+			return
+		}
+		for _, ir := range chunk {
+			if ir.err != nil {
+				report.Reject(importRejection(ir))
+				continue
+			}
+			report.Created++
+		}
+		chunk = chunk[:0]
+		return
+	}
+
+	for {
+		v, row, errRead := r.Read()
+		if errors.Is(errRead, io.EOF) {
+			break
+		}
+		var rowErr *internal.ImportRowError
+		switch {
+		case errors.As(errRead, &rowErr):
+			chunk = append(chunk, importRow{row: rowErr.Row, err: rowErr.Err})
+		case errRead != nil:
+			err = errRead
+			return
+		default:
+			chunk = append(chunk, importRow{row: row, v: &v})
+		}
+		report.Rows++
+
+		if len(chunk) == importChunk {
+			if err = flush(); err != nil {
+				return
+			}
+		}
+	}
+	err = flush()
+	return
+}
+
+// addImport is a method that adds the vehicles of a chunk that could be read, setting the error of the rest
+func (s *VehicleDefault) addImport(chunk []importRow) (err error) {
+	vehicles := make([]*internal.Vehicle, 0, len(chunk))
+	indexes := make([]int, 0, len(chunk))
+	for i, ir := range chunk {
+		if ir.err == nil {
+			vehicles = append(vehicles, ir.v)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(vehicles) == 0 {
+		return
+	}
+
+	err = s.AddBatch(vehicles, internal.BatchModeBestEffort)
+	var batchErr *internal.VehicleBatchError
+	if !errors.As(err, &batchErr) {
+		return
+	}
+	for i, e := range batchErr.Errors {
+		chunk[indexes[i]].err = e
+	}
+	return nil
+}
+
+// checkImport is a method that checks the vehicles of a chunk as they would be added, setting the error of the
+// rows that would not be created
+func (s *VehicleDefault) checkImport(chunk []importRow, seen *importSeen) (err error) {
+	for i := range chunk {
+		ir := &chunk[i]
+		if ir.err != nil {
+			continue
+		}
+		if ir.err = s.validate(ir.v); ir.err != nil {
+			var validationErr *internal.ValidationError
+			if !errors.As(ir.err, &validationErr) {
+				return ir.err
+			}
+			continue
+		}
+		if ir.err, err = s.checkExists(ir.v, seen); err != nil {
+			return
+		}
+		if ir.err == nil {
+			seen.add(ir.v)
+		}
+	}
+	return
+}
+
+// checkExists is a method that returns ErrVehicleAlreadyExists as the error of a vehicle whose id or registration
+// is in the repository or in an earlier row
+func (s *VehicleDefault) checkExists(v *internal.Vehicle, seen *importSeen) (errRow, err error) {
+	_, err = s.rp.GetById(v.Id)
+	switch {
+	case err == nil || seen.ids[v.Id]:
+		return fmt.Errorf("%w: id", internal.ErrVehicleAlreadyExists), nil
+	case !errors.Is(err, internal.ErrVehicleIdNotFound):
+		return
+	}
+
+	_, err = s.rp.GetByRegistration(v.Registration)
+	switch {
+	case err == nil || seen.registrations[internal.NormalizeRegistration(v.Registration)]:
+		return fmt.Errorf("%w: registration", internal.ErrVehicleAlreadyExists), nil
+	case !errors.Is(err, internal.ErrVehicleIdNotFound):
+		return
+	}
+	return nil, nil
+}
+
+// importRejection is a function that returns the rejection of a row of an import
+func importRejection(ir importRow) internal.ImportRejection {
+	rejection := internal.ImportRejection{Row: ir.row, Err: ir.err}
+	if ir.v != nil {
+		rejection.Id, rejection.Registration = ir.v.Id, ir.v.Registration
+	}
+	return rejection
+}
+
+// newImportSeen is a function that returns a new instance of importSeen
+func newImportSeen() *importSeen {
+	return &importSeen{ids: make(map[int]bool), registrations: make(map[string]bool)}
+}
+
+// importSeen is a struct that represents the ids and the normalized registrations of the rows of a dry run that
+// would be created
+type importSeen struct {
+	ids           map[int]bool
+	registrations map[string]bool
+}
+
+// add is a method that adds the id and the registration of a vehicle
+func (s *importSeen) add(v *internal.Vehicle) {
+	s.ids[v.Id] = true
+	s.registrations[internal.NormalizeRegistration(v.Registration)] = true
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"app/internal"
+	"app/internal/loader"
+	"app/internal/repository"
+	"app/internal/validator"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newImportService is a function that returns a vehicle service with the default rules and vocabularies, and a
+// catalog with a Ford Fiesta
+func newImportService(t *testing.T) (*VehicleDefault, internal.VehicleRepository) {
+	t.Helper()
+	rp := repository.NewVehicleMap(map[int]internal.Vehicle{
+		1: {Id: 1, Version: 1, VehicleAttributes: internal.VehicleAttributes{Brand: "Ford", Model: "Fiesta", Registration: "OLD-1"}},
+	})
+	vc, err := repository.NewVocabularyMap(loader.DefaultVocabularies(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := repository.NewCatalogMap([]internal.Brand{{Name: "Ford", Models: []internal.Model{{Name: "Fiesta"}}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewVehicleDefault(rp, validator.NewDefaultVehicleRules(), vc, NewCatalogDefault(ct, rp)), rp
+}
+
+func TestVehicleDefault_Import(t *testing.T) {
+	line := func(id int, registration string) string {
+		return `{"id":` + strconv.Itoa(id) + `,"brand":"Ford","model":"Fiesta","registration":"` + registration +
+			`","color":"Red","year":2010,"passengers":4,"max_speed":180,"fuel_type":"gas","transmission":"manual",` +
+			`"weight":100,"height":150,"length":400,"width":180}` + "\n"
+	}
+	data := line(2, "NEW-2") + // created
+		line(3, " old-1") + // registration of the repository
+		`{"id":"4"}` + "\n" + // id of another kind
+		line(5, "NEW-5") + // created
+		line(6, "new-5") // registration of an earlier row
+
+	for _, dryRun := range []bool{true, false} {
+		sv, rp := newImportService(t)
+		report, err := sv.Import(loader.NewVehicleNDJSONReader(strings.NewReader(data)), dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Rows != 5 || report.Created != 2 || report.Rejected != 3 {
+			t.Fatalf("dry run %v: unexpected report %+v", dryRun, report)
+		}
+		for i, row := range []int{2, 3, 5} {
+			if report.Rejections[i].Row != row {
+				t.Fatalf("dry run %v: expected row %d rejected, got %+v", dryRun, row, report.Rejections)
+			}
+		}
+		if !errors.Is(report.Rejections[0].Err, internal.ErrVehicleAlreadyExists) {
+			t.Fatalf("dry run %v: expected ErrVehicleAlreadyExists, got %v", dryRun, report.Rejections[0].Err)
+		}
+
+		_, err = rp.GetById(2)
+		if created := err == nil; created == dryRun {
+			t.Fatalf("dry run %v: expected vehicle 2 created %v, got error %v", dryRun, !dryRun, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"app/internal"
+	"strings"
+)
+
+// NewVocabularyDefault is a function that returns a new instance of VocabularyDefault
+func NewVocabularyDefault(rp internal.VocabularyRepository) *VocabularyDefault {
+	return &VocabularyDefault{rp: rp}
+}
+
+// VocabularyDefault is a struct that represents the default service for vocabularies
+type VocabularyDefault struct {
+	// rp is the repository that will be used by the service
+	rp internal.VocabularyRepository
+}
+
+// FindAll is a method that returns the vocabularies of all the vocabulary fields
+func (s *VocabularyDefault) FindAll() (v []internal.Vocabulary, err error) {
+	v, err = s.rp.FindAll()
+	return
+}
+
+// Get is a method that returns the vocabulary of a field
+func (s *VocabularyDefault) Get(f internal.VehicleField) (v internal.Vocabulary, err error) {
+	v, err = s.rp.Get(f)
+	return
+}
+
+// AddTerm is a method that adds a term to the vocabulary of a field
+func (s *VocabularyDefault) AddTerm(f internal.VehicleField, t internal.Term) (err error) {
+	err = s.rp.AddTerm(f, cleanTerm(t))
+	return
+}
+
+// UpdateTerm is a method that replaces the term with a value in the vocabulary of a field
+// The vehicles keep the values they have, they are normalized again when they are written or loaded
+func (s *VocabularyDefault) UpdateTerm(f internal.VehicleField, value string, t internal.Term) (err error) {
+	err = s.rp.UpdateTerm(f, value, cleanTerm(t))
+	return
+}
+
+// DeleteTerm is a method that deletes the term with a value from the vocabulary of a field
+func (s *VocabularyDefault) DeleteTerm(f internal.VehicleField, value string) (err error) {
+	err = s.rp.DeleteTerm(f, value)
+	return
+}
+
+// cleanTerm is a function that removes leading, trailing and repeated spaces from the value and the aliases of a term
+func cleanTerm(t internal.Term) internal.Term {
+	c := internal.Term{Value: strings.Join(strings.Fields(t.Value), " ")}
+	for _, alias := range t.Aliases {
+		c.Aliases = append(c.Aliases, strings.Join(strings.Fields(alias), " "))
+	}
+	return c
+}
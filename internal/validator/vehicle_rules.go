@@ -0,0 +1,391 @@
+package validator
+
+import (
+	"app/internal"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidRules is the error returned when a configuration of validation rules is not valid
+	ErrInvalidRules = errors.New("invalid validation rules")
+)
+
+// operatorDescriptions are the descriptions of the operators of the rules between two fields
+var operatorDescriptions = map[internal.FilterOperator]string{
+	internal.FilterEq:  "equal to",
+	internal.FilterNe:  "different from",
+	internal.FilterGt:  "greater than",
+	internal.FilterGte: "greater than or equal to",
+	internal.FilterLt:  "less than",
+	internal.FilterLte: "less than or equal to",
+}
+
+// NewVehicleRules is a function that returns a new instance of VehicleRules with the rules of a configuration
+func NewVehicleRules(c VehicleRulesConfig) (r *VehicleRules, err error) {
+	if len(c.RuleSets) == 0 {
+		err = fmt.Errorf("%w: there are no rule sets", ErrInvalidRules)
+		return
+	}
+
+	configs := make(map[string]RuleSetConfig, len(c.RuleSets))
+	for i, sc := range c.RuleSets {
+		if sc.Name == "" {
+			err = fmt.Errorf("%w: rule set %d has no name", ErrInvalidRules, i)
+			return
+		}
+		if _, ok := configs[sc.Name]; ok {
+			err = fmt.Errorf("%w: rule set %q is repeated", ErrInvalidRules, sc.Name)
+			return
+		}
+		configs[sc.Name] = sc
+	}
+
+	r = &VehicleRules{now: time.Now}
+	for _, sc := range c.RuleSets {
+		if sc, err = resolveRuleSet(configs, sc, nil); err != nil {
+			return
+		}
+		var set ruleSet
+		if set, err = compileRuleSet(sc); err != nil {
+			err = fmt.Errorf("%w: rule set %q: %s", ErrInvalidRules, sc.Name, err)
+			return
+		}
+		r.sets = append(r.sets, set)
+	}
+	return
+}
+
+// NewDefaultVehicleRules is a function that returns a new instance of VehicleRules with the default rules
+func NewDefaultVehicleRules() *VehicleRules {
+	r, err := NewVehicleRules(DefaultVehicleRulesConfig())
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// VehicleRules is a struct that implements the VehicleValidator interface with rules loaded from a configuration
+type VehicleRules struct {
+	// sets are the rule sets, in the order they are selected
+	sets []ruleSet
+	// now returns the time of the validation, the year of "current_year" limits
+	now func() time.Time
+}
+
+// ruleSet is a struct that represents the compiled rules of a category of vehicles
+type ruleSet struct {
+	// name is the name of the category
+	name string
+	// match are the conditions that select the vehicles of the category
+	match []internal.VehicleFilter
+	// fields are the rules of each field, in the order of internal.VehicleFields
+	fields []fieldRules
+	// compare are the rules between two fields
+	compare []compareRule
+}
+
+// fieldRules is a struct that represents the compiled rules of a field
+type fieldRules struct {
+	field    internal.VehicleField
+	required bool
+	min      *Limit
+	max      *Limit
+	enum     []any
+	regex    *regexp.Regexp
+}
+
+// compareRule is a struct that represents a compiled rule between two fields
+type compareRule struct {
+	field    internal.VehicleField
+	operator internal.FilterOperator
+	other    internal.VehicleField
+}
+
+// Validate is a method that checks every rule of a vehicle
+func (r *VehicleRules) Validate(v internal.Vehicle) (err error) {
+	err = r.validate(v, nil)
+	return
+}
+
+// ValidateFields is a method that checks only the rules of some fields of a vehicle
+func (r *VehicleRules) ValidateFields(v internal.Vehicle, fields ...internal.VehicleField) (err error) {
+	err = r.validate(v, fields)
+	return
+}
+
+// validate is a method that checks the rules of the fields of a vehicle (all of them when fields is nil)
+// with the rule set of its category. A vehicle of no category has no rules
+func (r *VehicleRules) validate(v internal.Vehicle, fields []internal.VehicleField) error {
+	set := r.ruleSet(v)
+	if set == nil {
+		return nil
+	}
+	selected := func(f internal.VehicleField) bool {
+		return fields == nil || slices.Contains(fields, f)
+	}
+
+	e := &internal.ValidationError{}
+	year := r.now().Year()
+	for _, fr := range set.fields {
+		if selected(fr.field) {
+			fr.check(e, fr.field.Value(v), year)
+		}
+	}
+	for _, cr := range set.compare {
+		if selected(cr.field) || selected(cr.other) {
+			cr.check(e, v)
+		}
+	}
+	return e.Err()
+}
+
+// ruleSet is a method that returns the first rule set whose conditions match a vehicle, or nil
+func (r *VehicleRules) ruleSet(v internal.Vehicle) *ruleSet {
+	for i := range r.sets {
+		matches := true
+		for _, f := range r.sets[i].match {
+			if !f.Match(v) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return &r.sets[i]
+		}
+	}
+	return nil
+}
+
+// check is a method that adds the violations of the rules of a field with a value
+func (fr fieldRules) check(e *internal.ValidationError, value any, year int) {
+	name := string(fr.field)
+	if isZero(value) {
+		if fr.required {
+			e.Add(name, internal.RuleRequired, "is required")
+		}
+		return
+	}
+
+	if fr.min != nil {
+		if min := fr.min.value(year); internal.CompareValues(value, min) < 0 {
+			e.Add(name, internal.RuleMin, "must be at least "+formatNumber(min))
+		}
+	}
+	if fr.max != nil {
+		if max := fr.max.value(year); internal.CompareValues(value, max) > 0 {
+			e.Add(name, internal.RuleMax, "must be at most "+formatNumber(max))
+		}
+	}
+	if len(fr.enum) > 0 && !slices.ContainsFunc(fr.enum, func(ev any) bool { return internal.CompareValues(value, ev) == 0 }) {
+		values := make([]string, 0, len(fr.enum))
+		for _, ev := range fr.enum {
+			values = append(values, fmt.Sprint(ev))
+		}
+		e.Add(name, internal.RuleEnum, "must be one of "+strings.Join(values, ", "))
+	}
+	if fr.regex != nil && !fr.regex.MatchString(value.(string)) {
+		e.Add(name, internal.RuleRegex, "must match "+fr.regex.String())
+	}
+}
+
+// check is a method that adds the violation of a rule between two fields of a vehicle
+// It is only checked when both fields have a value
+func (cr compareRule) check(e *internal.ValidationError, v internal.Vehicle) {
+	other := cr.other.Value(v)
+	if isZero(cr.field.Value(v)) || isZero(other) {
+		return
+	}
+	f := internal.VehicleFilter{Field: cr.field, Operator: cr.operator, Values: []any{other}}
+	if !f.Match(v) {
+		e.Add(string(cr.field), internal.RuleCompare,
+			fmt.Sprintf("must be %s %s", operatorDescriptions[cr.operator], cr.other))
+	}
+}
+
+// value is a method that returns the number of a limit in a year
+func (l Limit) value(year int) float64 {
+	if l.CurrentYear {
+		return float64(year)
+	}
+	return l.Value
+}
+
+// resolveRuleSet is a function that returns a rule set with the rules inherited from the rule sets it extends
+// seen are the rule sets that extend it, to detect cycles
+func resolveRuleSet(configs map[string]RuleSetConfig, sc RuleSetConfig, seen []string) (RuleSetConfig, error) {
+	if sc.Extends == "" {
+		return sc, nil
+	}
+	seen = append(seen, sc.Name)
+	if slices.Contains(seen, sc.Extends) {
+		return sc, fmt.Errorf("%w: rule sets extend each other: %s", ErrInvalidRules,
+			strings.Join(append(seen, sc.Extends), " -> "))
+	}
+	parent, ok := configs[sc.Extends]
+	if !ok {
+		return sc, fmt.Errorf("%w: rule set %q extends unknown rule set %q", ErrInvalidRules, sc.Name, sc.Extends)
+	}
+	parent, err := resolveRuleSet(configs, parent, seen)
+	if err != nil {
+		return sc, err
+	}
+	return extendRuleSet(parent, sc), nil
+}
+
+// extendRuleSet is a function that returns a rule set with the rules of a parent rule set and its own
+// The rules of a field of the child replace the ones of the parent, one by one. The conditions are not inherited
+func extendRuleSet(parent, child RuleSetConfig) RuleSetConfig {
+	fields := make(map[string]FieldRulesConfig, len(parent.Fields)+len(child.Fields))
+	for name, fr := range parent.Fields {
+		fields[name] = fr
+	}
+	for name, cfr := range child.Fields {
+		fr := fields[name]
+		if cfr.Required != nil {
+			fr.Required = cfr.Required
+		}
+		if cfr.Min != nil {
+			fr.Min = cfr.Min
+		}
+		if cfr.Max != nil {
+			fr.Max = cfr.Max
+		}
+		if cfr.Enum != nil {
+			fr.Enum = cfr.Enum
+		}
+		if cfr.Regex != "" {
+			fr.Regex = cfr.Regex
+		}
+		fields[name] = fr
+	}
+
+	child.Fields = fields
+	child.Compare = append(append([]CompareRuleConfig(nil), parent.Compare...), child.Compare...)
+	return child
+}
+
+// compileRuleSet is a function that checks the configuration of a rule set and compiles it
+func compileRuleSet(sc RuleSetConfig) (set ruleSet, err error) {
+	set.name = sc.Name
+
+	// conditions
+	for _, cc := range sc.Match {
+		f := internal.VehicleFilter{Field: internal.VehicleField(cc.Field), Operator: internal.FilterOperator(cc.Operator)}
+		values := []any{cc.Value}
+		if f.Operator == internal.FilterIn {
+			list, ok := cc.Value.([]any)
+			if !ok {
+				return set, fmt.Errorf("the value of %s[in] must be an array", cc.Field)
+			}
+			values = list
+		}
+		for _, value := range values {
+			if value, err = fieldValue(f.Field, value); err != nil {
+				return
+			}
+			f.Values = append(f.Values, value)
+		}
+		if err = f.Validate(); err != nil {
+			return
+		}
+		set.match = append(set.match, f)
+	}
+
+	// fields
+	for name := range sc.Fields {
+		if !internal.VehicleField(name).Valid() {
+			return set, fmt.Errorf("unknown field %q", name)
+		}
+	}
+	for _, field := range internal.VehicleFields {
+		fc, ok := sc.Fields[string(field)]
+		if !ok {
+			continue
+		}
+		fr := fieldRules{field: field, required: fc.Required != nil && *fc.Required, min: fc.Min, max: fc.Max}
+		numeric := field.Kind() != internal.FieldKindString
+		if (fc.Min != nil || fc.Max != nil) && !numeric {
+			return set, fmt.Errorf("%s: min and max need a numeric field", field)
+		}
+		for _, value := range fc.Enum {
+			if value, err = fieldValue(field, value); err != nil {
+				return
+			}
+			fr.enum = append(fr.enum, value)
+		}
+		if fc.Regex != "" {
+			if numeric {
+				return set, fmt.Errorf("%s: regex needs a text field", field)
+			}
+			if fr.regex, err = regexp.Compile(fc.Regex); err != nil {
+				return set, fmt.Errorf("%s: %w", field, err)
+			}
+		}
+		set.fields = append(set.fields, fr)
+	}
+
+	// rules between fields
+	for _, cc := range sc.Compare {
+		cr := compareRule{
+			field:    internal.VehicleField(cc.Field),
+			operator: internal.FilterOperator(cc.Operator),
+			other:    internal.VehicleField(cc.Other),
+		}
+		switch {
+		case !cr.field.Valid():
+			return set, fmt.Errorf("unknown field %q", cc.Field)
+		case !cr.other.Valid():
+			return set, fmt.Errorf("unknown field %q", cc.Other)
+		case operatorDescriptions[cr.operator] == "":
+			return set, fmt.Errorf("unknown operator %q", cc.Operator)
+		case (cr.field.Kind() == internal.FieldKindString) != (cr.other.Kind() == internal.FieldKindString):
+			return set, fmt.Errorf("%s and %s can not be compared", cc.Field, cc.Other)
+		}
+		set.compare = append(set.compare, cr)
+	}
+	return
+}
+
+// fieldValue is a function that converts a value decoded from JSON to the kind of a field
+func fieldValue(field internal.VehicleField, value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if field.Kind() == internal.FieldKindString {
+			return v, nil
+		}
+	case float64:
+		switch field.Kind() {
+		case internal.FieldKindFloat:
+			return v, nil
+		case internal.FieldKindInt:
+			if v == float64(int(v)) {
+				return int(v), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid value %v for %s", value, field)
+}
+
+// isZero is a function that returns if the value of a field is missing
+func isZero(value any) bool {
+	switch v := value.(type) {
+	case string:
+		return v == ""
+	case int:
+		return v == 0
+	case float64:
+		return v == 0
+	}
+	return true
+}
+
+// formatNumber is a function that formats a limit without trailing zeros
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
@@ -0,0 +1,116 @@
+package validator
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// defaultVehicleRules is the configuration of the rules used when there is no rules file
+//
+//go:embed vehicle_rules_default.json
+var defaultVehicleRules []byte
+
+// currentYear is the value of a limit that is the year of the validation
+const currentYear = "current_year"
+
+// VehicleRulesConfig is a struct that represents the configuration of the validation rules, in JSON format
+type VehicleRulesConfig struct {
+	// RuleSets are the rule sets, one per category of vehicles. A vehicle is checked against the first one it matches
+	RuleSets []RuleSetConfig `json:"rule_sets"`
+}
+
+// RuleSetConfig is a struct that represents the rules of a category of vehicles
+type RuleSetConfig struct {
+	// Name is the name of the category
+	Name string `json:"name"`
+	// Extends is the name of another rule set whose rules are inherited. The rules of this one replace them
+	Extends string `json:"extends,omitempty"`
+	// Match are the conditions that select the vehicles of the category, all of them. Without conditions
+	// the rule set matches any vehicle
+	Match []ConditionConfig `json:"match,omitempty"`
+	// Fields are the rules of each field, by its JSON name
+	Fields map[string]FieldRulesConfig `json:"fields,omitempty"`
+	// Compare are the rules between two fields
+	Compare []CompareRuleConfig `json:"compare,omitempty"`
+}
+
+// ConditionConfig is a struct that represents a condition of a rule set, e.g. {"field": "passengers", "operator": "gt", "value": 9}
+// The operators are the ones of the queries, and "in" takes an array
+type ConditionConfig struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    any    `json:"value"`
+}
+
+// FieldRulesConfig is a struct that represents the rules of a field
+// Missing fields are only reported by Required; the other rules check the fields that have a value
+type FieldRulesConfig struct {
+	// Required makes the field mandatory
+	Required *bool `json:"required,omitempty"`
+	// Min is the least value of a numeric field
+	Min *Limit `json:"min,omitempty"`
+	// Max is the greatest value of a numeric field
+	Max *Limit `json:"max,omitempty"`
+	// Enum are the allowed values
+	Enum []any `json:"enum,omitempty"`
+	// Regex is a regular expression that a text field must match
+	Regex string `json:"regex,omitempty"`
+}
+
+// CompareRuleConfig is a struct that represents a rule between two fields, e.g. {"field": "length", "operator": "gte", "other": "width"}
+type CompareRuleConfig struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Other    string `json:"other"`
+}
+
+// Limit is a bound of a numeric field: a number or "current_year"
+type Limit struct {
+	// Value is the number
+	Value float64
+	// CurrentYear is true when the bound is the year of the validation
+	CurrentYear bool
+}
+
+// UnmarshalJSON is a method that reads a limit from a number or the text "current_year"
+func (l *Limit) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		if s != currentYear {
+			return fmt.Errorf("invalid limit %q, it must be a number or %q", s, currentYear)
+		}
+		*l = Limit{CurrentYear: true}
+		return nil
+	}
+	return json.Unmarshal(b, &l.Value)
+}
+
+// String is a method that returns the limit as it is written in the configuration
+func (l Limit) String() string {
+	if l.CurrentYear {
+		return currentYear
+	}
+	return formatNumber(l.Value)
+}
+
+// LoadVehicleRulesFile is a function that reads the configuration of the validation rules from a JSON file
+func LoadVehicleRulesFile(path string) (c VehicleRulesConfig, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &c); err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return
+}
+
+// DefaultVehicleRulesConfig is a function that returns the configuration of the default validation rules
+func DefaultVehicleRulesConfig() (c VehicleRulesConfig) {
+	if err := json.Unmarshal(defaultVehicleRules, &c); err != nil {
+		panic(fmt.Sprintf("invalid default vehicle rules: %v", err))
+	}
+	return
+}
@@ -0,0 +1,152 @@
+package validator
+
+import (
+	"app/internal"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// validVehicle is a function that returns a vehicle that satisfies the default rules
+func validVehicle() internal.Vehicle {
+	return internal.Vehicle{
+		Id: 1,
+		VehicleAttributes: internal.VehicleAttributes{
+			Brand:           "Ford",
+			Model:           "Fiesta",
+			Registration:    "ABC-123",
+			Color:           "red",
+			FabricationYear: 2010,
+			Capacity:        5,
+			MaxSpeed:        180,
+			FuelType:        "gasoline",
+			Transmission:    "manual",
+			Weight:          120,
+			Dimensions:      internal.Dimensions{Height: 150, Length: 400, Width: 180},
+		},
+	}
+}
+
+// violations is a function that returns the field and rule of each violation of a validation error
+func violations(t *testing.T, err error) (v [][2]string) {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var validationErr *internal.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	for _, violation := range validationErr.Violations {
+		v = append(v, [2]string{violation.Field, violation.Rule})
+	}
+	return
+}
+
+func TestVehicleRules_Default(t *testing.T) {
+	r := NewDefaultVehicleRules()
+	r.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	cases := []struct {
+		name     string
+		change   func(v *internal.Vehicle)
+		expected [][2]string
+	}{
+		{name: "valid", change: func(v *internal.Vehicle) {}},
+		{name: "width is not limited to 0", change: func(v *internal.Vehicle) { v.Width = 200 }},
+		{
+			name: "every violation",
+			change: func(v *internal.Vehicle) {
+				v.Brand, v.FabricationYear, v.Capacity, v.Width = "", 2025, 7, 600
+			},
+			expected: [][2]string{
+				{"brand", internal.RuleRequired},
+				{"year", internal.RuleMax},
+				{"passengers", internal.RuleMax},
+				{"width", internal.RuleMax},
+				{"length", internal.RuleCompare},
+			},
+		},
+		{
+			name:     "length shorter than width",
+			change:   func(v *internal.Vehicle) { v.Length = 100 },
+			expected: [][2]string{{"length", internal.RuleCompare}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := validVehicle()
+			c.change(&v)
+			got := violations(t, r.Validate(v))
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestVehicleRules_Categories(t *testing.T) {
+	c, err := LoadVehicleRulesFile("../../docs/validation/vehicle_rules.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewVehicleRules(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a bus inherits the rules of a car, with its own limits
+	bus := validVehicle()
+	bus.Capacity, bus.Weight, bus.Length, bus.Width, bus.MaxSpeed = 50, 12000, 1200, 250, 100
+	if got := violations(t, r.Validate(bus)); got != nil {
+		t.Errorf("expected a valid bus, got %v", got)
+	}
+	bus.MaxSpeed, bus.Registration = 150, "BUS/1"
+	expected := [][2]string{{"registration", internal.RuleRegex}, {"max_speed", internal.RuleMax}}
+	if got := violations(t, r.Validate(bus)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// only the rules of the fields asked for
+	if got := violations(t, r.ValidateFields(bus, internal.VehicleFieldMaxSpeed)); !reflect.DeepEqual(got, expected[1:]) {
+		t.Errorf("expected %v, got %v", expected[1:], got)
+	}
+
+	// a truck has an enum of its own
+	truck := validVehicle()
+	truck.Weight, truck.Capacity, truck.MaxSpeed = 8000, 2, 120
+	expected = [][2]string{{"fuel_type", internal.RuleEnum}}
+	if got := violations(t, r.Validate(truck)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestNewVehicleRules_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"no rule sets":    `{"rule_sets": []}`,
+		"unknown field":   `{"rule_sets": [{"name": "a", "fields": {"wheels": {"required": true}}}]}`,
+		"min of text":     `{"rule_sets": [{"name": "a", "fields": {"brand": {"min": 1}}}]}`,
+		"regex of number": `{"rule_sets": [{"name": "a", "fields": {"weight": {"regex": "1"}}}]}`,
+		"bad regex":       `{"rule_sets": [{"name": "a", "fields": {"brand": {"regex": "("}}}]}`,
+		"enum kind":       `{"rule_sets": [{"name": "a", "fields": {"passengers": {"enum": ["one"]}}}]}`,
+		"unknown extends": `{"rule_sets": [{"name": "a", "extends": "b"}]}`,
+		"extends cycle":   `{"rule_sets": [{"name": "a", "extends": "b"}, {"name": "b", "extends": "a"}]}`,
+		"match operator":  `{"rule_sets": [{"name": "a", "match": [{"field": "weight", "operator": "like", "value": 1}]}]}`,
+		"compare kinds":   `{"rule_sets": [{"name": "a", "compare": [{"field": "brand", "operator": "eq", "other": "weight"}]}]}`,
+	}
+
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			var c VehicleRulesConfig
+			if err := json.Unmarshal([]byte(config), &c); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewVehicleRules(c); !errors.Is(err, ErrInvalidRules) {
+				t.Errorf("expected ErrInvalidRules, got %v", err)
+			}
+		})
+	}
+}
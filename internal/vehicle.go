@@ -1,5 +1,7 @@
 package internal
 
+import "strings"
+
 // Dimensions is a struct that represents a dimension in 3d
 type Dimensions struct {
 	// Height is the height of the dimension
@@ -40,7 +42,17 @@ type VehicleAttributes struct {
 type Vehicle struct {
 	// Id is the unique identifier of the vehicle
 	Id int
+	// Version is the version of the vehicle: 1 when it is added, incremented by every change
+	Version int
+	// Deletion is when and why the vehicle was deleted, nil unless it is in the trash
+	Deletion *VehicleDeletion
 
 	// VehicleAttribue is the attributes of a vehicle
 	VehicleAttributes
 }
+
+// NormalizeRegistration is a function that returns the normalized form of a registration: without spaces
+// and in upper case. Registrations with the same normalized form are the same registration
+func NormalizeRegistration(registration string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(registration), ""))
+}
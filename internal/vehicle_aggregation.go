@@ -0,0 +1,341 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AggregateFunc is the function of a metric of an aggregation
+type AggregateFunc string
+
+const (
+	// AggregateCount is the number of vehicles
+	AggregateCount AggregateFunc = "count"
+	// AggregateSum is the sum of the values of a field
+	AggregateSum AggregateFunc = "sum"
+	// AggregateMin is the least value of a field
+	AggregateMin AggregateFunc = "min"
+	// AggregateMax is the greatest value of a field
+	AggregateMax AggregateFunc = "max"
+	// AggregateAvg is the average of the values of a field
+	AggregateAvg AggregateFunc = "avg"
+	// AggregateMedian is the median of the values of a field
+	AggregateMedian AggregateFunc = "median"
+	// AggregatePercentile is a percentile of the values of a field
+	AggregatePercentile AggregateFunc = "percentile"
+)
+
+// GroupFields are the fields that vehicles can be grouped by in an aggregation
+var GroupFields = []VehicleField{
+	VehicleFieldBrand,
+	VehicleFieldModel,
+	VehicleFieldFuelType,
+	VehicleFieldFabricationYear,
+	VehicleFieldColor,
+	VehicleFieldTransmission,
+}
+
+// VehicleMetric is a struct that represents a metric of an aggregation, e.g. the average max speed
+type VehicleMetric struct {
+	// Func is the function of the metric
+	Func AggregateFunc
+	// Field is the numeric field the function is applied to. AggregateCount has no field
+	Field VehicleField
+	// Percentile is the percentile of AggregatePercentile, from 0 to 100
+	Percentile float64
+}
+
+// ParseVehicleMetric is a function that parses a metric written as count, fn(field) with fn in sum, min, max, avg
+// and median, or pN(field) for the percentile N, e.g. p90(max_speed) or p99.5(weight)
+func ParseVehicleMetric(s string) (m VehicleMetric, err error) {
+	if s == string(AggregateCount) {
+		m.Func = AggregateCount
+		return
+	}
+
+	i := strings.Index(s, "(")
+	if i < 0 || !strings.HasSuffix(s, ")") {
+		err = fmt.Errorf("%w: metric %q must be count or fn(field)", ErrInvalidQuery, s)
+		return
+	}
+	fn := s[:i]
+	m.Field = VehicleField(s[i+1 : len(s)-1])
+	m.Func = AggregateFunc(fn)
+	if m.Func == AggregatePercentile {
+		err = fmt.Errorf("%w: metric %q must be written as pN(field)", ErrInvalidQuery, s)
+		return
+	}
+	if strings.HasPrefix(fn, "p") && fn != "p" {
+		if p, errParse := strconv.ParseFloat(fn[1:], 64); errParse == nil {
+			m.Func, m.Percentile = AggregatePercentile, p
+		}
+	}
+
+	err = m.Validate()
+	return
+}
+
+// String is a method that returns the metric in the format read by ParseVehicleMetric
+func (m VehicleMetric) String() string {
+	switch m.Func {
+	case AggregateCount:
+		return string(AggregateCount)
+	case AggregatePercentile:
+		return "p" + strconv.FormatFloat(m.Percentile, 'f', -1, 64) + "(" + string(m.Field) + ")"
+	}
+	return string(m.Func) + "(" + string(m.Field) + ")"
+}
+
+// Validate is a method that checks that the function exists and is applied to a numeric field
+func (m VehicleMetric) Validate() error {
+	switch m.Func {
+	case AggregateCount:
+		return nil
+	case AggregateSum, AggregateMin, AggregateMax, AggregateAvg, AggregateMedian:
+	case AggregatePercentile:
+		if m.Percentile < 0 || m.Percentile > 100 || math.IsNaN(m.Percentile) {
+			return fmt.Errorf("%w: percentile of %s must be between 0 and 100", ErrInvalidQuery, m)
+		}
+	default:
+		return fmt.Errorf("%w: unknown aggregate function %q", ErrInvalidQuery, m.Func)
+	}
+	if !m.Field.Valid() {
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, m.Field)
+	}
+	if m.Field.Kind() == FieldKindString {
+		return fmt.Errorf("%w: %s needs a numeric field", ErrInvalidQuery, m)
+	}
+	return nil
+}
+
+// Quantile is a method that returns the quantile (from 0 to 1) of the median and percentile metrics
+func (m VehicleMetric) Quantile() (q float64, ok bool) {
+	switch m.Func {
+	case AggregateMedian:
+		return 0.5, true
+	case AggregatePercentile:
+		return m.Percentile / 100, true
+	}
+	return 0, false
+}
+
+// VehicleAggregation is a struct that represents an aggregation of the vehicles: filters, groups and metrics
+type VehicleAggregation struct {
+	// Filters are the conditions that the aggregated vehicles satisfy, all of them
+	Filters []VehicleFilter
+	// GroupBy are the fields the vehicles are grouped by, in order (see GroupFields). Without them there is a
+	// single group
+	GroupBy []VehicleField
+	// Metrics are the metrics computed for each group
+	Metrics []VehicleMetric
+}
+
+// Validate is a method that checks the filters, the groups and the metrics of the aggregation
+func (a VehicleAggregation) Validate() error {
+	for _, f := range a.Filters {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateGroupBy(a.GroupBy); err != nil {
+		return err
+	}
+	if len(a.Metrics) == 0 {
+		return fmt.Errorf("%w: at least one metric is required", ErrInvalidQuery)
+	}
+	for _, m := range a.Metrics {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VehicleGroup is a struct that represents a group of vehicles of an aggregation and its metrics
+type VehicleGroup struct {
+	// Keys are the values of the fields the vehicles are grouped by, in the order of GroupBy
+	Keys []any
+	// Values are the values of the metrics, in the order of Metrics
+	Values []float64
+}
+
+// CompareGroupKeys is a function that compares the keys of two groups, field by field
+func CompareGroupKeys(a, b []any) int {
+	for i := range a {
+		if c := CompareValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// QuantileValue is a function that returns the quantile q (from 0 to 1) of n sorted values, interpolated
+// linearly between lo, the value at the position floor(q*(n-1)), and hi, the next value (if any)
+func QuantileValue(q float64, n int, lo, hi float64) float64 {
+	pos := q * float64(n-1)
+	frac := pos - math.Floor(pos)
+	if frac == 0 {
+		return lo
+	}
+	return lo + frac*(hi-lo)
+}
+
+// QuantileIndex is a function that returns the position of lo (see QuantileValue) in n sorted values
+func QuantileIndex(q float64, n int) int {
+	return int(q * float64(n-1))
+}
+
+// NewVehicleAggregator is a function that returns a new instance of VehicleAggregator for a valid aggregation
+func NewVehicleAggregator(a VehicleAggregation) *VehicleAggregator {
+	return &VehicleAggregator{a: a, groups: make(map[string]*groupState)}
+}
+
+// VehicleAggregator is a struct that computes an aggregation in a single pass over the vehicles, for the
+// repositories that can not push it down to their storage
+type VehicleAggregator struct {
+	// a is the aggregation
+	a VehicleAggregation
+	// groups are the states of the groups by their keys
+	groups map[string]*groupState
+}
+
+// groupState is a struct that represents the partial metrics of a group
+type groupState struct {
+	// keys are the values of the fields of the group
+	keys []any
+	// count is the number of vehicles
+	count int
+	// sum, min and max are the partial metrics by the index of the metric
+	sum, min, max []float64
+	// values are the values of the fields of the median and percentile metrics
+	values map[VehicleField][]float64
+}
+
+// Add is a method that adds a vehicle (that satisfies the filters) to its group
+func (ag *VehicleAggregator) Add(v Vehicle) {
+	keys, key := groupKeys(v, ag.a.GroupBy)
+	g, ok := ag.groups[key]
+	if !ok {
+		n := len(ag.a.Metrics)
+		g = &groupState{keys: keys, sum: make([]float64, n), min: make([]float64, n), max: make([]float64, n)}
+		ag.groups[key] = g
+	}
+
+	g.count++
+	for i, m := range ag.a.Metrics {
+		if m.Func == AggregateCount {
+			continue
+		}
+		value := toFloat(m.Field.Value(v))
+		if _, ok := m.Quantile(); ok {
+			if g.values == nil {
+				g.values = make(map[VehicleField][]float64)
+			}
+			if !ag.collected(i) {
+				g.values[m.Field] = append(g.values[m.Field], value)
+			}
+			continue
+		}
+		g.sum[i] += value
+		if g.count == 1 || value < g.min[i] {
+			g.min[i] = value
+		}
+		if g.count == 1 || value > g.max[i] {
+			g.max[i] = value
+		}
+	}
+}
+
+// collected is a method that returns if an earlier quantile metric collects the values of the field of metric i
+func (ag *VehicleAggregator) collected(i int) bool {
+	for _, m := range ag.a.Metrics[:i] {
+		if _, ok := m.Quantile(); ok && m.Field == ag.a.Metrics[i].Field {
+			return true
+		}
+	}
+	return false
+}
+
+// Groups is a method that returns the groups of the vehicles added, sorted by their keys
+// Only groups with vehicles are returned, so there are none when no vehicle was added
+func (ag *VehicleAggregator) Groups() (groups []VehicleGroup) {
+	groups = make([]VehicleGroup, 0, len(ag.groups))
+	for _, g := range ag.groups {
+		for _, values := range g.values {
+			sort.Float64s(values)
+		}
+
+		group := VehicleGroup{Keys: g.keys, Values: make([]float64, 0, len(ag.a.Metrics))}
+		for i, m := range ag.a.Metrics {
+			var value float64
+			switch m.Func {
+			case AggregateCount:
+				value = float64(g.count)
+			case AggregateSum:
+				value = g.sum[i]
+			case AggregateMin:
+				value = g.min[i]
+			case AggregateMax:
+				value = g.max[i]
+			case AggregateAvg:
+				value = g.sum[i] / float64(g.count)
+			default:
+				q, _ := m.Quantile()
+				values := g.values[m.Field]
+				j := QuantileIndex(q, len(values))
+				hi := values[j]
+				if j+1 < len(values) {
+					hi = values[j+1]
+				}
+				value = QuantileValue(q, len(values), values[j], hi)
+			}
+			group.Values = append(group.Values, value)
+		}
+		groups = append(groups, group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return CompareGroupKeys(groups[i].Keys, groups[j].Keys) < 0
+	})
+	return
+}
+
+// validateGroupBy is a function that checks that vehicles can be grouped by the fields, each one once
+func validateGroupBy(groupBy []VehicleField) error {
+	for i, g := range groupBy {
+		if !isGroupField(g) {
+			return fmt.Errorf("%w: vehicles can not be grouped by %q", ErrInvalidQuery, g)
+		}
+		for _, prev := range groupBy[:i] {
+			if g == prev {
+				return fmt.Errorf("%w: vehicles are grouped by %q twice", ErrInvalidQuery, g)
+			}
+		}
+	}
+	return nil
+}
+
+// groupKeys is a function that returns the values of the fields a vehicle is grouped by and the key of the group
+func groupKeys(v Vehicle, groupBy []VehicleField) (keys []any, key string) {
+	keys = make([]any, 0, len(groupBy))
+	var b strings.Builder
+	for _, g := range groupBy {
+		value := g.Value(v)
+		keys = append(keys, value)
+		fmt.Fprintf(&b, "%v\x00", value)
+	}
+	return keys, b.String()
+}
+
+// isGroupField is a function that returns if vehicles can be grouped by a field
+func isGroupField(f VehicleField) bool {
+	for _, g := range GroupFields {
+		if f == g {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrInvalidBatchMode is the error returned when a batch mode is unknown
+	ErrInvalidBatchMode = errors.New("invalid batch mode")
+)
+
+// BatchMode is the way a batch of vehicles is added when some of them can not be added
+type BatchMode string
+
+const (
+	// BatchModeAtomic adds every vehicle of the batch or none of them
+	BatchModeAtomic BatchMode = "atomic"
+	// BatchModeBestEffort adds the vehicles that can be added and skips the rest
+	BatchModeBestEffort BatchMode = "best_effort"
+)
+
+// Valid is a method that returns if the batch mode exists
+func (m BatchMode) Valid() bool {
+	return m == BatchModeAtomic || m == BatchModeBestEffort
+}
+
+// VehicleBatchError is the error returned when some vehicles of a batch can not be added
+// It wraps the error of each of them, so errors.Is matches any of them
+type VehicleBatchError struct {
+	// Errors is the error of each vehicle that can not be added, by its index in the batch
+	Errors map[int]error
+}
+
+// Error is a method that returns the description of the error
+func (e *VehicleBatchError) Error() string {
+	indexes := e.Indexes()
+	if len(indexes) == 1 {
+		return fmt.Sprintf("vehicle %d of the batch: %v", indexes[0], e.Errors[indexes[0]])
+	}
+	return fmt.Sprintf("%d vehicles of the batch can not be added, the first one %d: %v",
+		len(indexes), indexes[0], e.Errors[indexes[0]])
+}
+
+// Unwrap is a method that returns the error of each vehicle, in the order of the batch
+func (e *VehicleBatchError) Unwrap() []error {
+	indexes := e.Indexes()
+	errs := make([]error, 0, len(indexes))
+	for _, i := range indexes {
+		errs = append(errs, e.Errors[i])
+	}
+	return errs
+}
+
+// Indexes is a method that returns the indexes of the vehicles that can not be added, sorted
+func (e *VehicleBatchError) Indexes() []int {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
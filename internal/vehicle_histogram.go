@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// HistogramMode is the way the buckets of a histogram are bounded
+type HistogramMode string
+
+const (
+	// HistogramFixed are buckets of the same width, from the least to the greatest value
+	HistogramFixed HistogramMode = "fixed"
+	// HistogramQuantile are buckets with about the same number of values, bounded by quantiles
+	HistogramQuantile HistogramMode = "quantile"
+)
+
+const (
+	// DefaultHistogramBuckets is the number of buckets of a histogram when it is not set
+	DefaultHistogramBuckets = 10
+	// MaxHistogramBuckets is the maximum number of buckets of a histogram
+	MaxHistogramBuckets = 1000
+)
+
+// VehicleHistogram is a struct that represents a histogram of a numeric field of the vehicles
+type VehicleHistogram struct {
+	// Filters are the conditions that the vehicles of the histogram satisfy, all of them
+	Filters []VehicleFilter
+	// Field is the numeric field whose values are counted
+	Field VehicleField
+	// GroupBy are the fields the vehicles are grouped by, with a histogram for each group (see GroupFields)
+	GroupBy []VehicleField
+	// Mode is the way the buckets are bounded (HistogramFixed by default)
+	Mode HistogramMode
+	// Buckets is the number of buckets (DefaultHistogramBuckets by default). Buckets with the same bounds are
+	// merged, so there may be fewer
+	Buckets int
+	// Width is the width of the buckets of HistogramFixed, aligned to its multiples. When it is set the number
+	// of buckets depends on the values
+	Width float64
+}
+
+// Validate is a method that checks the filters, the field, the groups and the buckets of the histogram
+func (h VehicleHistogram) Validate() error {
+	for _, f := range h.Filters {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	if !h.Field.Valid() {
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, h.Field)
+	}
+	if h.Field.Kind() == FieldKindString {
+		return fmt.Errorf("%w: the histogram needs a numeric field, not %s", ErrInvalidQuery, h.Field)
+	}
+	if err := validateGroupBy(h.GroupBy); err != nil {
+		return err
+	}
+	switch h.Mode {
+	case "", HistogramFixed:
+	case HistogramQuantile:
+		if h.Width != 0 {
+			return fmt.Errorf("%w: the width is only for %s buckets", ErrInvalidQuery, HistogramFixed)
+		}
+	default:
+		return fmt.Errorf("%w: unknown histogram mode %q", ErrInvalidQuery, h.Mode)
+	}
+	if h.Buckets < 0 || h.Buckets > MaxHistogramBuckets {
+		return fmt.Errorf("%w: buckets must be between 1 and %d", ErrInvalidQuery, MaxHistogramBuckets)
+	}
+	if h.Width < 0 || math.IsNaN(h.Width) || math.IsInf(h.Width, 0) {
+		return fmt.Errorf("%w: width must be positive", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// HistogramBucket is a struct that represents a bucket of a histogram: the values from Lower to Upper
+// The upper bound is excluded, except in the last bucket
+type HistogramBucket struct {
+	// Lower is the lower bound
+	Lower float64
+	// Upper is the upper bound
+	Upper float64
+	// Count is the number of values in the bucket
+	Count int
+}
+
+// HistogramGroup is a struct that represents the histogram of a group of vehicles
+type HistogramGroup struct {
+	// Keys are the values of the fields the vehicles are grouped by, in the order of GroupBy
+	Keys []any
+	// Count is the number of vehicles
+	Count int
+	// Buckets are the buckets, from the least to the greatest values
+	Buckets []HistogramBucket
+}
+
+// NewHistogramBuilder is a function that returns a new instance of HistogramBuilder for a valid histogram
+func NewHistogramBuilder(h VehicleHistogram) *HistogramBuilder {
+	if h.Mode == "" {
+		h.Mode = HistogramFixed
+	}
+	if h.Buckets == 0 {
+		h.Buckets = DefaultHistogramBuckets
+	}
+	return &HistogramBuilder{h: h, groups: make(map[string]*histogramState)}
+}
+
+// HistogramBuilder is a struct that computes the histograms of a field in a single pass over the vehicles
+// The values are kept by group until the bounds of the buckets are known
+type HistogramBuilder struct {
+	// h is the histogram
+	h VehicleHistogram
+	// groups are the values of the groups by their keys
+	groups map[string]*histogramState
+}
+
+// histogramState is a struct that represents the values of a group of a histogram
+type histogramState struct {
+	// keys are the values of the fields of the group
+	keys []any
+	// values are the values of the field
+	values []float64
+}
+
+// Add is a method that adds a vehicle (that satisfies the filters) to the histogram of its group
+func (hb *HistogramBuilder) Add(v Vehicle) {
+	keys, key := groupKeys(v, hb.h.GroupBy)
+	g, ok := hb.groups[key]
+	if !ok {
+		g = &histogramState{keys: keys}
+		hb.groups[key] = g
+	}
+	g.values = append(g.values, toFloat(hb.h.Field.Value(v)))
+}
+
+// Groups is a method that returns the histograms of the groups of the vehicles added, sorted by their keys
+// It fails with ErrInvalidQuery when a width gives more than MaxHistogramBuckets buckets
+func (hb *HistogramBuilder) Groups() (groups []HistogramGroup, err error) {
+	groups = make([]HistogramGroup, 0, len(hb.groups))
+	for _, g := range hb.groups {
+		sort.Float64s(g.values)
+
+		var bounds []float64
+		switch {
+		case hb.h.Mode == HistogramQuantile:
+			bounds = quantileBounds(g.values, hb.h.Buckets)
+		case hb.h.Width > 0:
+			if bounds, err = widthBounds(g.values, hb.h.Width); err != nil {
+				return
+			}
+		default:
+			bounds = fixedBounds(g.values, hb.h.Buckets)
+		}
+
+		groups = append(groups, HistogramGroup{Keys: g.keys, Count: len(g.values), Buckets: countBuckets(g.values, bounds)})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return CompareGroupKeys(groups[i].Keys, groups[j].Keys) < 0
+	})
+	return
+}
+
+// fixedBounds is a function that returns the bounds of n buckets of the same width for some sorted values
+func fixedBounds(values []float64, n int) []float64 {
+	lo, hi := values[0], values[len(values)-1]
+	if lo == hi {
+		return []float64{lo, hi}
+	}
+	bounds := make([]float64, 0, n+1)
+	width := (hi - lo) / float64(n)
+	for i := 0; i < n; i++ {
+		bounds = append(bounds, lo+float64(i)*width)
+	}
+	return append(bounds, hi)
+}
+
+// widthBounds is a function that returns the bounds of the buckets of a width, aligned to its multiples, that
+// cover some sorted values
+func widthBounds(values []float64, width float64) ([]float64, error) {
+	lo := math.Floor(values[0]/width) * width
+	n := int(math.Floor((values[len(values)-1]-lo)/width)) + 1
+	if n > MaxHistogramBuckets {
+		return nil, fmt.Errorf("%w: a width of %v gives more than %d buckets", ErrInvalidQuery, width, MaxHistogramBuckets)
+	}
+	bounds := make([]float64, 0, n+1)
+	for i := 0; i <= n; i++ {
+		bounds = append(bounds, lo+float64(i)*width)
+	}
+	return bounds, nil
+}
+
+// quantileBounds is a function that returns the bounds of n buckets of some sorted values with about the same
+// number of values, merging the buckets whose bounds are the same
+func quantileBounds(values []float64, n int) []float64 {
+	bounds := make([]float64, 0, n+1)
+	for i := 0; i <= n; i++ {
+		q := float64(i) / float64(n)
+		j := QuantileIndex(q, len(values))
+		hi := values[j]
+		if j+1 < len(values) {
+			hi = values[j+1]
+		}
+		bound := QuantileValue(q, len(values), values[j], hi)
+		if len(bounds) > 0 && bound <= bounds[len(bounds)-1] {
+			continue
+		}
+		bounds = append(bounds, bound)
+	}
+	if len(bounds) == 1 {
+		bounds = append(bounds, bounds[0])
+	}
+	return bounds
+}
+
+// countBuckets is a function that returns the buckets between some bounds with the number of sorted values
+// in each one. The upper bound of the last bucket is included
+func countBuckets(values []float64, bounds []float64) []HistogramBucket {
+	buckets := make([]HistogramBucket, 0, len(bounds)-1)
+	start := 0
+	for i := 1; i < len(bounds); i++ {
+		end := len(values)
+		if i < len(bounds)-1 {
+			end = sort.SearchFloat64s(values, bounds[i])
+		}
+		buckets = append(buckets, HistogramBucket{Lower: bounds[i-1], Upper: bounds[i], Count: end - start})
+		start = end
+	}
+	return buckets
+}
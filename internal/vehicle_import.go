@@ -0,0 +1,74 @@
+package internal
+
+import "fmt"
+
+const (
+	// RuleFormat is the rule of a value of an import that must be of the kind of its field, e.g. a number
+	RuleFormat = "format"
+	// MaxImportRejections is the maximum number of rejected rows described in an ImportReport
+	MaxImportRejections = 1000
+)
+
+// VehicleReader is an interface that represents a reader of the vehicles of an import, e.g. the rows of a CSV file
+type VehicleReader interface {
+	// Read is a method that returns the next vehicle and the row (line) it was read from, or io.EOF at the end
+	// A row that can not be read is an *ImportRowError and the following rows can still be read; any other
+	// error stops the import
+	Read() (v Vehicle, row int, err error)
+}
+
+// ImportRowError is the error of a row of an import that can not be read as a vehicle
+type ImportRowError struct {
+	// Row is the row (line) of the error
+	Row int
+	// Err is the error, a *ValidationError when some values do not have the kind of their field
+	Err error
+}
+
+// Error is a method that returns the description of the error
+func (e *ImportRowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+// Unwrap is a method that returns the error of the row
+func (e *ImportRowError) Unwrap() error {
+	return e.Err
+}
+
+// ImportRejection is a struct that represents a row of an import that is not (or would not be) created
+type ImportRejection struct {
+	// Row is the row (line) of the vehicle
+	Row int
+	// Id is the id of the vehicle, if it was read
+	Id int
+	// Registration is the registration of the vehicle, if it was read
+	Registration string
+	// Err is the reason, a *ValidationError for invalid vehicles
+	Err error
+}
+
+// ImportReport is a struct that represents the result of an import
+type ImportReport struct {
+	// DryRun is true when the vehicles were only checked, and Created is what would be created
+	DryRun bool
+	// Rows is the number of rows read
+	Rows int
+	// Created is the number of vehicles created
+	Created int
+	// Rejected is the number of rows not created
+	Rejected int
+	// Rejections are the first MaxImportRejections rows not created, in order
+	Rejections []ImportRejection
+	// Truncated is true when there are more rejected rows than Rejections
+	Truncated bool
+}
+
+// Reject is a method that counts a rejected row and describes it, up to MaxImportRejections rows
+func (r *ImportReport) Reject(rejection ImportRejection) {
+	r.Rejected++
+	if len(r.Rejections) >= MaxImportRejections {
+		r.Truncated = true
+		return
+	}
+	r.Rejections = append(r.Rejections, rejection)
+}
@@ -0,0 +1,417 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidQuery is the error returned when a query has an unknown field, an unknown operator or an invalid value
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// VehicleField is a field of a vehicle that can be used in queries, named as in the JSON representation
+type VehicleField string
+
+const (
+	// VehicleFieldId is the id of the vehicle
+	VehicleFieldId VehicleField = "id"
+	// VehicleFieldBrand is the brand of the vehicle
+	VehicleFieldBrand VehicleField = "brand"
+	// VehicleFieldModel is the model of the vehicle
+	VehicleFieldModel VehicleField = "model"
+	// VehicleFieldRegistration is the registration of the vehicle
+	VehicleFieldRegistration VehicleField = "registration"
+	// VehicleFieldColor is the color of the vehicle
+	VehicleFieldColor VehicleField = "color"
+	// VehicleFieldFabricationYear is the fabrication year of the vehicle
+	VehicleFieldFabricationYear VehicleField = "year"
+	// VehicleFieldCapacity is the capacity of people of the vehicle
+	VehicleFieldCapacity VehicleField = "passengers"
+	// VehicleFieldMaxSpeed is the maximum speed of the vehicle
+	VehicleFieldMaxSpeed VehicleField = "max_speed"
+	// VehicleFieldFuelType is the fuel type of the vehicle
+	VehicleFieldFuelType VehicleField = "fuel_type"
+	// VehicleFieldTransmission is the transmission of the vehicle
+	VehicleFieldTransmission VehicleField = "transmission"
+	// VehicleFieldWeight is the weight of the vehicle
+	VehicleFieldWeight VehicleField = "weight"
+	// VehicleFieldHeight is the height of the vehicle
+	VehicleFieldHeight VehicleField = "height"
+	// VehicleFieldLength is the length of the vehicle
+	VehicleFieldLength VehicleField = "length"
+	// VehicleFieldWidth is the width of the vehicle
+	VehicleFieldWidth VehicleField = "width"
+)
+
+// VehicleFields is the list of all the fields of a vehicle
+var VehicleFields = []VehicleField{
+	VehicleFieldId,
+	VehicleFieldBrand,
+	VehicleFieldModel,
+	VehicleFieldRegistration,
+	VehicleFieldColor,
+	VehicleFieldFabricationYear,
+	VehicleFieldCapacity,
+	VehicleFieldMaxSpeed,
+	VehicleFieldFuelType,
+	VehicleFieldTransmission,
+	VehicleFieldWeight,
+	VehicleFieldHeight,
+	VehicleFieldLength,
+	VehicleFieldWidth,
+}
+
+// FieldKind is the type of the values of a field
+type FieldKind int
+
+const (
+	// FieldKindString is the kind of the text fields
+	FieldKindString FieldKind = iota
+	// FieldKindInt is the kind of the integer fields
+	FieldKindInt
+	// FieldKindFloat is the kind of the decimal fields
+	FieldKindFloat
+)
+
+// Valid is a method that returns if the field exists
+func (f VehicleField) Valid() bool {
+	for _, field := range VehicleFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Kind is a method that returns the type of the values of the field
+func (f VehicleField) Kind() FieldKind {
+	switch f {
+	case VehicleFieldId, VehicleFieldFabricationYear, VehicleFieldCapacity:
+		return FieldKindInt
+	case VehicleFieldMaxSpeed, VehicleFieldWeight, VehicleFieldHeight, VehicleFieldLength, VehicleFieldWidth:
+		return FieldKindFloat
+	default:
+		return FieldKindString
+	}
+}
+
+// Value is a method that returns the value of the field in a vehicle: a string, an int or a float64 depending on its kind
+func (f VehicleField) Value(v Vehicle) any {
+	switch f {
+	case VehicleFieldId:
+		return v.Id
+	case VehicleFieldBrand:
+		return v.Brand
+	case VehicleFieldModel:
+		return v.Model
+	case VehicleFieldRegistration:
+		return v.Registration
+	case VehicleFieldColor:
+		return v.Color
+	case VehicleFieldFabricationYear:
+		return v.FabricationYear
+	case VehicleFieldCapacity:
+		return v.Capacity
+	case VehicleFieldMaxSpeed:
+		return v.MaxSpeed
+	case VehicleFieldFuelType:
+		return v.FuelType
+	case VehicleFieldTransmission:
+		return v.Transmission
+	case VehicleFieldWeight:
+		return v.Weight
+	case VehicleFieldHeight:
+		return v.Height
+	case VehicleFieldLength:
+		return v.Length
+	case VehicleFieldWidth:
+		return v.Width
+	}
+	return nil
+}
+
+// SetValue is a method that sets the field of a vehicle to a value of its kind
+// Integer values are accepted by decimal fields. Values of another kind are ignored
+func (f VehicleField) SetValue(v *Vehicle, value any) {
+	if !f.Kind().accepts(value) {
+		return
+	}
+	switch f {
+	case VehicleFieldId:
+		v.Id = value.(int)
+	case VehicleFieldBrand:
+		v.Brand = value.(string)
+	case VehicleFieldModel:
+		v.Model = value.(string)
+	case VehicleFieldRegistration:
+		v.Registration = value.(string)
+	case VehicleFieldColor:
+		v.Color = value.(string)
+	case VehicleFieldFabricationYear:
+		v.FabricationYear = value.(int)
+	case VehicleFieldCapacity:
+		v.Capacity = value.(int)
+	case VehicleFieldMaxSpeed:
+		v.MaxSpeed = toFloat(value)
+	case VehicleFieldFuelType:
+		v.FuelType = value.(string)
+	case VehicleFieldTransmission:
+		v.Transmission = value.(string)
+	case VehicleFieldWeight:
+		v.Weight = toFloat(value)
+	case VehicleFieldHeight:
+		v.Height = toFloat(value)
+	case VehicleFieldLength:
+		v.Length = toFloat(value)
+	case VehicleFieldWidth:
+		v.Width = toFloat(value)
+	}
+}
+
+// IsZero is a method that returns if the field of a vehicle has no value
+func (f VehicleField) IsZero(v Vehicle) bool {
+	switch value := f.Value(v).(type) {
+	case string:
+		return value == ""
+	case int:
+		return value == 0
+	case float64:
+		return value == 0
+	}
+	return true
+}
+
+// ParseValue is a method that converts a text to a value of the kind of the field
+func (f VehicleField) ParseValue(s string) (value any, err error) {
+	switch f.Kind() {
+	case FieldKindInt:
+		value, err = strconv.Atoi(s)
+	case FieldKindFloat:
+		value, err = strconv.ParseFloat(s, 64)
+	default:
+		value = s
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %s must be a number", ErrInvalidQuery, f)
+	}
+	return
+}
+
+// FilterOperator is the comparison of a filter
+type FilterOperator string
+
+const (
+	// FilterEq matches values equal to the value of the filter
+	FilterEq FilterOperator = "eq"
+	// FilterNe matches values different from the value of the filter
+	FilterNe FilterOperator = "ne"
+	// FilterGt matches values greater than the value of the filter
+	FilterGt FilterOperator = "gt"
+	// FilterGte matches values greater than or equal to the value of the filter
+	FilterGte FilterOperator = "gte"
+	// FilterLt matches values less than the value of the filter
+	FilterLt FilterOperator = "lt"
+	// FilterLte matches values less than or equal to the value of the filter
+	FilterLte FilterOperator = "lte"
+	// FilterIn matches values equal to any of the values of the filter
+	FilterIn FilterOperator = "in"
+)
+
+// VehicleFilter is a struct that represents a condition over a field of a vehicle
+type VehicleFilter struct {
+	// Field is the field compared
+	Field VehicleField
+	// Operator is the comparison
+	Operator FilterOperator
+	// Values are the values compared with, of the kind of the field. Only FilterIn uses more than one
+	Values []any
+}
+
+// Validate is a method that checks that the field and the operator exist and the values have the kind of the field
+func (f VehicleFilter) Validate() error {
+	if !f.Field.Valid() {
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, f.Field)
+	}
+	switch f.Operator {
+	case FilterEq, FilterNe, FilterGt, FilterGte, FilterLt, FilterLte:
+		if len(f.Values) != 1 {
+			return fmt.Errorf("%w: %s[%s] needs exactly one value", ErrInvalidQuery, f.Field, f.Operator)
+		}
+	case FilterIn:
+		if len(f.Values) == 0 {
+			return fmt.Errorf("%w: %s[%s] needs at least one value", ErrInvalidQuery, f.Field, f.Operator)
+		}
+	default:
+		return fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, f.Operator)
+	}
+	for _, value := range f.Values {
+		if !f.Field.Kind().accepts(value) {
+			return fmt.Errorf("%w: invalid value %v for %s", ErrInvalidQuery, value, f.Field)
+		}
+	}
+	return nil
+}
+
+// Match is a method that returns if a vehicle satisfies the filter
+func (f VehicleFilter) Match(v Vehicle) bool {
+	value := f.Field.Value(v)
+	switch f.Operator {
+	case FilterEq:
+		return CompareValues(value, f.Values[0]) == 0
+	case FilterNe:
+		return CompareValues(value, f.Values[0]) != 0
+	case FilterGt:
+		return CompareValues(value, f.Values[0]) > 0
+	case FilterGte:
+		return CompareValues(value, f.Values[0]) >= 0
+	case FilterLt:
+		return CompareValues(value, f.Values[0]) < 0
+	case FilterLte:
+		return CompareValues(value, f.Values[0]) <= 0
+	case FilterIn:
+		for _, fv := range f.Values {
+			if CompareValues(value, fv) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VehicleSort is a struct that represents a sort key
+type VehicleSort struct {
+	// Field is the field sorted by
+	Field VehicleField
+	// Desc is true to sort from the greatest to the least value
+	Desc bool
+}
+
+// VehicleQuery is a struct that represents a query over the vehicles: filters, order and page
+type VehicleQuery struct {
+	// Filters are the conditions that the vehicles satisfy, all of them
+	Filters []VehicleFilter
+	// Sort are the keys the vehicles are sorted by, in order. Ties are always sorted by id
+	Sort []VehicleSort
+	// Offset is the number of vehicles skipped
+	Offset int
+	// Limit is the maximum number of vehicles returned, 0 returns all of them
+	Limit int
+}
+
+// Validate is a method that checks the filters, the sort keys and the page of the query
+func (q VehicleQuery) Validate() error {
+	for _, f := range q.Filters {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, s := range q.Sort {
+		if !s.Field.Valid() {
+			return fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, s.Field)
+		}
+	}
+	if q.Offset < 0 {
+		return fmt.Errorf("%w: offset must not be negative", ErrInvalidQuery)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// Match is a method that returns if a vehicle satisfies all the filters of the query
+func (q VehicleQuery) Match(v Vehicle) bool {
+	for _, f := range q.Filters {
+		if !f.Match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare is a method that compares two vehicles by the sort keys of the query and then by id
+// It returns a negative number when a goes before b, a positive number when a goes after b, and 0 when they are equal
+func (q VehicleQuery) Compare(a, b Vehicle) int {
+	for _, s := range q.Sort {
+		c := CompareValues(s.Field.Value(a), s.Field.Value(b))
+		if s.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a.Id < b.Id:
+		return -1
+	case a.Id > b.Id:
+		return 1
+	}
+	return 0
+}
+
+// Page is a method that returns the part of the sorted vehicles selected by the offset and the limit of the query
+func (q VehicleQuery) Page(v []Vehicle) []Vehicle {
+	if q.Offset >= len(v) {
+		return v[:0]
+	}
+	v = v[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(v) {
+		v = v[:q.Limit]
+	}
+	return v
+}
+
+// CompareValues is a function that compares two values of the same kind
+// It returns a negative number when a < b, a positive number when a > b and 0 when they are equal
+func CompareValues(a, b any) int {
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	case int:
+		bv := toFloat(b)
+		switch {
+		case float64(av) < bv:
+			return -1
+		case float64(av) > bv:
+			return 1
+		}
+	case float64:
+		bv := toFloat(b)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	}
+	return 0
+}
+
+// toFloat is a function that converts a numeric value to float64
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// accepts is a method that returns if a value has the kind
+// Integer values are accepted by decimal fields
+func (k FieldKind) accepts(value any) bool {
+	switch value.(type) {
+	case string:
+		return k == FieldKindString
+	case int:
+		return k == FieldKindInt || k == FieldKindFloat
+	case float64:
+		return k == FieldKindFloat
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package internal
+
+// VehicleRecord is a struct that represents a record of a file of vehicles, as it is read
+type VehicleRecord struct {
+	// Path is the path of the file
+	Path string
+	// Row is the row of the record: its line for CSV and NDJSON, its position (from 1) in the sequence of vehicles
+	// for JSON and YAML
+	Row int
+	// Vehicle is the vehicle of the record, when it can be read
+	Vehicle Vehicle
+	// Err is the error of a record that can not be read as a vehicle, a *ValidationError when some values do not
+	// have the kind of their field
+	Err error
+}
+
+// VehicleRecordLoader is an interface that represents a loader that also reads the vehicles record by record,
+// keeping the records with the same id and the ones that can not be read
+type VehicleRecordLoader interface {
+	VehicleLoader
+	// Records is a method that calls fn with every record, in the order of the files. It stops with the first
+	// error of fn or of the files (other than the errors of the records) and returns it
+	Records(fn func(r VehicleRecord) error) (err error)
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+)
+
+// VehicleDiff is a struct that represents the changes from the vehicles of a repository to a new set of vehicles,
+// e.g. a seed file that was edited
+type VehicleDiff struct {
+	// Added are the vehicles whose ids are not in the repository, sorted by id
+	Added []Vehicle
+	// Updated are the vehicles whose attributes changed, at the version after the current one, sorted by id
+	Updated []Vehicle
+	// Deleted are the ids of the vehicles that are not in the new set, which are moved to the trash, sorted
+	Deleted []int
+}
+
+// ReloadCheck is a function that checks the changes of a reload before they are applied, given the current
+// vehicles, which it must not change. It may replace the added and updated vehicles, keeping their ids and
+// versions, and an error rejects the whole reload
+type ReloadCheck func(current map[int]Vehicle, d *VehicleDiff) error
+
+// ReloadDeletionReason is the reason of the deletion of the vehicles that a reload moves to the trash
+const ReloadDeletionReason = "reload"
+
+// Empty is a method that returns if there are no changes
+func (d VehicleDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Updated) == 0 && len(d.Deleted) == 0
+}
+
+// DiffVehicles is a function that returns the changes from the current vehicles to the next ones, by id
+// The vehicles whose attributes are the same are not changed, so they keep their version. The added vehicles keep
+// their version (1 when they have none). The vehicles of next marked as deleted are deleted, and the ones with
+// the ids of the vehicles of the trash are ignored, so a reload does not bring back a deleted vehicle
+func DiffVehicles(current, next, trash map[int]Vehicle) (d VehicleDiff) {
+	for id, v := range next {
+		if _, ok := trash[id]; ok || v.Deleted() {
+			continue
+		}
+		old, ok := current[id]
+		switch {
+		case !ok:
+			if v.Version == 0 {
+				v.Version = 1
+			}
+			d.Added = append(d.Added, v)
+		case old.VehicleAttributes != v.VehicleAttributes:
+			v.Version = old.Version + 1
+			d.Updated = append(d.Updated, v)
+		}
+	}
+	for id := range current {
+		if v, ok := next[id]; !ok || v.Deleted() {
+			d.Deleted = append(d.Deleted, id)
+		}
+	}
+
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].Id < d.Added[j].Id })
+	sort.Slice(d.Updated, func(i, j int) bool { return d.Updated[i].Id < d.Updated[j].Id })
+	sort.Ints(d.Deleted)
+	return
+}
+
+// VehicleReloadError is the error returned when some vehicles added or changed by a reload do not pass the checks
+// of the vehicles that are added or updated, so nothing is reloaded
+// It wraps the error of each of them, so errors.Is matches any of them
+type VehicleReloadError struct {
+	// Errors is the error of each vehicle that can not be reloaded, by its id
+	Errors map[int]error
+}
+
+// Error is a method that returns the description of the error
+func (e *VehicleReloadError) Error() string {
+	ids := e.Ids()
+	if len(ids) == 1 {
+		return fmt.Sprintf("reload rejected, vehicle %d: %v", ids[0], e.Errors[ids[0]])
+	}
+	return fmt.Sprintf("reload rejected, %d vehicles can not be reloaded, the first one %d: %v",
+		len(ids), ids[0], e.Errors[ids[0]])
+}
+
+// Unwrap is a method that returns the error of each vehicle, in the order of their ids
+func (e *VehicleReloadError) Unwrap() []error {
+	ids := e.Ids()
+	errs := make([]error, 0, len(ids))
+	for _, id := range ids {
+		errs = append(errs, e.Errors[id])
+	}
+	return errs
+}
+
+// Ids is a method that returns the ids of the vehicles that can not be reloaded, sorted
+func (e *VehicleReloadError) Ids() []int {
+	ids := make([]int, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -1,6 +1,9 @@
 package internal
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	// ErrVehicleIdAlreadyExists is the error returned when a vehicle id already exists
@@ -11,13 +14,20 @@ var (
 	ErrVehiclesNotFound = errors.New("vehicles not found")
 	// ErrVehicleIdNotFound is the error returned when a vehicle registration already exists
 	ErrVehicleIdNotFound = errors.New("vehicle not found")
+	// ErrVehicleVersionMismatch is the error returned when a vehicle changed since the version expected by a change
+	ErrVehicleVersionMismatch = errors.New("vehicle version mismatch")
 )
 
 // VehicleRepository is an interface that represents a vehicle repository
 type VehicleRepository interface {
 	// FindAll is a method that returns a map of all vehicles
 	FindAll() (v map[int]Vehicle, err error)
-	// Add is a method that adds a new vehicle to the repository
+	// GetById is a method that returns the vehicle with an id, or ErrVehicleIdNotFound
+	GetById(id int) (v Vehicle, err error)
+	// GetByRegistration is a method that returns the vehicle with a registration, compared in its normalized form
+	// (see NormalizeRegistration), or ErrVehicleIdNotFound. If several vehicles match, the one with the lowest id
+	GetByRegistration(registration string) (v Vehicle, err error)
+	// Add is a method that adds a new vehicle to the repository, at version 1
 	Add(v *Vehicle) (err error)
 	// GetByColorAndYear is a method that returns a map of vehicles with a specific color and year
 	GetByColorAndYear(color string, year int) (v map[int]Vehicle, err error)
@@ -26,16 +36,54 @@ type VehicleRepository interface {
 	GetByBrandAndYears(brand string, startYear, endYear int) (v map[int]Vehicle, err error)
 	// GetByBrand is a method that returns the vehicles of a brand
 	GetByBrand(brand string) (v map[int]Vehicle, err error)
-	// AddBatch is a method that adds a new vehicles to the repository
-	AddBatch(vSlice []*Vehicle) (err error)
+	// AddBatch is a method that adds a new vehicles to the repository, at version 1
+	// A vehicle can not be added if its id or registration is already in the repository or earlier in the batch.
+	// Those are reported in a *VehicleBatchError; in BatchModeAtomic none of the vehicles is added then, and in
+	// BatchModeBestEffort the rest of them are added
+	AddBatch(vSlice []*Vehicle, mode BatchMode) (err error)
 	// UpdateSpeed is a method that updates the speed of a vehicle
-	UpdateSpeed(speed float64, id int) (err error)
+	// If version is not 0 and the vehicle is at another version, it returns ErrVehicleVersionMismatch
+	UpdateSpeed(speed float64, id int, version int) (err error)
+	// Update is a method that replaces the vehicle with the id of v, or returns ErrVehicleIdNotFound
+	// A changed registration must not be the registration of another vehicle
+	// If v.Version is not 0 and the vehicle is at another version, it returns ErrVehicleVersionMismatch.
+	// On success v.Version is the new version
+	Update(v *Vehicle) (err error)
 	// GetByFuelType is a method that returns a map of vehicles with a type of fuel
 	GetByFuelType(fuelType string) (v map[int]Vehicle, err error)
-	// DeleteVehicle is a method that deletes a vehicle
-	DeleteVehicle(id int) (err error)
+	// DeleteVehicle is a method that moves a vehicle to the trash, deleted now for a reason (which may be empty)
+	// The vehicles in the trash are only returned by Trash. Their registrations can be taken by other vehicles, but
+	// their ids can not until they are purged
+	// If version is not 0 and the vehicle is at another version, it returns ErrVehicleVersionMismatch
+	DeleteVehicle(id int, version int, reason string) (err error)
+	// Trash is a method that returns the vehicles in the trash, with their Deletion, sorted by id
+	Trash() (v []Vehicle, err error)
+	// Restore is a method that moves a vehicle from the trash back to the vehicles, at the version after the one it
+	// was deleted at, or returns ErrVehicleIdNotFound. If another vehicle took its registration, it returns
+	// ErrVehicleRegistrationAlreadyExists
+	Restore(id int) (v Vehicle, err error)
+	// Purge is a method that removes for good the vehicles of the trash deleted before a time, and returns how many
+	Purge(before time.Time) (n int, err error)
 	// GetByDimensions is a method that returns vehicles with a specific dimension
 	GetByDimensions(minLength, maxLength, minWidth, maxWidth float64) (v map[int]Vehicle, err error)
 	// GetByWeight is a method that returns vehicles with a specific weight
 	GetByWeight(minWeight, maxWeight float64) (v map[int]Vehicle, err error)
+	// Query is a method that returns the page of vehicles that satisfy the filters of a query, sorted,
+	// and the total number of vehicles that satisfy them. An empty result is not an error
+	Query(q VehicleQuery) (v []Vehicle, total int, err error)
+	// Aggregate is a method that returns the metrics of the groups of the vehicles that satisfy the filters of
+	// an aggregation, sorted by their keys. Only groups with vehicles are returned
+	Aggregate(a VehicleAggregation) (groups []VehicleGroup, err error)
+	// Histogram is a method that returns the histograms of the groups of the vehicles that satisfy the filters of
+	// a histogram, sorted by their keys, computed in a single pass over the vehicles
+	Histogram(h VehicleHistogram) (groups []HistogramGroup, err error)
+	// Stream is a method that calls fn with every vehicle that satisfies the filters, sorted by id, without
+	// holding all of them in memory. It stops with the first error of fn and returns it
+	Stream(filters []VehicleFilter, fn func(v Vehicle) error) (err error)
+	// Reload is a method that replaces all the vehicles with v, atomically, and returns the changes (see
+	// DiffVehicles). The vehicles whose attributes are the same keep their version
+	// The vehicles deleted are moved to the trash with ReloadDeletionReason, and the vehicles of v with the ids of
+	// the vehicles in the trash are ignored: only Restore brings them back
+	// check, when it is not nil, is called with the changes while no other change can happen (see ReloadCheck)
+	Reload(v map[int]Vehicle, check ReloadCheck) (d VehicleDiff, err error)
 }
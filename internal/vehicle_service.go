@@ -1,6 +1,9 @@
 package internal
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	// ErrFieldRequired is an error returned when a field is missing
@@ -15,6 +18,11 @@ var (
 type VehicleService interface {
 	// FindAll is a method that returns a map of all vehicles
 	FindAll() (v map[int]Vehicle, err error)
+	// GetById is a method that returns the vehicle with an id, or ErrVehicleIdNotFound
+	GetById(id int) (v Vehicle, err error)
+	// GetByRegistration is a method that returns the vehicle with a registration, compared in its normalized form
+	// (see NormalizeRegistration), or ErrVehicleIdNotFound. If several vehicles match, the one with the lowest id
+	GetByRegistration(registration string) (v Vehicle, err error)
 	// Add is a method that adds a new vehicle to the repository
 	Add(v *Vehicle) (err error)
 	// GetByColorAndYear is a method that returns a map of vehicles with a specific color and year
@@ -24,18 +32,46 @@ type VehicleService interface {
 	GetByBrandAndYears(brand string, startYear, endYear int) (v map[int]Vehicle, err error)
 	// GetAverageSpeedByBrand is a method that returns the average speed of the vehicles of a brand
 	GetAverageSpeedByBrand(brand string) (s float64, err error)
-	// AddBatch is a method that adds a new vehicles to the repository
-	AddBatch(vSlice []*Vehicle) (err error)
-	// UpdateSpeed is a method that updates the speed of a vehicle
-	UpdateSpeed(speed float64, id int) (err error)
+	// AddBatch is a method that adds a new vehicles to the repository, with the same checks as Add
+	// The vehicles that can not be added are reported in a *VehicleBatchError, see VehicleRepository.AddBatch
+	AddBatch(vSlice []*Vehicle, mode BatchMode) (err error)
+	// UpdateSpeed is a method that updates the speed of a vehicle, if it is at version (0 is any version)
+	UpdateSpeed(speed float64, id int, version int) (err error)
+	// Update is a method that replaces the vehicle with the id of v, with the same checks as Add,
+	// if it is at v.Version (0 is any version)
+	Update(v *Vehicle) (err error)
 	// GetByFuelType is a method that returns a map of vehicles with a type of fuel
 	GetByFuelType(fuelType string) (v map[int]Vehicle, err error)
-	// DeleteVehicle is a method that deletes a vehicle
-	DeleteVehicle(id int) (err error)
+	// DeleteVehicle is a method that moves a vehicle to the trash for a reason, if it is at version (0 is any
+	// version). See VehicleRepository.DeleteVehicle
+	DeleteVehicle(id int, version int, reason string) (err error)
+	// Trash is a method that returns the vehicles in the trash, sorted by id
+	Trash() (v []Vehicle, err error)
+	// Restore is a method that moves a vehicle from the trash back to the vehicles
+	Restore(id int) (v Vehicle, err error)
+	// Purge is a method that removes for good the vehicles of the trash deleted before a time, and returns how many
+	Purge(before time.Time) (n int, err error)
 	// GetAverageCapacityByBrand is a method that returns the average capacity of the vehicles of a brand
 	GetAverageCapacityByBrand(brand string) (ac float64, err error)
 	// GetByDimensions is a method that returns vehicles with a specific dimension
 	GetByDimensions(minLength, maxLength, minWidth, maxWidth float64) (v map[int]Vehicle, err error)
 	// GetByWeight is a method that returns vehicles with a specific weight
 	GetByWeight(minWeight, maxWeight float64) (v map[int]Vehicle, err error)
+	// Query is a method that returns the page of vehicles that satisfy the filters of a query, sorted,
+	// and the total number of vehicles that satisfy them
+	Query(q VehicleQuery) (v []Vehicle, total int, err error)
+	// Aggregate is a method that returns the metrics of the groups of the vehicles that satisfy the filters of
+	// an aggregation, sorted by their keys
+	Aggregate(a VehicleAggregation) (groups []VehicleGroup, err error)
+	// Histogram is a method that returns the histograms of a numeric field of the groups of the vehicles that
+	// satisfy the filters of a histogram, sorted by their keys
+	Histogram(h VehicleHistogram) (groups []HistogramGroup, err error)
+	// Stream is a method that calls fn with every vehicle that satisfies the filters, sorted by id, without
+	// holding all of them in memory. It stops with the first error of fn and returns it
+	Stream(filters []VehicleFilter, fn func(v Vehicle) error) (err error)
+	// Import is a method that adds the vehicles of a reader with the same checks as AddBatch, in best effort mode,
+	// and reports the rows created and rejected. With dryRun the vehicles are only checked
+	Import(r VehicleReader, dryRun bool) (report ImportReport, err error)
+	// Reload is a method that replaces all the vehicles with v, atomically, and returns the changes
+	Reload(v map[int]Vehicle) (d VehicleDiff, err error)
 }
@@ -0,0 +1,16 @@
+package internal
+
+import "time"
+
+// VehicleDeletion is a struct that represents the deletion of a vehicle that is in the trash
+type VehicleDeletion struct {
+	// At is the time of the deletion
+	At time.Time
+	// Reason is the reason of the deletion, if any
+	Reason string
+}
+
+// Deleted is a method that returns if the vehicle is in the trash
+func (v Vehicle) Deleted() bool {
+	return v.Deletion != nil
+}
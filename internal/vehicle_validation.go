@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// RuleRequired is the rule of a field that must have a value
+	RuleRequired = "required"
+	// RuleMin is the rule of a field that must not be less than a limit
+	RuleMin = "min"
+	// RuleMax is the rule of a field that must not be greater than a limit
+	RuleMax = "max"
+	// RuleEnum is the rule of a field that must have one of a list of values
+	RuleEnum = "enum"
+	// RuleRegex is the rule of a text field that must match a regular expression
+	RuleRegex = "regex"
+	// RuleCompare is the rule of a field that must compare in a way with another field, e.g. length >= width
+	RuleCompare = "compare"
+)
+
+// VehicleValidator is an interface that represents the validation rules of the vehicles
+type VehicleValidator interface {
+	// Validate is a method that checks every rule of a vehicle
+	// It returns a *ValidationError with all the violations, or nil
+	Validate(v Vehicle) (err error)
+	// ValidateFields is a method that checks only the rules of some fields of a vehicle, including the rules
+	// that compare them with other fields
+	ValidateFields(v Vehicle, fields ...VehicleField) (err error)
+}
+
+// Violation is a struct that represents a validation rule broken by a field of a vehicle
+type Violation struct {
+	// Field is the field, named as in the JSON representation
+	Field string
+	// Rule is the rule broken, e.g. RuleRequired
+	Rule string
+	// Message is the description of the violation
+	Message string
+}
+
+// ValidationError is the error returned when a vehicle breaks validation rules, with every violation
+// It wraps ErrFieldRequired when a required field is missing and ErrInvalidFieldValue when a field has an
+// invalid value, so errors.Is matches both kinds
+type ValidationError struct {
+	// Violations are the rules broken, in the order they were checked
+	Violations []Violation
+}
+
+// Error is a method that returns the description of the error
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, fmt.Sprintf("%s: %s", v.Field, v.Message))
+	}
+	return "invalid vehicle: " + strings.Join(messages, "; ")
+}
+
+// Unwrap is a method that returns the kinds of the violations: ErrFieldRequired and/or ErrInvalidFieldValue
+func (e *ValidationError) Unwrap() []error {
+	var required, invalid bool
+	for _, v := range e.Violations {
+		if v.Rule == RuleRequired {
+			required = true
+		} else {
+			invalid = true
+		}
+	}
+
+	errs := make([]error, 0, 2)
+	if required {
+		errs = append(errs, ErrFieldRequired)
+	}
+	if invalid {
+		errs = append(errs, ErrInvalidFieldValue)
+	}
+	return errs
+}
+
+// Add is a method that adds a violation
+func (e *ValidationError) Add(field, rule, message string) {
+	e.Violations = append(e.Violations, Violation{Field: field, Rule: rule, Message: message})
+}
+
+// Err is a method that returns the error if it has violations, or nil otherwise
+func (e *ValidationError) Err() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrVocabularyNotFound is the error returned when a field has no vocabulary
+	ErrVocabularyNotFound = errors.New("vocabulary not found")
+	// ErrTermNotFound is the error returned when a value is not a term or an alias of a vocabulary
+	ErrTermNotFound = errors.New("term not found")
+	// ErrTermAlreadyExists is the error returned when a value or an alias of a term is already used by another term
+	ErrTermAlreadyExists = errors.New("term already exists")
+)
+
+// RuleVocabulary is the rule of a field that must have a value of its vocabulary
+const RuleVocabulary = "vocabulary"
+
+// VocabularyFields are the fields of a vehicle whose values are managed by a vocabulary
+var VocabularyFields = []VehicleField{
+	VehicleFieldFuelType,
+	VehicleFieldTransmission,
+	VehicleFieldColor,
+}
+
+// IsVocabularyField is a function that returns if the values of a field are managed by a vocabulary
+func IsVocabularyField(f VehicleField) bool {
+	for _, field := range VocabularyFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Term is a struct that represents a canonical value of a vocabulary
+type Term struct {
+	// Value is the canonical value, the one stored in the vehicles
+	Value string
+	// Aliases are other ways to write the value, e.g. "petrol" for "gasoline"
+	Aliases []string
+}
+
+// Keys is a method that returns the keys the term is matched by: the ones of its value and its aliases
+func (t Term) Keys() []string {
+	keys := make([]string, 0, len(t.Aliases)+1)
+	keys = append(keys, TermKey(t.Value))
+	for _, alias := range t.Aliases {
+		keys = append(keys, TermKey(alias))
+	}
+	return keys
+}
+
+// Vocabulary is a struct that represents the values a field of the vehicles can have
+type Vocabulary struct {
+	// Field is the field of the vehicles
+	Field VehicleField
+	// Terms are the canonical values. A vocabulary without terms accepts any value
+	Terms []Term
+}
+
+// TermKey is a function that returns the key a value is matched by: lower case, without leading, trailing or
+// repeated spaces
+func TermKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// NewVocabularyIndex is a function that returns a new instance of VocabularyIndex with the terms of vocabularies
+func NewVocabularyIndex(vs []Vocabulary) VocabularyIndex {
+	ix := make(VocabularyIndex, len(vs))
+	for _, v := range vs {
+		keys := make(map[string]string)
+		for _, t := range v.Terms {
+			for _, key := range t.Keys() {
+				keys[key] = t.Value
+			}
+		}
+		ix[v.Field] = keys
+	}
+	return ix
+}
+
+// VocabularyIndex is a map that returns the canonical value of each key, by field
+type VocabularyIndex map[VehicleField]map[string]string
+
+// Canonical is a method that returns the canonical value of a value of a field
+// Fields without a vocabulary, or with an empty one, keep any value. Otherwise known is false when the value
+// is not a term or an alias
+func (ix VocabularyIndex) Canonical(f VehicleField, value string) (canonical string, known bool) {
+	keys := ix[f]
+	if len(keys) == 0 {
+		return value, true
+	}
+	canonical, known = keys[TermKey(value)]
+	return
+}
+
+// Normalize is a method that replaces the values of the vocabulary fields of a vehicle with their canonical values
+// It returns if any value changed and the fields with a value that is not in their vocabulary, which are kept
+func (ix VocabularyIndex) Normalize(v *Vehicle) (changed bool, unknown []VehicleField) {
+	for _, f := range VocabularyFields {
+		value := f.Value(*v).(string)
+		if value == "" {
+			continue
+		}
+		canonical, known := ix.Canonical(f, value)
+		if !known {
+			unknown = append(unknown, f)
+			continue
+		}
+		if canonical != value {
+			f.SetValue(v, canonical)
+			changed = true
+		}
+	}
+	return
+}
+
+// VocabularyLoader is an interface that represents the loader for vocabularies
+type VocabularyLoader interface {
+	// Load is a method that loads the vocabularies
+	Load() (v []Vocabulary, err error)
+}
+
+// VocabularyRepository is an interface that represents a vocabulary repository
+type VocabularyRepository interface {
+	// FindAll is a method that returns the vocabularies of all the vocabulary fields
+	FindAll() (v []Vocabulary, err error)
+	// Get is a method that returns the vocabulary of a field
+	Get(f VehicleField) (v Vocabulary, err error)
+	// Index is a method that returns the canonical values of all the vocabularies, as they are now
+	Index() (ix VocabularyIndex, err error)
+	// AddTerm is a method that adds a term to the vocabulary of a field
+	AddTerm(f VehicleField, t Term) (err error)
+	// UpdateTerm is a method that replaces the term with a value in the vocabulary of a field
+	UpdateTerm(f VehicleField, value string, t Term) (err error)
+	// DeleteTerm is a method that deletes the term with a value from the vocabulary of a field
+	DeleteTerm(f VehicleField, value string) (err error)
+}
+
+// VocabularyService is an interface that represents a vocabulary service
+type VocabularyService interface {
+	// FindAll is a method that returns the vocabularies of all the vocabulary fields
+	FindAll() (v []Vocabulary, err error)
+	// Get is a method that returns the vocabulary of a field
+	Get(f VehicleField) (v Vocabulary, err error)
+	// AddTerm is a method that adds a term to the vocabulary of a field
+	AddTerm(f VehicleField, t Term) (err error)
+	// UpdateTerm is a method that replaces the term with a value in the vocabulary of a field
+	UpdateTerm(f VehicleField, value string, t Term) (err error)
+	// DeleteTerm is a method that deletes the term with a value from the vocabulary of a field
+	DeleteTerm(f VehicleField, value string) (err error)
+}